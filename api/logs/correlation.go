@@ -0,0 +1,85 @@
+package logs
+
+import (
+	"net/url"
+)
+
+var (
+	// DefaultTraceFields are the labels the trace id of a log line is looked up in
+	// when a backend doesn't configure its own
+	DefaultTraceFields = []string{"trace_id", "traceId", "traceID", "trace.id", "otel.trace_id"}
+
+	// DefaultSpanFields are the labels the span id of a log line is looked up in
+	// when a backend doesn't configure its own
+	DefaultSpanFields = []string{"span_id", "spanId", "spanID", "span.id", "otel.span_id"}
+)
+
+// TraceLink links a log line to the trace it was logged in
+type TraceLink struct {
+	TraceID string `json:"traceId"`
+	SpanID  string `json:"spanId,omitempty"`
+	// URL is the path of the trace on this server
+	URL string `json:"url"`
+}
+
+// GetTraceFields returns the labels that hold the trace id of the log lines
+func (t CommonBackend) GetTraceFields() []string {
+	if len(t.TraceFields) == 0 {
+		return DefaultTraceFields
+	}
+	return t.TraceFields
+}
+
+// GetSpanFields returns the labels that hold the span id of the log lines
+func (t CommonBackend) GetSpanFields() []string {
+	if len(t.SpanFields) == 0 {
+		return DefaultSpanFields
+	}
+	return t.SpanFields
+}
+
+// LinkTrace returns the result with a link to its trace
+// if any of the trace fields is among its labels
+func LinkTrace(r Result, traceFields, spanFields []string) Result {
+	traceID := firstLabel(r.Labels, traceFields)
+	if traceID == "" {
+		return r
+	}
+
+	r.Trace = &TraceLink{
+		TraceID: traceID,
+		SpanID:  firstLabel(r.Labels, spanFields),
+		URL:     "/traces/" + url.PathEscape(traceID),
+	}
+	return r
+}
+
+// LinkTraces links each of the results that carries a trace id to its trace
+func LinkTraces(results []Result, traceFields, spanFields []string) {
+	for i := range results {
+		results[i] = LinkTrace(results[i], traceFields, spanFields)
+	}
+}
+
+// TraceQuery returns the query that matches the log lines of a trace
+// whose trace id is in any of the given fields
+func TraceQuery(traceID string, traceFields []string) QueryExpr {
+	var exprs []QueryExpr
+	for _, field := range traceFields {
+		exprs = append(exprs, QueryTerm{Field: field, Op: QueryOpEquals, Value: traceID})
+	}
+
+	if len(exprs) == 1 {
+		return exprs[0]
+	}
+	return QueryOr{Exprs: exprs}
+}
+
+func firstLabel(labels map[string]string, fields []string) string {
+	for _, field := range fields {
+		if value := labels[field]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,31 @@
+package logs
+
+import "testing"
+
+func TestLinkTrace(t *testing.T) {
+	r := LinkTrace(Result{Labels: map[string]string{"trace.id": "4bf92f35", "span.id": "00f067aa"}}, DefaultTraceFields, DefaultSpanFields)
+	want := TraceLink{TraceID: "4bf92f35", SpanID: "00f067aa", URL: "/traces/4bf92f35"}
+	if r.Trace == nil || *r.Trace != want {
+		t.Errorf("LinkTrace() = %+v, want %+v", r.Trace, want)
+	}
+
+	if r := LinkTrace(Result{Labels: map[string]string{"pod": "api-0"}}, DefaultTraceFields, DefaultSpanFields); r.Trace != nil {
+		t.Errorf("expected no trace link, got %+v", r.Trace)
+	}
+}
+
+func TestTraceQuery(t *testing.T) {
+	query := TraceQuery("abc", []string{"trace_id", "trace.id"})
+	if got, want := query.String(), `(trace_id="abc" OR trace.id="abc")`; got != want {
+		t.Errorf("TraceQuery() = %s, want %s", got, want)
+	}
+
+	// The query is parsed back the same by the backends
+	parsed, err := ParseQuery(query.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !parsed.Match(Result{Labels: map[string]string{"trace.id": "abc"}}) {
+		t.Errorf("expected the query to match the trace id")
+	}
+}
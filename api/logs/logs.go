@@ -2,12 +2,15 @@ package logs
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 
 	"github.com/flanksource/commons/collections"
 	durationUtil "github.com/flanksource/commons/duration"
+	"github.com/flanksource/commons/logger"
 	"github.com/flanksource/kommons"
 )
 
@@ -23,52 +26,240 @@ type SearchConfig struct {
 
 // +kubebuilder:object:generate=true
 type SearchBackendConfig struct {
-	ElasticSearch *ElasticSearchBackendConfig    `json:"elasticsearch,omitempty" yaml:"elasticsearch,omitempty"`
-	OpenSearch    *OpenSearchBackendConfig       `json:"opensearch,omitempty" yaml:"opensearch,omitempty"`
-	CloudWatch    *CloudWatchBackendConfig       `json:"cloudwatch,omitempty" yaml:"cloudwatch,omitempty"`
-	Kubernetes    *KubernetesSearchBackendConfig `json:"kubernetes,omitempty" yaml:"kubernetes,omitempty"`
-	File          *FileSearchBackendConfig       `json:"file,omitempty" yaml:"file,omitempty"`
+	ElasticSearch     *ElasticSearchBackendConfig     `json:"elasticsearch,omitempty" yaml:"elasticsearch,omitempty"`
+	OpenSearch        *OpenSearchBackendConfig        `json:"opensearch,omitempty" yaml:"opensearch,omitempty"`
+	CloudWatch        *CloudWatchBackendConfig        `json:"cloudwatch,omitempty" yaml:"cloudwatch,omitempty"`
+	GCPLogging        *GCPLoggingBackendConfig        `json:"gcpLogging,omitempty" yaml:"gcpLogging,omitempty"`
+	AzureLogAnalytics *AzureLogAnalyticsBackendConfig `json:"azureLogAnalytics,omitempty" yaml:"azureLogAnalytics,omitempty"`
+	Kubernetes        *KubernetesSearchBackendConfig  `json:"kubernetes,omitempty" yaml:"kubernetes,omitempty"`
+	File              *FileSearchBackendConfig        `json:"file,omitempty" yaml:"file,omitempty"`
+	Journald          *JournaldBackendConfig          `json:"journald,omitempty" yaml:"journald,omitempty"`
+	Loki              *LokiBackendConfig              `json:"loki,omitempty" yaml:"loki,omitempty"`
+	HTTP              *HTTPBackendConfig              `json:"http,omitempty" yaml:"http,omitempty"`
+
+	// Trace backends
+	Jaeger *JaegerBackendConfig `json:"jaeger,omitempty" yaml:"jaeger,omitempty"`
+	Tempo  *TempoBackendConfig  `json:"tempo,omitempty" yaml:"tempo,omitempty"`
+
+	// Metrics backends
+	Prometheus *PrometheusBackendConfig `json:"prometheus,omitempty" yaml:"prometheus,omitempty"`
 }
 
-func NewSearchBackend(api SearchAPI) SearchBackend {
+// Validate returns an error if the common settings of any of the configured backends are invalid
+func (t SearchBackendConfig) Validate() error {
+	for name, common := range t.commonBackends() {
+		if err := common.Validate(); err != nil {
+			return fmt.Errorf("invalid %s backend: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// WarnDeprecated logs a warning for each deprecated setting of the configured backends
+func (t SearchBackendConfig) WarnDeprecated() {
+	for name, common := range t.commonBackends() {
+		for _, route := range common.Routes {
+			if route.IsAdditive && route.Mode == "" {
+				logger.Warnf("the additive field of the routes of the %s backend is deprecated, use mode: exclusive instead", name)
+			}
+		}
+	}
+}
+
+// commonBackends returns the common settings of the configured backends by their type
+func (t SearchBackendConfig) commonBackends() map[string]CommonBackend {
+	backends := make(map[string]CommonBackend)
+	if t.ElasticSearch != nil {
+		backends["elasticsearch"] = t.ElasticSearch.CommonBackend
+	}
+	if t.OpenSearch != nil {
+		backends["opensearch"] = t.OpenSearch.CommonBackend
+	}
+	if t.CloudWatch != nil {
+		backends["cloudwatch"] = t.CloudWatch.CommonBackend
+	}
+	if t.GCPLogging != nil {
+		backends["gcpLogging"] = t.GCPLogging.CommonBackend
+	}
+	if t.AzureLogAnalytics != nil {
+		backends["azureLogAnalytics"] = t.AzureLogAnalytics.CommonBackend
+	}
+	if t.Kubernetes != nil {
+		backends["kubernetes"] = t.Kubernetes.CommonBackend
+	}
+	if t.File != nil {
+		backends["file"] = t.File.CommonBackend
+	}
+	if t.Journald != nil {
+		backends["journald"] = t.Journald.CommonBackend
+	}
+	if t.Loki != nil {
+		backends["loki"] = t.Loki.CommonBackend
+	}
+	if t.HTTP != nil {
+		backends["http"] = t.HTTP.CommonBackend
+	}
+	if t.Jaeger != nil {
+		backends["jaeger"] = t.Jaeger.CommonBackend
+	}
+	if t.Tempo != nil {
+		backends["tempo"] = t.Tempo.CommonBackend
+	}
+	if t.Prometheus != nil {
+		backends["prometheus"] = t.Prometheus.CommonBackend
+	}
+	return backends
+}
+
+func NewSearchBackend(backendType string, api SearchAPI, common CommonBackend) SearchBackend {
 	return SearchBackend{
-		API: api,
+		Name:    common.Name,
+		Type:    backendType,
+		API:     api,
+		Timeout: common.GetTimeout(),
+
+		TraceFields: common.GetTraceFields(),
+		SpanFields:  common.GetSpanFields(),
 	}
 }
 
 type SearchBackend struct {
-	API SearchAPI
+	// Name identifies the backend in the search results
+	Name string
+	// Type is the kind of the backend, e.g. kubernetes, elasticsearch, etc.
+	Type string
+	API  SearchAPI
+
+	// Timeout is the deadline for a single search on this backend.
+	// Zero means the server wide default is used.
+	Timeout time.Duration
+
+	// TraceFields and SpanFields are the labels that hold the trace and span ids of the log lines
+	TraceFields []string
+	SpanFields  []string
 }
 
 type Routes []SearchRoute
 
-func (t Routes) MatchRoute(q *SearchParams) (match bool, isAdditive bool) {
-	for _, route := range t {
-		if route.Match(q) {
-			return true, route.IsAdditive
+// MatchRoute returns the matching route with the highest priority.
+// Routes with the same priority are matched in the order they are configured.
+func (t Routes) MatchRoute(q *SearchParams) (route SearchRoute, match bool) {
+	for _, r := range t {
+		if !r.Match(q) {
+			continue
+		}
+
+		if !match || r.Priority > route.Priority {
+			route, match = r, true
 		}
 	}
 
-	return false, false
+	return route, match
 }
 
 // +kubebuilder:object:generate=true
 type CommonBackend struct {
+	// Name identifies the backend in the search results and the page tokens, so it must be unique.
+	// Defaults to the backend type followed by its index, which changes when the backends are reordered,
+	// so set it explicitly when the results are paged.
+	Name   string `yaml:"name,omitempty" json:"name,omitempty"`
 	Routes Routes `yaml:"routes,omitempty" json:"routes,omitempty"`
 
 	// Labels are custom labels specified in the configuration file for a backend
 	// that will be attached to each log line returned by that backend.
 	Labels map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"`
+
+	// Timeout is the maximum duration (e.g. "10s", "1m") a search on this backend
+	// is allowed to take before it is cancelled.
+	Timeout string `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+
+	// TraceFields are the labels that hold the trace id of a log line, e.g. "trace.id".
+	// The log lines with a trace id are linked to their trace. Defaults to the common field names.
+	TraceFields []string `yaml:"traceFields,omitempty" json:"traceFields,omitempty"`
+	// SpanFields are the labels that hold the span id of a log line. Defaults to the common field names.
+	SpanFields []string `yaml:"spanFields,omitempty" json:"spanFields,omitempty"`
+}
+
+// Validate returns an error if the settings common to the backends are invalid
+func (t CommonBackend) Validate() error {
+	if t.Timeout != "" {
+		if _, err := time.ParseDuration(t.Timeout); err != nil {
+			return fmt.Errorf("invalid timeout %q: %w", t.Timeout, err)
+		}
+	}
+
+	for _, route := range t.Routes {
+		switch route.Mode {
+		case "", RouteModeAdditive, RouteModeExclusive, RouteModeFallback:
+		default:
+			return fmt.Errorf("invalid route mode %q, expected one of %s, %s or %s", route.Mode, RouteModeAdditive, RouteModeExclusive, RouteModeFallback)
+		}
+	}
+	return nil
+}
+
+// GetTimeout returns the parsed timeout or 0 if it isn't set.
+// The timeout is validated when the backends are set up.
+func (t CommonBackend) GetTimeout() time.Duration {
+	if t.Timeout == "" {
+		return 0
+	}
+
+	duration, err := time.ParseDuration(t.Timeout)
+	if err != nil {
+		return 0
+	}
+
+	return duration
 }
 
 type SearchBackendConfigs []SearchBackendConfig
 
+// RouteMode defines how the results of a backend are combined
+// with the results of the other backends that match the same search.
+type RouteMode string
+
+const (
+	// RouteModeAdditive combines the results with the other additive backends.
+	RouteModeAdditive RouteMode = "additive"
+	// RouteModeExclusive returns the results of just this backend,
+	// discarding all the other backends that match the search.
+	RouteModeExclusive RouteMode = "exclusive"
+	// RouteModeFallback only searches the backend if no
+	// exclusive or additive route matches the search.
+	RouteModeFallback RouteMode = "fallback"
+)
+
 // +kubebuilder:object:generate=true
 type SearchRoute struct {
-	Type       string            `yaml:"type,omitempty" json:"type,omitempty"`
-	IdPrefix   string            `yaml:"idPrefix,omitempty" json:"id_prefix,omitempty"`
-	Labels     map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"`
-	IsAdditive bool              `yaml:"additive,omitempty" json:"is_additive,omitempty"`
+	Type     string            `yaml:"type,omitempty" json:"type,omitempty"`
+	IdPrefix string            `yaml:"idPrefix,omitempty" json:"id_prefix,omitempty"`
+	Labels   map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"`
+
+	// Mode is one of additive, exclusive or fallback. Defaults to additive.
+	// +kubebuilder:validation:Enum=additive;exclusive;fallback
+	Mode RouteMode `yaml:"mode,omitempty" json:"mode,omitempty"`
+
+	// Priority decides which route wins when several routes match a search.
+	// Routes with a higher priority win.
+	Priority int `yaml:"priority,omitempty" json:"priority,omitempty"`
+
+	// Deprecated: use Mode instead.
+	// The results of a backend matched by an additive route used to be returned on their own,
+	// so it's the exclusive mode when the mode isn't set.
+	IsAdditive bool `yaml:"additive,omitempty" json:"is_additive,omitempty"`
+}
+
+// GetMode returns the mode of the route, defaulting to additive
+func (t SearchRoute) GetMode() RouteMode {
+	if t.Mode == "" {
+		if t.IsAdditive {
+			return RouteModeExclusive
+		}
+		return RouteModeAdditive
+	}
+
+	return t.Mode
 }
 
 func (t *SearchRoute) Match(q *SearchParams) bool {
@@ -102,12 +293,145 @@ type KubernetesSearchBackendConfig struct {
 	Kubeconfig *kommons.EnvVar `json:"kubeconfig,omitempty"`
 	//namespace to search the kommons.EnvVar in
 	Namespace string `json:"namespace,omitempty"`
+	// Events includes the events of the pods, and of the deployment, service or node searched, in the results
+	Events *KubernetesEventsConfig `json:"events,omitempty" yaml:"events,omitempty"`
+
+	// Concurrency is the number of log and event requests sent at once. Defaults to 10.
+	Concurrency int `json:"concurrency,omitempty" yaml:"concurrency,omitempty"`
+	// QPS and Burst limit the rate of the requests to the API server. Default to 20 and 40.
+	QPS   int `json:"qps,omitempty" yaml:"qps,omitempty"`
+	Burst int `json:"burst,omitempty" yaml:"burst,omitempty"`
+	// MaxPods is the maximum number of pods a search can resolve to. Defaults to 200.
+	MaxPods int `json:"maxPods,omitempty" yaml:"maxPods,omitempty"`
+
+	// Clusters are the clusters to search, in place of the kubeconfig.
+	// A search covers all of them unless its id is prefixed with the name of a cluster,
+	// e.g. <cluster>/<namespace>/<name>, or it has the cluster label.
+	Clusters []KubernetesCluster `json:"clusters,omitempty" yaml:"clusters,omitempty"`
+
+	// Cache keeps the recent logs of the containers in memory so the searches that follow
+	// only fetch the lines written since. Disabled by default.
+	Cache *KubernetesLogCacheConfig `json:"cache,omitempty" yaml:"cache,omitempty"`
+}
+
+func (t KubernetesSearchBackendConfig) GetConcurrency() int {
+	if t.Concurrency <= 0 {
+		return 10
+	}
+	return t.Concurrency
+}
+
+func (t KubernetesSearchBackendConfig) GetQPS() int {
+	if t.QPS <= 0 {
+		return 20
+	}
+	return t.QPS
+}
+
+func (t KubernetesSearchBackendConfig) GetBurst() int {
+	if t.Burst <= 0 {
+		return 2 * t.GetQPS()
+	}
+	return t.Burst
+}
+
+func (t KubernetesSearchBackendConfig) GetMaxPods() int {
+	if t.MaxPods <= 0 {
+		return 200
+	}
+	return t.MaxPods
+}
+
+// +kubebuilder:object:generate=true
+type KubernetesCluster struct {
+	// Name identifies the cluster in the search ids and labels its results
+	Name string `json:"name" yaml:"name"`
+	// empty kubeconfig indicates to use the current kubeconfig for connection
+	Kubeconfig *kommons.EnvVar `json:"kubeconfig,omitempty" yaml:"kubeconfig,omitempty"`
+	// Context is the context of the kubeconfig to connect to. Defaults to its current context.
+	Context string `json:"context,omitempty" yaml:"context,omitempty"`
+}
+
+// +kubebuilder:object:generate=true
+type KubernetesLogCacheConfig struct {
+	// MaxSize is the memory the cached logs can take, e.g. 64Mi. Defaults to 64Mi.
+	MaxSize string `json:"maxSize,omitempty" yaml:"maxSize,omitempty"`
+	// MaxEntrySize is the most logs cached for an instance of a container, e.g. 1Mi. Defaults to 1Mi.
+	MaxEntrySize string `json:"maxEntrySize,omitempty" yaml:"maxEntrySize,omitempty"`
+	// TTL is how long (e.g. "5m") the logs of a container are kept after they were last searched. Defaults to 5m.
+	TTL string `json:"ttl,omitempty" yaml:"ttl,omitempty"`
+	// Dir is the directory the logs evicted from memory spill to. The logs aren't spilled to disk if empty.
+	Dir string `json:"dir,omitempty" yaml:"dir,omitempty"`
+	// MaxDiskSize is the disk the spilled logs can take, e.g. 1Gi. Defaults to 1Gi.
+	MaxDiskSize string `json:"maxDiskSize,omitempty" yaml:"maxDiskSize,omitempty"`
+}
+
+// +kubebuilder:object:generate=true
+type KubernetesEventsConfig struct {
+	// API is the API the events are listed from, either v1 (core) or events.k8s.io/v1. Defaults to v1.
+	// +kubebuilder:validation:Enum=v1;events.k8s.io/v1
+	API string `json:"api,omitempty" yaml:"api,omitempty"`
+	// Types are the types of the events to include, e.g. Warning. Defaults to all the types.
+	Types []string `json:"types,omitempty" yaml:"types,omitempty"`
 }
 
 // +kubebuilder:object:generate=true
 type FileSearchBackendConfig struct {
 	CommonBackend `json:",inline" yaml:",inline"`
-	Paths         []string `yaml:"path,omitempty" json:"path,omitempty"`
+	// Paths are the files to search, glob patterns included.
+	// A file along with its rotated files (e.g. access.log*) is searched as one, newest to oldest.
+	// Compressed files (gzip, zstd and bzip2) are decompressed transparently.
+	Paths []string `yaml:"path,omitempty" json:"path,omitempty"`
+
+	// TimestampRegex extracts the timestamp from a line.
+	// The timestamp is taken from the capture group named "timestamp", else from the first
+	// capture group, else from the whole match. Defaults to the common log formats.
+	TimestampRegex string `yaml:"timestampRegex,omitempty" json:"timestamp_regex,omitempty"`
+	// TimestampFormats are the Go time layouts (e.g. "2006-01-02 15:04:05") used to parse
+	// the extracted timestamp. Defaults to the layouts of the common log formats.
+	TimestampFormats []string `yaml:"timestampFormats,omitempty" json:"timestamp_formats,omitempty"`
+
+	// Parser parses the lines into structured fields. The lines are returned as is when not set.
+	Parser *FileParser `yaml:"parser,omitempty" json:"parser,omitempty"`
+}
+
+// +kubebuilder:object:generate=true
+// JournaldBackendConfig searches the systemd journal of the host, e.g. for the VM type
+type JournaldBackendConfig struct {
+	CommonBackend `json:",inline" yaml:",inline"`
+	// Paths are the journal directories and files to search, glob patterns included.
+	// The directories and the .journal files are read with journalctl,
+	// while any other file is read as the journal export format (journalctl -o export).
+	// Defaults to the journal of the host.
+	Paths []string `yaml:"path,omitempty" json:"path,omitempty"`
+	// Journalctl is the path of the journalctl binary. Defaults to journalctl in the PATH.
+	Journalctl string `yaml:"journalctl,omitempty" json:"journalctl,omitempty"`
+
+	// Units, Priority and BootID filter the entries.
+	// The unit, priority and boot_id labels of the search params override them.
+	Units []string `yaml:"units,omitempty" json:"units,omitempty"`
+	// Priority is the lowest priority of the entries, as a name (e.g. warning) or a number (e.g. 4)
+	Priority string `yaml:"priority,omitempty" json:"priority,omitempty"`
+	BootID   string `yaml:"bootID,omitempty" json:"boot_id,omitempty"`
+
+	// Fields are the journal fields added to the labels, along with
+	// _SYSTEMD_UNIT, _HOSTNAME, PRIORITY, SYSLOG_IDENTIFIER, _PID and _BOOT_ID
+	Fields []string `yaml:"fields,omitempty" json:"fields,omitempty"`
+}
+
+// +kubebuilder:object:generate=true
+// FileParser defines how the lines of a file are parsed into fields.
+// The parsed fields become the labels of the results, except for the message and timestamp fields.
+type FileParser struct {
+	// Type is the format of the lines.
+	// nginx, nginx-error, apache and syslog are presets of the common log formats.
+	// +kubebuilder:validation:Enum=json;logfmt;regex;nginx;nginx-error;apache;syslog
+	Type string `yaml:"type" json:"type"`
+	// Regex is the regular expression, with named capture groups, used by the regex type
+	Regex string `yaml:"regex,omitempty" json:"regex,omitempty"`
+	// Fields maps the parsed fields to the message and timestamp.
+	// Defaults to "message" and "timestamp".
+	Fields ElasticSearchFields `yaml:"fields,omitempty" json:"fields,omitempty"`
 }
 
 // +kubebuilder:object:generate=true
@@ -117,13 +441,112 @@ type AWSAuthentication struct {
 	SecretKey *kommons.EnvVar `yaml:"secret_key,omitempty" json:"secret_key,omitempty"`
 }
 
+// +kubebuilder:object:generate=true
+type CloudWatchAccount struct {
+	// Region of the log groups. Defaults to the region of the auth.
+	Region string `yaml:"region,omitempty" json:"region,omitempty"`
+	// AccountID is an account linked to the one of the auth through cross-account observability,
+	// whose log groups are searched with the credentials of the auth
+	AccountID string `yaml:"account_id,omitempty" json:"account_id,omitempty"`
+	// Auth overrides the credentials of the backend for the account
+	Auth *AWSAuthentication `yaml:"auth,omitempty" json:"auth,omitempty"`
+}
+
+// +kubebuilder:object:generate=true
+type ResultCacheConfig struct {
+	// TTL is how long (e.g. "1h") the results of a search between two timestamps are kept. Defaults to 1h.
+	TTL string `yaml:"ttl,omitempty" json:"ttl,omitempty"`
+	// RelativeTTL is how long (e.g. "30s") the results of a search relative to its time, e.g. of the last hour, are kept.
+	// Defaults to 30s.
+	RelativeTTL string `yaml:"relativeTTL,omitempty" json:"relativeTTL,omitempty"`
+}
+
+// GetTTL returns how long the results of a search are kept, depending on whether its time window is relative.
+// An invalid duration falls back to the default.
+func (t ResultCacheConfig) GetTTL(relative bool) time.Duration {
+	value, defaultTTL := t.TTL, time.Hour
+	if relative {
+		value, defaultTTL = t.RelativeTTL, 30*time.Second
+	}
+
+	if value == "" {
+		return defaultTTL
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil {
+		return defaultTTL
+	}
+	return ttl
+}
+
 // +kubebuilder:object:generate=true
 type CloudWatchBackendConfig struct {
 	CommonBackend `json:",inline" yaml:",inline"`
 	Auth          AWSAuthentication `yaml:"auth,omitempty" json:"auth,omitempty"`
 	Namespace     string            `yaml:"namespace,omitempty" json:"namespace,omitempty"` // Namespace to search the kommons.EnvVar in
-	LogGroup      string            `yaml:"log_group,omitempty" json:"log_group,omitempty"`
-	Query         string            `yaml:"query,omitempty" json:"query,omitempty"`
+	// LogGroup is a log group to search
+	LogGroup string `yaml:"log_group,omitempty" json:"log_group,omitempty"`
+	// LogGroups are more log groups to search
+	LogGroups []string `yaml:"log_groups,omitempty" json:"log_groups,omitempty"`
+	// LogGroupPrefixes discover the log groups whose name starts with one of the prefixes, e.g. /aws/eks/
+	LogGroupPrefixes []string `yaml:"log_group_prefixes,omitempty" json:"log_group_prefixes,omitempty"`
+	// LogGroupPatterns discover the log groups whose name contains one of the patterns, case-insensitively
+	LogGroupPatterns []string `yaml:"log_group_patterns,omitempty" json:"log_group_patterns,omitempty"`
+	// LogGroupTemplate is a text/template of the log group to search, rendered with the search params,
+	// e.g. /aws/eks/{{.Id}}/cluster. The log groups above are searched when it renders empty.
+	LogGroupTemplate string `yaml:"log_group_template,omitempty" json:"log_group_template,omitempty"`
+	// Accounts are the accounts and regions to search, instead of the region of the auth
+	Accounts []CloudWatchAccount `yaml:"accounts,omitempty" json:"accounts,omitempty"`
+	Query    string              `yaml:"query,omitempty" json:"query,omitempty"`
+
+	// Cache keeps the results of the searches, so the same search isn't sent again. Disabled by default.
+	Cache *ResultCacheConfig `yaml:"cache,omitempty" json:"cache,omitempty"`
+}
+
+// +kubebuilder:object:generate=true
+type GCPLoggingBackendConfig struct {
+	CommonBackend `json:",inline" yaml:",inline"`
+	// ResourceNames are the projects, folders, organizations or billing accounts to search,
+	// e.g. projects/my-project, folders/123, organizations/456
+	ResourceNames []string `yaml:"resourceNames" json:"resource_names"`
+	// Filter is a text/template of the Logging query language filter, rendered with the search params,
+	// e.g. resource.labels.namespace_name="{{index .Labels "namespace"}}"
+	Filter    string `yaml:"filter,omitempty" json:"filter,omitempty"`
+	Namespace string `yaml:"namespace,omitempty" json:"namespace,omitempty"` // Namespace to search the kommons.EnvVar in
+	// Credentials is the JSON key of the service account.
+	// The application default credentials are used when it isn't set.
+	Credentials *kommons.EnvVar `yaml:"credentials,omitempty" json:"credentials,omitempty"`
+	// Endpoint overrides the endpoint of the Logging API, e.g. for a private endpoint or an emulator
+	Endpoint string `yaml:"endpoint,omitempty" json:"endpoint,omitempty"`
+}
+
+// +kubebuilder:object:generate=true
+// AzureLogAnalyticsBackendConfig searches the tables of an Azure Monitor Log Analytics workspace with KQL
+type AzureLogAnalyticsBackendConfig struct {
+	CommonBackend `json:",inline" yaml:",inline"`
+	WorkspaceID   string `yaml:"workspaceID" json:"workspace_id"`
+	// Query is a text/template of the KQL query, rendered with the search params,
+	// e.g. ContainerLogV2 | where PodNamespace == "{{index .Labels "namespace"}}"
+	Query     string `yaml:"query" json:"query"`
+	Namespace string `yaml:"namespace,omitempty" json:"namespace,omitempty"` // Namespace to search the kommons.EnvVar in
+	// Endpoint overrides the endpoint of the Log Analytics API. Defaults to https://api.loganalytics.io
+	Endpoint string                  `yaml:"endpoint,omitempty" json:"endpoint,omitempty"`
+	Fields   AzureLogAnalyticsFields `yaml:"fields,omitempty" json:"fields,omitempty"`
+
+	// TenantID, ClientID and ClientSecret are the credentials of the service principal allowed to read the workspace
+	TenantID     *kommons.EnvVar `yaml:"tenantID,omitempty" json:"tenant_id,omitempty"`
+	ClientID     *kommons.EnvVar `yaml:"clientID,omitempty" json:"client_id,omitempty"`
+	ClientSecret *kommons.EnvVar `yaml:"clientSecret,omitempty" json:"client_secret,omitempty"`
+}
+
+// +kubebuilder:object:generate=true
+// AzureLogAnalyticsFields maps the columns of the rows to the results.
+// The columns that aren't mapped or excluded, flattened, are the labels of the results.
+type AzureLogAnalyticsFields struct {
+	Timestamp  string   `yaml:"timestamp,omitempty" json:"timestamp,omitempty"`   // Timestamp is the column of the timestamp. Defaults to TimeGenerated.
+	Message    string   `yaml:"message,omitempty" json:"message,omitempty"`       // Message is the column of the message
+	ID         string   `yaml:"id,omitempty" json:"id,omitempty"`                 // ID is the column of the id
+	Exclusions []string `yaml:"exclusions,omitempty" json:"exclusions,omitempty"` // Exclusions are the columns that aren't added to the labels
 }
 
 // +kubebuilder:object:generate=true
@@ -148,6 +571,64 @@ type ElasticSearchBackendConfig struct {
 	APIKey   *kommons.EnvVar `yaml:"apiKey,omitempty" json:"api_key,omitempty"`
 	Username *kommons.EnvVar `yaml:"username,omitempty" json:"username,omitempty"`
 	Password *kommons.EnvVar `yaml:"password,omitempty" json:"password,omitempty"`
+
+	// Cache keeps the results of the searches, so the same search isn't sent again. Disabled by default.
+	Cache *ResultCacheConfig `yaml:"cache,omitempty" json:"cache,omitempty"`
+}
+
+// +kubebuilder:object:generate=true
+type LokiBackendConfig struct {
+	CommonBackend `json:",inline" yaml:",inline"`
+	// Address of the Loki query frontend, e.g. http://loki:3100
+	Address string `yaml:"address,omitempty" json:"address,omitempty"`
+	// Query is a text/template of the LogQL query, rendered with the search params,
+	// e.g. {namespace="{{index .Labels "namespace"}}"}
+	Query     string `yaml:"query,omitempty" json:"query,omitempty"`
+	Namespace string `yaml:"namespace,omitempty" json:"namespace,omitempty"` // Namespace to search the kommons.EnvVar in
+	// TenantID is sent as the X-Scope-OrgID header to a multi-tenant Loki
+	TenantID string `yaml:"tenantID,omitempty" json:"tenant_id,omitempty"`
+
+	// Username and Password are sent with basic auth, while the BearerToken is sent in the Authorization header
+	Username    *kommons.EnvVar `yaml:"username,omitempty" json:"username,omitempty"`
+	Password    *kommons.EnvVar `yaml:"password,omitempty" json:"password,omitempty"`
+	BearerToken *kommons.EnvVar `yaml:"bearerToken,omitempty" json:"bearer_token,omitempty"`
+}
+
+// +kubebuilder:object:generate=true
+// HTTPBackendConfig searches any HTTP API that returns the hits as JSON
+type HTTPBackendConfig struct {
+	CommonBackend `json:",inline" yaml:",inline"`
+	// URL is a text/template of the URL, rendered with the search params.
+	// The params in the query of the URL are escaped with urlquery, e.g. ?q={{urlquery .Query}}
+	URL string `yaml:"url" json:"url"`
+	// Method defaults to POST
+	Method    string `yaml:"method,omitempty" json:"method,omitempty"`
+	Namespace string `yaml:"namespace,omitempty" json:"namespace,omitempty"` // Namespace to search the kommons.EnvVar in
+	// Headers are sent with each request. The name of each env var is the name of the header.
+	Headers []kommons.EnvVar `yaml:"headers,omitempty" json:"headers,omitempty"`
+	// Body is a text/template of the request body, rendered with the search params.
+	// The params in the JSON body are encoded with json, e.g. {"query": {{json .Query}}}
+	Body   string             `yaml:"body,omitempty" json:"body,omitempty"`
+	Fields HTTPResponseFields `yaml:"fields,omitempty" json:"fields,omitempty"`
+}
+
+// +kubebuilder:object:generate=true
+// HTTPResponseFields are the gjson paths (https://github.com/tidwall/gjson/blob/master/SYNTAX.md)
+// of the fields in the response of a HTTP backend
+type HTTPResponseFields struct {
+	// Hits is the path of the array of hits in the response. Defaults to the whole response.
+	Hits string `yaml:"hits,omitempty" json:"hits,omitempty"`
+	// Message, Timestamp, ID and Labels are paths in each hit.
+	// The message defaults to the whole hit.
+	Message   string `yaml:"message,omitempty" json:"message,omitempty"`
+	Timestamp string `yaml:"timestamp,omitempty" json:"timestamp,omitempty"`
+	ID        string `yaml:"id,omitempty" json:"id,omitempty"`
+	// Labels is the path of an object whose fields, flattened, are the labels of the hit
+	Labels string `yaml:"labels,omitempty" json:"labels,omitempty"`
+	// NextPage and Total are paths in the response.
+	// The next page token is rendered as the .Page of the search params of the next request.
+	NextPage string `yaml:"nextPage,omitempty" json:"nextPage,omitempty"`
+	Total    string `yaml:"total,omitempty" json:"total,omitempty"`
 }
 
 // +kubebuilder:object:generate=true
@@ -161,32 +642,71 @@ type OpenSearchBackendConfig struct {
 
 	Username *kommons.EnvVar `yaml:"username,omitempty" json:"username,omitempty"`
 	Password *kommons.EnvVar `yaml:"password,omitempty" json:"password,omitempty"`
+
+	// Cache keeps the results of the searches, so the same search isn't sent again. Disabled by default.
+	Cache *ResultCacheConfig `yaml:"cache,omitempty" json:"cache,omitempty"`
+}
+
+// +kubebuilder:object:generate=true
+type JaegerBackendConfig struct {
+	CommonBackend `json:",inline" yaml:",inline"`
+	// Address of the Jaeger query service, e.g. http://jaeger-query:16686
+	Address string `yaml:"address" json:"address"`
+}
+
+// +kubebuilder:object:generate=true
+type TempoBackendConfig struct {
+	CommonBackend `json:",inline" yaml:",inline"`
+	// Address of the Tempo query frontend, e.g. http://tempo:3200
+	Address string `yaml:"address" json:"address"`
+	// TenantID is sent as the X-Scope-OrgID header to a multi-tenant Tempo
+	TenantID string `yaml:"tenantID,omitempty" json:"tenant_id,omitempty"`
+}
+
+// +kubebuilder:object:generate=true
+type PrometheusBackendConfig struct {
+	CommonBackend `json:",inline" yaml:",inline"`
+	// Address of the Prometheus compatible HTTP API, e.g. http://prometheus:9090
+	Address   string `yaml:"address" json:"address"`
+	Namespace string `yaml:"namespace,omitempty" json:"namespace,omitempty"` // Namespace to search the kommons.EnvVar in
+
+	// Username and Password are sent with basic auth
+	Username *kommons.EnvVar `yaml:"username,omitempty" json:"username,omitempty"`
+	Password *kommons.EnvVar `yaml:"password,omitempty" json:"password,omitempty"`
 }
 
 type SearchParams struct {
 	// Limit is the maximum number of results to return.
-	Limit      int64 `json:"limit,omitempty"`
-	LimitBytes int64 `json:"limitBytes,omitempty"`
+	Limit      int64 `json:"limit,omitempty" query:"limit"`
+	LimitBytes int64 `json:"limitBytes,omitempty" query:"limitBytes"`
 	// The page token, returned by a previous call, to request the next page of results.
-	Page string `json:"page,omitempty"`
+	Page string `json:"page,omitempty" query:"page"`
 	// comma separated list of labels to filter the results. key1=value1,key2=value2
 	Labels map[string]string `json:"labels,omitempty"`
 	// A generic query string, that is rewritten to the underlying system,
-	// If the underlying system does not support queries, than this query is applied on the returned results
-	Query string `json:"query,omitempty"`
+	// If the underlying system does not support queries, than this query is applied on the returned results.
+	// See ParseQuery for the syntax.
+	Query string `json:"query,omitempty" query:"query"`
 	// A RFC3339 timestamp or an age string (e.g. "1h", "2d", "1w"), default to 1h
-	Start string `json:"start,omitempty"`
+	Start string `json:"start,omitempty" query:"start"`
 	// A RFC3339 timestamp or an age string (e.g. "1h", "2d", "1w")
-	End string `json:"end,omitempty"`
+	End string `json:"end,omitempty" query:"end"`
 	// The type of logs to find, e.g. KubernetesNode, KubernetesService, KubernetesPod, VM, etc. Type and ID are used to route search requests
-	Type string `json:"type,omitempty"`
+	Type string `json:"type,omitempty" query:"type"`
 	// The identifier of the type of logs to find, e.g. k8s-node-1, k8s-service-1, k8s-pod-1, vm-1, etc.
 	// The ID should include include any cluster/namespace/account information required for routing
-	Id string `json:"id,omitempty"`
+	Id string `json:"id,omitempty" query:"id"`
 	// Limits the number of log messages return per item, e.g. pod
-	LimitPerItem int64 `json:"limitPerItem,omitempty"`
+	LimitPerItem int64 `json:"limitPerItem,omitempty" query:"limitPerItem"`
 	// Limits the number of bytes returned per item, e.g. pod
-	LimitBytesPerItem int64 `json:"limitBytesPerItem,omitempty"`
+	LimitBytesPerItem int64 `json:"limitBytesPerItem,omitempty" query:"limitBytesPerItem"`
+	// The order of the results by their timestamp, either "asc" or "desc". Defaults to "desc"
+	Order string `json:"order,omitempty" query:"order"`
+	// Previous includes the logs of the previous instance of the containers that have restarted, e.g. after a crash
+	Previous bool `json:"previous,omitempty" query:"previous"`
+	// NoCache bypasses the result cache of the backends, e.g. to refresh a dashboard.
+	// The fresh results are still cached for the searches that follow.
+	NoCache bool `json:"noCache,omitempty" query:"noCache"`
 
 	start *time.Time `json:"-"`
 	end   *time.Time `json:"-"`
@@ -210,6 +730,36 @@ func (t *SearchParams) SetDefaults() {
 	if t.LimitBytesPerItem == 0 {
 		t.LimitBytesPerItem = 100 * 1024
 	}
+
+	if t.Order != OrderAscending {
+		t.Order = OrderDescending
+	}
+}
+
+// GetQuery parses the generic query string.
+// A nil expression is returned if there's no query.
+func (p SearchParams) GetQuery() (QueryExpr, error) {
+	return ParseQuery(p.Query)
+}
+
+// Clone returns a copy of the search params that can be
+// handed off to a backend without sharing the labels map.
+func (p SearchParams) Clone() *SearchParams {
+	clone := p
+	if p.Labels != nil {
+		clone.Labels = make(map[string]string, len(p.Labels))
+		for k, v := range p.Labels {
+			clone.Labels[k] = v
+		}
+	}
+
+	return &clone
+}
+
+// SetStart sets the start of the time window
+func (p *SearchParams) SetStart(start time.Time) {
+	p.Start = start.Format(time.RFC3339Nano)
+	p.start = &start
 }
 
 func (p SearchParams) GetStartISO() string {
@@ -251,6 +801,21 @@ func (p *SearchParams) GetEnd() *time.Time {
 	return p.end
 }
 
+// IsRelative reports whether the time window is relative to the time of the search, e.g. the last hour,
+// as opposed to one between two timestamps
+func (p SearchParams) IsRelative() bool {
+	if p.End == "" {
+		return true
+	}
+
+	for _, value := range []string{p.Start, p.End} {
+		if _, err := durationUtil.ParseDuration(value); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
 func (q SearchParams) String() string {
 	s := ""
 	if q.Type != "" {
@@ -277,6 +842,15 @@ func (q SearchParams) String() string {
 	if q.Page != "" {
 		s += fmt.Sprintf("page=%s ", q.Page)
 	}
+	if q.Order != "" {
+		s += fmt.Sprintf("order=%s ", q.Order)
+	}
+	if q.Previous {
+		s += "previous=true "
+	}
+	if q.NoCache {
+		s += "noCache=true "
+	}
 	return s
 }
 
@@ -284,12 +858,47 @@ type SearchResults struct {
 	Total    int      `json:"total,omitempty"`
 	Results  []Result `json:"results,omitempty"`
 	NextPage string   `json:"nextPage,omitempty"`
+
+	// Partial is set when at least one of the searched backends
+	// failed or timed out, so the results are incomplete.
+	Partial bool `json:"partial,omitempty"`
+	// Backends lists the outcome of the search on each backend,
+	// or on each part of a backend for the results of a backend that searches several, e.g. clusters
+	Backends []BackendResult `json:"backends,omitempty"`
 }
 
-func (r *SearchResults) Append(other *SearchResults) {
-	r.Results = append(r.Results, other.Results...)
-	r.Total += other.Total
-	r.NextPage = other.NextPage
+type BackendStatus string
+
+const (
+	BackendStatusSuccess   BackendStatus = "success"
+	BackendStatusError     BackendStatus = "error"
+	BackendStatusTimeout   BackendStatus = "timeout"
+	BackendStatusCancelled BackendStatus = "cancelled"
+	// BackendStatusPartial is a backend that returned the results of some of what it searches, e.g. of some of its clusters
+	BackendStatusPartial BackendStatus = "partial"
+)
+
+// GetBackendStatus returns the status of a backend that failed with the given error.
+func GetBackendStatus(err error) BackendStatus {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return BackendStatusTimeout
+	case errors.Is(err, context.Canceled):
+		return BackendStatusCancelled
+	default:
+		return BackendStatusError
+	}
+}
+
+// BackendResult is the outcome of a search on a single backend.
+type BackendResult struct {
+	Name   string        `json:"name"`
+	Type   string        `json:"type"`
+	Status BackendStatus `json:"status"`
+	// DurationMs is the time taken by the backend in milliseconds
+	DurationMs int64  `json:"durationMs"`
+	Count      int    `json:"count"`
+	Error      string `json:"error,omitempty"`
 }
 
 type Result struct {
@@ -299,6 +908,13 @@ type Result struct {
 	Time    string            `json:"timestamp,omitempty"`
 	Message string            `json:"message,omitempty"`
 	Labels  map[string]string `json:"labels,omitempty"`
+
+	// Trace links the log line to its trace when it carries a trace id
+	Trace *TraceLink `json:"trace,omitempty"`
+
+	// Cursor is the backend specific page token that resumes the search right after this result.
+	// It's used to build the next page token when only some of the results of a backend are returned.
+	Cursor string `json:"-"`
 }
 
 func (r Result) Process() Result {
@@ -317,8 +933,8 @@ func (r Result) Process() Result {
 
 // +kubebuilder:object:generate=false
 type SearchAPI interface {
-	Search(q *SearchParams) (r SearchResults, err error)
-	MatchRoute(q *SearchParams) (match bool, isAdditive bool)
+	Search(ctx context.Context, q *SearchParams) (r SearchResults, err error)
+	MatchRoute(q *SearchParams) (route SearchRoute, match bool)
 }
 
 type SearchMapper interface {
@@ -1,6 +1,9 @@
 package logs
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+)
 
 func TestSearchRoute_Match(t *testing.T) {
 	type fields struct {
@@ -208,3 +211,130 @@ func TestSearchRoute_Match(t *testing.T) {
 		})
 	}
 }
+
+func TestRoutes_MatchRoute(t *testing.T) {
+	q := &SearchParams{Type: "KubernetesPod", Id: "prod-api-1234", Labels: map[string]string{"app": "api"}}
+
+	tests := []struct {
+		name      string
+		routes    Routes
+		wantMatch bool
+		wantRoute SearchRoute
+	}{
+		{
+			name:      "no routes",
+			routes:    nil,
+			wantMatch: false,
+		},
+		{
+			name: "no matching route",
+			routes: Routes{
+				{Type: "KubernetesNode"},
+				{IdPrefix: "staging-"},
+			},
+			wantMatch: false,
+		},
+		{
+			name: "first matching route wins on equal priority",
+			routes: Routes{
+				{Type: "KubernetesNode", Mode: RouteModeExclusive},
+				{IdPrefix: "prod-", Mode: RouteModeFallback},
+				{Type: "KubernetesPod", Mode: RouteModeExclusive},
+			},
+			wantMatch: true,
+			wantRoute: SearchRoute{IdPrefix: "prod-", Mode: RouteModeFallback},
+		},
+		{
+			name: "highest priority matching route wins",
+			routes: Routes{
+				{IdPrefix: "prod-", Mode: RouteModeFallback},
+				{Type: "KubernetesPod", Mode: RouteModeExclusive, Priority: 10},
+				{Type: "KubernetesNode", Mode: RouteModeAdditive, Priority: 20},
+			},
+			wantMatch: true,
+			wantRoute: SearchRoute{Type: "KubernetesPod", Mode: RouteModeExclusive, Priority: 10},
+		},
+		{
+			name: "negative priority loses to the default priority",
+			routes: Routes{
+				{Type: "KubernetesPod", Mode: RouteModeExclusive, Priority: -1},
+				{Labels: map[string]string{"app": "api"}},
+			},
+			wantMatch: true,
+			wantRoute: SearchRoute{Labels: map[string]string{"app": "api"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route, match := tt.routes.MatchRoute(q)
+			if match != tt.wantMatch {
+				t.Fatalf("Routes.MatchRoute() match = %v, want %v", match, tt.wantMatch)
+			}
+
+			if !reflect.DeepEqual(route, tt.wantRoute) {
+				t.Errorf("Routes.MatchRoute() route = %+v, want %+v", route, tt.wantRoute)
+			}
+		})
+	}
+}
+
+func TestSearchRoute_GetMode(t *testing.T) {
+	tests := []struct {
+		route SearchRoute
+		want  RouteMode
+	}{
+		{route: SearchRoute{}, want: RouteModeAdditive},
+		{route: SearchRoute{IsAdditive: true}, want: RouteModeExclusive},
+		{route: SearchRoute{IsAdditive: true, Mode: RouteModeAdditive}, want: RouteModeAdditive},
+		{route: SearchRoute{Mode: RouteModeExclusive}, want: RouteModeExclusive},
+		{route: SearchRoute{Mode: RouteModeFallback}, want: RouteModeFallback},
+	}
+
+	for _, tt := range tests {
+		if got := tt.route.GetMode(); got != tt.want {
+			t.Errorf("SearchRoute.GetMode() = %v, want %v", got, tt.want)
+		}
+	}
+}
+
+func TestSearchParams_IsRelative(t *testing.T) {
+	tests := []struct {
+		params SearchParams
+		want   bool
+	}{
+		{params: SearchParams{Start: "1h"}, want: true},
+		{params: SearchParams{Start: "2023-03-09T12:00:00Z"}, want: true},
+		{params: SearchParams{Start: "2h", End: "1h"}, want: true},
+		{params: SearchParams{Start: "2h", End: "2023-03-09T13:00:00Z"}, want: true},
+		{params: SearchParams{Start: "2023-03-09T12:00:00Z", End: "2023-03-09T13:00:00Z"}, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.params.IsRelative(); got != tt.want {
+			t.Errorf("SearchParams{Start: %q, End: %q}.IsRelative() = %v, want %v", tt.params.Start, tt.params.End, got, tt.want)
+		}
+	}
+}
+
+func TestSearchBackendConfig_Validate(t *testing.T) {
+	valid := SearchBackendConfig{Kubernetes: &KubernetesSearchBackendConfig{CommonBackend: CommonBackend{Timeout: "10s"}}}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("expected the config to be valid, got %v", err)
+	}
+
+	invalid := SearchBackendConfig{Loki: &LokiBackendConfig{CommonBackend: CommonBackend{Timeout: "10 seconds"}}}
+	if err := invalid.Validate(); err == nil {
+		t.Error("expected an invalid timeout to be an error")
+	}
+
+	modes := SearchBackendConfig{Loki: &LokiBackendConfig{CommonBackend: CommonBackend{Routes: Routes{{Mode: RouteModeFallback}}}}}
+	if err := modes.Validate(); err != nil {
+		t.Errorf("expected the route mode to be valid, got %v", err)
+	}
+
+	modes.Loki.Routes = append(modes.Loki.Routes, SearchRoute{Mode: "addtive"})
+	if err := modes.Validate(); err == nil {
+		t.Error("expected an unknown route mode to be an error")
+	}
+}
@@ -0,0 +1,519 @@
+package logs
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The query language used by SearchParams.Query.
+//
+//	error                      message contains "error"
+//	"connection refused"       message contains the phrase
+//	/time(d)? out/             message matches the regular expression
+//	level:warn                 the level label contains "warn"
+//	pod=api-0                  the pod label equals "api-0"
+//	pod!=api-0                 the pod label doesn't equal "api-0"
+//	status>=500                numeric (or lexical) comparison with >, >=, < and <=
+//	path:/\.php$/              the path label matches the regular expression
+//	a AND b, a b               both match
+//	a OR b                     either matches
+//	NOT a                      a doesn't match
+//	(a OR b) AND NOT c         parentheses group the expressions
+//
+// The message, id and timestamp fields refer to the respective fields of a Result,
+// any other field refers to a label.
+
+// QueryOperator is the comparison of a QueryTerm
+type QueryOperator string
+
+const (
+	QueryOpContains     QueryOperator = ":"
+	QueryOpEquals       QueryOperator = "="
+	QueryOpNotEquals    QueryOperator = "!="
+	QueryOpRegex        QueryOperator = "~"
+	QueryOpGreater      QueryOperator = ">"
+	QueryOpGreaterEqual QueryOperator = ">="
+	QueryOpLess         QueryOperator = "<"
+	QueryOpLessEqual    QueryOperator = "<="
+)
+
+const (
+	QueryFieldMessage   = "message"
+	QueryFieldID        = "id"
+	QueryFieldTimestamp = "timestamp"
+)
+
+// QueryExpr is a node of a parsed query
+type QueryExpr interface {
+	// Match evaluates the expression against a result
+	Match(r Result) bool
+	String() string
+}
+
+// QueryAnd matches when all of its expressions match
+type QueryAnd struct {
+	Exprs []QueryExpr
+}
+
+// QueryOr matches when any of its expressions match
+type QueryOr struct {
+	Exprs []QueryExpr
+}
+
+// QueryNot matches when its expression doesn't match
+type QueryNot struct {
+	Expr QueryExpr
+}
+
+// QueryTerm compares a field of a result against a value
+type QueryTerm struct {
+	// Field is the field to compare. Defaults to the message.
+	Field string
+	Op    QueryOperator
+	Value string
+
+	regex *regexp.Regexp
+}
+
+// ParseQuery parses a query string into an expression.
+// A nil expression is returned for an empty query.
+func ParseQuery(query string) (QueryExpr, error) {
+	tokens, err := lexQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+
+	p := &queryParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q at position %d", p.tokens[p.pos].value, p.tokens[p.pos].pos)
+	}
+
+	return expr, nil
+}
+
+// FilterResults returns the results that match the expression.
+func FilterResults(expr QueryExpr, results []Result) []Result {
+	if expr == nil {
+		return results
+	}
+
+	filtered := make([]Result, 0, len(results))
+	for _, r := range results {
+		if expr.Match(r) {
+			filtered = append(filtered, r)
+		}
+	}
+
+	return filtered
+}
+
+func (t QueryAnd) Match(r Result) bool {
+	for _, e := range t.Exprs {
+		if !e.Match(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func (t QueryAnd) String() string {
+	return joinQueryExprs(t.Exprs, " AND ")
+}
+
+func (t QueryOr) Match(r Result) bool {
+	for _, e := range t.Exprs {
+		if e.Match(r) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t QueryOr) String() string {
+	return joinQueryExprs(t.Exprs, " OR ")
+}
+
+func (t QueryNot) Match(r Result) bool {
+	return !t.Expr.Match(r)
+}
+
+func (t QueryNot) String() string {
+	return "NOT " + t.Expr.String()
+}
+
+// GetField returns the field of the term, defaulting to the message
+func (t QueryTerm) GetField() string {
+	if t.Field == "" {
+		return QueryFieldMessage
+	}
+	return t.Field
+}
+
+func (t QueryTerm) Match(r Result) bool {
+	val, ok := getResultField(r, t.GetField())
+	switch t.Op {
+	case QueryOpNotEquals:
+		return !ok || val != t.Value
+	case QueryOpEquals:
+		return ok && val == t.Value
+	case QueryOpContains:
+		return ok && strings.Contains(strings.ToLower(val), strings.ToLower(t.Value))
+	case QueryOpRegex:
+		return ok && t.regex != nil && t.regex.MatchString(val)
+	case QueryOpGreater, QueryOpGreaterEqual, QueryOpLess, QueryOpLessEqual:
+		if !ok {
+			return false
+		}
+
+		cmp := compareQueryValues(val, t.Value)
+		switch t.Op {
+		case QueryOpGreater:
+			return cmp > 0
+		case QueryOpGreaterEqual:
+			return cmp >= 0
+		case QueryOpLess:
+			return cmp < 0
+		default:
+			return cmp <= 0
+		}
+	}
+
+	return false
+}
+
+func (t QueryTerm) String() string {
+	value := strconv.Quote(t.Value)
+	if t.Op == QueryOpRegex {
+		value = "/" + t.Value + "/"
+	}
+
+	switch {
+	case t.Field == "":
+		return value
+	case t.Op == QueryOpRegex:
+		return t.Field + string(QueryOpContains) + value
+	default:
+		return t.Field + string(t.Op) + value
+	}
+}
+
+// IsNumeric reports whether the value of the term is a number
+func (t QueryTerm) IsNumeric() bool {
+	_, err := strconv.ParseFloat(t.Value, 64)
+	return err == nil
+}
+
+func getResultField(r Result, field string) (string, bool) {
+	switch field {
+	case QueryFieldMessage:
+		return r.Message, true
+	case QueryFieldID:
+		return r.Id, true
+	case QueryFieldTimestamp:
+		return r.Time, true
+	default:
+		val, ok := r.Labels[field]
+		return val, ok
+	}
+}
+
+// compareQueryValues compares the values as numbers if both are numeric or as strings otherwise.
+func compareQueryValues(a, b string) int {
+	aNum, aErr := strconv.ParseFloat(a, 64)
+	bNum, bErr := strconv.ParseFloat(b, 64)
+	if aErr == nil && bErr == nil {
+		switch {
+		case aNum < bNum:
+			return -1
+		case aNum > bNum:
+			return 1
+		default:
+			return 0
+		}
+	}
+
+	return strings.Compare(a, b)
+}
+
+func joinQueryExprs(exprs []QueryExpr, sep string) string {
+	parts := make([]string, 0, len(exprs))
+	for _, e := range exprs {
+		parts = append(parts, e.String())
+	}
+	return "(" + strings.Join(parts, sep) + ")"
+}
+
+type queryTokenKind int
+
+const (
+	tokenWord queryTokenKind = iota
+	tokenString
+	tokenRegex
+	tokenOperator
+	tokenLParen
+	tokenRParen
+)
+
+type queryToken struct {
+	kind  queryTokenKind
+	value string
+	pos   int
+}
+
+// lexQuery splits the query into tokens
+func lexQuery(query string) ([]queryToken, error) {
+	var tokens []queryToken
+	runes := []rune(query)
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+
+		case c == '(':
+			tokens = append(tokens, queryToken{kind: tokenLParen, value: "(", pos: i})
+			i++
+
+		case c == ')':
+			tokens = append(tokens, queryToken{kind: tokenRParen, value: ")", pos: i})
+			i++
+
+		case c == '"':
+			var sb strings.Builder
+			j := i + 1
+			for ; j < len(runes) && runes[j] != '"'; j++ {
+				if runes[j] == '\\' && j+1 < len(runes) {
+					j++
+				}
+				sb.WriteRune(runes[j])
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("unterminated string at position %d", i)
+			}
+			tokens = append(tokens, queryToken{kind: tokenString, value: sb.String(), pos: i})
+			i = j + 1
+
+		case c == '/':
+			// A regex ends at the next unescaped slash that is followed by a boundary
+			end := -1
+			for j := i + 1; j < len(runes); j++ {
+				if runes[j] == '\\' {
+					j++
+					continue
+				}
+				if runes[j] == '/' && (j+1 == len(runes) || unicode.IsSpace(runes[j+1]) || runes[j+1] == ')') {
+					end = j
+					break
+				}
+			}
+			if end == -1 {
+				// Not a regex, e.g. a path
+				word := lexWord(runes, i)
+				tokens = append(tokens, queryToken{kind: tokenWord, value: word, pos: i})
+				i += len([]rune(word))
+				continue
+			}
+			tokens = append(tokens, queryToken{kind: tokenRegex, value: string(runes[i+1 : end]), pos: i})
+			i = end + 1
+
+		case strings.ContainsRune(":=!<>", c):
+			op := string(c)
+			if i+1 < len(runes) && runes[i+1] == '=' && c != ':' && c != '=' {
+				op += "="
+			}
+			if op == "!" {
+				return nil, fmt.Errorf("unexpected '!' at position %d", i)
+			}
+			tokens = append(tokens, queryToken{kind: tokenOperator, value: op, pos: i})
+			i += len(op)
+
+		default:
+			word := lexWord(runes, i)
+			tokens = append(tokens, queryToken{kind: tokenWord, value: word, pos: i})
+			i += len([]rune(word))
+		}
+	}
+
+	return tokens, nil
+}
+
+func lexWord(runes []rune, start int) string {
+	end := start
+	for end < len(runes) {
+		c := runes[end]
+		if unicode.IsSpace(c) || strings.ContainsRune(`()":=!<>`, c) {
+			break
+		}
+		end++
+	}
+	return string(runes[start:end])
+}
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+func (p *queryParser) peek() *queryToken {
+	if p.pos >= len(p.tokens) {
+		return nil
+	}
+	return &p.tokens[p.pos]
+}
+
+func (p *queryParser) isKeyword(keyword string) bool {
+	t := p.peek()
+	return t != nil && t.kind == tokenWord && t.value == keyword
+}
+
+// parseOr parses: and ("OR" and)*
+func (p *queryParser) parseOr() (QueryExpr, error) {
+	var exprs []QueryExpr
+	for {
+		expr, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+
+		if !p.isKeyword("OR") {
+			break
+		}
+		p.pos++
+	}
+
+	if len(exprs) == 1 {
+		return exprs[0], nil
+	}
+	return QueryOr{Exprs: exprs}, nil
+}
+
+// parseAnd parses: not (["AND"] not)*
+func (p *queryParser) parseAnd() (QueryExpr, error) {
+	var exprs []QueryExpr
+	for {
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+
+		if p.isKeyword("AND") {
+			p.pos++
+			continue
+		}
+
+		// Terms next to each other are implicitly joined with AND
+		if t := p.peek(); t == nil || t.kind == tokenRParen || p.isKeyword("OR") {
+			break
+		}
+	}
+
+	if len(exprs) == 1 {
+		return exprs[0], nil
+	}
+	return QueryAnd{Exprs: exprs}, nil
+}
+
+// parseNot parses: "NOT" not | primary
+func (p *queryParser) parseNot() (QueryExpr, error) {
+	if p.isKeyword("NOT") {
+		p.pos++
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return QueryNot{Expr: expr}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+// parsePrimary parses: "(" or ")" | term
+func (p *queryParser) parsePrimary() (QueryExpr, error) {
+	t := p.peek()
+	if t == nil {
+		return nil, fmt.Errorf("unexpected end of query")
+	}
+
+	switch t.kind {
+	case tokenLParen:
+		p.pos++
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if next := p.peek(); next == nil || next.kind != tokenRParen {
+			return nil, fmt.Errorf("missing ')' for '(' at position %d", t.pos)
+		}
+		p.pos++
+		return expr, nil
+
+	case tokenString, tokenRegex:
+		p.pos++
+		return toQueryExpr(newQueryTerm("", *t))
+
+	case tokenWord:
+		p.pos++
+		if op := p.peek(); op != nil && op.kind == tokenOperator {
+			p.pos++
+			value := p.peek()
+			if value == nil || (value.kind != tokenWord && value.kind != tokenString && value.kind != tokenRegex) {
+				return nil, fmt.Errorf("missing value for %s%s at position %d", t.value, op.value, op.pos)
+			}
+			p.pos++
+
+			term, err := newQueryTerm(t.value, *value)
+			if err != nil {
+				return nil, err
+			}
+
+			if value.kind == tokenRegex {
+				if op.value != string(QueryOpContains) {
+					return nil, fmt.Errorf("regular expressions can only be used with ':' at position %d", op.pos)
+				}
+			} else {
+				term.Op = QueryOperator(op.value)
+			}
+
+			return term, nil
+		}
+		return toQueryExpr(newQueryTerm("", *t))
+
+	default:
+		return nil, fmt.Errorf("unexpected %q at position %d", t.value, t.pos)
+	}
+}
+
+func toQueryExpr(term QueryTerm, err error) (QueryExpr, error) {
+	if err != nil {
+		return nil, err
+	}
+	return term, nil
+}
+
+func newQueryTerm(field string, value queryToken) (QueryTerm, error) {
+	term := QueryTerm{Field: field, Op: QueryOpContains, Value: value.value}
+	if value.kind == tokenRegex {
+		regex, err := regexp.Compile(value.value)
+		if err != nil {
+			return term, fmt.Errorf("invalid regular expression at position %d: %w", value.pos, err)
+		}
+		term.Op = QueryOpRegex
+		term.regex = regex
+	}
+
+	return term, nil
+}
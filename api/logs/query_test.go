@@ -0,0 +1,98 @@
+package logs
+
+import "testing"
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    string
+		wantErr bool
+	}{
+		{query: "", want: "<nil>"},
+		{query: "error", want: `"error"`},
+		{query: `"connection refused"`, want: `"connection refused"`},
+		{query: "/time(d)? out/", want: "/time(d)? out/"},
+		{query: "level:warn", want: `level:"warn"`},
+		{query: "pod=api-0 pod!=api-1", want: `(pod="api-0" AND pod!="api-1")`},
+		{query: "status>=500 AND status<600", want: `(status>="500" AND status<"600")`},
+		{query: `path:/\.php$/`, want: `path:/\.php$/`},
+		{query: "path:/var/log/nginx", want: `path:"/var/log/nginx"`},
+		{query: "a OR b c", want: `("a" OR ("b" AND "c"))`},
+		{query: "(a OR b) AND NOT c", want: `(("a" OR "b") AND NOT "c")`},
+		{query: "NOT NOT a", want: `NOT NOT "a"`},
+		{query: "(a OR b", wantErr: true},
+		{query: "a)", wantErr: true},
+		{query: `"unterminated`, wantErr: true},
+		{query: "level:", wantErr: true},
+		{query: "level=/warn/", wantErr: true},
+		{query: "/(/", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			expr, err := ParseQuery(tt.query)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseQuery() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			got := "<nil>"
+			if expr != nil {
+				got = expr.String()
+			}
+			if got != tt.want {
+				t.Errorf("ParseQuery() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryMatch(t *testing.T) {
+	result := Result{
+		Id:      "1",
+		Message: "GET /index.php HTTP/1.1 500 Connection refused",
+		Labels: map[string]string{
+			"pod":    "api-0",
+			"status": "500",
+			"level":  "error",
+		},
+	}
+
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{query: "refused", want: true},
+		{query: `"connection REFUSED"`, want: true},
+		{query: "/index\\.php/", want: true},
+		{query: "/^POST/", want: false},
+		{query: "pod=api-0", want: true},
+		{query: "pod=api", want: false},
+		{query: "pod:api", want: true},
+		{query: "pod!=api-1", want: true},
+		{query: "missing!=x", want: true},
+		{query: "missing:x", want: false},
+		{query: "status>=500", want: true},
+		{query: "status>99", want: true},
+		{query: "status<500", want: false},
+		{query: "level:error AND NOT pod:worker", want: true},
+		{query: "level:warn OR status>=500", want: true},
+		{query: "(level:warn OR level:info) refused", want: false},
+		{query: "id=1 message:/HTTP\\/1\\.1/", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			expr, err := ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery() error = %v", err)
+			}
+
+			if got := expr.Match(result); got != tt.want {
+				t.Errorf("%s Match() = %v, want %v", expr, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package logs
+
+import (
+	"container/heap"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	// OrderAscending sorts the results from the oldest to the newest
+	OrderAscending = "asc"
+	// OrderDescending sorts the results from the newest to the oldest
+	OrderDescending = "desc"
+)
+
+// PageTokens holds the position of each backend, keyed by the backend name.
+//
+// A backend with an empty position is searched from the start while
+// a backend that's missing from a non-empty set of tokens has no more results.
+type PageTokens map[string]string
+
+// ParsePageTokens decodes the opaque page token returned in SearchResults.NextPage.
+func ParsePageTokens(page string) (PageTokens, error) {
+	if page == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(page)
+	if err != nil {
+		return nil, fmt.Errorf("invalid page token: %w", err)
+	}
+
+	var tokens PageTokens
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("invalid page token: %w", err)
+	}
+
+	return tokens, nil
+}
+
+// Encode returns the opaque page token.
+// An empty string is returned when none of the backends have more results.
+func (t PageTokens) Encode() string {
+	if len(t) == 0 {
+		return ""
+	}
+
+	data, err := json.Marshal(t)
+	if err != nil {
+		return ""
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// GetTime parses the timestamp of the result.
+// Zero time is returned if the timestamp is missing or invalid.
+func (r Result) GetTime() time.Time {
+	t, err := time.Parse(time.RFC3339Nano, r.Time)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return t
+}
+
+// resultBefore reports whether a comes before b in the given order.
+// Results without a timestamp always go last.
+func resultBefore(a, b time.Time, order string) bool {
+	switch {
+	case a.IsZero():
+		return false
+	case b.IsZero():
+		return true
+	case order == OrderAscending:
+		return a.Before(b)
+	default:
+		return a.After(b)
+	}
+}
+
+// SortResults sorts the results in place by their timestamp.
+func SortResults(results []Result, order string) {
+	sort.SliceStable(results, func(i, j int) bool {
+		return resultBefore(results[i].GetTime(), results[j].GetTime(), order)
+	})
+}
+
+// MergeResults merges the results of several backends by their timestamp
+// and caps the merged results at the given limit. A limit <= 0 means no limit.
+//
+// Each list is sorted in place before merging. Along with the merged results,
+// it returns how many results were taken from each of the given lists.
+func MergeResults(order string, limit int, lists ...[]Result) ([]Result, []int) {
+	consumed := make([]int, len(lists))
+	h := &resultHeap{order: order}
+	for i, list := range lists {
+		SortResults(list, order)
+		if len(list) > 0 {
+			h.items = append(h.items, heapItem{list: i, time: list[0].GetTime()})
+		}
+	}
+	heap.Init(h)
+
+	var merged []Result
+	for h.Len() > 0 && (limit <= 0 || len(merged) < limit) {
+		item := heap.Pop(h).(heapItem)
+		list := lists[item.list]
+		merged = append(merged, list[consumed[item.list]])
+		consumed[item.list]++
+
+		if next := consumed[item.list]; next < len(list) {
+			heap.Push(h, heapItem{list: item.list, time: list[next].GetTime()})
+		}
+	}
+
+	return merged, consumed
+}
+
+type heapItem struct {
+	list int
+	time time.Time
+}
+
+// resultHeap holds the next result of each list being merged
+type resultHeap struct {
+	order string
+	items []heapItem
+}
+
+func (h resultHeap) Len() int { return len(h.items) }
+
+func (h resultHeap) Less(i, j int) bool {
+	a, b := h.items[i], h.items[j]
+	if a.time.Equal(b.time) {
+		// keep the order of the backends stable for equal timestamps
+		return a.list < b.list
+	}
+	return resultBefore(a.time, b.time, h.order)
+}
+
+func (h resultHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+
+func (h *resultHeap) Push(x any) { h.items = append(h.items, x.(heapItem)) }
+
+func (h *resultHeap) Pop() any {
+	old := h.items
+	item := old[len(old)-1]
+	h.items = old[:len(old)-1]
+	return item
+}
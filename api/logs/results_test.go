@@ -0,0 +1,95 @@
+package logs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeResults(t *testing.T) {
+	backendA := func() []Result {
+		return []Result{
+			{Id: "a3", Time: "2023-01-01T00:00:30Z"},
+			{Id: "a1", Time: "2023-01-01T00:00:10Z"},
+			{Id: "a2", Time: "2023-01-01T00:00:20Z"},
+		}
+	}
+	backendB := func() []Result {
+		return []Result{
+			{Id: "b1", Time: "2023-01-01T00:00:15Z"},
+			{Id: "b0", Time: ""},
+			{Id: "b2", Time: "2023-01-01T00:00:25.500Z"},
+		}
+	}
+
+	tests := []struct {
+		name         string
+		order        string
+		limit        int
+		wantIds      []string
+		wantConsumed []int
+	}{
+		{
+			name:         "descending",
+			order:        OrderDescending,
+			wantIds:      []string{"a3", "b2", "a2", "b1", "a1", "b0"},
+			wantConsumed: []int{3, 3},
+		},
+		{
+			name:         "ascending",
+			order:        OrderAscending,
+			wantIds:      []string{"a1", "b1", "a2", "b2", "a3", "b0"},
+			wantConsumed: []int{3, 3},
+		},
+		{
+			name:         "limit is applied after the merge",
+			order:        OrderAscending,
+			limit:        3,
+			wantIds:      []string{"a1", "b1", "a2"},
+			wantConsumed: []int{2, 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, consumed := MergeResults(tt.order, tt.limit, backendA(), nil, backendB())
+
+			var ids []string
+			for _, r := range merged {
+				ids = append(ids, r.Id)
+			}
+
+			if !reflect.DeepEqual(ids, tt.wantIds) {
+				t.Errorf("MergeResults() ids = %v, want %v", ids, tt.wantIds)
+			}
+
+			wantConsumed := []int{tt.wantConsumed[0], 0, tt.wantConsumed[1]}
+			if !reflect.DeepEqual(consumed, wantConsumed) {
+				t.Errorf("MergeResults() consumed = %v, want %v", consumed, wantConsumed)
+			}
+		})
+	}
+}
+
+func TestPageTokens(t *testing.T) {
+	tokens := PageTokens{
+		"elasticsearch[0]": `[1678364951828,"abc"]`,
+		"kubernetes[1]":    "",
+	}
+
+	parsed, err := ParsePageTokens(tokens.Encode())
+	if err != nil {
+		t.Fatalf("ParsePageTokens() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(parsed, tokens) {
+		t.Errorf("ParsePageTokens() = %v, want %v", parsed, tokens)
+	}
+
+	if PageTokens(nil).Encode() != "" {
+		t.Errorf("expected empty page token when no backend has more results")
+	}
+
+	if _, err := ParsePageTokens("not a token"); err == nil {
+		t.Errorf("expected an error for an invalid page token")
+	}
+}
@@ -0,0 +1,118 @@
+package logs
+
+import (
+	"context"
+	"time"
+
+	"github.com/flanksource/apm-hub/utils"
+	"github.com/flanksource/commons/logger"
+)
+
+// TailPollInterval is the interval between the searches of the backends that are tailed by polling
+var TailPollInterval = 5 * time.Second
+
+// +kubebuilder:object:generate=false
+// TailAPI is implemented by the backends that can stream the new lines as they arrive.
+// The backends that don't implement it are tailed with PollSearch.
+type TailAPI interface {
+	// Tail sends the new lines that match the search params until the context is done.
+	// Sending blocks while the client is behind, which holds the backend back.
+	Tail(ctx context.Context, q *SearchParams, lines chan<- Result) error
+}
+
+// SendResult sends the result unless the context is done first
+func SendResult(ctx context.Context, lines chan<- Result, r Result) error {
+	select {
+	case lines <- r:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Poll calls fn right away and then on every interval until the context is done.
+// Failed calls are retried on the next interval.
+func Poll(ctx context.Context, interval time.Duration, fn func(ctx context.Context) error) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := fn(ctx); err != nil && ctx.Err() == nil {
+			logger.Warnf("error polling for new lines: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// PollSearch tails a backend by searching for the lines since the newest one sent so far.
+//
+// The time window of each search starts at the timestamp of the newest line,
+// so the lines at that timestamp are searched again and have to be deduplicated.
+func PollSearch(ctx context.Context, api SearchAPI, q *SearchParams, lines chan<- Result) error {
+	params := q.Clone()
+	params.Order = OrderAscending
+	params.End = ""
+	params.end = nil
+
+	since := time.Now()
+	if start := params.GetStart(); start != nil {
+		since = *start
+	}
+
+	// The hashes of the lines sent at the since timestamp
+	seen := make(map[string]struct{})
+
+	return Poll(ctx, TailPollInterval, func(ctx context.Context) error {
+		params.SetStart(since)
+		params.Page = ""
+
+		// All the pages are searched before any line is sent,
+		// as the backends may not return the pages oldest first.
+		var results []Result
+		for {
+			res, err := api.Search(ctx, params)
+			if err != nil {
+				return err
+			}
+
+			results = append(results, res.Results...)
+			if res.NextPage == "" {
+				break
+			}
+			params.Page = res.NextPage
+		}
+
+		SortResults(results, OrderAscending)
+		for _, r := range results {
+			ts := r.GetTime()
+			if ts.Before(since) {
+				continue
+			}
+
+			hash, err := utils.Hash(r)
+			if err != nil {
+				return err
+			}
+			if _, ok := seen[hash]; ok {
+				continue
+			}
+
+			if ts.After(since) {
+				since = ts
+				seen = make(map[string]struct{})
+			}
+			seen[hash] = struct{}{}
+
+			if err := SendResult(ctx, lines, r); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -50,11 +50,110 @@ func (in *AWSAuthentication) DeepCopy() *AWSAuthentication {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AzureLogAnalyticsBackendConfig) DeepCopyInto(out *AzureLogAnalyticsBackendConfig) {
+	*out = *in
+	in.CommonBackend.DeepCopyInto(&out.CommonBackend)
+	in.Fields.DeepCopyInto(&out.Fields)
+	if in.TenantID != nil {
+		in, out := &in.TenantID, &out.TenantID
+		*out = new(kommons.EnvVar)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ClientID != nil {
+		in, out := &in.ClientID, &out.ClientID
+		*out = new(kommons.EnvVar)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ClientSecret != nil {
+		in, out := &in.ClientSecret, &out.ClientSecret
+		*out = new(kommons.EnvVar)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AzureLogAnalyticsBackendConfig.
+func (in *AzureLogAnalyticsBackendConfig) DeepCopy() *AzureLogAnalyticsBackendConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(AzureLogAnalyticsBackendConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AzureLogAnalyticsFields) DeepCopyInto(out *AzureLogAnalyticsFields) {
+	*out = *in
+	if in.Exclusions != nil {
+		in, out := &in.Exclusions, &out.Exclusions
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AzureLogAnalyticsFields.
+func (in *AzureLogAnalyticsFields) DeepCopy() *AzureLogAnalyticsFields {
+	if in == nil {
+		return nil
+	}
+	out := new(AzureLogAnalyticsFields)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CloudWatchAccount) DeepCopyInto(out *CloudWatchAccount) {
+	*out = *in
+	if in.Auth != nil {
+		in, out := &in.Auth, &out.Auth
+		*out = new(AWSAuthentication)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudWatchAccount.
+func (in *CloudWatchAccount) DeepCopy() *CloudWatchAccount {
+	if in == nil {
+		return nil
+	}
+	out := new(CloudWatchAccount)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CloudWatchBackendConfig) DeepCopyInto(out *CloudWatchBackendConfig) {
 	*out = *in
 	in.CommonBackend.DeepCopyInto(&out.CommonBackend)
 	in.Auth.DeepCopyInto(&out.Auth)
+	if in.LogGroups != nil {
+		in, out := &in.LogGroups, &out.LogGroups
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.LogGroupPrefixes != nil {
+		in, out := &in.LogGroupPrefixes, &out.LogGroupPrefixes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.LogGroupPatterns != nil {
+		in, out := &in.LogGroupPatterns, &out.LogGroupPatterns
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Accounts != nil {
+		in, out := &in.Accounts, &out.Accounts
+		*out = make([]CloudWatchAccount, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Cache != nil {
+		in, out := &in.Cache, &out.Cache
+		*out = new(ResultCacheConfig)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudWatchBackendConfig.
@@ -84,6 +183,16 @@ func (in *CommonBackend) DeepCopyInto(out *CommonBackend) {
 			(*out)[key] = val
 		}
 	}
+	if in.TraceFields != nil {
+		in, out := &in.TraceFields, &out.TraceFields
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.SpanFields != nil {
+		in, out := &in.SpanFields, &out.SpanFields
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CommonBackend.
@@ -121,6 +230,11 @@ func (in *ElasticSearchBackendConfig) DeepCopyInto(out *ElasticSearchBackendConf
 		*out = new(kommons.EnvVar)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.Cache != nil {
+		in, out := &in.Cache, &out.Cache
+		*out = new(ResultCacheConfig)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ElasticSearchBackendConfig.
@@ -153,6 +267,22 @@ func (in *ElasticSearchFields) DeepCopy() *ElasticSearchFields {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FileParser) DeepCopyInto(out *FileParser) {
+	*out = *in
+	in.Fields.DeepCopyInto(&out.Fields)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FileParser.
+func (in *FileParser) DeepCopy() *FileParser {
+	if in == nil {
+		return nil
+	}
+	out := new(FileParser)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *FileSearchBackendConfig) DeepCopyInto(out *FileSearchBackendConfig) {
 	*out = *in
@@ -162,6 +292,16 @@ func (in *FileSearchBackendConfig) DeepCopyInto(out *FileSearchBackendConfig) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.TimestampFormats != nil {
+		in, out := &in.TimestampFormats, &out.TimestampFormats
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Parser != nil {
+		in, out := &in.Parser, &out.Parser
+		*out = new(FileParser)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FileSearchBackendConfig.
@@ -174,6 +314,173 @@ func (in *FileSearchBackendConfig) DeepCopy() *FileSearchBackendConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GCPLoggingBackendConfig) DeepCopyInto(out *GCPLoggingBackendConfig) {
+	*out = *in
+	in.CommonBackend.DeepCopyInto(&out.CommonBackend)
+	if in.ResourceNames != nil {
+		in, out := &in.ResourceNames, &out.ResourceNames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Credentials != nil {
+		in, out := &in.Credentials, &out.Credentials
+		*out = new(kommons.EnvVar)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GCPLoggingBackendConfig.
+func (in *GCPLoggingBackendConfig) DeepCopy() *GCPLoggingBackendConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(GCPLoggingBackendConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HTTPBackendConfig) DeepCopyInto(out *HTTPBackendConfig) {
+	*out = *in
+	in.CommonBackend.DeepCopyInto(&out.CommonBackend)
+	if in.Headers != nil {
+		in, out := &in.Headers, &out.Headers
+		*out = make([]kommons.EnvVar, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	out.Fields = in.Fields
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HTTPBackendConfig.
+func (in *HTTPBackendConfig) DeepCopy() *HTTPBackendConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(HTTPBackendConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HTTPResponseFields) DeepCopyInto(out *HTTPResponseFields) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HTTPResponseFields.
+func (in *HTTPResponseFields) DeepCopy() *HTTPResponseFields {
+	if in == nil {
+		return nil
+	}
+	out := new(HTTPResponseFields)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *JaegerBackendConfig) DeepCopyInto(out *JaegerBackendConfig) {
+	*out = *in
+	in.CommonBackend.DeepCopyInto(&out.CommonBackend)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JaegerBackendConfig.
+func (in *JaegerBackendConfig) DeepCopy() *JaegerBackendConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(JaegerBackendConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *JournaldBackendConfig) DeepCopyInto(out *JournaldBackendConfig) {
+	*out = *in
+	in.CommonBackend.DeepCopyInto(&out.CommonBackend)
+	if in.Paths != nil {
+		in, out := &in.Paths, &out.Paths
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Units != nil {
+		in, out := &in.Units, &out.Units
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Fields != nil {
+		in, out := &in.Fields, &out.Fields
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JournaldBackendConfig.
+func (in *JournaldBackendConfig) DeepCopy() *JournaldBackendConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(JournaldBackendConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubernetesCluster) DeepCopyInto(out *KubernetesCluster) {
+	*out = *in
+	if in.Kubeconfig != nil {
+		in, out := &in.Kubeconfig, &out.Kubeconfig
+		*out = new(kommons.EnvVar)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubernetesCluster.
+func (in *KubernetesCluster) DeepCopy() *KubernetesCluster {
+	if in == nil {
+		return nil
+	}
+	out := new(KubernetesCluster)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubernetesEventsConfig) DeepCopyInto(out *KubernetesEventsConfig) {
+	*out = *in
+	if in.Types != nil {
+		in, out := &in.Types, &out.Types
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubernetesEventsConfig.
+func (in *KubernetesEventsConfig) DeepCopy() *KubernetesEventsConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(KubernetesEventsConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubernetesLogCacheConfig) DeepCopyInto(out *KubernetesLogCacheConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubernetesLogCacheConfig.
+func (in *KubernetesLogCacheConfig) DeepCopy() *KubernetesLogCacheConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(KubernetesLogCacheConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KubernetesSearchBackendConfig) DeepCopyInto(out *KubernetesSearchBackendConfig) {
 	*out = *in
@@ -183,6 +490,23 @@ func (in *KubernetesSearchBackendConfig) DeepCopyInto(out *KubernetesSearchBacke
 		*out = new(kommons.EnvVar)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.Events != nil {
+		in, out := &in.Events, &out.Events
+		*out = new(KubernetesEventsConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Clusters != nil {
+		in, out := &in.Clusters, &out.Clusters
+		*out = make([]KubernetesCluster, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Cache != nil {
+		in, out := &in.Cache, &out.Cache
+		*out = new(KubernetesLogCacheConfig)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubernetesSearchBackendConfig.
@@ -195,6 +519,37 @@ func (in *KubernetesSearchBackendConfig) DeepCopy() *KubernetesSearchBackendConf
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LokiBackendConfig) DeepCopyInto(out *LokiBackendConfig) {
+	*out = *in
+	in.CommonBackend.DeepCopyInto(&out.CommonBackend)
+	if in.Username != nil {
+		in, out := &in.Username, &out.Username
+		*out = new(kommons.EnvVar)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Password != nil {
+		in, out := &in.Password, &out.Password
+		*out = new(kommons.EnvVar)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.BearerToken != nil {
+		in, out := &in.BearerToken, &out.BearerToken
+		*out = new(kommons.EnvVar)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LokiBackendConfig.
+func (in *LokiBackendConfig) DeepCopy() *LokiBackendConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(LokiBackendConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *OpenSearchBackendConfig) DeepCopyInto(out *OpenSearchBackendConfig) {
 	*out = *in
@@ -210,6 +565,11 @@ func (in *OpenSearchBackendConfig) DeepCopyInto(out *OpenSearchBackendConfig) {
 		*out = new(kommons.EnvVar)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.Cache != nil {
+		in, out := &in.Cache, &out.Cache
+		*out = new(ResultCacheConfig)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OpenSearchBackendConfig.
@@ -222,6 +582,47 @@ func (in *OpenSearchBackendConfig) DeepCopy() *OpenSearchBackendConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PrometheusBackendConfig) DeepCopyInto(out *PrometheusBackendConfig) {
+	*out = *in
+	in.CommonBackend.DeepCopyInto(&out.CommonBackend)
+	if in.Username != nil {
+		in, out := &in.Username, &out.Username
+		*out = new(kommons.EnvVar)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Password != nil {
+		in, out := &in.Password, &out.Password
+		*out = new(kommons.EnvVar)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PrometheusBackendConfig.
+func (in *PrometheusBackendConfig) DeepCopy() *PrometheusBackendConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(PrometheusBackendConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ResultCacheConfig) DeepCopyInto(out *ResultCacheConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResultCacheConfig.
+func (in *ResultCacheConfig) DeepCopy() *ResultCacheConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(ResultCacheConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SearchBackendConfig) DeepCopyInto(out *SearchBackendConfig) {
 	*out = *in
@@ -240,6 +641,16 @@ func (in *SearchBackendConfig) DeepCopyInto(out *SearchBackendConfig) {
 		*out = new(CloudWatchBackendConfig)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.GCPLogging != nil {
+		in, out := &in.GCPLogging, &out.GCPLogging
+		*out = new(GCPLoggingBackendConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AzureLogAnalytics != nil {
+		in, out := &in.AzureLogAnalytics, &out.AzureLogAnalytics
+		*out = new(AzureLogAnalyticsBackendConfig)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.Kubernetes != nil {
 		in, out := &in.Kubernetes, &out.Kubernetes
 		*out = new(KubernetesSearchBackendConfig)
@@ -250,6 +661,36 @@ func (in *SearchBackendConfig) DeepCopyInto(out *SearchBackendConfig) {
 		*out = new(FileSearchBackendConfig)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.Journald != nil {
+		in, out := &in.Journald, &out.Journald
+		*out = new(JournaldBackendConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Loki != nil {
+		in, out := &in.Loki, &out.Loki
+		*out = new(LokiBackendConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.HTTP != nil {
+		in, out := &in.HTTP, &out.HTTP
+		*out = new(HTTPBackendConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Jaeger != nil {
+		in, out := &in.Jaeger, &out.Jaeger
+		*out = new(JaegerBackendConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Tempo != nil {
+		in, out := &in.Tempo, &out.Tempo
+		*out = new(TempoBackendConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Prometheus != nil {
+		in, out := &in.Prometheus, &out.Prometheus
+		*out = new(PrometheusBackendConfig)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SearchBackendConfig.
@@ -283,3 +724,19 @@ func (in *SearchRoute) DeepCopy() *SearchRoute {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TempoBackendConfig) DeepCopyInto(out *TempoBackendConfig) {
+	*out = *in
+	in.CommonBackend.DeepCopyInto(&out.CommonBackend)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TempoBackendConfig.
+func (in *TempoBackendConfig) DeepCopy() *TempoBackendConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(TempoBackendConfig)
+	in.DeepCopyInto(out)
+	return out
+}
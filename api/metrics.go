@@ -1 +1,193 @@
 package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+var GlobalMetricsBackends []MetricsBackend
+
+// maxMetricsPoints is the number of points per series the default step aims for
+const maxMetricsPoints = 250
+
+type MetricsParams struct {
+	// The type of metrics to query. Type, ID and Labels are used to route queries like the log searches.
+	Type   string            `json:"type,omitempty"`
+	Id     string            `json:"id,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Query is the expression evaluated by the backend, e.g. a PromQL expression
+	Query string `json:"query"`
+
+	// A RFC3339 timestamp or an age string (e.g. "1h", "2d", "1w"), default to 1h
+	Start string `json:"start,omitempty"`
+	// A RFC3339 timestamp or an age string (e.g. "1h", "2d", "1w"), default to now
+	End string `json:"end,omitempty"`
+	// Step is the resolution of the series, e.g. "30s", "5m".
+	// Defaults to the time window divided in 250 points.
+	Step string `json:"step,omitempty"`
+
+	start *time.Time `json:"-"`
+	end   *time.Time `json:"-"`
+}
+
+// SetDefaults sets the default values for the metrics params
+// if they are not set
+func (t *MetricsParams) SetDefaults() {
+	if t.Start == "" {
+		t.Start = "1h"
+	}
+}
+
+func (t MetricsParams) String() string {
+	s := ""
+	if t.Type != "" {
+		s += fmt.Sprintf("type=%s ", t.Type)
+	}
+	if t.Id != "" {
+		s += fmt.Sprintf("id=%s ", t.Id)
+	}
+	if t.Start != "" {
+		s += fmt.Sprintf("start=%s ", t.Start)
+	}
+	if t.End != "" {
+		s += fmt.Sprintf("end=%s ", t.End)
+	}
+	if t.Step != "" {
+		s += fmt.Sprintf("step=%s ", t.Step)
+	}
+	s += fmt.Sprintf("query=%q", t.Query)
+	return s
+}
+
+// Clone returns a copy of the params that can be changed independently
+func (t MetricsParams) Clone() *MetricsParams {
+	clone := t
+	clone.Labels = copyMap(t.Labels)
+	return &clone
+}
+
+func (t *MetricsParams) GetStart() *time.Time {
+	if t.start == nil {
+		t.start = parseTime(t.Start)
+	}
+	return t.start
+}
+
+// GetEnd returns the end of the time window, which defaults to now
+func (t *MetricsParams) GetEnd() *time.Time {
+	if t.end == nil {
+		if t.End == "" {
+			now := time.Now()
+			t.end = &now
+		} else {
+			t.end = parseTime(t.End)
+		}
+	}
+	return t.end
+}
+
+// Validate checks that the query, the time window and the step are valid
+func (t *MetricsParams) Validate() error {
+	if t.Query == "" {
+		return fmt.Errorf("the query is required")
+	}
+
+	start, end := t.GetStart(), t.GetEnd()
+	if start == nil {
+		return fmt.Errorf("invalid start %q", t.Start)
+	}
+	if end == nil {
+		return fmt.Errorf("invalid end %q", t.End)
+	}
+	if end.Before(*start) {
+		return fmt.Errorf("the end is before the start")
+	}
+
+	_, err := t.GetStep()
+	return err
+}
+
+// GetStep returns the resolution of the series
+func (t *MetricsParams) GetStep() (time.Duration, error) {
+	if t.Step != "" {
+		step, err := parseDuration(t.Step)
+		if err != nil {
+			return 0, err
+		}
+		if step <= 0 {
+			return 0, fmt.Errorf("the step must be positive")
+		}
+		return step, nil
+	}
+
+	start, end := t.GetStart(), t.GetEnd()
+	if start == nil || end == nil {
+		return time.Minute, nil
+	}
+
+	step := end.Sub(*start) / maxMetricsPoints
+	if step < time.Second {
+		step = time.Second
+	}
+	return step.Truncate(time.Second), nil
+}
+
+// MatchRoute returns the matching route with the highest priority.
+// The routes are matched the same way as for the log searches.
+func (t MetricsParams) MatchRoute(routes logs.Routes) (logs.SearchRoute, bool) {
+	return routes.MatchRoute(&logs.SearchParams{Type: t.Type, Id: t.Id, Labels: t.Labels})
+}
+
+type MetricsResults struct {
+	Results []Series `json:"results,omitempty"`
+
+	// Partial is set when at least one of the queried backends
+	// failed or timed out, so the results are incomplete.
+	Partial bool `json:"partial,omitempty"`
+	// Backends lists the outcome of the query on each backend
+	Backends []logs.BackendResult `json:"backends,omitempty"`
+}
+
+// Series is a set of samples of a metric, identified by its labels
+type Series struct {
+	Labels  map[string]string `json:"labels,omitempty"`
+	Samples []Sample          `json:"samples"`
+}
+
+type Sample struct {
+	// RFC3339 timestamp
+	Time  string  `json:"timestamp"`
+	Value float64 `json:"value"`
+}
+
+// +kubebuilder:object:generate=false
+type MetricsAPI interface {
+	// Query evaluates the query over the time window of the params
+	Query(ctx context.Context, q *MetricsParams) (MetricsResults, error)
+	MatchRoute(q *MetricsParams) (route logs.SearchRoute, match bool)
+}
+
+func NewMetricsBackend(backendType string, api MetricsAPI, common logs.CommonBackend) MetricsBackend {
+	return MetricsBackend{
+		Name:    common.Name,
+		Type:    backendType,
+		API:     api,
+		Timeout: common.GetTimeout(),
+	}
+}
+
+type MetricsBackend struct {
+	// Name identifies the backend in the query results
+	Name string
+	// Type is the kind of the backend, e.g. prometheus
+	Type string
+	API  MetricsAPI
+
+	// Timeout is the deadline for a single query on this backend.
+	// Zero means the server wide default is used.
+	Timeout time.Duration
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMetricsParams_GetStep(t *testing.T) {
+	tests := []struct {
+		params  MetricsParams
+		want    time.Duration
+		wantErr bool
+	}{
+		{params: MetricsParams{Start: "1h"}, want: 14 * time.Second},
+		{params: MetricsParams{Start: "2m"}, want: time.Second},
+		{params: MetricsParams{Start: "1h", Step: "30s"}, want: 30 * time.Second},
+		{params: MetricsParams{Start: "1h", Step: "0s"}, wantErr: true},
+		{params: MetricsParams{Start: "1h", Step: "abc"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := tt.params.GetStep()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("GetStep(%s) error = %v, wantErr %v", tt.params.Step, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("GetStep(%s) over %s = %s, want %s", tt.params.Step, tt.params.Start, got, tt.want)
+		}
+	}
+}
+
+func TestMetricsParams_Validate(t *testing.T) {
+	if err := (&MetricsParams{Start: "1h"}).Validate(); err == nil {
+		t.Errorf("expected an error without a query")
+	}
+	if err := (&MetricsParams{Query: "up", Start: "1h", End: "2h"}).Validate(); err == nil {
+		t.Errorf("expected an error when the end is before the start")
+	}
+	if err := (&MetricsParams{Query: "up", Start: "1h"}).Validate(); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -1,15 +1,300 @@
 package api
 
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/flanksource/apm-hub/api/logs"
+	durationUtil "github.com/flanksource/commons/duration"
+)
+
+var GlobalTraceBackends []TraceBackend
+
 type TraceParams struct {
-	Limit int
-	Page  string
+	// Limit is the maximum number of traces to return.
+	Limit int64 `json:"limit,omitempty"`
+	// The page token, returned by a previous call, to request the next page of traces.
+	Page string `json:"page,omitempty"`
+	// The type of traces to find. Type, ID and Labels are used to route search requests like the log searches.
+	Type   string            `json:"type,omitempty"`
+	Id     string            `json:"id,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Service is the name of the service the traces have spans of
+	Service string `json:"service,omitempty"`
+	// Operation is the name of the operation the traces have spans of
+	Operation string `json:"operation,omitempty"`
+	// Attributes the spans should have
+	Attributes map[string]string `json:"attributes,omitempty"`
+	// MinDuration and MaxDuration are the bounds of the durations of the traces, e.g. "100ms", "1s"
+	MinDuration string `json:"minDuration,omitempty"`
+	MaxDuration string `json:"maxDuration,omitempty"`
+
+	// A RFC3339 timestamp or an age string (e.g. "1h", "2d", "1w"), default to 1h
+	Start string `json:"start,omitempty"`
+	// A RFC3339 timestamp or an age string (e.g. "1h", "2d", "1w")
+	End string `json:"end,omitempty"`
+
+	start *time.Time `json:"-"`
+	end   *time.Time `json:"-"`
+}
+
+// SetDefaults sets the default values for the trace params
+// if they are not set
+func (t *TraceParams) SetDefaults() {
+	if t.Start == "" {
+		t.Start = "1h"
+	}
+
+	if t.Limit <= 0 {
+		t.Limit = 20
+	}
+}
+
+func (t TraceParams) String() string {
+	s := ""
+	if t.Type != "" {
+		s += fmt.Sprintf("type=%s ", t.Type)
+	}
+	if t.Service != "" {
+		s += fmt.Sprintf("service=%s ", t.Service)
+	}
+	if t.Operation != "" {
+		s += fmt.Sprintf("operation=%s ", t.Operation)
+	}
+	if t.Start != "" {
+		s += fmt.Sprintf("start=%s ", t.Start)
+	}
+	if t.End != "" {
+		s += fmt.Sprintf("end=%s ", t.End)
+	}
+	s += fmt.Sprintf("limit=%d", t.Limit)
+	return s
+}
+
+// Clone returns a copy of the params that can be changed independently
+func (t TraceParams) Clone() *TraceParams {
+	clone := t
+	clone.Labels = copyMap(t.Labels)
+	clone.Attributes = copyMap(t.Attributes)
+	return &clone
+}
+
+func (t *TraceParams) GetStart() *time.Time {
+	if t.start == nil {
+		t.start = parseTime(t.Start)
+	}
+	return t.start
+}
+
+func (t *TraceParams) GetEnd() *time.Time {
+	if t.end == nil {
+		t.end = parseTime(t.End)
+	}
+	return t.end
+}
+
+// GetSearchEnd returns the end of the time window of the current page.
+// The page token holds the time up to which the traces of the next page started.
+func (t *TraceParams) GetSearchEnd() (*time.Time, error) {
+	end := t.GetEnd()
+	if t.Page == "" {
+		return end, nil
+	}
+
+	pageEnd, err := time.Parse(time.RFC3339Nano, t.Page)
+	if err != nil {
+		return nil, fmt.Errorf("invalid page token %q: %w", t.Page, err)
+	}
+
+	if end != nil && end.Before(pageEnd) {
+		return end, nil
+	}
+	return &pageEnd, nil
+}
+
+// NextTracePage returns the page token that resumes the search right after the given trace
+func NextTracePage(trace Trace) string {
+	return trace.GetStartTime().Add(-time.Microsecond).Format(time.RFC3339Nano)
+}
+
+// GetMinDuration returns the minimum duration of the traces, or zero if not set
+func (t TraceParams) GetMinDuration() (time.Duration, error) {
+	return parseDuration(t.MinDuration)
+}
+
+// GetMaxDuration returns the maximum duration of the traces, or zero if not set
+func (t TraceParams) GetMaxDuration() (time.Duration, error) {
+	return parseDuration(t.MaxDuration)
+}
+
+// MatchRoute returns the matching route with the highest priority.
+// The routes are matched the same way as for the log searches.
+func (t TraceParams) MatchRoute(routes logs.Routes) (logs.SearchRoute, bool) {
+	return routes.MatchRoute(&logs.SearchParams{Type: t.Type, Id: t.Id, Labels: t.Labels})
+}
+
+// parseTime parses a RFC3339 timestamp or an age string
+func parseTime(value string) *time.Time {
+	if duration, err := durationUtil.ParseDuration(value); err == nil {
+		t := time.Now().Add(-time.Duration(duration))
+		return &t
+	} else if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return &t
+	}
+	return nil
+}
+
+func parseDuration(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q: %w", value, err)
+	}
+	return d, nil
+}
+
+func copyMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+
+	clone := make(map[string]string, len(m))
+	for k, v := range m {
+		clone[k] = v
+	}
+	return clone
 }
 
 type TraceResults struct {
-	Total    int
-	NextPage string
+	Total    int     `json:"total,omitempty"`
+	Results  []Trace `json:"results,omitempty"`
+	NextPage string  `json:"nextPage,omitempty"`
+
+	// Partial is set when at least one of the searched backends
+	// failed or timed out, so the results are incomplete.
+	Partial bool `json:"partial,omitempty"`
+	// Backends lists the outcome of the search on each backend
+	Backends []logs.BackendResult `json:"backends,omitempty"`
+}
+
+// Trace is a trace, or a summary of it when the backend's search doesn't return the spans
+type Trace struct {
+	TraceID string `json:"traceId"`
+	// RootService and RootOperation are the service and the operation of the root span
+	RootService   string `json:"rootService,omitempty"`
+	RootOperation string `json:"rootOperation,omitempty"`
+	// RFC3339 timestamp of the start of the earliest span
+	StartTime string `json:"startTime,omitempty"`
+	// Duration is the duration of the whole trace in microseconds
+	Duration int64  `json:"duration"`
+	Spans    []Span `json:"spans,omitempty"`
+}
+
+// GetStartTime returns the start time of the trace
+func (t Trace) GetStartTime() time.Time {
+	ts, err := time.Parse(time.RFC3339Nano, t.StartTime)
+	if err != nil {
+		return time.Time{}
+	}
+	return ts
+}
+
+// SetSummary fills the root service & operation, the start time and the duration from the spans
+func (t *Trace) SetSummary() {
+	if len(t.Spans) == 0 {
+		return
+	}
+
+	var start, end time.Time
+	for i, span := range t.Spans {
+		spanStart := span.GetStartTime()
+		spanEnd := spanStart.Add(time.Duration(span.Duration) * time.Microsecond)
+		if i == 0 || spanStart.Before(start) {
+			start = spanStart
+		}
+		if i == 0 || spanEnd.After(end) {
+			end = spanEnd
+		}
+
+		if span.ParentSpanID == "" && t.RootService == "" {
+			t.RootService, t.RootOperation = span.Service, span.Operation
+		}
+	}
+
+	t.StartTime = start.Format(time.RFC3339Nano)
+	t.Duration = end.Sub(start).Microseconds()
+}
+
+type Span struct {
+	TraceID      string `json:"traceId"`
+	SpanID       string `json:"spanId"`
+	ParentSpanID string `json:"parentSpanId,omitempty"`
+	Service      string `json:"service,omitempty"`
+	Operation    string `json:"operation,omitempty"`
+	// RFC3339 timestamp
+	StartTime string `json:"startTime"`
+	// Duration in microseconds
+	Duration   int64             `json:"duration"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Events     []SpanEvent       `json:"events,omitempty"`
+}
+
+// GetStartTime returns the start time of the span
+func (t Span) GetStartTime() time.Time {
+	ts, err := time.Parse(time.RFC3339Nano, t.StartTime)
+	if err != nil {
+		return time.Time{}
+	}
+	return ts
+}
+
+// SpanEvent is an event, or a log, recorded during a span
+type SpanEvent struct {
+	Name string `json:"name,omitempty"`
+	// RFC3339 timestamp
+	Time       string            `json:"timestamp"`
+	Attributes map[string]string `json:"attributes,omitempty"`
 }
 
+// SortTraces sorts the traces by their start time, newest first
+func SortTraces(traces []Trace) {
+	sort.SliceStable(traces, func(i, j int) bool {
+		return traces[i].GetStartTime().After(traces[j].GetStartTime())
+	})
+}
+
+// +kubebuilder:object:generate=false
 type TraceAPI interface {
-	Search(q TraceParams) (r TraceResults, err error)
+	// Search returns the traces that match the params, newest first
+	Search(ctx context.Context, q *TraceParams) (TraceResults, error)
+	// GetTrace returns the trace with all its spans, or nil if it isn't found
+	GetTrace(ctx context.Context, traceID string) (*Trace, error)
+	MatchRoute(q *TraceParams) (route logs.SearchRoute, match bool)
+}
+
+func NewTraceBackend(backendType string, api TraceAPI, common logs.CommonBackend) TraceBackend {
+	return TraceBackend{
+		Name:    common.Name,
+		Type:    backendType,
+		API:     api,
+		Timeout: common.GetTimeout(),
+	}
+}
+
+type TraceBackend struct {
+	// Name identifies the backend in the search results
+	Name string
+	// Type is the kind of the backend, e.g. jaeger, tempo, etc.
+	Type string
+	API  TraceAPI
+
+	// Timeout is the deadline for a single search on this backend.
+	// Zero means the server wide default is used.
+	Timeout time.Duration
 }
@@ -2,8 +2,12 @@ package cmd
 
 import (
 	"os"
+	"time"
 
+	"github.com/flanksource/apm-hub/api/logs"
 	"github.com/flanksource/apm-hub/db"
+	"github.com/flanksource/apm-hub/pkg"
+	"github.com/flanksource/apm-hub/pkg/resultcache"
 	"github.com/flanksource/commons/logger"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
@@ -22,6 +26,12 @@ var metricsPort int
 func ServerFlags(flags *pflag.FlagSet) {
 	flags.IntVar(&httpPort, "httpPort", 8080, "Port to expose the http server")
 	flags.IntVar(&metricsPort, "metricsPort", 8081, "Port to expose a health dashboard")
+	flags.DurationVar(&pkg.SearchTimeout, "search-timeout", time.Minute, "Overall deadline of a search request across all the backends")
+	flags.DurationVar(&pkg.BackendTimeout, "backend-timeout", 30*time.Second, "Default deadline of a search on a single backend")
+	flags.DurationVar(&pkg.TailHeartbeat, "tail-heartbeat", 15*time.Second, "Interval of the heartbeats sent to the tail clients")
+	flags.DurationVar(&logs.TailPollInterval, "tail-poll-interval", 5*time.Second, "Interval between the searches of the backends that are tailed by polling")
+	flags.IntVar(&resultcache.MaxEntries, "result-cache-entries", 1000, "Number of search results kept in memory for the backends with a cache")
+	flags.BoolVar(&resultcache.UsePostgres, "result-cache-postgres", false, "Share the cached search results between the instances of the server through the database")
 }
 
 func readFromEnv(v string) string {
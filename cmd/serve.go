@@ -8,9 +8,12 @@ import (
 	"github.com/flanksource/apm-hub/api/logs"
 	"github.com/flanksource/apm-hub/db"
 	"github.com/flanksource/apm-hub/pkg"
+	"github.com/flanksource/apm-hub/pkg/resultcache"
 	"github.com/flanksource/commons/logger"
 	"github.com/flanksource/kommons"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/cobra"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 
 	"github.com/labstack/echo/v4"
 )
@@ -27,6 +30,12 @@ func runServe(cmd *cobra.Command, configFiles []string) {
 		logger.Warnf("error getting the client from default k8s cluster: %v", err)
 	}
 
+	// The flags are parsed by now, unlike when the db was initialized
+	if err := db.Migrate(); err != nil {
+		logger.Fatalf("error running the db migrations: %v", err)
+	}
+	resultcache.Init()
+
 	if err := db.DeleteOldConfigFileBackends(); err != nil {
 		logger.Fatalf("error deleting old config file backends: %v", err)
 	}
@@ -46,11 +55,14 @@ func runServe(cmd *cobra.Command, configFiles []string) {
 			}
 		}
 	}
+
 	err = pkg.LoadGlobalBackends()
 	if err != nil {
 		logger.Fatalf("error loading backends: %v", err)
 	}
 	logger.Infof("loaded %d backends in total", len(logs.GlobalBackends))
+	logger.Infof("loaded %d trace backends in total", len(api.GlobalTraceBackends))
+	logger.Infof("loaded %d metrics backends in total", len(api.GlobalMetricsBackends))
 
 	server := SetupServer(kommonsClient)
 	addr := "0.0.0.0:" + strconv.Itoa(httpPort)
@@ -76,6 +88,13 @@ func SetupServer(kClient *kommons.Client) *echo.Echo {
 	})
 
 	e.POST("/search", pkg.Search)
+	e.GET("/tail", pkg.Tail)
+	e.POST("/traces/search", pkg.SearchTraces)
+	e.GET("/traces/:id", pkg.GetTrace)
+	e.GET("/traces/:id/logs", pkg.TraceLogs)
+	e.POST("/metrics/query", pkg.QueryMetrics)
+	// The metrics of the server itself, e.g. of the kubernetes log cache
+	e.GET("/metrics", echo.WrapHandler(promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{})))
 
 	return e
 }
@@ -57,11 +57,5 @@ func Init(connection string) error {
 		return err
 	}
 
-	if runMigrations {
-		if err = duty.Migrate(connection, nil); err != nil {
-			return err
-		}
-	}
-
 	return nil
 }
@@ -0,0 +1,44 @@
+package db
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+
+	"github.com/flanksource/commons/logger"
+	"github.com/flanksource/duty"
+)
+
+// migrations are the scripts of the tables of apm-hub, run in the order of their names after the ones of duty
+//
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Migrate runs the migrations if they're enabled by the flags
+func Migrate() error {
+	if !runMigrations {
+		return nil
+	}
+
+	if err := duty.Migrate(ConnectionString, nil); err != nil {
+		return err
+	}
+
+	files, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		script, err := migrations.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		logger.Tracef("Running script %s", file)
+		if err := gormDB.Exec(string(script)).Error; err != nil {
+			return fmt.Errorf("error running the migration %s: %w", file, err)
+		}
+	}
+	return nil
+}
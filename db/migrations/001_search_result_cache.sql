@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS search_result_cache (
+  key TEXT PRIMARY KEY,
+  results BYTEA NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,45 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// SearchResult is the cached results of a search, shared by the instances of the server
+type SearchResult struct {
+	Key       string `gorm:"primaryKey"`
+	Results   []byte
+	ExpiresAt time.Time
+}
+
+// searchResultCacheTable is created by the migrations
+const searchResultCacheTable = "search_result_cache"
+
+// GetSearchResult returns the cached results of the search with the key, nil if they aren't cached or have expired
+func GetSearchResult(ctx context.Context, key string) (*SearchResult, error) {
+	var results []SearchResult
+	err := gormDB.WithContext(ctx).Table(searchResultCacheTable).
+		Where("key = ? AND expires_at > ?", key, time.Now()).
+		Limit(1).
+		Find(&results).Error
+	if err != nil || len(results) == 0 {
+		return nil, err
+	}
+	return &results[0], nil
+}
+
+// PersistSearchResult caches the results of a search, replacing the ones of the same key
+func PersistSearchResult(ctx context.Context, result SearchResult) error {
+	return gormDB.WithContext(ctx).Table(searchResultCacheTable).
+		Clauses(clause.OnConflict{UpdateAll: true}).
+		Create(&result).Error
+}
+
+// DeleteExpiredSearchResults deletes the cached results that have expired
+func DeleteExpiredSearchResults(ctx context.Context) error {
+	return gormDB.WithContext(ctx).Table(searchResultCacheTable).
+		Where("expires_at <= ?", time.Now()).
+		Delete(&SearchResult{}).Error
+}
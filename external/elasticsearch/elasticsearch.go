@@ -1,6 +1,7 @@
 package elasticsearch
 
 import (
+	"encoding/json"
 	"fmt"
 
 	"github.com/flanksource/apm-hub/api/logs"
@@ -10,6 +11,13 @@ import (
 	"github.com/jeremywohl/flatten"
 )
 
+// CacheRequest is the search request sent to an index, which the results of the search are cached by
+type CacheRequest struct {
+	Index string
+	Size  int64
+	Body  json.RawMessage
+}
+
 type TotalHitsInfo struct {
 	Value    int64  `json:"value"`
 	Relation string `json:"relation"`
@@ -86,12 +94,21 @@ func (t *HitsInfo) GetResultsFromHits(requestedRowsCount int64, msgField, timest
 			logger.Errorf("error extracting labels: %v", err)
 		}
 
+		// The sort values of a hit are used with search_after to resume right after it
+		var cursor string
+		if len(row.Sort) != 0 {
+			if cursor, err = utils.Stringify(row.Sort); err != nil {
+				logger.Debugf("error stringifying sort: %v", err)
+			}
+		}
+
 		var timestamp, _ = row.Source[timestampField].(string)
 		resp = append(resp, logs.Result{
 			Id:      row.ID,
 			Message: msg,
 			Time:    timestamp,
-			Labels:  collections.MergeMap(labelsToAttach, labels),
+			Labels:  collections.MergeMap(collections.MergeMap(nil, labelsToAttach), labels),
+			Cursor:  cursor,
 		})
 	}
 
@@ -0,0 +1,156 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+// ToQuery compiles a query expression into an Elasticsearch bool query.
+func ToQuery(expr logs.QueryExpr, fields logs.ElasticSearchFields) map[string]any {
+	switch e := expr.(type) {
+	case logs.QueryAnd:
+		return boolQuery("filter", toQueries(e.Exprs, fields))
+	case logs.QueryOr:
+		q := boolQuery("should", toQueries(e.Exprs, fields))
+		q["bool"].(map[string]any)["minimum_should_match"] = 1
+		return q
+	case logs.QueryNot:
+		return boolQuery("must_not", []any{ToQuery(e.Expr, fields)})
+	case logs.QueryTerm:
+		return termQuery(e, fields)
+	}
+
+	return map[string]any{"match_all": map[string]any{}}
+}
+
+// AddQueryFilter adds the query expression as a filter to the query of the rendered request body.
+func AddQueryFilter(body []byte, expr logs.QueryExpr, fields logs.ElasticSearchFields) ([]byte, error) {
+	if expr == nil {
+		return body, nil
+	}
+
+	request := make(map[string]any)
+	if len(strings.TrimSpace(string(body))) != 0 {
+		if err := json.Unmarshal(body, &request); err != nil {
+			return nil, fmt.Errorf("error parsing the request body: %w", err)
+		}
+	}
+
+	filter := []any{ToQuery(expr, fields)}
+	if existing, ok := request["query"]; ok {
+		filter = append([]any{existing}, filter...)
+	}
+	request["query"] = boolQuery("filter", filter)
+
+	return json.Marshal(request)
+}
+
+// TailRequest changes the rendered request body to return the hits after the given sort values, oldest first,
+// so that the new hits can be polled for.
+func TailRequest(body []byte, fields logs.ElasticSearchFields, searchAfter string) ([]byte, error) {
+	request := make(map[string]any)
+	if len(strings.TrimSpace(string(body))) != 0 {
+		if err := json.Unmarshal(body, &request); err != nil {
+			return nil, fmt.Errorf("error parsing the request body: %w", err)
+		}
+	}
+
+	timestampField := fields.Timestamp
+	if timestampField == "" {
+		timestampField = "@timestamp"
+	}
+	request["sort"] = []any{
+		map[string]any{timestampField: map[string]any{"order": "asc", "unmapped_type": "boolean"}},
+	}
+
+	delete(request, "search_after")
+	if searchAfter != "" {
+		// The sort values are kept as they are, as large numbers lose their precision as floats
+		var values []json.RawMessage
+		if err := json.Unmarshal([]byte(searchAfter), &values); err != nil {
+			return nil, fmt.Errorf("invalid search_after %q: %w", searchAfter, err)
+		}
+		request["search_after"] = values
+	}
+
+	return json.Marshal(request)
+}
+
+func toQueries(exprs []logs.QueryExpr, fields logs.ElasticSearchFields) []any {
+	queries := make([]any, 0, len(exprs))
+	for _, e := range exprs {
+		queries = append(queries, ToQuery(e, fields))
+	}
+	return queries
+}
+
+func boolQuery(occur string, queries []any) map[string]any {
+	return map[string]any{
+		"bool": map[string]any{occur: queries},
+	}
+}
+
+func termQuery(term logs.QueryTerm, fields logs.ElasticSearchFields) map[string]any {
+	field := term.GetField()
+	switch field {
+	case logs.QueryFieldMessage:
+		if fields.Message != "" {
+			field = fields.Message
+		}
+	case logs.QueryFieldTimestamp:
+		if fields.Timestamp != "" {
+			field = fields.Timestamp
+		}
+	case logs.QueryFieldID:
+		field = "_id"
+	}
+
+	switch term.Op {
+	case logs.QueryOpEquals:
+		return map[string]any{"term": map[string]any{field: term.Value}}
+	case logs.QueryOpNotEquals:
+		return boolQuery("must_not", []any{map[string]any{"term": map[string]any{field: term.Value}}})
+	case logs.QueryOpRegex:
+		return map[string]any{"regexp": map[string]any{field: toAnchoredRegex(term.Value)}}
+	case logs.QueryOpGreater:
+		return rangeQuery(field, "gt", term)
+	case logs.QueryOpGreaterEqual:
+		return rangeQuery(field, "gte", term)
+	case logs.QueryOpLess:
+		return rangeQuery(field, "lt", term)
+	case logs.QueryOpLessEqual:
+		return rangeQuery(field, "lte", term)
+	default:
+		return map[string]any{"match_phrase": map[string]any{field: term.Value}}
+	}
+}
+
+// toAnchoredRegex converts an unanchored regular expression to the
+// Lucene syntax, where the expression always matches the whole value.
+func toAnchoredRegex(pattern string) string {
+	if strings.HasPrefix(pattern, "^") {
+		pattern = pattern[1:]
+	} else {
+		pattern = ".*" + pattern
+	}
+
+	if strings.HasSuffix(pattern, "$") && !strings.HasSuffix(pattern, `\$`) {
+		pattern = pattern[:len(pattern)-1]
+	} else {
+		pattern += ".*"
+	}
+
+	return pattern
+}
+
+func rangeQuery(field, op string, term logs.QueryTerm) map[string]any {
+	var value any = term.Value
+	if term.IsNumeric() {
+		value = json.Number(term.Value)
+	}
+
+	return map[string]any{"range": map[string]any{field: map[string]any{op: value}}}
+}
@@ -0,0 +1,110 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+func TestAddQueryFilter(t *testing.T) {
+	fields := logs.ElasticSearchFields{Message: "log.message", Timestamp: "@timestamp"}
+
+	tests := []struct {
+		name  string
+		body  string
+		query string
+		want  string
+	}{
+		{
+			name:  "no query",
+			body:  `{"size":10}`,
+			query: "",
+			want:  `{"size":10}`,
+		},
+		{
+			name:  "empty body",
+			body:  "",
+			query: `"connection refused"`,
+			want:  `{"query":{"bool":{"filter":[{"match_phrase":{"log.message":"connection refused"}}]}}}`,
+		},
+		{
+			name:  "combined with the template query",
+			body:  `{"query":{"match_all":{}},"sort":["@timestamp"]}`,
+			query: "pod=api-0 AND (status>=500 OR NOT level:info) path:/\\.php$/",
+			want: `{"query":{"bool":{"filter":[{"match_all":{}},{"bool":{"filter":[` +
+				`{"term":{"pod":"api-0"}},` +
+				`{"bool":{"minimum_should_match":1,"should":[{"range":{"status":{"gte":500}}},{"bool":{"must_not":[{"match_phrase":{"level":"info"}}]}}]}},` +
+				`{"regexp":{"path":".*\\.php"}}` +
+				`]}}]}},"sort":["@timestamp"]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := logs.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("error parsing query: %v", err)
+			}
+
+			got, err := AddQueryFilter([]byte(tt.body), expr, fields)
+			if err != nil {
+				t.Fatalf("AddQueryFilter() error = %v", err)
+			}
+
+			if !jsonEqual(t, string(got), tt.want) {
+				t.Errorf("AddQueryFilter() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTailRequest(t *testing.T) {
+	fields := logs.ElasticSearchFields{Timestamp: "time"}
+	body := `{"search_after":[1],"sort":[{"time":{"order":"desc"}}],"query":{"match_all":{}}}`
+
+	tests := []struct {
+		name        string
+		searchAfter string
+		want        string
+	}{
+		{
+			name: "first poll",
+			want: `{"sort":[{"time":{"order":"asc","unmapped_type":"boolean"}}],"query":{"match_all":{}}}`,
+		},
+		{
+			name:        "after a hit",
+			searchAfter: `[1678363751828]`,
+			want:        `{"search_after":[1678363751828],"sort":[{"time":{"order":"asc","unmapped_type":"boolean"}}],"query":{"match_all":{}}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := TailRequest([]byte(body), fields, tt.searchAfter)
+			if err != nil {
+				t.Fatalf("TailRequest() error = %v", err)
+			}
+
+			if !jsonEqual(t, string(got), tt.want) {
+				t.Errorf("TailRequest() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func jsonEqual(t *testing.T, a, b string) bool {
+	t.Helper()
+
+	var aVal, bVal any
+	if err := json.Unmarshal([]byte(a), &aVal); err != nil {
+		t.Fatalf("invalid json %s: %v", a, err)
+	}
+	if err := json.Unmarshal([]byte(b), &bVal); err != nil {
+		t.Fatalf("invalid json %s: %v", b, err)
+	}
+
+	aData, _ := json.Marshal(aVal)
+	bData, _ := json.Marshal(bVal)
+	return string(aData) == string(bData)
+}
@@ -0,0 +1,151 @@
+package cloudwatch
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+)
+
+// Client is the part of the CloudWatch Logs API the backend uses
+type Client interface {
+	cloudwatchlogs.DescribeLogGroupsAPIClient
+	StartQuery(ctx context.Context, params *cloudwatchlogs.StartQueryInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.StartQueryOutput, error)
+	GetQueryResults(ctx context.Context, params *cloudwatchlogs.GetQueryResultsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.GetQueryResultsOutput, error)
+	StopQuery(ctx context.Context, params *cloudwatchlogs.StopQueryInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.StopQueryOutput, error)
+}
+
+// Target is an account and region whose log groups are searched
+type Target struct {
+	Region string
+	// AccountID is set for an account linked through cross-account observability,
+	// whose log groups are queried by their ARN
+	AccountID string
+	Client    Client
+}
+
+// String returns the region of the target, along with its account if it's linked
+func (t Target) String() string {
+	if t.AccountID == "" {
+		return t.Region
+	}
+	return t.AccountID + "/" + t.Region
+}
+
+// discoveryInterval is how long the log groups discovered in a target are searched before being discovered again
+const discoveryInterval = 5 * time.Minute
+
+// maxQueryLogGroups is the maximum number of log groups an Insights query can search
+const maxQueryLogGroups = 50
+
+// target discovers the log groups of a Target
+type target struct {
+	Target
+
+	lock         sync.Mutex
+	discovered   []string
+	discoveredAt time.Time
+}
+
+// identifier returns how a query refers to the log group with the given name
+func (t *target) identifier(name string) string {
+	if t.AccountID == "" {
+		return name
+	}
+	return fmt.Sprintf("arn:%s:logs:%s:%s:log-group:%s", partition(t.Region), t.Region, t.AccountID, name)
+}
+
+// discover returns the log groups of the target matching the prefixes and patterns.
+// They're discovered again once the previous ones are older than the discovery interval.
+func (t *target) discover(ctx context.Context, prefixes, patterns []string) ([]string, error) {
+	if len(prefixes) == 0 && len(patterns) == 0 {
+		return nil, nil
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if !t.discoveredAt.IsZero() && time.Since(t.discoveredAt) < discoveryInterval {
+		return t.discovered, nil
+	}
+
+	// A prefix and a pattern can't be given together, so each one is listed on its own
+	var inputs []*cloudwatchlogs.DescribeLogGroupsInput
+	for _, prefix := range prefixes {
+		inputs = append(inputs, &cloudwatchlogs.DescribeLogGroupsInput{LogGroupNamePrefix: ptr(prefix)})
+	}
+	for _, pattern := range patterns {
+		inputs = append(inputs, &cloudwatchlogs.DescribeLogGroupsInput{LogGroupNamePattern: ptr(pattern)})
+	}
+
+	var discovered []string
+	for _, input := range inputs {
+		if t.AccountID != "" {
+			input.IncludeLinkedAccounts = ptr(true)
+			input.AccountIdentifiers = []string{t.AccountID}
+		}
+
+		paginator := cloudwatchlogs.NewDescribeLogGroupsPaginator(t.Client, input)
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("error listing the log groups of %s: %w", t, err)
+			}
+
+			for _, group := range page.LogGroups {
+				if t.AccountID == "" {
+					discovered = append(discovered, deref(group.LogGroupName))
+				} else {
+					// The ARN of a log group ends with :*, which the queries don't take
+					discovered = append(discovered, strings.TrimSuffix(deref(group.Arn), ":*"))
+				}
+			}
+		}
+	}
+
+	t.discovered, t.discoveredAt = unique(discovered), time.Now()
+	return t.discovered, nil
+}
+
+// partition returns the AWS partition of the region
+func partition(region string) string {
+	switch {
+	case strings.HasPrefix(region, "cn-"):
+		return "aws-cn"
+	case strings.HasPrefix(region, "us-gov-"):
+		return "aws-us-gov"
+	default:
+		return "aws"
+	}
+}
+
+// unique returns the sorted values without the empty and duplicate ones
+func unique(values []string) []string {
+	set := make(map[string]struct{}, len(values))
+	list := make([]string, 0, len(values))
+	for _, value := range values {
+		if _, ok := set[value]; ok || value == "" {
+			continue
+		}
+		set[value] = struct{}{}
+		list = append(list, value)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// chunk splits the log groups into lists a query can search
+func chunk(logGroups []string) [][]string {
+	var chunks [][]string
+	for len(logGroups) > maxQueryLogGroups {
+		chunks = append(chunks, logGroups[:maxQueryLogGroups])
+		logGroups = logGroups[maxQueryLogGroups:]
+	}
+	if len(logGroups) > 0 {
+		chunks = append(chunks, logGroups)
+	}
+	return chunks
+}
@@ -0,0 +1,105 @@
+package cloudwatch
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+// toFilter compiles a query expression into the expression of a
+// CloudWatch Logs Insights filter command.
+func toFilter(expr logs.QueryExpr) string {
+	switch e := expr.(type) {
+	case logs.QueryAnd:
+		return joinFilters(e.Exprs, " and ")
+	case logs.QueryOr:
+		return joinFilters(e.Exprs, " or ")
+	case logs.QueryNot:
+		return "not (" + toFilter(e.Expr) + ")"
+	case logs.QueryTerm:
+		return termFilter(e)
+	}
+
+	return ""
+}
+
+// addFilter prepends a filter command for the query expression to the insights query
+func addFilter(query string, expr logs.QueryExpr) string {
+	if expr == nil {
+		return query
+	}
+
+	filter := "filter " + toFilter(expr)
+	if strings.TrimSpace(query) == "" {
+		return filter
+	}
+
+	return filter + " | " + query
+}
+
+// labelFields are the fields of the events the results are labelled with
+const labelFields = "fields @logStream, @log"
+
+// addLabelFields prepends the fields command of the labels of the results to the insights query
+func addLabelFields(query string) string {
+	if strings.TrimSpace(query) == "" {
+		return labelFields
+	}
+
+	return labelFields + " | " + query
+}
+
+// addSort appends a sort command of the events in the order of the search to the insights query,
+// so the limit of the query keeps the events at the start of that order
+func addSort(query string, order string) string {
+	if order != logs.OrderAscending {
+		order = logs.OrderDescending
+	}
+
+	sort := "sort @timestamp " + order
+	if strings.TrimSpace(query) == "" {
+		return sort
+	}
+
+	return query + " | " + sort
+}
+
+func joinFilters(exprs []logs.QueryExpr, sep string) string {
+	filters := make([]string, 0, len(exprs))
+	for _, e := range exprs {
+		filters = append(filters, toFilter(e))
+	}
+	return "(" + strings.Join(filters, sep) + ")"
+}
+
+func termFilter(term logs.QueryTerm) string {
+	field := term.GetField()
+	switch field {
+	case logs.QueryFieldMessage:
+		field = "@message"
+	case logs.QueryFieldTimestamp:
+		field = "@timestamp"
+	case logs.QueryFieldID:
+		field = "@ptr"
+	default:
+		field = "`" + strings.ReplaceAll(field, "`", "") + "`"
+	}
+
+	value := strconv.Quote(term.Value)
+	switch term.Op {
+	case logs.QueryOpContains:
+		return field + " like " + value
+	case logs.QueryOpRegex:
+		return field + " like /" + term.Value + "/"
+	case logs.QueryOpNotEquals:
+		return field + " != " + value
+	case logs.QueryOpGreater, logs.QueryOpGreaterEqual, logs.QueryOpLess, logs.QueryOpLessEqual:
+		if term.IsNumeric() {
+			value = term.Value
+		}
+		return field + " " + string(term.Op) + " " + value
+	default:
+		return field + " = " + value
+	}
+}
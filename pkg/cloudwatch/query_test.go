@@ -0,0 +1,62 @@
+package cloudwatch
+
+import (
+	"testing"
+
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+func TestAddFilter(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{
+			query: "",
+			want:  "fields @timestamp, @message | sort @timestamp desc",
+		},
+		{
+			query: `"connection refused"`,
+			want:  `filter @message like "connection refused" | fields @timestamp, @message | sort @timestamp desc`,
+		},
+		{
+			query: `level=error status>=500 NOT pod:/^worker-/`,
+			want:  "filter (`level` = \"error\" and `status` >= 500 and not (`pod` like /^worker-/)) | fields @timestamp, @message | sort @timestamp desc",
+		},
+		{
+			query: `timeout OR id!=abc`,
+			want:  `filter (@message like "timeout" or @ptr != "abc") | fields @timestamp, @message | sort @timestamp desc`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			expr, err := logs.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("error parsing query: %v", err)
+			}
+
+			if got := addFilter("fields @timestamp, @message | sort @timestamp desc", expr); got != tt.want {
+				t.Errorf("addFilter() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddSort(t *testing.T) {
+	tests := []struct {
+		query string
+		order string
+		want  string
+	}{
+		{query: "", order: logs.OrderDescending, want: "sort @timestamp desc"},
+		{query: "fields @logStream, @log", order: "", want: "fields @logStream, @log | sort @timestamp desc"},
+		{query: "fields @logStream, @log | sort @timestamp desc", order: logs.OrderAscending, want: "fields @logStream, @log | sort @timestamp desc | sort @timestamp asc"},
+	}
+
+	for _, tt := range tests {
+		if got := addSort(tt.query, tt.order); got != tt.want {
+			t.Errorf("addSort(%q, %q) = %s, want %s", tt.query, tt.order, got, tt.want)
+		}
+	}
+}
@@ -1,65 +1,259 @@
 package cloudwatch
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
 	"github.com/flanksource/apm-hub/api/logs"
+	"github.com/flanksource/apm-hub/pkg/resultcache"
+	"github.com/flanksource/commons/collections"
+	"github.com/flanksource/commons/logger"
+	"golang.org/x/sync/errgroup"
 )
 
-func NewCloudWatchSearchBackend(config *logs.CloudWatchBackendConfig, client *cloudwatchlogs.Client) *cloudWatchSearch {
-	return &cloudWatchSearch{
-		client: client,
+func NewCloudWatchSearchBackend(config *logs.CloudWatchBackendConfig, targets []Target) (*cloudWatchSearch, error) {
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no account or region to search")
+	}
+
+	if config.LogGroup == "" && len(config.LogGroups) == 0 && len(config.LogGroupPrefixes) == 0 &&
+		len(config.LogGroupPatterns) == 0 && config.LogGroupTemplate == "" {
+		return nil, fmt.Errorf("no log groups to search")
+	}
+
+	search := &cloudWatchSearch{
 		config: config,
+		cache:  resultcache.New("cloudwatch", config, config.Cache),
 	}
+
+	if config.LogGroupTemplate != "" {
+		template, err := template.New("log_group").Parse(config.LogGroupTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing template: %w", err)
+		}
+		search.logGroup = template
+	}
+
+	for _, t := range targets {
+		search.targets = append(search.targets, &target{Target: t})
+	}
+
+	return search, nil
 }
 
 type cloudWatchSearch struct {
-	client *cloudwatchlogs.Client
-	config *logs.CloudWatchBackendConfig
+	targets []*target
+	config  *logs.CloudWatchBackendConfig
+	// logGroup selects the log group to search from the search params
+	logGroup *template.Template
+	cache    *resultcache.Cache
 }
 
-func (t *cloudWatchSearch) MatchRoute(q *logs.SearchParams) (match bool, isAdditive bool) {
+func (t *cloudWatchSearch) MatchRoute(q *logs.SearchParams) (route logs.SearchRoute, match bool) {
 	return t.config.CommonBackend.Routes.MatchRoute(q)
 }
 
-func (t *cloudWatchSearch) Search(q *logs.SearchParams) (logs.SearchResults, error) {
-	logFilter := &cloudwatchlogs.StartQueryInput{
-		LogGroupName: &t.config.LogGroup,
-		Limit:        ptr(int32(q.Limit)),
-		QueryString:  &t.config.Query,
+// maxQueryLimit is the maximum number of log events a query can return
+const maxQueryLimit = 10000
+
+// insightsQuery is a query of log groups of a target
+type insightsQuery struct {
+	target *target
+	input  *cloudwatchlogs.StartQueryInput
+}
+
+func (t *cloudWatchSearch) Search(ctx context.Context, q *logs.SearchParams) (logs.SearchResults, error) {
+	var result logs.SearchResults
+
+	// Insights queries can't be paginated, so the page token is the
+	// number of events to skip from the start of the merged query results.
+	var offset int
+	if q.Page != "" {
+		var err error
+		if offset, err = strconv.Atoi(q.Page); err != nil || offset < 0 {
+			return result, fmt.Errorf("invalid page token %q", q.Page)
+		}
 	}
 
-	if q.GetStart() != nil {
-		logFilter.StartTime = ptr(q.GetStart().UnixMilli())
+	query, err := q.GetQuery()
+	if err != nil {
+		return result, fmt.Errorf("error parsing query: %w", err)
+	}
+
+	logGroup, err := t.renderLogGroup(q)
+	if err != nil {
+		return result, err
+	}
+
+	limit := offset + int(q.Limit)
+	if limit > maxQueryLimit {
+		limit = maxQueryLimit
 	}
 
+	var startTime, endTime *int64
+	if q.GetStart() != nil {
+		startTime = ptr(q.GetStart().UnixMilli())
+	}
 	if q.GetEnd() != nil {
-		logFilter.EndTime = ptr(q.GetEnd().UnixMilli())
+		endTime = ptr(q.GetEnd().UnixMilli())
 	} else {
-		logFilter.EndTime = ptr(time.Now().UnixMilli()) // end time is a required field
+		endTime = ptr(time.Now().UnixMilli()) // end time is a required field
 	}
 
-	var result logs.SearchResults
-	queryOutput, err := t.client.StartQuery(context.Background(), logFilter)
+	var queries []insightsQuery
+	for _, target := range t.targets {
+		logGroups, err := t.getLogGroups(ctx, target, logGroup)
+		if err != nil {
+			return result, err
+		}
+
+		for _, logGroups := range chunk(logGroups) {
+			input := &cloudwatchlogs.StartQueryInput{
+				Limit:       ptr(int32(limit)),
+				QueryString: ptr(addSort(addLabelFields(addFilter(t.config.Query, query)), q.Order)),
+				StartTime:   startTime,
+				EndTime:     endTime,
+			}
+			if target.AccountID == "" {
+				input.LogGroupNames = logGroups
+			} else {
+				input.LogGroupIdentifiers = logGroups
+			}
+			queries = append(queries, insightsQuery{target: target, input: input})
+		}
+	}
+	if len(queries) == 0 {
+		return result, fmt.Errorf("no log groups found")
+	}
+
+	// The results depend on the region of the queries and the offset too, which aren't part of the query inputs
+	rendered := struct {
+		Targets []string
+		Inputs  []*cloudwatchlogs.StartQueryInput
+		Offset  int
+	}{Offset: offset}
+	for _, query := range queries {
+		rendered.Targets = append(rendered.Targets, query.target.String())
+		rendered.Inputs = append(rendered.Inputs, query.input)
+	}
+
+	return t.cache.Search(ctx, q, rendered, func() (logs.SearchResults, error) {
+		return t.search(ctx, q, queries, offset, limit)
+	})
+}
+
+// renderLogGroup returns the log group the search params select, if any
+func (t *cloudWatchSearch) renderLogGroup(q *logs.SearchParams) (string, error) {
+	if t.logGroup == nil {
+		return "", nil
+	}
+
+	var buf bytes.Buffer
+	if err := t.logGroup.Execute(&buf, q); err != nil {
+		return "", fmt.Errorf("error executing template: %w", err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// getLogGroups returns the log groups to search in the target.
+// The log group selected by the search params is the only one searched, else the configured and discovered ones are.
+func (t *cloudWatchSearch) getLogGroups(ctx context.Context, target *target, logGroup string) ([]string, error) {
+	if logGroup != "" {
+		return []string{target.identifier(logGroup)}, nil
+	}
+
+	logGroups, err := target.discover(ctx, t.config.LogGroupPrefixes, t.config.LogGroupPatterns)
 	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range append([]string{t.config.LogGroup}, t.config.LogGroups...) {
+		if name != "" {
+			logGroups = append(logGroups, target.identifier(name))
+		}
+	}
+	return unique(logGroups), nil
+}
+
+// search runs the queries concurrently and returns their merged events from the offset
+func (t *cloudWatchSearch) search(ctx context.Context, q *logs.SearchParams, queries []insightsQuery, offset, limit int) (logs.SearchResults, error) {
+	var result logs.SearchResults
+
+	lists := make([][]logs.Result, len(queries))
+	totals := make([]int, len(queries))
+	group, ctx := errgroup.WithContext(ctx)
+	for i, query := range queries {
+		i, query := i, query
+		group.Go(func() error {
+			events, total, err := t.query(ctx, query)
+			if err != nil {
+				return fmt.Errorf("error querying the log groups of %s: %w", query.target, err)
+			}
+			lists[i], totals[i] = events, total
+			return nil
+		})
+	}
+	if err := group.Wait(); err != nil {
 		return result, err
 	}
 
-	queryResult, err := t.getQueryResults(queryOutput.QueryId)
+	// A query returning as many events as its limit might have more
+	var more bool
+	for i, events := range lists {
+		result.Total += totals[i]
+		if len(events) == limit && limit < maxQueryLimit {
+			more = true
+		}
+	}
+
+	merged, _ := logs.MergeResults(q.Order, 0, lists...)
+	if len(merged) > limit {
+		merged, more = merged[:limit], true
+	}
+
+	result.Results = make([]logs.Result, 0, len(merged))
+	for i := offset; i < len(merged); i++ {
+		event := merged[i]
+		event.Cursor = strconv.Itoa(i + 1)
+		result.Results = append(result.Results, event)
+	}
+
+	if more {
+		result.NextPage = strconv.Itoa(limit)
+	}
+
+	return result, nil
+}
+
+// query runs the Insights query and returns its events along with the number of records it matched
+func (t *cloudWatchSearch) query(ctx context.Context, query insightsQuery) ([]logs.Result, int, error) {
+	queryOutput, err := query.target.Client.StartQuery(ctx, query.input)
 	if err != nil {
-		return result, err
+		return nil, 0, err
 	}
 
-	result.Total = int(queryResult.Statistics.RecordsMatched)
+	queryResult, err := t.getQueryResults(ctx, query.target, queryOutput.QueryId)
+	if err != nil {
+		return nil, 0, err
+	}
 
-	result.Results = make([]logs.Result, 0, len(queryResult.Results))
+	var total int
+	if queryResult.Statistics != nil {
+		total = int(queryResult.Statistics.RecordsMatched)
+	}
+
+	events := make([]logs.Result, 0, len(queryResult.Results))
 	for _, fields := range queryResult.Results {
 		var event = logs.Result{
-			Labels: t.config.Labels,
+			// Copy the configured labels as the fields are added to the event labels
+			Labels: collections.MergeMap(nil, t.config.Labels),
 		}
 
 		for _, field := range fields {
@@ -77,20 +271,25 @@ func (t *cloudWatchSearch) Search(q *logs.SearchParams) (logs.SearchResults, err
 			}
 		}
 
-		result.Results = append(result.Results, event)
+		events = append(events, event)
 	}
 
-	return result, nil
+	return events, total, nil
 }
 
-func (t *cloudWatchSearch) getQueryResults(queryID *string) (*cloudwatchlogs.GetQueryResultsOutput, error) {
+// getQueryResults polls the query until it's complete.
+// If the context is done before that, the query is stopped.
+func (t *cloudWatchSearch) getQueryResults(ctx context.Context, target *target, queryID *string) (*cloudwatchlogs.GetQueryResultsOutput, error) {
 	input := &cloudwatchlogs.GetQueryResultsInput{
 		QueryId: queryID,
 	}
 
 	for {
-		resp, err := t.client.GetQueryResults(context.Background(), input)
+		resp, err := target.Client.GetQueryResults(ctx, input)
 		if err != nil {
+			if ctx.Err() != nil {
+				t.stopQuery(target, queryID)
+			}
 			return nil, err
 		}
 
@@ -106,11 +305,27 @@ func (t *cloudWatchSearch) getQueryResults(queryID *string) (*cloudwatchlogs.Get
 		default:
 			// Might be scheduling or running.
 			// Wait before retrying.
-			time.Sleep(time.Second)
+			select {
+			case <-ctx.Done():
+				t.stopQuery(target, queryID)
+				return nil, ctx.Err()
+			case <-time.After(time.Second):
+			}
 		}
 	}
 }
 
+// stopQuery stops a running query so it doesn't keep
+// scanning the log group after the search was abandoned.
+func (t *cloudWatchSearch) stopQuery(target *target, queryID *string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := target.Client.StopQuery(ctx, &cloudwatchlogs.StopQueryInput{QueryId: queryID}); err != nil {
+		logger.Warnf("error stopping cloudwatch query %s: %v", deref(queryID), err)
+	}
+}
+
 // timestamp layout returned by Cloudwatch
 const timestampLayout = "2006-01-02 15:04:05.000"
 
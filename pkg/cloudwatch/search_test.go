@@ -0,0 +1,189 @@
+package cloudwatch
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+// fakeClient serves the log groups and events of a region, with its requests recorded
+type fakeClient struct {
+	lock      sync.Mutex
+	logGroups []string
+	// events are the timestamp and log stream of the events every query returns
+	events    [][2]string
+	describes []*cloudwatchlogs.DescribeLogGroupsInput
+	queries   []*cloudwatchlogs.StartQueryInput
+}
+
+func (f *fakeClient) DescribeLogGroups(ctx context.Context, input *cloudwatchlogs.DescribeLogGroupsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.DescribeLogGroupsOutput, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.describes = append(f.describes, input)
+
+	var output cloudwatchlogs.DescribeLogGroupsOutput
+	for _, name := range f.logGroups {
+		if strings.HasPrefix(name, deref(input.LogGroupNamePrefix)) && strings.Contains(strings.ToLower(name), strings.ToLower(deref(input.LogGroupNamePattern))) {
+			arn := fmt.Sprintf("arn:aws:logs:us-east-1:%s:log-group:%s:*", strings.Join(input.AccountIdentifiers, ""), name)
+			output.LogGroups = append(output.LogGroups, types.LogGroup{LogGroupName: ptr(name), Arn: ptr(arn)})
+		}
+	}
+	return &output, nil
+}
+
+func (f *fakeClient) StartQuery(ctx context.Context, input *cloudwatchlogs.StartQueryInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.StartQueryOutput, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.queries = append(f.queries, input)
+	return &cloudwatchlogs.StartQueryOutput{QueryId: ptr(fmt.Sprint(len(f.queries) - 1))}, nil
+}
+
+func (f *fakeClient) GetQueryResults(ctx context.Context, input *cloudwatchlogs.GetQueryResultsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.GetQueryResultsOutput, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	var query *cloudwatchlogs.StartQueryInput
+	for i, q := range f.queries {
+		if fmt.Sprint(i) == deref(input.QueryId) {
+			query = q
+		}
+	}
+
+	output := &cloudwatchlogs.GetQueryResultsOutput{
+		Status:     types.QueryStatusComplete,
+		Statistics: &types.QueryStatistics{RecordsMatched: float64(len(f.events))},
+	}
+	for i, event := range f.events {
+		if i == int(deref(query.Limit)) {
+			break
+		}
+		output.Results = append(output.Results, []types.ResultField{
+			{Field: ptr("@timestamp"), Value: ptr(event[0])},
+			{Field: ptr("@message"), Value: ptr("message")},
+			{Field: ptr("@logStream"), Value: ptr(event[1])},
+			{Field: ptr("@log"), Value: ptr("123456789012:" + query.LogGroupNames[0])},
+		})
+	}
+	return output, nil
+}
+
+func (f *fakeClient) StopQuery(ctx context.Context, input *cloudwatchlogs.StopQueryInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.StopQueryOutput, error) {
+	return &cloudwatchlogs.StopQueryOutput{}, nil
+}
+
+func TestGetLogGroups(t *testing.T) {
+	client := &fakeClient{logGroups: []string{"/aws/eks/dev/cluster", "/aws/eks/prod/cluster", "/aws/lambda/Checkout"}}
+	search, err := NewCloudWatchSearchBackend(&logs.CloudWatchBackendConfig{
+		LogGroup:         "/aws/eks/dev/cluster",
+		LogGroups:        []string{"/custom"},
+		LogGroupPrefixes: []string{"/aws/eks/"},
+		LogGroupPatterns: []string{"checkout"},
+		LogGroupTemplate: "{{if .Id}}/aws/eks/{{.Id}}/cluster{{end}}",
+	}, []Target{{Region: "us-east-1", Client: client}, {Region: "us-east-1", AccountID: "210987654321", Client: client}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, linked := search.targets[0], search.targets[1]
+
+	for i := 0; i < 2; i++ {
+		got, err := search.getLogGroups(context.Background(), local, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"/aws/eks/dev/cluster", "/aws/eks/prod/cluster", "/aws/lambda/Checkout", "/custom"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+	if len(client.describes) != 2 {
+		t.Errorf("expected the discovered log groups to be reused, got %d requests", len(client.describes))
+	}
+
+	got, err := search.getLogGroups(context.Background(), linked, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "arn:aws:logs:us-east-1:210987654321:log-group:/custom"; !reflect.DeepEqual(got[len(got)-1], want) {
+		t.Errorf("expected the log groups of a linked account to be queried by their ARN, got %v", got)
+	}
+	if describe := client.describes[len(client.describes)-1]; !deref(describe.IncludeLinkedAccounts) || !reflect.DeepEqual(describe.AccountIdentifiers, []string{"210987654321"}) {
+		t.Errorf("expected the log groups of the linked account to be discovered, got %+v", describe)
+	}
+
+	// The route id selects the log group
+	logGroup, err := search.renderLogGroup(&logs.SearchParams{Id: "prod"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := search.getLogGroups(context.Background(), local, logGroup); !reflect.DeepEqual(got, []string{"/aws/eks/prod/cluster"}) {
+		t.Errorf("expected the log group of the id to be searched, got %v", got)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	east := &fakeClient{events: [][2]string{{"2023-03-09 12:00:04.000", "east"}, {"2023-03-09 12:00:02.000", "east"}, {"2023-03-09 12:00:00.000", "east"}}}
+	west := &fakeClient{events: [][2]string{{"2023-03-09 12:00:03.000", "west"}, {"2023-03-09 12:00:01.000", "west"}}}
+	for i := 0; i < 60; i++ {
+		west.logGroups = append(west.logGroups, fmt.Sprintf("/app/%02d", i))
+	}
+
+	search, err := NewCloudWatchSearchBackend(&logs.CloudWatchBackendConfig{LogGroupPrefixes: []string{"/app/"}, LogGroup: "/app/00"},
+		[]Target{{Region: "us-east-1", Client: east}, {Region: "us-west-2", Client: west}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q := &logs.SearchParams{Limit: 3, Start: "2023-03-09T11:00:00Z"}
+	var streams []string
+	for page := 0; page < 3; page++ {
+		results, err := search.Search(context.Background(), q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, result := range results.Results {
+			streams = append(streams, result.Labels["@logStream"])
+		}
+		if results.NextPage == "" {
+			break
+		}
+		q.Page = results.NextPage
+	}
+
+	// The events of the two chunks of log groups of us-west-2 are the same in the fake
+	if want := []string{"east", "west", "west", "east", "west", "west", "east"}; !reflect.DeepEqual(streams, want) {
+		t.Errorf("got %v, want %v", streams, want)
+	}
+
+	if len(east.queries) != 3 || len(west.queries) != 6 {
+		t.Fatalf("expected a query per page and chunk of log groups, got %d and %d", len(east.queries), len(west.queries))
+	}
+	if got := len(west.queries[0].LogGroupNames) + len(west.queries[1].LogGroupNames); got != 60 {
+		t.Errorf("expected the 60 log groups to be queried, got %d", got)
+	}
+	if query := deref(east.queries[0].QueryString); !strings.HasPrefix(query, "fields @logStream, @log") {
+		t.Errorf("expected the log stream and group to be queried, got %s", query)
+	}
+}
+
+func TestSearchAscending(t *testing.T) {
+	client := &fakeClient{events: [][2]string{{"2023-03-09 12:00:00.000", "api"}}}
+	search, err := NewCloudWatchSearchBackend(&logs.CloudWatchBackendConfig{LogGroup: "/app/api"}, []Target{{Region: "us-east-1", Client: client}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := search.Search(context.Background(), &logs.SearchParams{Limit: 3, Start: "2023-03-09T11:00:00Z", Order: logs.OrderAscending}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The query keeps the oldest events rather than the newest ones
+	if query := deref(client.queries[0].QueryString); !strings.HasSuffix(query, "| sort @timestamp asc") {
+		t.Errorf("expected the events to be sorted from the oldest, got %s", query)
+	}
+}
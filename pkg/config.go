@@ -5,21 +5,35 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
 	v8 "github.com/elastic/go-elasticsearch/v8"
+	"github.com/flanksource/apm-hub/api"
 	"github.com/flanksource/apm-hub/api/logs"
 	"github.com/flanksource/apm-hub/db"
 	"github.com/flanksource/apm-hub/pkg/cloudwatch"
 	"github.com/flanksource/apm-hub/pkg/elasticsearch"
 	"github.com/flanksource/apm-hub/pkg/files"
+	"github.com/flanksource/apm-hub/pkg/gcplogging"
+	"github.com/flanksource/apm-hub/pkg/httpbackend"
+	"github.com/flanksource/apm-hub/pkg/jaeger"
+	"github.com/flanksource/apm-hub/pkg/journald"
 	k8s "github.com/flanksource/apm-hub/pkg/kubernetes"
+	"github.com/flanksource/apm-hub/pkg/loganalytics"
+	"github.com/flanksource/apm-hub/pkg/loki"
 	pkgOpensearch "github.com/flanksource/apm-hub/pkg/opensearch"
+	"github.com/flanksource/apm-hub/pkg/prometheus"
+	"github.com/flanksource/apm-hub/pkg/tempo"
 	"github.com/flanksource/commons/logger"
 	"github.com/flanksource/kommons"
 	"github.com/opensearch-project/opensearch-go/v2"
+	"golang.org/x/oauth2/clientcredentials"
+	logging "google.golang.org/api/logging/v2"
+	"google.golang.org/api/option"
 	"gopkg.in/yaml.v3"
 )
 
@@ -44,14 +58,32 @@ func ParseConfig(configFile string) (*logs.SearchConfig, error) {
 // SetupBackends instantiates backends from the given configurations.
 func SetupBackends(kommonsClient *kommons.Client, backendConfigs []logs.SearchBackendConfig) []logs.SearchBackend {
 	var allBackends []logs.SearchBackend
+	names := make(map[string]bool)
 	for _, config := range backendConfigs {
+		config.WarnDeprecated()
+		if err := config.Validate(); err != nil {
+			logger.Errorf("error instantiating backend from the config: %v", err)
+			continue
+		}
+
 		backends, err := getBackendsFromConfigs(kommonsClient, config)
 		if err != nil {
 			logger.Errorf("error instantiating backend from the config: %v", err)
 			continue
 		}
 
-		allBackends = append(allBackends, backends...)
+		for _, backend := range backends {
+			if backend.Name == "" {
+				backend.Name = fmt.Sprintf("%s[%d]", backend.Type, len(allBackends))
+			}
+			// The page tokens hold the position of each backend by its name
+			if names[backend.Name] {
+				logger.Errorf("error instantiating backend from the config: duplicate name %q", backend.Name)
+				continue
+			}
+			names[backend.Name] = true
+			allBackends = append(allBackends, backend)
+		}
 	}
 	return allBackends
 }
@@ -68,11 +100,135 @@ func LoadGlobalBackends() error {
 	}
 
 	logs.GlobalBackends = SetupBackends(kommonsClient, dbBackendConfigs)
+	api.GlobalTraceBackends = SetupTraceBackends(dbBackendConfigs)
+	api.GlobalMetricsBackends = SetupMetricsBackends(kommonsClient, dbBackendConfigs)
 	return nil
 }
 
+// SetupMetricsBackends instantiates the metrics backends from the given configurations.
+func SetupMetricsBackends(kommonsClient *kommons.Client, backendConfigs []logs.SearchBackendConfig) []api.MetricsBackend {
+	var allBackends []api.MetricsBackend
+	names := make(map[string]bool)
+	for _, config := range backendConfigs {
+		if err := config.Validate(); err != nil {
+			logger.Errorf("error instantiating metrics backend from the config: %v", err)
+			continue
+		}
+
+		backends, err := getMetricsBackendsFromConfigs(kommonsClient, config)
+		if err != nil {
+			logger.Errorf("error instantiating metrics backend from the config: %v", err)
+			continue
+		}
+
+		for _, backend := range backends {
+			if backend.Name == "" {
+				backend.Name = fmt.Sprintf("%s[%d]", backend.Type, len(allBackends))
+			}
+			// The page tokens hold the position of each backend by its name
+			if names[backend.Name] {
+				logger.Errorf("error instantiating metrics backend from the config: duplicate name %q", backend.Name)
+				continue
+			}
+			names[backend.Name] = true
+			allBackends = append(allBackends, backend)
+		}
+	}
+	return allBackends
+}
+
+// SetupTraceBackends instantiates the trace backends from the given configurations.
+func SetupTraceBackends(backendConfigs []logs.SearchBackendConfig) []api.TraceBackend {
+	var allBackends []api.TraceBackend
+	names := make(map[string]bool)
+	for _, config := range backendConfigs {
+		if err := config.Validate(); err != nil {
+			logger.Errorf("error instantiating trace backend from the config: %v", err)
+			continue
+		}
+
+		backends, err := getTraceBackendsFromConfigs(config)
+		if err != nil {
+			logger.Errorf("error instantiating trace backend from the config: %v", err)
+			continue
+		}
+
+		for _, backend := range backends {
+			if backend.Name == "" {
+				backend.Name = fmt.Sprintf("%s[%d]", backend.Type, len(allBackends))
+			}
+			// The page tokens hold the position of each backend by its name
+			if names[backend.Name] {
+				logger.Errorf("error instantiating trace backend from the config: duplicate name %q", backend.Name)
+				continue
+			}
+			names[backend.Name] = true
+			allBackends = append(allBackends, backend)
+		}
+	}
+	return allBackends
+}
+
+// getTraceBackendsFromConfigs instantiates the trace backends from the given configuration.
+func getTraceBackendsFromConfigs(backendConfig logs.SearchBackendConfig) ([]api.TraceBackend, error) {
+	var backends []api.TraceBackend
+
+	if backendConfig.Jaeger != nil {
+		if len(backendConfig.Jaeger.Routes) == 0 {
+			return nil, errRoutesNotProvided
+		}
+
+		jaegerBackend, err := jaeger.NewJaegerBackend(backendConfig.Jaeger)
+		if err != nil {
+			return nil, fmt.Errorf("error creating the jaeger backend: %w", err)
+		}
+
+		backends = append(backends, api.NewTraceBackend("jaeger", jaegerBackend, backendConfig.Jaeger.CommonBackend))
+	}
+
+	if backendConfig.Tempo != nil {
+		if len(backendConfig.Tempo.Routes) == 0 {
+			return nil, errRoutesNotProvided
+		}
+
+		tempoBackend, err := tempo.NewTempoBackend(backendConfig.Tempo)
+		if err != nil {
+			return nil, fmt.Errorf("error creating the tempo backend: %w", err)
+		}
+
+		backends = append(backends, api.NewTraceBackend("tempo", tempoBackend, backendConfig.Tempo.CommonBackend))
+	}
+
+	return backends, nil
+}
+
 var errRoutesNotProvided = fmt.Errorf("no routes provided")
 
+// getMetricsBackendsFromConfigs instantiates the metrics backends from the given configuration.
+func getMetricsBackendsFromConfigs(kommonsClient *kommons.Client, backendConfig logs.SearchBackendConfig) ([]api.MetricsBackend, error) {
+	var backends []api.MetricsBackend
+
+	if backendConfig.Prometheus != nil {
+		if len(backendConfig.Prometheus.Routes) == 0 {
+			return nil, errRoutesNotProvided
+		}
+
+		username, password, err := getPrometheusEnvVars(kommonsClient, backendConfig.Prometheus)
+		if err != nil {
+			return nil, fmt.Errorf("error getting the env vars: %w", err)
+		}
+
+		prometheusBackend, err := prometheus.NewPrometheusBackend(backendConfig.Prometheus, username, password)
+		if err != nil {
+			return nil, fmt.Errorf("error creating the prometheus backend: %w", err)
+		}
+
+		backends = append(backends, api.NewMetricsBackend("prometheus", prometheusBackend, backendConfig.Prometheus.CommonBackend))
+	}
+
+	return backends, nil
+}
+
 // getBackendsFromConfigs instantiates backends from the given configuration.
 //
 // A single configuration can have multiple backends.
@@ -84,12 +240,17 @@ func getBackendsFromConfigs(kommonsClient *kommons.Client, backendConfig logs.Se
 			return nil, errRoutesNotProvided
 		}
 
-		k8sclient, err := k8s.GetKubeClient(kommonsClient, backendConfig.Kubernetes)
+		clusters, err := k8s.GetKubeClients(kommonsClient, backendConfig.Kubernetes)
 		if err != nil {
 			return nil, err
 		}
 
-		backend := logs.NewSearchBackend(k8s.NewKubernetesSearchBackend(k8sclient, backendConfig.Kubernetes))
+		search, err := k8s.NewKubernetesSearchBackend(clusters, backendConfig.Kubernetes)
+		if err != nil {
+			return nil, err
+		}
+
+		backend := logs.NewSearchBackend("kubernetes", search, backendConfig.Kubernetes.CommonBackend)
 		backends = append(backends, backend)
 	}
 
@@ -107,7 +268,35 @@ func getBackendsFromConfigs(kommonsClient *kommons.Client, backendConfig logs.Se
 			}
 		}
 
-		backend := logs.NewSearchBackend(files.NewFileSearchBackend(backendConfig.File))
+		fileSearch, err := files.NewFileSearchBackend(backendConfig.File)
+		if err != nil {
+			return nil, fmt.Errorf("error creating the file backend: %w", err)
+		}
+
+		backend := logs.NewSearchBackend("file", fileSearch, backendConfig.File.CommonBackend)
+		backends = append(backends, backend)
+	}
+
+	if backendConfig.Journald != nil {
+		if len(backendConfig.Journald.Routes) == 0 {
+			return nil, errRoutesNotProvided
+		}
+
+		// If the paths are not absolute,
+		// They should be parsed with respect to the current path
+		for j, p := range backendConfig.Journald.Paths {
+			if !filepath.IsAbs(p) {
+				currentPath, _ := os.Getwd()
+				backendConfig.Journald.Paths[j] = filepath.Join(currentPath, p)
+			}
+		}
+
+		journaldBackend, err := journald.NewJournaldBackend(backendConfig.Journald)
+		if err != nil {
+			return nil, fmt.Errorf("error creating the journald backend: %w", err)
+		}
+
+		backend := logs.NewSearchBackend("journald", journaldBackend, backendConfig.Journald.CommonBackend)
 		backends = append(backends, backend)
 	}
 
@@ -140,7 +329,7 @@ func getBackendsFromConfigs(kommonsClient *kommons.Client, backendConfig logs.Se
 			return nil, fmt.Errorf("error creating the elastic search backend: %w", err)
 		}
 
-		backend := logs.NewSearchBackend(es)
+		backend := logs.NewSearchBackend("elasticsearch", es, backendConfig.ElasticSearch.CommonBackend)
 		backends = append(backends, backend)
 	}
 
@@ -173,58 +362,195 @@ func getBackendsFromConfigs(kommonsClient *kommons.Client, backendConfig logs.Se
 			return nil, fmt.Errorf("error creating the openSearch backend: %w", err)
 		}
 
-		backend := logs.NewSearchBackend(osBackend)
+		backend := logs.NewSearchBackend("opensearch", osBackend, backendConfig.OpenSearch.CommonBackend)
 		backends = append(backends, backend)
 	}
 
-	if backendConfig.CloudWatch != nil {
-		_, accessKey, err := kommonsClient.GetEnvValue(*backendConfig.CloudWatch.Auth.AccessKey, backendConfig.CloudWatch.Namespace)
-		if err != nil {
-			return nil, err
+	if backendConfig.Loki != nil {
+		if len(backendConfig.Loki.Routes) == 0 {
+			return nil, errRoutesNotProvided
 		}
 
-		_, secretKey, err := kommonsClient.GetEnvValue(*backendConfig.CloudWatch.Auth.SecretKey, backendConfig.CloudWatch.Namespace)
+		username, password, bearerToken, err := getLokiEnvVars(kommonsClient, backendConfig.Loki)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("error getting the env vars: %w", err)
 		}
 
-		cfg, err := config.LoadDefaultConfig(context.Background(),
-			config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(accessKey, secretKey, "")),
-			config.WithRegion(backendConfig.CloudWatch.Auth.Region),
-		)
+		lokiBackend, err := loki.NewLokiBackend(backendConfig.Loki, username, password, bearerToken)
 		if err != nil {
-			return nil, fmt.Errorf("error creating aws config: %w", err)
+			return nil, fmt.Errorf("error creating the loki backend: %w", err)
 		}
 
-		client := cloudwatchlogs.NewFromConfig(cfg)
+		backend := logs.NewSearchBackend("loki", lokiBackend, backendConfig.Loki.CommonBackend)
+		backends = append(backends, backend)
+	}
 
-		// Make a request to verify that the auth & log group is valid.
-		resp, err := client.DescribeLogGroups(context.Background(), &cloudwatchlogs.DescribeLogGroupsInput{LogGroupNamePrefix: &backendConfig.CloudWatch.LogGroup})
+	if backendConfig.HTTP != nil {
+		if len(backendConfig.HTTP.Routes) == 0 {
+			return nil, errRoutesNotProvided
+		}
+
+		headers := make(map[string]string, len(backendConfig.HTTP.Headers))
+		for _, header := range backendConfig.HTTP.Headers {
+			_, value, err := kommonsClient.GetEnvValue(header, backendConfig.HTTP.Namespace)
+			if err != nil {
+				return nil, fmt.Errorf("error getting the header %s: %w", header.Name, err)
+			}
+			headers[header.Name] = value
+		}
+
+		httpBackend, err := httpbackend.NewHTTPBackend(backendConfig.HTTP, headers)
 		if err != nil {
-			return nil, fmt.Errorf("error querying log group: %w", err)
+			return nil, fmt.Errorf("error creating the http backend: %w", err)
+		}
+
+		backend := logs.NewSearchBackend("http", httpBackend, backendConfig.HTTP.CommonBackend)
+		backends = append(backends, backend)
+	}
+
+	if backendConfig.GCPLogging != nil {
+		if len(backendConfig.GCPLogging.Routes) == 0 {
+			return nil, errRoutesNotProvided
 		}
 
-		var logGroupExists bool
-		for _, group := range resp.LogGroups {
-			if *group.LogGroupName == backendConfig.CloudWatch.LogGroup {
-				logGroupExists = true
-				break
+		var opts []option.ClientOption
+		if backendConfig.GCPLogging.Credentials != nil {
+			_, credentials, err := kommonsClient.GetEnvValue(*backendConfig.GCPLogging.Credentials, backendConfig.GCPLogging.Namespace)
+			if err != nil {
+				return nil, fmt.Errorf("error getting the credentials: %w", err)
 			}
+			opts = append(opts, option.WithCredentialsJSON([]byte(credentials)))
+		}
+		if backendConfig.GCPLogging.Endpoint != "" {
+			opts = append(opts, option.WithEndpoint(backendConfig.GCPLogging.Endpoint))
 		}
 
-		if !logGroupExists {
-			return nil, fmt.Errorf("log group %s does not exist", backendConfig.CloudWatch.LogGroup)
+		service, err := logging.NewService(context.Background(), opts...)
+		if err != nil {
+			return nil, fmt.Errorf("error creating the gcp logging service: %w", err)
 		}
 
-		cloudwatch := cloudwatch.NewCloudWatchSearchBackend(backendConfig.CloudWatch, client)
+		gcpBackend, err := gcplogging.NewGCPLoggingBackend(service, backendConfig.GCPLogging)
+		if err != nil {
+			return nil, fmt.Errorf("error creating the gcp logging backend: %w", err)
+		}
+
+		backend := logs.NewSearchBackend("gcpLogging", gcpBackend, backendConfig.GCPLogging.CommonBackend)
+		backends = append(backends, backend)
+	}
+
+	if backendConfig.AzureLogAnalytics != nil {
+		if len(backendConfig.AzureLogAnalytics.Routes) == 0 {
+			return nil, errRoutesNotProvided
+		}
+
+		tenantID, clientID, clientSecret, err := getAzureLogAnalyticsEnvVars(kommonsClient, backendConfig.AzureLogAnalytics)
+		if err != nil {
+			return nil, fmt.Errorf("error getting the env vars of the azure log analytics backend: %w", err)
+		}
+
+		endpoint := backendConfig.AzureLogAnalytics.Endpoint
+		if endpoint == "" {
+			endpoint = loganalytics.DefaultEndpoint
+		}
+
+		// The client credentials of the service principal are exchanged for tokens, refreshed as they expire
+		credentials := clientcredentials.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			TokenURL:     fmt.Sprintf("https://login.microsoftonline.com/%s/oauth2/v2.0/token", tenantID),
+			Scopes:       []string{strings.TrimSuffix(endpoint, "/") + "/.default"},
+		}
+
+		azureBackend, err := loganalytics.NewAzureLogAnalyticsBackend(credentials.Client(context.Background()), backendConfig.AzureLogAnalytics)
+		if err != nil {
+			return nil, fmt.Errorf("error creating the azure log analytics backend: %w", err)
+		}
+
+		backend := logs.NewSearchBackend("azureLogAnalytics", azureBackend, backendConfig.AzureLogAnalytics.CommonBackend)
+		backends = append(backends, backend)
+	}
+
+	if backendConfig.CloudWatch != nil {
+		targets, err := getCloudWatchTargets(kommonsClient, backendConfig.CloudWatch)
+		if err != nil {
+			return nil, err
+		}
+
+		cloudwatch, err := cloudwatch.NewCloudWatchSearchBackend(backendConfig.CloudWatch, targets)
+		if err != nil {
+			return nil, fmt.Errorf("error creating the cloudwatch backend: %w", err)
+		}
 
-		backend := logs.NewSearchBackend(cloudwatch)
+		backend := logs.NewSearchBackend("cloudwatch", cloudwatch, backendConfig.CloudWatch.CommonBackend)
 		backends = append(backends, backend)
 	}
 
 	return backends, nil
 }
 
+// getCloudWatchTargets returns the accounts and regions the cloudwatch backend searches, after checking their credentials
+func getCloudWatchTargets(kommonsClient *kommons.Client, conf *logs.CloudWatchBackendConfig) ([]cloudwatch.Target, error) {
+	accounts := conf.Accounts
+	if len(accounts) == 0 {
+		accounts = []logs.CloudWatchAccount{{}}
+	}
+
+	var targets []cloudwatch.Target
+	for _, account := range accounts {
+		auth := conf.Auth
+		if account.Auth != nil {
+			auth = *account.Auth
+		}
+
+		target := cloudwatch.Target{Region: account.Region, AccountID: account.AccountID}
+		if target.Region == "" {
+			target.Region = auth.Region
+		}
+
+		client, err := getCloudWatchClient(kommonsClient, auth, target.Region, conf.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		target.Client = client
+
+		// Make a request to verify that the auth is valid.
+		if _, err := client.DescribeLogGroups(context.Background(), &cloudwatchlogs.DescribeLogGroupsInput{Limit: aws.Int32(1)}); err != nil {
+			return nil, fmt.Errorf("error querying the log groups of %s: %w", target, err)
+		}
+
+		targets = append(targets, target)
+	}
+
+	return targets, nil
+}
+
+func getCloudWatchClient(kommonsClient *kommons.Client, auth logs.AWSAuthentication, region, namespace string) (*cloudwatchlogs.Client, error) {
+	if auth.AccessKey == nil || auth.SecretKey == nil {
+		return nil, fmt.Errorf("access key and secret key are required")
+	}
+
+	_, accessKey, err := kommonsClient.GetEnvValue(*auth.AccessKey, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	_, secretKey, err := kommonsClient.GetEnvValue(*auth.SecretKey, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.Background(),
+		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(accessKey, secretKey, "")),
+		config.WithRegion(region),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creating aws config: %w", err)
+	}
+
+	return cloudwatchlogs.NewFromConfig(cfg), nil
+}
+
 func getOpenSearchEnvVars(client *kommons.Client, conf *logs.OpenSearchBackendConfig) (username, password string, err error) {
 	if conf.Username != nil {
 		_, username, err = client.GetEnvValue(*conf.Username, conf.Namespace)
@@ -245,6 +571,81 @@ func getOpenSearchEnvVars(client *kommons.Client, conf *logs.OpenSearchBackendCo
 	return
 }
 
+func getLokiEnvVars(client *kommons.Client, conf *logs.LokiBackendConfig) (username, password, bearerToken string, err error) {
+	if conf.Username != nil {
+		_, username, err = client.GetEnvValue(*conf.Username, conf.Namespace)
+		if err != nil {
+			err = fmt.Errorf("error getting the username: %w", err)
+			return
+		}
+	}
+
+	if conf.Password != nil {
+		_, password, err = client.GetEnvValue(*conf.Password, conf.Namespace)
+		if err != nil {
+			err = fmt.Errorf("error getting the password: %w", err)
+			return
+		}
+	}
+
+	if conf.BearerToken != nil {
+		_, bearerToken, err = client.GetEnvValue(*conf.BearerToken, conf.Namespace)
+		if err != nil {
+			err = fmt.Errorf("error getting the bearer token: %w", err)
+			return
+		}
+	}
+
+	return
+}
+
+func getAzureLogAnalyticsEnvVars(client *kommons.Client, conf *logs.AzureLogAnalyticsBackendConfig) (tenantID, clientID, clientSecret string, err error) {
+	if conf.TenantID == nil || conf.ClientID == nil || conf.ClientSecret == nil {
+		err = fmt.Errorf("tenantID, clientID and clientSecret are required")
+		return
+	}
+
+	_, tenantID, err = client.GetEnvValue(*conf.TenantID, conf.Namespace)
+	if err != nil {
+		err = fmt.Errorf("error getting the tenant id: %w", err)
+		return
+	}
+
+	_, clientID, err = client.GetEnvValue(*conf.ClientID, conf.Namespace)
+	if err != nil {
+		err = fmt.Errorf("error getting the client id: %w", err)
+		return
+	}
+
+	_, clientSecret, err = client.GetEnvValue(*conf.ClientSecret, conf.Namespace)
+	if err != nil {
+		err = fmt.Errorf("error getting the client secret: %w", err)
+		return
+	}
+
+	return
+}
+
+func getPrometheusEnvVars(client *kommons.Client, conf *logs.PrometheusBackendConfig) (username, password string, err error) {
+	if conf.Username != nil {
+		_, username, err = client.GetEnvValue(*conf.Username, conf.Namespace)
+		if err != nil {
+			err = fmt.Errorf("error getting the username: %w", err)
+			return
+		}
+	}
+
+	if conf.Password != nil {
+		_, password, err = client.GetEnvValue(*conf.Password, conf.Namespace)
+		if err != nil {
+			err = fmt.Errorf("error getting the password: %w", err)
+			return
+		}
+	}
+
+	return
+}
+
 func getElasticSearchEnvVars(kClient *kommons.Client, conf *logs.ElasticSearchBackendConfig) (cloudID, apiKey, username, password string, err error) {
 	if conf.CloudID != nil {
 		_, cloudID, err = kClient.GetEnvValue(*conf.CloudID, conf.Namespace)
@@ -0,0 +1,33 @@
+package pkg
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+func TestSetupBackends(t *testing.T) {
+	file := func(name, timeout string) logs.SearchBackendConfig {
+		return logs.SearchBackendConfig{File: &logs.FileSearchBackendConfig{
+			CommonBackend: logs.CommonBackend{Name: name, Timeout: timeout, Routes: logs.Routes{{}}},
+			Paths:         []string{"/var/log/app.log"},
+		}}
+	}
+
+	backends := SetupBackends(nil, []logs.SearchBackendConfig{
+		file("app", ""),
+		file("app", ""),
+		file("", "1 minute"),
+		file("", "1m"),
+	})
+
+	var names []string
+	for _, backend := range backends {
+		names = append(names, backend.Name)
+	}
+	// The duplicate name and the invalid timeout are rejected
+	if want := []string{"app", "file[1]"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("expected backends %v, got %v", want, names)
+	}
+}
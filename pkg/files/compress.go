@@ -0,0 +1,217 @@
+package files
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"container/list"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/flanksource/commons/logger"
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	bzip2Magic = []byte("BZh")
+)
+
+// logFile is a file opened to be read backwards
+type logFile struct {
+	io.ReaderAt
+	size    int64
+	modTime time.Time
+	close   func() error
+}
+
+func (t *logFile) Close() error {
+	return t.close()
+}
+
+// openLogFile opens the file at the path.
+// Compressed files are detected by their magic bytes and decompressed
+// into a temporary file, as they can't be read backwards. The temporary file is reused
+// by the next searches until the compressed file changes.
+func openLogFile(path string) (*logFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	fInfo, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	decompress, err := getDecompressor(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if decompress == nil {
+		return &logFile{ReaderAt: file, size: fInfo.Size(), modTime: fInfo.ModTime(), close: file.Close}, nil
+	}
+
+	defer file.Close()
+	return decompressedFiles.open(file, fInfo, decompress)
+}
+
+// getDecompressor returns the decompressor of the file or nil if the file isn't compressed
+func getDecompressor(file io.ReaderAt) (func(io.Reader) (io.ReadCloser, error), error) {
+	header := make([]byte, 4)
+	n, err := file.ReadAt(header, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	header = header[:n]
+
+	switch {
+	case bytes.HasPrefix(header, gzipMagic):
+		return func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		}, nil
+	case bytes.HasPrefix(header, zstdMagic):
+		return func(r io.Reader) (io.ReadCloser, error) {
+			decoder, err := zstd.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			return decoder.IOReadCloser(), nil
+		}, nil
+	case bytes.HasPrefix(header, bzip2Magic):
+		return func(r io.Reader) (io.ReadCloser, error) {
+			return io.NopCloser(bzip2.NewReader(r)), nil
+		}, nil
+	}
+
+	return nil, nil
+}
+
+var (
+	// maxDecompressedSize is the size a compressed file can be decompressed to, past which it isn't searched
+	maxDecompressedSize int64 = 1 << 30
+	// maxDecompressedCacheSize is the total size of the decompressed files kept for the next searches
+	maxDecompressedCacheSize int64 = 4 << 30
+)
+
+// decompressedFiles holds the decompressed copies of the compressed files, so they're decompressed once
+var decompressedFiles = &decompressedCache{entries: make(map[string]*decompressedFile), lru: list.New()}
+
+// decompressedCache holds the decompressed copies of the compressed files, removing the least recently searched ones once full
+type decompressedCache struct {
+	lock    sync.Mutex
+	entries map[string]*decompressedFile
+	lru     *list.List
+	size    int64
+}
+
+// decompressedFile is the decompressed copy of a compressed file, valid while the compressed file has the same size and modification time.
+// Its fields are guarded by the lock of the cache.
+type decompressedFile struct {
+	// lock is held while the file is decompressed, so it's only decompressed once at a time
+	lock sync.Mutex
+
+	size    int64
+	modTime time.Time
+	// temp is the path of the decompressed copy, empty if there's none
+	temp     string
+	tempSize int64
+	element  *list.Element
+}
+
+// open returns the decompressed copy of the file, decompressing it unless its copy is still valid
+func (t *decompressedCache) open(file *os.File, fInfo os.FileInfo, decompress func(io.Reader) (io.ReadCloser, error)) (*logFile, error) {
+	t.lock.Lock()
+	entry, ok := t.entries[file.Name()]
+	if !ok {
+		entry = &decompressedFile{}
+		t.entries[file.Name()] = entry
+	}
+	t.lock.Unlock()
+
+	entry.lock.Lock()
+	defer entry.lock.Unlock()
+
+	t.lock.Lock()
+	valid := entry.temp != "" && entry.size == fInfo.Size() && entry.modTime.Equal(fInfo.ModTime())
+	if valid {
+		t.lru.MoveToFront(entry.element)
+		defer t.lock.Unlock()
+		return openTemp(entry, fInfo.ModTime())
+	}
+	t.remove(entry)
+	t.lock.Unlock()
+
+	temp, size, err := decompressToTemp(file, decompress)
+	if err != nil {
+		return nil, err
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	entry.size, entry.modTime, entry.temp, entry.tempSize = fInfo.Size(), fInfo.ModTime(), temp, size
+	entry.element = t.lru.PushFront(entry)
+	t.size += size
+	for element := t.lru.Back(); element != nil && element != entry.element && t.size > maxDecompressedCacheSize; element = t.lru.Back() {
+		t.remove(element.Value.(*decompressedFile))
+	}
+
+	// The copy is opened under the lock, as it can be removed once the lock is released
+	return openTemp(entry, fInfo.ModTime())
+}
+
+// remove deletes the decompressed copy of the entry, if any
+func (t *decompressedCache) remove(entry *decompressedFile) {
+	if entry.temp == "" {
+		return
+	}
+
+	if err := os.Remove(entry.temp); err != nil && !os.IsNotExist(err) {
+		logger.Warnf("error removing the decompressed file. path=%s; %v", entry.temp, err)
+	}
+	t.lru.Remove(entry.element)
+	t.size -= entry.tempSize
+	entry.temp, entry.tempSize, entry.element = "", 0, nil
+}
+
+func openTemp(entry *decompressedFile, modTime time.Time) (*logFile, error) {
+	temp, err := os.Open(entry.temp)
+	if err != nil {
+		return nil, err
+	}
+	return &logFile{ReaderAt: temp, size: entry.tempSize, modTime: modTime, close: temp.Close}, nil
+}
+
+// decompressToTemp decompresses the file into a temporary file and returns its path and size.
+// The files decompressed to more than the max size, e.g. decompression bombs, are an error.
+func decompressToTemp(file *os.File, decompress func(io.Reader) (io.ReadCloser, error)) (string, int64, error) {
+	reader, err := decompress(file)
+	if err != nil {
+		return "", 0, fmt.Errorf("error decompressing %s: %w", file.Name(), err)
+	}
+	defer reader.Close()
+
+	temp, err := os.CreateTemp("", "apm-hub-*.log")
+	if err != nil {
+		return "", 0, err
+	}
+	defer temp.Close()
+
+	size, err := io.Copy(temp, io.LimitReader(reader, maxDecompressedSize+1))
+	if err == nil && size > maxDecompressedSize {
+		err = fmt.Errorf("the decompressed file is larger than %d bytes", maxDecompressedSize)
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+		return "", 0, fmt.Errorf("error decompressing %s: %w", file.Name(), err)
+	}
+
+	return temp.Name(), size, nil
+}
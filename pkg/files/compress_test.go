@@ -0,0 +1,67 @@
+package files
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOpenLogFile_Compressed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log.1.gz")
+	if err := os.WriteFile(path, gzipData([]byte(testLog)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	read := func() string {
+		file, err := openLogFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		data, err := io.ReadAll(io.NewSectionReader(file, 0, file.size))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	if got := read(); got != testLog {
+		t.Fatalf("got %q, want %q", got, testLog)
+	}
+	temp := decompressedFiles.entries[path].temp
+
+	// The decompressed copy is reused until the file changes
+	if got := read(); got != testLog || decompressedFiles.entries[path].temp != temp {
+		t.Errorf("expected the decompressed copy to be reused")
+	}
+
+	if err := os.WriteFile(path, gzipData([]byte("2022-11-01T11:00:00Z INFO rotated\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, time.Now(), time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(); got != "2022-11-01T11:00:00Z INFO rotated\n" {
+		t.Errorf("expected the changed file to be decompressed again, got %q", got)
+	}
+	if _, err := os.Stat(temp); !os.IsNotExist(err) {
+		t.Errorf("expected the previous decompressed copy to be removed")
+	}
+}
+
+func TestOpenLogFile_MaxDecompressedSize(t *testing.T) {
+	defer func(size int64) { maxDecompressedSize = size }(maxDecompressedSize)
+	maxDecompressedSize = 16
+
+	path := filepath.Join(t.TempDir(), "app.log.1.gz")
+	if err := os.WriteFile(path, gzipData([]byte(testLog)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := openLogFile(path); err == nil {
+		t.Error("expected a file decompressed past the max size to be an error")
+	}
+}
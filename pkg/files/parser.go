@@ -0,0 +1,218 @@
+package files
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/flanksource/apm-hub/api/logs"
+	"github.com/flanksource/commons/collections"
+	"github.com/flanksource/commons/logger"
+	"github.com/flanksource/commons/utils"
+	"github.com/jeremywohl/flatten"
+)
+
+const (
+	ParserJSON       = "json"
+	ParserLogfmt     = "logfmt"
+	ParserRegex      = "regex"
+	ParserNginx      = "nginx"
+	ParserNginxError = "nginx-error"
+	ParserApache     = "apache"
+	ParserSyslog     = "syslog"
+)
+
+// parserPresets are the regular expressions of the common log formats
+var parserPresets = map[string]*regexp.Regexp{
+	// nginx combined log format
+	ParserNginx: regexp.MustCompile(`^(?P<remote_addr>\S+) - (?P<remote_user>\S+) \[(?P<timestamp>[^\]]+)\] "(?P<request>[^"]*)" (?P<status>\d{3}) (?P<body_bytes_sent>\d+|-) "(?P<http_referer>[^"]*)" "(?P<http_user_agent>[^"]*)"`),
+	// nginx error log format
+	ParserNginxError: regexp.MustCompile(`^(?P<timestamp>\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}) \[(?P<level>\w+)\] (?P<pid>\d+)#(?P<tid>\d+): (?:\*(?P<connection>\d+) )?(?P<message>.*)$`),
+	// apache common and combined log formats
+	ParserApache: regexp.MustCompile(`^(?P<host>\S+) (?P<ident>\S+) (?P<user>\S+) \[(?P<timestamp>[^\]]+)\] "(?P<request>[^"]*)" (?P<status>\d{3}) (?P<size>\d+|-)(?: "(?P<referer>[^"]*)" "(?P<user_agent>[^"]*)")?`),
+	// RFC3164 syslog
+	ParserSyslog: regexp.MustCompile(`^(?:<(?P<priority>\d+)>)?(?P<timestamp>[A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2}) (?P<hostname>\S+) (?P<app>[^:\[\s]+)(?:\[(?P<pid>\d+)\])?: (?P<message>.*)$`),
+}
+
+// lineParser parses a line into fields and maps them to the message, timestamp and labels
+type lineParser struct {
+	parse  func(line string) (map[string]any, error)
+	fields logs.ElasticSearchFields
+}
+
+type parsedLine struct {
+	message   string
+	timestamp string
+	labels    map[string]string
+}
+
+func newLineParser(config *logs.FileParser) (*lineParser, error) {
+	parser := &lineParser{fields: config.Fields}
+	if parser.fields.Message == "" {
+		parser.fields.Message = "message"
+	}
+	if parser.fields.Timestamp == "" {
+		parser.fields.Timestamp = "timestamp"
+	}
+
+	switch config.Type {
+	case ParserJSON:
+		parser.parse = parseJSON
+	case ParserLogfmt:
+		parser.parse = parseLogfmt
+	case ParserRegex:
+		regex, err := regexp.Compile(config.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid parser regex: %w", err)
+		}
+		parser.parse = regexParser(regex)
+	default:
+		regex, ok := parserPresets[config.Type]
+		if !ok {
+			return nil, fmt.Errorf("unknown parser type %q", config.Type)
+		}
+		parser.parse = regexParser(regex)
+	}
+
+	return parser, nil
+}
+
+// Parse returns the message, timestamp and labels of the line.
+// The message falls back to the whole line when the message field isn't found.
+func (t *lineParser) Parse(line string) (*parsedLine, bool) {
+	fields, err := t.parse(line)
+	if err != nil {
+		return nil, false
+	}
+
+	parsed := &parsedLine{message: line}
+	if v, ok := fields[t.fields.Message]; ok {
+		if msg, err := utils.Stringify(v); err == nil {
+			parsed.message = msg
+		}
+	}
+
+	if v, ok := fields[t.fields.Timestamp]; ok {
+		if timestamp, err := utils.Stringify(v); err == nil {
+			parsed.timestamp = timestamp
+		}
+	}
+
+	labels := make(map[string]any, len(fields))
+	for k, v := range fields {
+		// Exclude message field, timestamp field and fields that are explicitly excluded
+		if k == t.fields.Message || k == t.fields.Timestamp || collections.Contains(t.fields.Exclusions, k) {
+			continue
+		}
+		labels[k] = v
+	}
+
+	flattenedLabels, err := flatten.Flatten(labels, "", flatten.DotStyle)
+	if err != nil {
+		logger.Debugf("error flattening fields: %v", err)
+		return parsed, true
+	}
+
+	parsed.labels = make(map[string]string, len(flattenedLabels))
+	for k, v := range flattenedLabels {
+		str, err := utils.Stringify(v)
+		if err != nil {
+			logger.Debugf("error stringifying %v: %v", v, err)
+			continue
+		}
+		parsed.labels[k] = str
+	}
+
+	return parsed, true
+}
+
+func parseJSON(line string) (map[string]any, error) {
+	decoder := json.NewDecoder(strings.NewReader(line))
+	// Keep the numbers as they are in the line
+	decoder.UseNumber()
+
+	var fields map[string]any
+	if err := decoder.Decode(&fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+func regexParser(regex *regexp.Regexp) func(line string) (map[string]any, error) {
+	return func(line string) (map[string]any, error) {
+		match := regex.FindStringSubmatch(line)
+		if match == nil {
+			return nil, fmt.Errorf("line doesn't match %s", regex)
+		}
+
+		fields := make(map[string]any)
+		for i, name := range regex.SubexpNames() {
+			// Skip the unnamed groups and the optional groups that didn't match
+			if name == "" || match[i] == "" {
+				continue
+			}
+			fields[name] = match[i]
+		}
+		return fields, nil
+	}
+}
+
+// parseLogfmt parses a line of key=value pairs, where the values can be quoted
+func parseLogfmt(line string) (map[string]any, error) {
+	fields := make(map[string]any)
+	var hasValues bool
+	for i := 0; i < len(line); {
+		if line[i] == ' ' || line[i] == '\t' {
+			i++
+			continue
+		}
+
+		start := i
+		for i < len(line) && line[i] != '=' && line[i] != ' ' && line[i] != '\t' {
+			i++
+		}
+		key := line[start:i]
+		if key == "" {
+			return nil, fmt.Errorf("missing key at %d", start)
+		}
+
+		// A key without a value is a boolean flag
+		if i >= len(line) || line[i] != '=' {
+			fields[key] = "true"
+			continue
+		}
+		i++
+		hasValues = true
+
+		if i < len(line) && line[i] == '"' {
+			var value bytes.Buffer
+			i++
+			for ; i < len(line) && line[i] != '"'; i++ {
+				if line[i] == '\\' && i+1 < len(line) {
+					i++
+				}
+				value.WriteByte(line[i])
+			}
+			if i >= len(line) {
+				return nil, fmt.Errorf("unterminated quote for key %s", key)
+			}
+			i++
+			fields[key] = value.String()
+			continue
+		}
+
+		start = i
+		for i < len(line) && line[i] != ' ' && line[i] != '\t' {
+			i++
+		}
+		fields[key] = line[start:i]
+	}
+
+	// Plain text lines, e.g. stack traces, would be all flags otherwise
+	if !hasValues {
+		return nil, fmt.Errorf("no key=value pairs found")
+	}
+	return fields, nil
+}
@@ -0,0 +1,106 @@
+package files
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+func TestLineParser_Parse(t *testing.T) {
+	tests := []struct {
+		name   string
+		config logs.FileParser
+		line   string
+		want   *parsedLine
+	}{
+		{
+			name:   "json",
+			config: logs.FileParser{Type: ParserJSON, Fields: logs.ElasticSearchFields{Message: "msg", Timestamp: "ts", Exclusions: []string{"caller"}}},
+			line:   `{"ts": 1667296800.5, "msg": "failed to connect", "level": "error", "caller": "main.go", "http": {"status": 502}}`,
+			want: &parsedLine{
+				message:   "failed to connect",
+				timestamp: "1667296800.5",
+				labels:    map[string]string{"level": "error", "http.status": "502"},
+			},
+		},
+		{
+			name:   "logfmt",
+			config: logs.FileParser{Type: ParserLogfmt},
+			line:   `timestamp=2022-11-01T10:00:00Z level=info message="user \"admin\" logged in" debug`,
+			want: &parsedLine{
+				message:   `user "admin" logged in`,
+				timestamp: "2022-11-01T10:00:00Z",
+				labels:    map[string]string{"level": "info", "debug": "true"},
+			},
+		},
+		{
+			name:   "regex",
+			config: logs.FileParser{Type: ParserRegex, Regex: `^(?P<timestamp>\S+) (?P<level>\w+) (?P<message>.*)$`},
+			line:   "2022-11-01T10:00:00Z WARN disk is almost full",
+			want: &parsedLine{
+				message:   "disk is almost full",
+				timestamp: "2022-11-01T10:00:00Z",
+				labels:    map[string]string{"level": "WARN"},
+			},
+		},
+		{
+			name:   "nginx",
+			config: logs.FileParser{Type: ParserNginx},
+			line:   `127.0.0.1 - - [20/Jan/2023:10:15:30 +0000] "GET /index.html HTTP/1.1" 200 612 "-" "curl/7.68.0"`,
+			want: &parsedLine{
+				message:   `127.0.0.1 - - [20/Jan/2023:10:15:30 +0000] "GET /index.html HTTP/1.1" 200 612 "-" "curl/7.68.0"`,
+				timestamp: "20/Jan/2023:10:15:30 +0000",
+				labels: map[string]string{
+					"remote_addr":     "127.0.0.1",
+					"remote_user":     "-",
+					"request":         "GET /index.html HTTP/1.1",
+					"status":          "200",
+					"body_bytes_sent": "612",
+					"http_referer":    "-",
+					"http_user_agent": "curl/7.68.0",
+				},
+			},
+		},
+		{
+			name:   "nginx error",
+			config: logs.FileParser{Type: ParserNginxError},
+			line:   "2023/02/08 16:51:50 [notice] 1#1: signal 17 (SIGCHLD) received from 44",
+			want: &parsedLine{
+				message:   "signal 17 (SIGCHLD) received from 44",
+				timestamp: "2023/02/08 16:51:50",
+				labels:    map[string]string{"level": "notice", "pid": "1", "tid": "1"},
+			},
+		},
+		{
+			name:   "syslog",
+			config: logs.FileParser{Type: ParserSyslog},
+			line:   "Feb  8 16:51:50 acmehost sshd[4721]: Accepted publickey for root",
+			want: &parsedLine{
+				message:   "Accepted publickey for root",
+				timestamp: "Feb  8 16:51:50",
+				labels:    map[string]string{"hostname": "acmehost", "app": "sshd", "pid": "4721"},
+			},
+		},
+		{
+			name:   "unparsable line",
+			config: logs.FileParser{Type: ParserLogfmt},
+			line:   "at main()",
+			want:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser, err := newLineParser(&tt.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, _ := parser.Parse(tt.line)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
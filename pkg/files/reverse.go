@@ -0,0 +1,61 @@
+package files
+
+import (
+	"bytes"
+	"io"
+)
+
+// reverseChunkSize is the number of bytes read at a time when scanning a file backwards
+const reverseChunkSize = 64 * 1024
+
+// reverseLineReader reads the lines of a file from the end towards the start
+// without loading the whole file into memory.
+type reverseLineReader struct {
+	reader io.ReaderAt
+	// offset is the position up to which the file hasn't been read yet
+	offset int64
+	// buf holds the bytes read from the file that aren't returned yet
+	buf []byte
+}
+
+func newReverseLineReader(reader io.ReaderAt, end int64) *reverseLineReader {
+	return &reverseLineReader{reader: reader, offset: end}
+}
+
+// Next returns the previous line along with the offset of its first byte in the file.
+// io.EOF is returned once the start of the file is reached.
+func (t *reverseLineReader) Next() (string, int64, error) {
+	for {
+		// The last line of the buffer is complete if there's a newline before it
+		// or the start of the file has been reached.
+		trimmed := bytes.TrimSuffix(t.buf, []byte("\n"))
+		if i := bytes.LastIndexByte(trimmed, '\n'); i >= 0 {
+			line := trimmed[i+1:]
+			t.buf = t.buf[:i+1]
+			return string(bytes.TrimSuffix(line, []byte("\r"))), t.offset + int64(i+1), nil
+		}
+
+		if t.offset == 0 {
+			if len(t.buf) == 0 {
+				return "", 0, io.EOF
+			}
+
+			line := bytes.TrimSuffix(trimmed, []byte("\r"))
+			t.buf = nil
+			return string(line), 0, nil
+		}
+
+		size := int64(reverseChunkSize)
+		if t.offset < size {
+			size = t.offset
+		}
+
+		chunk := make([]byte, size, size+int64(len(t.buf)))
+		if _, err := t.reader.ReadAt(chunk, t.offset-size); err != nil && err != io.EOF {
+			return "", 0, err
+		}
+
+		t.offset -= size
+		t.buf = append(chunk, t.buf...)
+	}
+}
@@ -0,0 +1,54 @@
+package files
+
+import (
+	"os"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/flanksource/commons/logger"
+)
+
+// rotatedFileRegex matches the suffixes of rotated files, e.g.
+// access.log.1, access.log.2.gz and access.log-20230120.zst
+var rotatedFileRegex = regexp.MustCompile(`^(.+?)(?:[.-]\d+)?(?:\.(?:gz|zst|zstd|bz2))?$`)
+
+type seriesFile struct {
+	path    string
+	modTime time.Time
+}
+
+// groupRotatedFiles groups the paths into series of a log file
+// along with its rotated files, ordered newest to oldest.
+func groupRotatedFiles(paths []string) [][]seriesFile {
+	var names []string
+	series := make(map[string][]seriesFile)
+	for _, path := range paths {
+		fInfo, err := os.Stat(path)
+		if err != nil {
+			logger.Warnf("error reading file info. path=%s; %v", path, err)
+			continue
+		}
+		if fInfo.IsDir() {
+			continue
+		}
+
+		name := rotatedFileRegex.FindStringSubmatch(path)[1]
+		if _, ok := series[name]; !ok {
+			names = append(names, name)
+		}
+		series[name] = append(series[name], seriesFile{path: path, modTime: fInfo.ModTime()})
+	}
+
+	grouped := make([][]seriesFile, 0, len(names))
+	for _, name := range names {
+		files := series[name]
+		// Each rotated file was last written to when it was rotated
+		sort.SliceStable(files, func(i, j int) bool {
+			return files[i].modTime.After(files[j].modTime)
+		})
+		grouped = append(grouped, files)
+	}
+
+	return grouped
+}
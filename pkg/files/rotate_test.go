@@ -0,0 +1,142 @@
+package files
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/flanksource/apm-hub/api/logs"
+	"github.com/klauspost/compress/zstd"
+)
+
+// writeRotatedFiles writes a log file rotated every hour, with one line per 10 minutes
+func writeRotatedFiles(t *testing.T) string {
+	dir := t.TempDir()
+	files := []struct {
+		name     string
+		compress func([]byte) []byte
+	}{
+		{name: "app.log"},
+		{name: "app.log.1"},
+		{name: "app.log.2.gz", compress: gzipData},
+		{name: "app.log.3.zst", compress: zstdData},
+	}
+
+	for i, f := range files {
+		var data []byte
+		hour := 13 - i
+		for minute := 0; minute < 60; minute += 10 {
+			data = append(data, fmt.Sprintf("2022-11-01T%02d:%02d:00Z line %d\n", hour, minute, hour*100+minute)...)
+		}
+		if f.compress != nil {
+			data = f.compress(data)
+		}
+
+		path := filepath.Join(dir, f.name)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		modTime := time.Date(2022, 11, 1, hour, 50, 0, 0, time.UTC)
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func gzipData(data []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+func zstdData(data []byte) []byte {
+	w, _ := zstd.NewWriter(nil)
+	return w.EncodeAll(data, nil)
+}
+
+func TestGroupRotatedFiles(t *testing.T) {
+	dir := writeRotatedFiles(t)
+
+	var got []string
+	for _, f := range groupRotatedFiles(unfoldGlobs([]string{filepath.Join(dir, "*")}))[0] {
+		got = append(got, filepath.Base(f.path))
+	}
+
+	want := []string{"app.log", "app.log.1", "app.log.2.gz", "app.log.3.zst"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("groupRotatedFiles() = %v, want %v", got, want)
+	}
+}
+
+func TestFileSearch_SearchRotated(t *testing.T) {
+	dir := writeRotatedFiles(t)
+	search, err := NewFileSearchBackend(&logs.FileSearchBackendConfig{Paths: []string{filepath.Join(dir, "*")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		params logs.SearchParams
+		want   []string
+	}{
+		{
+			name:   "across rotated files",
+			params: logs.SearchParams{Start: "2022-11-01T00:00:00Z", End: "2022-11-01T12:20:00Z", Limit: 4},
+			want:   []string{"2022-11-01T12:20:00Z line 1220", "2022-11-01T12:10:00Z line 1210", "2022-11-01T12:00:00Z line 1200", "2022-11-01T11:50:00Z line 1150"},
+		},
+		{
+			name:   "compressed files",
+			params: logs.SearchParams{Start: "2022-11-01T10:30:00Z", End: "2022-11-01T11:10:00Z"},
+			want:   []string{"2022-11-01T11:10:00Z line 1110", "2022-11-01T11:00:00Z line 1100", "2022-11-01T10:50:00Z line 1050", "2022-11-01T10:40:00Z line 1040", "2022-11-01T10:30:00Z line 1030"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.params.SetDefaults()
+			res, err := search.Search(context.Background(), &tt.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := messages(res.Results); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Search() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("pages", func(t *testing.T) {
+		params := logs.SearchParams{Start: "2022-11-01T00:00:00Z", Limit: 5}
+		params.SetDefaults()
+
+		var got int
+		for i := 0; i < 10; i++ {
+			res, err := search.Search(context.Background(), &params)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got += len(res.Results)
+			if res.NextPage == "" {
+				break
+			}
+			params.Page = res.NextPage
+		}
+
+		if got != 24 {
+			t.Errorf("got %d lines across the pages, want 24", got)
+		}
+	})
+}
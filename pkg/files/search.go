@@ -1,9 +1,12 @@
 package files
 
 import (
-	"bufio"
-	"os"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -12,63 +15,425 @@ import (
 	"github.com/flanksource/commons/logger"
 )
 
-func NewFileSearchBackend(config *logs.FileSearchBackendConfig) *FileSearch {
-	return &FileSearch{
-		config: config,
+func NewFileSearchBackend(config *logs.FileSearchBackendConfig) (*FileSearch, error) {
+	timestamps, err := newTimestampParser(config.TimestampRegex, config.TimestampFormats)
+	if err != nil {
+		return nil, err
 	}
+
+	search := &FileSearch{
+		config:     config,
+		timestamps: timestamps,
+	}
+
+	if config.Parser != nil {
+		if search.parser, err = newLineParser(config.Parser); err != nil {
+			return nil, err
+		}
+	}
+
+	return search, nil
 }
 
 type FileSearch struct {
-	config *logs.FileSearchBackendConfig
+	config     *logs.FileSearchBackendConfig
+	timestamps *timestampParser
+	parser     *lineParser
+}
+
+type seriesSearchResult struct {
+	// index is the index of the series in the search
+	index int
+	// files are the file and its rotated files, newest first
+	files []seriesFile
+	// lines are the matching lines, newest first
+	lines []logs.Result
+	// oldest keeps the oldest lines up to the limit, rather than stopping at the newest ones
+	oldest bool
+	// trimmed is whether newer lines were left out to keep the oldest ones
+	trimmed bool
+	// start holds the positions of the files the page started from
+	start filePositions
+	// next holds the positions the next page should resume from once all the lines are consumed
+	next filePositions
+}
+
+// positionsAfter returns the positions of the files right after the given line is consumed
+func (t *seriesSearchResult) positionsAfter(line logs.Result) filePositions {
+	_, file, offset := parseLineCursor(line)
+	positions := make(filePositions, len(t.files))
+	for i, f := range t.files {
+		switch {
+		case i < file:
+			positions[f.path] = 0
+		case i == file:
+			positions[f.path] = offset
+		default:
+			positions[f.path] = t.start[f.path]
+		}
+	}
+	return positions
+}
+
+// filePositions is the page token of the file backend.
+// It holds the byte offset of each file up to which the lines have been returned.
+// The next page reads the lines before that offset.
+// A negative offset is a file that hasn't been read yet and a missing one is a file that has been read fully.
+type filePositions map[string]int64
+
+func (t filePositions) merge(positions filePositions) {
+	for path, offset := range positions {
+		t[path] = offset
+	}
 }
 
-func (t *FileSearch) Search(q *logs.SearchParams) (r logs.SearchResults, err error) {
+func (t filePositions) encode() string {
+	remaining := make(filePositions)
+	for path, offset := range t {
+		if offset != 0 {
+			remaining[path] = offset
+		}
+	}
+
+	if len(remaining) == 0 {
+		return ""
+	}
+
+	data, err := json.Marshal(remaining)
+	if err != nil {
+		return ""
+	}
+
+	return string(data)
+}
+
+func (t *FileSearch) Search(ctx context.Context, q *logs.SearchParams) (r logs.SearchResults, err error) {
 	var res logs.SearchResults
-	lines := readFilesLines(t.config.Paths, collections.MergeMap(t.config.Labels, q.Labels))
-	for _, content := range lines {
-		res.Results = append(res.Results, content...)
+	query, err := q.GetQuery()
+	if err != nil {
+		return res, fmt.Errorf("error parsing query: %w", err)
+	}
+
+	if q.Order == logs.OrderAscending {
+		return t.searchAscending(ctx, q, query)
+	}
+
+	var positions filePositions
+	if q.Page != "" {
+		if err := json.Unmarshal([]byte(q.Page), &positions); err != nil {
+			return res, fmt.Errorf("invalid page token %q: %w", q.Page, err)
+		}
 	}
 
+	limit := q.LimitPerItem
+	if limit <= 0 || (q.Limit > 0 && q.Limit < limit) {
+		limit = q.Limit
+	}
+
+	var series []*seriesSearchResult
+	var lists [][]logs.Result
+	for _, files := range groupRotatedFiles(unfoldGlobs(t.config.Paths)) {
+		result, err := t.searchSeries(ctx, len(series), files, positions, limit, false, q, query)
+		if err != nil {
+			return res, err
+		}
+
+		series = append(series, result)
+		lists = append(lists, result.lines)
+	}
+
+	// The series are merged here, newest first, so the positions
+	// of the files can be tracked as the results are consumed.
+	merged, consumed := logs.MergeResults(logs.OrderDescending, int(q.Limit), lists...)
+	var cursor, nextPositions = make(filePositions), make(filePositions)
+	for i, s := range series {
+		cursor.merge(s.start)
+		switch {
+		case consumed[i] == len(s.lines):
+			nextPositions.merge(s.next)
+		case consumed[i] == 0:
+			nextPositions.merge(s.start)
+		default:
+			nextPositions.merge(s.positionsAfter(s.lines[consumed[i]-1]))
+		}
+	}
+
+	// The cursor of each result holds the positions of all the files right after that result
+	for i := range merged {
+		index, _, _ := parseLineCursor(merged[i])
+		cursor.merge(series[index].positionsAfter(merged[i]))
+		merged[i].Cursor = cursor.encode()
+	}
+
+	res.Results = merged
+	res.Total = len(merged)
+	res.NextPage = nextPositions.encode()
 	return res, nil
 }
 
-func (t *FileSearch) MatchRoute(q *logs.SearchParams) (match bool, isAdditive bool) {
+// searchAscending returns the oldest lines of the time window, from the offset held in the page token.
+// The files are read backwards down to the start of the window, so each series only keeps the oldest lines up to the end of the page.
+func (t *FileSearch) searchAscending(ctx context.Context, q *logs.SearchParams, query logs.QueryExpr) (logs.SearchResults, error) {
+	var res logs.SearchResults
+	var offset int
+	if q.Page != "" {
+		var err error
+		if offset, err = strconv.Atoi(q.Page); err != nil || offset < 0 {
+			return res, fmt.Errorf("invalid page token %q", q.Page)
+		}
+	}
+
+	var keep int64
+	if q.Limit > 0 {
+		keep = int64(offset) + q.Limit
+	}
+
+	var more bool
+	var lists [][]logs.Result
+	for _, files := range groupRotatedFiles(unfoldGlobs(t.config.Paths)) {
+		result, err := t.searchSeries(ctx, len(lists), files, nil, keep, true, q, query)
+		if err != nil {
+			return res, err
+		}
+
+		// The lines are read newest first, and the ones of the same time are kept in the order of the file once sorted
+		for i, j := 0, len(result.lines)-1; i < j; i, j = i+1, j-1 {
+			result.lines[i], result.lines[j] = result.lines[j], result.lines[i]
+		}
+
+		more = more || result.trimmed
+		lists = append(lists, result.lines)
+	}
+
+	merged, consumed := logs.MergeResults(logs.OrderAscending, int(keep), lists...)
+	for i, list := range lists {
+		more = more || consumed[i] < len(list)
+	}
+	if offset > len(merged) {
+		offset = len(merged)
+	}
+
+	// The cursor of each result is the number of lines of the window up to it
+	res.Results = merged[offset:]
+	for i := range res.Results {
+		res.Results[i].Cursor = strconv.Itoa(offset + i + 1)
+	}
+	res.Total = len(res.Results)
+	if more {
+		res.NextPage = strconv.Itoa(len(merged))
+	}
+	return res, nil
+}
+
+func (t *FileSearch) MatchRoute(q *logs.SearchParams) (route logs.SearchRoute, match bool) {
 	return t.config.CommonBackend.Routes.MatchRoute(q)
 }
 
-type logsPerFile map[string][]logs.Result
+// searchSeries searches a file along with its rotated files, newest to oldest, up to the limit.
+// With oldest set, the series is read down to the start of the time window and the oldest lines up to the limit are kept.
+// The files that can't hold lines in the time window, based on their modification time, aren't opened.
+//
+// The indexes of the series and the file, and the offset of each line are held in the cursor of the line until the series are merged.
+func (t *FileSearch) searchSeries(ctx context.Context, index int, files []seriesFile, positions filePositions, limit int64, oldest bool, q *logs.SearchParams, query logs.QueryExpr) (*seriesSearchResult, error) {
+	result := &seriesSearchResult{
+		index:  index,
+		files:  files,
+		start:  make(filePositions, len(files)),
+		next:   make(filePositions),
+		oldest: oldest,
+	}
+	for _, f := range files {
+		result.start[f.path] = -1
+		if positions != nil {
+			result.start[f.path] = positions[f.path]
+		}
+	}
 
-// readFilesLines takes a list of file paths and returns each lines of those files.
-// If labels are also passed, it'll attach those labels to each lines of those files.
-func readFilesLines(paths []string, labelsToAttach map[string]string) logsPerFile {
-	fileContents := make(logsPerFile, len(paths))
-	for _, path := range unfoldGlobs(paths) {
-		fInfo, err := os.Stat(path)
-		if err != nil {
-			logger.Warnf("error get file stat. path=%s; %w", path, err)
+	start, end := q.GetStart(), q.GetEnd()
+	for i, f := range files {
+		offset := result.start[f.path]
+		if offset == 0 {
+			// There are no more lines in this file
 			continue
 		}
 
-		file, err := os.Open(path)
+		if start != nil && f.modTime.Before(*start) {
+			// This file and the older ones were last written to before the time window
+			break
+		}
+
+		if end != nil && i+1 < len(files) && files[i+1].modTime.After(*end) {
+			// The older file was written to after the time window, so all lines of this file are after it too
+			continue
+		}
+
+		done, err := t.searchFile(ctx, result, i, offset, limit, q, query)
 		if err != nil {
-			logger.Warnf("error opening file. path=%s; %w", path, err)
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			logger.Warnf("error searching file. path=%s; %v", f.path, err)
 			continue
 		}
 
-		// All lines of the same file will share these labels
-		labels := collections.MergeMap(map[string]string{"path": path}, labelsToAttach)
+		if !oldest && limit > 0 && int64(len(result.lines)) >= limit {
+			result.next = result.positionsAfter(result.lines[len(result.lines)-1])
+			break
+		}
+
+		if done {
+			// The start of the time window has been reached
+			break
+		}
+	}
+
+	return result, nil
+}
+
+// searchFile reads the lines of a file of the series backwards from the given offset (or the end of the file if negative)
+// and adds the newest lines that match the time window and the query to the result, up to the limit.
+// A result keeping the oldest lines drops the newest ones past the limit instead.
+// It returns whether the start of the time window has been reached.
+func (t *FileSearch) searchFile(ctx context.Context, result *seriesSearchResult, fileIndex int, end, limit int64, q *logs.SearchParams, query logs.QueryExpr) (bool, error) {
+	path := result.files[fileIndex].path
+	file, err := openLogFile(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	if end < 0 || end > file.size {
+		end = file.size
+	}
+
+	// All lines of the same file have these labels, copied to each line
+	labels := collections.MergeMap(map[string]string{"path": path}, t.config.Labels)
 
-		scanner := bufio.NewScanner(file)
-		for scanner.Scan() {
-			fileContents[path] = append(fileContents[path], logs.Result{
-				Time:    fInfo.ModTime().Format(time.RFC3339),
-				Labels:  labels,
-				Message: strings.TrimSpace(scanner.Text()),
-			})
+	start, windowEnd := q.GetStart(), q.GetEnd()
+
+	// Lines without a timestamp, e.g. stack traces, belong to the
+	// closest line before them that has a timestamp.
+	var pending []logs.Result
+
+	emit := func(ts time.Time) (done bool) {
+		for _, line := range pending {
+			line.Time = ts.Format(time.RFC3339Nano)
+			if windowEnd != nil && ts.After(*windowEnd) {
+				continue
+			}
+			if !matchLabels(line.Labels, q.Labels) || (query != nil && !query.Match(line)) {
+				continue
+			}
+
+			result.lines = append(result.lines, line)
+			if limit <= 0 {
+				continue
+			}
+			if result.oldest && int64(len(result.lines)) > limit {
+				result.lines, result.trimmed = result.lines[1:], true
+			} else if !result.oldest && int64(len(result.lines)) >= limit {
+				return true
+			}
 		}
+		pending = pending[:0]
+		return false
+	}
+
+	reader := newReverseLineReader(file, end)
+	for {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+
+		text, offset, err := reader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return false, err
+		}
+
+		message := strings.TrimSpace(text)
+		if message == "" {
+			continue
+		}
+
+		line, ts, ok := t.parseLine(message, labels)
+		line.Cursor = fmt.Sprintf("%d:%d:%d", result.index, fileIndex, offset)
+		pending = append(pending, line)
+		if !ok {
+			continue
+		}
+
+		if start != nil && ts.Before(*start) {
+			// The lines are in chronological order, so the rest of the series is out of the time window
+			return true, nil
+		}
+
+		if emit(ts) {
+			return false, nil
+		}
+	}
+
+	// The lines at the start of the file without a timestamp fall back to the modification time of the file
+	if len(pending) != 0 {
+		ts := file.modTime
+		if start != nil && ts.Before(*start) {
+			return true, nil
+		}
+		emit(ts)
+	}
+
+	return false, nil
+}
+
+// parseLine returns the result of the line along with its timestamp, if found.
+// The lines the parser fails on, e.g. stack traces, are returned as is.
+func (t *FileSearch) parseLine(message string, labels map[string]string) (logs.Result, time.Time, bool) {
+	if t.parser != nil {
+		if parsed, ok := t.parser.Parse(message); ok {
+			line := logs.Result{
+				Message: parsed.message,
+				Labels:  collections.MergeMap(collections.MergeMap(nil, labels), parsed.labels),
+			}
+
+			if parsed.timestamp != "" {
+				if ts, ok := t.timestamps.ParseValue(parsed.timestamp); ok {
+					return line, ts, true
+				}
+			}
+
+			ts, ok := t.timestamps.Parse(message)
+			return line, ts, ok
+		}
+	}
+
+	ts, ok := t.timestamps.Parse(message)
+	return logs.Result{Message: message, Labels: collections.MergeMap(nil, labels)}, ts, ok
+}
+
+// matchLabels returns whether the labels of a line match the label filter of the search.
+// The value of each label of the filter is a comma separated list of the values to match.
+func matchLabels(labels, filter map[string]string) bool {
+	for k, v := range filter {
+		value, ok := labels[k]
+		if !ok || !collections.MatchItems(value, strings.Split(v, ",")...) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseLineCursor returns the indexes of the series and the file, and the offset of the line held in its cursor
+func parseLineCursor(r logs.Result) (int, int, int64) {
+	parts := strings.SplitN(r.Cursor, ":", 3)
+	if len(parts) != 3 {
+		return 0, 0, 0
 	}
 
-	return fileContents
+	series, _ := strconv.Atoi(parts[0])
+	file, _ := strconv.Atoi(parts[1])
+	offset, _ := strconv.ParseInt(parts[2], 10, 64)
+	return series, file, offset
 }
 
 func unfoldGlobs(paths []string) []string {
@@ -0,0 +1,243 @@
+package files
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+const testLog = `2022-11-01T10:00:00Z INFO starting
+2022-11-01T10:01:00Z ERROR failed to connect
+	at connect()
+	at main()
+2022-11-01T10:02:00Z INFO retrying
+2022-11-01T10:03:00Z ERROR failed again
+2022-11-01T10:04:00Z INFO connected
+`
+
+func newTestFileSearch(t *testing.T) *FileSearch {
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(path, []byte(testLog), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	search, err := NewFileSearchBackend(&logs.FileSearchBackendConfig{Paths: []string{path}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return search
+}
+
+func messages(results []logs.Result) []string {
+	var out []string
+	for _, r := range results {
+		out = append(out, r.Message)
+	}
+	return out
+}
+
+func TestFileSearch_Search(t *testing.T) {
+	tests := []struct {
+		name   string
+		params logs.SearchParams
+		want   []string
+	}{
+		{
+			name:   "newest lines first",
+			params: logs.SearchParams{Start: "2022-11-01T00:00:00Z", Limit: 2},
+			want:   []string{"2022-11-01T10:04:00Z INFO connected", "2022-11-01T10:03:00Z ERROR failed again"},
+		},
+		{
+			name:   "time window",
+			params: logs.SearchParams{Start: "2022-11-01T10:02:00Z", End: "2022-11-01T10:03:30Z"},
+			want:   []string{"2022-11-01T10:03:00Z ERROR failed again", "2022-11-01T10:02:00Z INFO retrying"},
+		},
+		{
+			name:   "query",
+			params: logs.SearchParams{Start: "2022-11-01T00:00:00Z", Query: "message:error"},
+			want:   []string{"2022-11-01T10:03:00Z ERROR failed again", "2022-11-01T10:01:00Z ERROR failed to connect"},
+		},
+		{
+			name:   "lines without a timestamp",
+			params: logs.SearchParams{Query: "message:main", Start: "2022-11-01T10:01:00Z", End: "2022-11-01T10:01:00Z"},
+			want:   []string{"at main()"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			search := newTestFileSearch(t)
+			tt.params.SetDefaults()
+
+			res, err := search.Search(context.Background(), &tt.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := messages(res.Results); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Search() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileSearch_SearchPages(t *testing.T) {
+	search := newTestFileSearch(t)
+
+	var got []string
+	params := logs.SearchParams{Start: "2022-11-01T00:00:00Z", Limit: 3}
+	params.SetDefaults()
+	for i := 0; i < 10; i++ {
+		res, err := search.Search(context.Background(), &params)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got = append(got, messages(res.Results)...)
+		if res.NextPage == "" {
+			break
+		}
+		params.Page = res.NextPage
+	}
+
+	lines := strings.Split(strings.TrimSpace(testLog), "\n")
+	var want []string
+	for i := len(lines) - 1; i >= 0; i-- {
+		want = append(want, strings.TrimSpace(lines[i]))
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pages = %v, want %v", got, want)
+	}
+}
+
+func TestFileSearch_SearchParsed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	data := `{"time": "2022-11-01T10:00:00Z", "level": "info", "msg": "starting"}
+{"time": "2022-11-01T10:01:00Z", "level": "error", "msg": "failed to connect"}
+`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	search, err := NewFileSearchBackend(&logs.FileSearchBackendConfig{
+		Paths:  []string{path},
+		Parser: &logs.FileParser{Type: ParserJSON, Fields: logs.ElasticSearchFields{Message: "msg", Timestamp: "time"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params := logs.SearchParams{Start: "2022-11-01T00:00:00Z", Query: "level=error"}
+	params.SetDefaults()
+	res, err := search.Search(context.Background(), &params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []logs.Result{{
+		Message: "failed to connect",
+		Time:    "2022-11-01T10:01:00Z",
+		Labels:  map[string]string{"path": path, "level": "error"},
+	}}
+	for i := range res.Results {
+		res.Results[i].Cursor = ""
+	}
+	if !reflect.DeepEqual(res.Results, want) {
+		t.Errorf("Search() = %+v, want %+v", res.Results, want)
+	}
+}
+
+func TestFileSearch_SearchAscending(t *testing.T) {
+	search := newTestFileSearch(t)
+
+	var got []string
+	params := logs.SearchParams{Start: "2022-11-01T00:00:00Z", Limit: 2, Order: logs.OrderAscending}
+	params.SetDefaults()
+	for i := 0; i < 10; i++ {
+		res, err := search.Search(context.Background(), &params)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got = append(got, messages(res.Results)...)
+		if res.NextPage == "" {
+			break
+		}
+		params.Page = res.NextPage
+	}
+
+	var want []string
+	for _, line := range strings.Split(strings.TrimSpace(testLog), "\n") {
+		want = append(want, strings.TrimSpace(line))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pages = %v, want %v", got, want)
+	}
+}
+
+func TestFileSearch_SearchLabels(t *testing.T) {
+	search := newTestFileSearch(t)
+	results, err := search.Search(context.Background(), &logs.SearchParams{Start: "2022-11-01T00:00:00Z", Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each line has its own labels
+	results.Results[0].Labels["level"] = "info"
+	if _, ok := results.Results[1].Labels["level"]; ok {
+		t.Error("expected the labels of the lines not to be shared")
+	}
+}
+
+func TestFileSearch_SearchLabelFilter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	data := `{"time": "2022-11-01T10:00:00Z", "level": "info", "msg": "starting"}
+{"time": "2022-11-01T10:01:00Z", "level": "error", "msg": "failed to connect"}
+{"time": "2022-11-01T10:02:00Z", "level": "warn", "msg": "retrying"}
+`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	search, err := NewFileSearchBackend(&logs.FileSearchBackendConfig{
+		CommonBackend: logs.CommonBackend{Labels: map[string]string{"app": "api"}},
+		Paths:         []string{path},
+		Parser:        &logs.FileParser{Type: ParserJSON, Fields: logs.ElasticSearchFields{Message: "msg", Timestamp: "time"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		labels map[string]string
+		want   []string
+	}{
+		{labels: map[string]string{"level": "error"}, want: []string{"failed to connect"}},
+		{labels: map[string]string{"level": "error,warn", "app": "api"}, want: []string{"retrying", "failed to connect"}},
+		{labels: map[string]string{"app": "web"}},
+	}
+
+	for _, tt := range tests {
+		params := logs.SearchParams{Start: "2022-11-01T00:00:00Z", Labels: tt.labels}
+		params.SetDefaults()
+		res, err := search.Search(context.Background(), &params)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := messages(res.Results); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Search(%v) = %v, want %v", tt.labels, got, tt.want)
+		}
+		for _, r := range res.Results {
+			if r.Labels["app"] != "api" {
+				t.Errorf("expected the configured labels to be attached, got %v", r.Labels)
+			}
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package files
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/flanksource/apm-hub/api/logs"
+	"github.com/flanksource/commons/collections"
+	"github.com/flanksource/commons/logger"
+	"github.com/fsnotify/fsnotify"
+)
+
+// tailedFile is a file followed from the offset up to which its lines have been sent
+type tailedFile struct {
+	offset int64
+	// lastTime is the timestamp of the last line, given to the lines without one
+	lastTime time.Time
+}
+
+// Tail watches the files for writes and sends their new lines, starting with the lines written since the start of the search params.
+// Just the current file of each rotated series is followed, which is reopened once rotated.
+func (t *FileSearch) Tail(ctx context.Context, q *logs.SearchParams, lines chan<- logs.Result) error {
+	query, err := q.GetQuery()
+	if err != nil {
+		return err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	start := q.GetStart()
+	tailed := make(map[string]*tailedFile)
+	for _, files := range groupRotatedFiles(unfoldGlobs(t.config.Paths)) {
+		current := files[0].path
+		if !isCurrentFile(current) {
+			continue
+		}
+
+		fInfo, err := os.Stat(current)
+		if err != nil {
+			continue
+		}
+
+		offset := fInfo.Size()
+		if start != nil {
+			if offset, err = t.startOffset(current, *start); err != nil {
+				logger.Warnf("error finding the lines since the start. path=%s; %v", current, err)
+				offset = fInfo.Size()
+			}
+		}
+		tailed[current] = &tailedFile{offset: offset}
+	}
+
+	// The directories are watched, rather than the files, so the files created once rotated are noticed
+	for _, dir := range t.watchedDirs(tailed) {
+		if err := watcher.Add(dir); err != nil {
+			logger.Warnf("error watching directory. path=%s; %v", dir, err)
+		}
+	}
+
+	// The lines written since the start are sent before the new ones
+	for path, file := range tailed {
+		if err := t.sendNewLines(ctx, path, file, query, q.Labels, lines); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			logger.Warnf("error reading the lines since the start. path=%s; %v", path, err)
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			logger.Warnf("error watching files: %v", err)
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+
+			file, ok := tailed[event.Name]
+			switch {
+			case event.Has(fsnotify.Create) && !ok && t.matchesPaths(event.Name) && isCurrentFile(event.Name):
+				file = &tailedFile{}
+				tailed[event.Name] = file
+			case event.Has(fsnotify.Create) && ok:
+				// The file has been rotated, so the new file is read from its start
+				file.offset = 0
+			case event.Has(fsnotify.Write) && ok:
+			default:
+				continue
+			}
+
+			if err := t.sendNewLines(ctx, event.Name, file, query, q.Labels, lines); err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				logger.Warnf("error reading new lines. path=%s; %v", event.Name, err)
+			}
+		}
+	}
+}
+
+// sendNewLines sends the complete lines written to the file after its offset that match the query and the label filter
+func (t *FileSearch) sendNewLines(ctx context.Context, path string, file *tailedFile, query logs.QueryExpr, labelFilter map[string]string, lines chan<- logs.Result) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fInfo, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	if fInfo.Size() < file.offset {
+		// The file has been truncated
+		file.offset = 0
+	}
+
+	data, err := io.ReadAll(io.NewSectionReader(f, file.offset, fInfo.Size()-file.offset))
+	if err != nil {
+		return err
+	}
+
+	// The last line is left for the next write if it isn't complete yet
+	end := bytes.LastIndexByte(data, '\n')
+	if end < 0 {
+		return nil
+	}
+	file.offset += int64(end + 1)
+
+	labels := collections.MergeMap(map[string]string{"path": path}, t.config.Labels)
+	for _, text := range strings.Split(string(data[:end]), "\n") {
+		message := strings.TrimSpace(text)
+		if message == "" {
+			continue
+		}
+
+		line, ts, ok := t.parseLine(message, labels)
+		if ok {
+			file.lastTime = ts
+		} else if !file.lastTime.IsZero() {
+			ts = file.lastTime
+		} else {
+			ts = time.Now()
+		}
+
+		line.Time = ts.Format(time.RFC3339Nano)
+		if !matchLabels(line.Labels, labelFilter) || (query != nil && !query.Match(line)) {
+			continue
+		}
+
+		if err := logs.SendResult(ctx, lines, line); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// startOffset returns the offset of the first line of the file at or after the start, reading the file backwards.
+// The lines without a timestamp belong to the line before them.
+func (t *FileSearch) startOffset(path string, start time.Time) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	fInfo, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	offset := fInfo.Size()
+	reader := newReverseLineReader(file, offset)
+	for {
+		text, lineOffset, err := reader.Next()
+		if err == io.EOF {
+			return offset, nil
+		} else if err != nil {
+			return 0, err
+		}
+
+		message := strings.TrimSpace(text)
+		if message == "" {
+			continue
+		}
+
+		if _, ts, ok := t.parseLine(message, nil); ok {
+			if ts.Before(start) {
+				return offset, nil
+			}
+			offset = lineOffset
+		}
+	}
+}
+
+// watchedDirs returns the directories of the tailed files and the configured paths
+func (t *FileSearch) watchedDirs(tailed map[string]*tailedFile) []string {
+	var dirs []string
+	for path := range tailed {
+		dirs = append(dirs, filepath.Dir(path))
+	}
+	for _, path := range t.config.Paths {
+		dirs = append(dirs, unfoldGlobs([]string{filepath.Dir(path)})...)
+	}
+
+	return collections.Dedup(dirs)
+}
+
+// matchesPaths returns whether the file matches any of the configured paths
+func (t *FileSearch) matchesPaths(path string) bool {
+	for _, pattern := range t.config.Paths {
+		if matched, _ := filepath.Match(pattern, path); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// isCurrentFile returns whether the file is the one being written to,
+// rather than one of its rotated files
+func isCurrentFile(path string) bool {
+	return rotatedFileRegex.FindStringSubmatch(path)[1] == path
+}
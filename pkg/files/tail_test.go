@@ -0,0 +1,97 @@
+package files
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+func TestFileSearch_Tail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(path, []byte("2022-11-01T10:00:00Z INFO old line\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	search, err := NewFileSearchBackend(&logs.FileSearchBackendConfig{Paths: []string{path}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	params := logs.SearchParams{Query: "message:error"}
+	lines := make(chan logs.Result)
+	done := make(chan error)
+	go func() {
+		done <- search.Tail(ctx, &params, lines)
+	}()
+
+	// Wait for the watcher to be set up
+	time.Sleep(200 * time.Millisecond)
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString("2022-11-01T10:01:00Z INFO new line\n2022-11-01T10:02:00Z ERROR new error\n2022-11-01T10:03:00Z ERROR incomplete"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case line := <-lines:
+		if line.Message != "2022-11-01T10:02:00Z ERROR new error" || line.Time != "2022-11-01T10:02:00Z" {
+			t.Errorf("Tail() sent %+v", line)
+		}
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for the new line")
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Tail() error = %v", err)
+	}
+}
+
+func TestFileSearch_TailStart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	data := "2022-11-01T10:00:00Z ERROR before the start\n2022-11-01T10:01:00Z INFO at the start\n2022-11-01T10:02:00Z ERROR after the start\n"
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	search, err := NewFileSearchBackend(&logs.FileSearchBackendConfig{Paths: []string{path}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	params := logs.SearchParams{Query: "message:error", Start: "2022-11-01T10:01:00Z"}
+	lines := make(chan logs.Result)
+	done := make(chan error)
+	go func() {
+		done <- search.Tail(ctx, &params, lines)
+	}()
+
+	select {
+	case line := <-lines:
+		if line.Message != "2022-11-01T10:02:00Z ERROR after the start" {
+			t.Errorf("Tail() sent %+v", line)
+		}
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for the lines since the start")
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Tail() error = %v", err)
+	}
+}
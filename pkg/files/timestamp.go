@@ -0,0 +1,141 @@
+package files
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+type timestampPattern struct {
+	regex   *regexp.Regexp
+	formats []string
+}
+
+// defaultTimestampPatterns are the timestamps found in the common log formats
+var defaultTimestampPatterns = []timestampPattern{
+	{
+		// RFC3339 and ISO8601 like timestamps
+		regex: regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:[.,]\d+)?(?:Z|[+-]\d{2}:?\d{2})?`),
+		formats: []string{
+			time.RFC3339Nano,
+			"2006-01-02 15:04:05.999999999Z07:00",
+			"2006-01-02T15:04:05.999999999Z0700",
+			"2006-01-02 15:04:05.999999999Z0700",
+			"2006-01-02T15:04:05.999999999",
+			"2006-01-02 15:04:05.999999999",
+			"2006-01-02 15:04:05,999999999",
+		},
+	},
+	{
+		// nginx & apache access logs
+		regex:   regexp.MustCompile(`\d{2}/[A-Z][a-z]{2}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}`),
+		formats: []string{"02/Jan/2006:15:04:05 -0700"},
+	},
+	{
+		// nginx error logs
+		regex:   regexp.MustCompile(`\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}`),
+		formats: []string{"2006/01/02 15:04:05"},
+	},
+	{
+		// syslog
+		regex:   regexp.MustCompile(`[A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2}`),
+		formats: []string{time.Stamp},
+	},
+}
+
+// timestampParser extracts the timestamp of a log line
+type timestampParser struct {
+	patterns []timestampPattern
+}
+
+// newTimestampParser creates a parser from the configured regex and formats.
+// The default patterns are used for whatever isn't configured.
+func newTimestampParser(regex string, formats []string) (*timestampParser, error) {
+	if regex == "" && len(formats) == 0 {
+		return &timestampParser{patterns: defaultTimestampPatterns}, nil
+	}
+
+	if regex == "" {
+		// Use the configured formats on the timestamps found by the default patterns
+		var patterns []timestampPattern
+		for _, p := range defaultTimestampPatterns {
+			patterns = append(patterns, timestampPattern{regex: p.regex, formats: formats})
+		}
+		return &timestampParser{patterns: patterns}, nil
+	}
+
+	compiled, err := regexp.Compile(regex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp regex: %w", err)
+	}
+
+	if len(formats) == 0 {
+		for _, p := range defaultTimestampPatterns {
+			formats = append(formats, p.formats...)
+		}
+	}
+
+	return &timestampParser{patterns: []timestampPattern{{regex: compiled, formats: formats}}}, nil
+}
+
+// Parse returns the timestamp of the line.
+//
+// The timestamp is taken from the capture group named "timestamp",
+// else from the first capture group, else from the whole match of the regex.
+func (t *timestampParser) Parse(line string) (time.Time, bool) {
+	for _, p := range t.patterns {
+		match := p.regex.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		value := match[0]
+		if i := p.regex.SubexpIndex("timestamp"); i > 0 {
+			value = match[i]
+		} else if len(match) > 1 {
+			value = match[1]
+		}
+
+		if ts, ok := parseFormats(p.formats, value); ok {
+			return ts, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// ParseValue returns the timestamp of a parsed field.
+// Besides the formats, the value can be a unix timestamp in seconds or milliseconds.
+func (t *timestampParser) ParseValue(value string) (time.Time, bool) {
+	if epoch, err := strconv.ParseFloat(value, 64); err == nil {
+		if epoch > 1e12 {
+			return time.UnixMilli(int64(epoch)), true
+		}
+		sec, frac := math.Modf(epoch)
+		return time.Unix(int64(sec), int64(frac*1e9)), true
+	}
+
+	for _, p := range t.patterns {
+		if ts, ok := parseFormats(p.formats, value); ok {
+			return ts, true
+		}
+	}
+
+	return t.Parse(value)
+}
+
+func parseFormats(formats []string, value string) (time.Time, bool) {
+	for _, format := range formats {
+		if ts, err := time.Parse(format, value); err == nil {
+			if ts.Year() == 0 {
+				// Formats like syslog don't have a year
+				ts = ts.AddDate(time.Now().Year(), 0, 0)
+			}
+			return ts, true
+		}
+	}
+
+	return time.Time{}, false
+}
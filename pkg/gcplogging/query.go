@@ -0,0 +1,86 @@
+package gcplogging
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+// messageFields are the fields of a log entry that hold its message
+var messageFields = []string{"textPayload", "jsonPayload.message"}
+
+var identifierRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// toFilter compiles a query expression into a filter of the Logging query language.
+// The labels of the results are named after the fields of the log entries, so they're used as is.
+func toFilter(expr logs.QueryExpr) string {
+	switch e := expr.(type) {
+	case logs.QueryAnd:
+		return joinFilters(e.Exprs, " AND ")
+	case logs.QueryOr:
+		return joinFilters(e.Exprs, " OR ")
+	case logs.QueryNot:
+		return "NOT (" + toFilter(e.Expr) + ")"
+	case logs.QueryTerm:
+		return termFilter(e)
+	}
+
+	return ""
+}
+
+// joinFilters joins the non empty filters, wrapping each in parentheses
+func joinFilters(exprs []logs.QueryExpr, sep string) string {
+	filters := make([]string, 0, len(exprs))
+	for _, e := range exprs {
+		if filter := toFilter(e); filter != "" {
+			filters = append(filters, filter)
+		}
+	}
+	return "(" + strings.Join(filters, sep) + ")"
+}
+
+func termFilter(term logs.QueryTerm) string {
+	switch field := term.GetField(); field {
+	case logs.QueryFieldMessage:
+		var filters []string
+		for _, f := range messageFields {
+			filters = append(filters, fieldFilter(f, term))
+		}
+		return "(" + strings.Join(filters, " OR ") + ")"
+	case logs.QueryFieldID:
+		return fieldFilter("insertId", term)
+	case logs.QueryFieldTimestamp:
+		return fieldFilter("timestamp", term)
+	default:
+		return fieldFilter(fieldPath(field), term)
+	}
+}
+
+func fieldFilter(field string, term logs.QueryTerm) string {
+	value := strconv.Quote(term.Value)
+	switch term.Op {
+	case logs.QueryOpRegex:
+		return field + "=~" + value
+	case logs.QueryOpGreater, logs.QueryOpGreaterEqual, logs.QueryOpLess, logs.QueryOpLessEqual:
+		if term.IsNumeric() {
+			value = term.Value
+		}
+		return field + string(term.Op) + value
+	default:
+		// The ":" of the query is the has operator of the Logging query language too
+		return field + string(term.Op) + value
+	}
+}
+
+// fieldPath quotes the segments of the path that aren't identifiers, e.g. labels."k8s-pod/app"
+func fieldPath(field string) string {
+	segments := strings.Split(field, ".")
+	for i, s := range segments {
+		if !identifierRegex.MatchString(s) {
+			segments[i] = strconv.Quote(s)
+		}
+	}
+	return strings.Join(segments, ".")
+}
@@ -0,0 +1,40 @@
+package gcplogging
+
+import (
+	"testing"
+
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+func TestToFilter(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{
+			query: `"connection refused"`,
+			want:  `(textPayload:"connection refused" OR jsonPayload.message:"connection refused")`,
+		},
+		{
+			query: `severity=ERROR jsonPayload.status>=500 NOT resource.labels.pod_name:/^worker-/`,
+			want:  `(severity="ERROR" AND jsonPayload.status>=500 AND NOT (resource.labels.pod_name=~"^worker-"))`,
+		},
+		{
+			query: `labels.k8s-pod/app=api OR id!=abc`,
+			want:  `(labels."k8s-pod/app"="api" OR insertId!="abc")`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			expr, err := logs.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("error parsing query: %v", err)
+			}
+
+			if got := toFilter(expr); got != tt.want {
+				t.Errorf("toFilter() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package gcplogging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/flanksource/apm-hub/api/logs"
+	"github.com/flanksource/commons/collections"
+	"github.com/flanksource/commons/logger"
+	"github.com/flanksource/commons/utils"
+	"github.com/jeremywohl/flatten"
+	logging "google.golang.org/api/logging/v2"
+)
+
+// maxPageSize is the maximum number of entries the Logging API returns at once
+const maxPageSize = 1000
+
+// GCPLoggingBackend searches the log entries of Google Cloud Logging
+type GCPLoggingBackend struct {
+	service  *logging.Service
+	config   *logs.GCPLoggingBackendConfig
+	template *template.Template
+}
+
+func NewGCPLoggingBackend(service *logging.Service, config *logs.GCPLoggingBackendConfig) (*GCPLoggingBackend, error) {
+	if service == nil {
+		return nil, fmt.Errorf("service is nil")
+	}
+
+	if len(config.ResourceNames) == 0 {
+		return nil, fmt.Errorf("resourceNames is empty")
+	}
+
+	template, err := template.New("filter").Parse(config.Filter)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing template: %w", err)
+	}
+
+	return &GCPLoggingBackend{
+		service:  service,
+		config:   config,
+		template: template,
+	}, nil
+}
+
+func (t *GCPLoggingBackend) MatchRoute(q *logs.SearchParams) (route logs.SearchRoute, match bool) {
+	return t.config.CommonBackend.Routes.MatchRoute(q)
+}
+
+// Search lists the log entries that match the rendered filter and the query.
+//
+// The page tokens of the Logging API are only valid with the same filter, so the page
+// token holds the time window of the first page along with the token of the API.
+func (t *GCPLoggingBackend) Search(ctx context.Context, q *logs.SearchParams) (logs.SearchResults, error) {
+	var result logs.SearchResults
+	var buf bytes.Buffer
+
+	if err := t.template.Execute(&buf, q); err != nil {
+		return result, fmt.Errorf("error executing template: %w", err)
+	}
+
+	query, err := q.GetQuery()
+	if err != nil {
+		return result, fmt.Errorf("error parsing query: %w", err)
+	}
+
+	start, end := q.GetStart(), q.GetEnd()
+	if end == nil {
+		now := time.Now()
+		end = &now
+	}
+
+	var pageToken string
+	if q.Page != "" {
+		if start, end, pageToken, err = parseCursor(q.Page); err != nil {
+			return result, err
+		}
+	}
+
+	var filters []string
+	if filter := strings.TrimSpace(buf.String()); filter != "" {
+		filters = append(filters, "("+filter+")")
+	}
+	if start != nil {
+		filters = append(filters, fmt.Sprintf("timestamp>=%q", start.UTC().Format(time.RFC3339Nano)))
+	}
+	filters = append(filters, fmt.Sprintf("timestamp<=%q", end.UTC().Format(time.RFC3339Nano)))
+	if query != nil {
+		filters = append(filters, toFilter(query))
+	}
+
+	orderBy := "timestamp desc"
+	if q.Order == logs.OrderAscending {
+		orderBy = "timestamp asc"
+	}
+
+	pageSize := q.Limit
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+
+	resp, err := t.service.Entries.List(&logging.ListLogEntriesRequest{
+		ResourceNames: t.config.ResourceNames,
+		Filter:        strings.Join(filters, " AND "),
+		OrderBy:       orderBy,
+		PageSize:      pageSize,
+		PageToken:     pageToken,
+	}).Context(ctx).Do()
+	if err != nil {
+		return result, fmt.Errorf("error listing log entries: %w", err)
+	}
+
+	for _, entry := range resp.Entries {
+		result.Results = append(result.Results, toResult(entry, t.config.Labels))
+	}
+
+	result.Total = len(result.Results)
+	if resp.NextPageToken != "" {
+		result.NextPage = encodeCursor(start, end, resp.NextPageToken)
+	}
+	return result, nil
+}
+
+// encodeCursor returns the page token of the next page
+func encodeCursor(start, end *time.Time, pageToken string) string {
+	var startTime string
+	if start != nil {
+		startTime = start.UTC().Format(time.RFC3339Nano)
+	}
+	return strings.Join([]string{startTime, end.UTC().Format(time.RFC3339Nano), pageToken}, "|")
+}
+
+// parseCursor returns the time window and the page token of the API in the page token
+func parseCursor(page string) (*time.Time, *time.Time, string, error) {
+	parts := strings.SplitN(page, "|", 3)
+	if len(parts) != 3 {
+		return nil, nil, "", fmt.Errorf("invalid page token %q", page)
+	}
+
+	var start *time.Time
+	if parts[0] != "" {
+		s, err := time.Parse(time.RFC3339Nano, parts[0])
+		if err != nil {
+			return nil, nil, "", fmt.Errorf("invalid page token %q: %w", page, err)
+		}
+		start = &s
+	}
+
+	end, err := time.Parse(time.RFC3339Nano, parts[1])
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("invalid page token %q: %w", page, err)
+	}
+
+	return start, &end, parts[2], nil
+}
+
+// toResult maps a log entry to a result.
+// The labels are named after the fields of the entry, e.g. resource.labels.pod_name, jsonPayload.status.
+func toResult(entry *logging.LogEntry, labelsToAttach map[string]string) logs.Result {
+	r := logs.Result{
+		Id:     entry.InsertId,
+		Time:   entry.Timestamp,
+		Labels: collections.MergeMap(nil, labelsToAttach),
+	}
+
+	severity := entry.Severity
+	if severity == "" {
+		severity = "DEFAULT"
+	}
+	r.Labels["severity"] = severity
+	r.Labels["logName"] = entry.LogName
+
+	if entry.Resource != nil {
+		r.Labels["resource.type"] = entry.Resource.Type
+		for k, v := range entry.Resource.Labels {
+			r.Labels["resource.labels."+k] = v
+		}
+	}
+	for k, v := range entry.Labels {
+		r.Labels["labels."+k] = v
+	}
+	if entry.Trace != "" {
+		r.Labels["trace"] = entry.Trace
+	}
+	if entry.SpanId != "" {
+		r.Labels["spanId"] = entry.SpanId
+	}
+
+	switch {
+	case entry.TextPayload != "":
+		r.Message = entry.TextPayload
+	case len(entry.JsonPayload) != 0:
+		r.Message = jsonPayloadMessage(entry.JsonPayload, r.Labels)
+	case len(entry.ProtoPayload) != 0:
+		r.Message = string(entry.ProtoPayload)
+	}
+
+	return r
+}
+
+// jsonPayloadMessage returns the message field of the payload, or the whole payload if it has none.
+// The other fields of the payload are added to the labels.
+func jsonPayloadMessage(payload []byte, labels map[string]string) string {
+	var fields map[string]any
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return string(payload)
+	}
+
+	message, hasMessage := fields["message"]
+	delete(fields, "message")
+
+	flattened, err := flatten.Flatten(fields, "jsonPayload.", flatten.DotStyle)
+	if err != nil {
+		logger.Debugf("error flattening the json payload: %v", err)
+	}
+	for k, v := range flattened {
+		if str, err := utils.Stringify(v); err == nil {
+			labels[k] = str
+		}
+	}
+
+	if !hasMessage {
+		return string(payload)
+	}
+
+	str, err := utils.Stringify(message)
+	if err != nil {
+		return string(payload)
+	}
+	return str
+}
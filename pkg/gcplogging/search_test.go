@@ -0,0 +1,138 @@
+package gcplogging
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/flanksource/apm-hub/api/logs"
+	logging "google.golang.org/api/logging/v2"
+	"google.golang.org/api/option"
+)
+
+// newTestServer fakes the entries.list method of the Logging API
+func newTestServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/entries:list" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		var req logging.ListLogEntriesRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("invalid request: %v", err)
+		}
+
+		if !reflect.DeepEqual(req.ResourceNames, []string{"projects/my-project"}) || req.OrderBy != "timestamp desc" || req.PageSize != 2 {
+			t.Errorf("unexpected request %+v", req)
+		}
+		if !strings.HasPrefix(req.Filter, `(resource.labels.namespace_name="default") AND timestamp>="2023-03-09T00:00:00Z" AND timestamp<="2023-03-10T00:00:00Z" AND `) {
+			t.Errorf("unexpected filter %s", req.Filter)
+		}
+
+		resp := logging.ListLogEntriesResponse{NextPageToken: "token-2"}
+		if req.PageToken == "token-2" {
+			resp = logging.ListLogEntriesResponse{}
+		} else {
+			resp.Entries = []*logging.LogEntry{
+				{
+					InsertId:    "a1",
+					Timestamp:   "2023-03-09T12:29:11.828Z",
+					Severity:    "ERROR",
+					LogName:     "projects/my-project/logs/stderr",
+					TextPayload: "connection refused",
+					Resource:    &logging.MonitoredResource{Type: "k8s_container", Labels: map[string]string{"pod_name": "api-0"}},
+					Labels:      map[string]string{"k8s-pod/app": "api"},
+				},
+				{
+					InsertId:    "a2",
+					Timestamp:   "2023-03-09T12:29:10Z",
+					LogName:     "projects/my-project/logs/stdout",
+					JsonPayload: []byte(`{"message": "GET /users", "http": {"status": 200}}`),
+					Trace:       "projects/my-project/traces/abc",
+				},
+			}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestGCPLoggingBackend_Search(t *testing.T) {
+	server := newTestServer(t)
+	service, err := logging.NewService(context.Background(), option.WithEndpoint(server.URL+"/"), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend, err := NewGCPLoggingBackend(service, &logs.GCPLoggingBackendConfig{
+		CommonBackend: logs.CommonBackend{Labels: map[string]string{"cloud": "gcp"}},
+		ResourceNames: []string{"projects/my-project"},
+		Filter:        `resource.labels.namespace_name="{{index .Labels "namespace"}}"`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q := &logs.SearchParams{
+		Labels: map[string]string{"namespace": "default"},
+		Start:  "2023-03-09T00:00:00Z",
+		End:    "2023-03-10T00:00:00Z",
+		Query:  "error OR GET",
+		Limit:  2,
+	}
+	q.SetDefaults()
+
+	res, err := backend.Search(context.Background(), q)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []logs.Result{
+		{
+			Id:      "a1",
+			Time:    "2023-03-09T12:29:11.828Z",
+			Message: "connection refused",
+			Labels: map[string]string{
+				"cloud":                    "gcp",
+				"severity":                 "ERROR",
+				"logName":                  "projects/my-project/logs/stderr",
+				"resource.type":            "k8s_container",
+				"resource.labels.pod_name": "api-0",
+				"labels.k8s-pod/app":       "api",
+			},
+		},
+		{
+			Id:      "a2",
+			Time:    "2023-03-09T12:29:10Z",
+			Message: "GET /users",
+			Labels: map[string]string{
+				"cloud":                   "gcp",
+				"severity":                "DEFAULT",
+				"logName":                 "projects/my-project/logs/stdout",
+				"trace":                   "projects/my-project/traces/abc",
+				"jsonPayload.http.status": "200",
+			},
+		},
+	}
+	if !reflect.DeepEqual(res.Results, want) {
+		t.Errorf("got %+v, want %+v", res.Results, want)
+	}
+
+	// The next page searches the same time window with the token of the API
+	if res.NextPage != "2023-03-09T00:00:00Z|2023-03-10T00:00:00Z|token-2" {
+		t.Fatalf("unexpected next page %q", res.NextPage)
+	}
+	q.Page = res.NextPage
+	if res, err = backend.Search(context.Background(), q); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Results) != 0 || res.NextPage != "" {
+		t.Errorf("unexpected last page %+v", res)
+	}
+}
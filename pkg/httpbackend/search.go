@@ -0,0 +1,316 @@
+package httpbackend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/flanksource/apm-hub/api/logs"
+	"github.com/flanksource/commons/collections"
+	"github.com/flanksource/commons/logger"
+	"github.com/flanksource/commons/utils"
+	"github.com/jeremywohl/flatten"
+	"github.com/tidwall/gjson"
+)
+
+// HTTPBackend searches any HTTP API that returns the hits as JSON,
+// mapping the hits to results with the configured gjson paths
+type HTTPBackend struct {
+	client  *http.Client
+	config  *logs.HTTPBackendConfig
+	url     *template.Template
+	body    *template.Template
+	headers map[string]string
+}
+
+// NewHTTPBackend returns the backend. The headers are the values of the configured headers.
+func NewHTTPBackend(config *logs.HTTPBackendConfig, headers map[string]string) (*HTTPBackend, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("url is empty")
+	}
+
+	urlTemplate, err := template.New("url").Funcs(templateFuncs).Parse(config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing url template: %w", err)
+	}
+
+	bodyTemplate, err := template.New("body").Funcs(templateFuncs).Parse(config.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing body template: %w", err)
+	}
+
+	return &HTTPBackend{
+		client:  http.DefaultClient,
+		config:  config,
+		url:     urlTemplate,
+		body:    bodyTemplate,
+		headers: headers,
+	}, nil
+}
+
+// templateFuncs escape the search params rendered in the requests
+var templateFuncs = template.FuncMap{
+	// json encodes a value as JSON, e.g. a string as a quoted JSON string
+	"json": func(value any) (string, error) {
+		data, err := json.Marshal(value)
+		return string(data), err
+	},
+	// urlquery escapes a value for a query parameter of the URL
+	"urlquery": url.QueryEscape,
+}
+
+// maxResponseSize is the maximum size of the response body
+const maxResponseSize = 32 * 1024 * 1024
+
+func (t *HTTPBackend) MatchRoute(q *logs.SearchParams) (route logs.SearchRoute, match bool) {
+	return t.config.CommonBackend.Routes.MatchRoute(q)
+}
+
+// maxQueryPages is the number of pages fetched for a search whose query is matched against the results,
+// past which the page is returned with fewer results than its limit
+const maxQueryPages = 10
+
+// Search sends the rendered request and maps the hits of the response to results.
+// The generic query is matched against the results, as it can't be translated for an unknown API.
+// So the pages that follow are fetched too until the limit of results match the query,
+// and the total is the number of results that matched.
+func (t *HTTPBackend) Search(ctx context.Context, q *logs.SearchParams) (logs.SearchResults, error) {
+	var result logs.SearchResults
+
+	query, err := q.GetQuery()
+	if err != nil {
+		return result, fmt.Errorf("error parsing query: %w", err)
+	}
+
+	page := q.Clone()
+	for i := 0; i < maxQueryPages; i++ {
+		results, total, next, err := t.searchPage(ctx, page)
+		if err != nil {
+			return result, err
+		}
+
+		if query == nil {
+			result.Results, result.Total, result.NextPage = results, total, next
+			return result, nil
+		}
+
+		for _, r := range results {
+			if query.Match(r) {
+				result.Results = append(result.Results, r)
+			}
+		}
+		result.NextPage = next
+		if next == "" || next == page.Page || (q.Limit > 0 && int64(len(result.Results)) >= q.Limit) {
+			break
+		}
+		page.Page = next
+	}
+
+	result.Total = len(result.Results)
+	return result, nil
+}
+
+// searchPage sends the request of the page and returns its results, the total of the response and the next page token
+func (t *HTTPBackend) searchPage(ctx context.Context, q *logs.SearchParams) ([]logs.Result, int, string, error) {
+	body, err := t.request(ctx, q)
+	if err != nil {
+		return nil, 0, "", err
+	}
+
+	if !gjson.ValidBytes(body) {
+		return nil, 0, "", fmt.Errorf("the response body isn't valid JSON")
+	}
+	response := gjson.ParseBytes(body)
+
+	hits := response
+	if t.config.Fields.Hits != "" {
+		hits = response.Get(t.config.Fields.Hits)
+	}
+	if !hits.IsArray() {
+		return nil, 0, "", fmt.Errorf("the hits at %q aren't an array", t.config.Fields.Hits)
+	}
+
+	var results []logs.Result
+	for _, hit := range hits.Array() {
+		r, err := t.toResult(hit)
+		if err != nil {
+			logger.Debugf("error mapping hit: %v", err)
+			continue
+		}
+		results = append(results, r)
+	}
+
+	total := len(results)
+	if t.config.Fields.Total != "" {
+		if value := response.Get(t.config.Fields.Total); value.Exists() {
+			total = int(value.Int())
+		}
+	}
+
+	var next string
+	if t.config.Fields.NextPage != "" {
+		if value := response.Get(t.config.Fields.NextPage); value.Exists() && value.Type != gjson.Null {
+			// A string token is used as is, while any other token is used as JSON
+			if value.Type == gjson.String {
+				next = value.String()
+			} else {
+				next = value.Raw
+			}
+		}
+	}
+
+	return results, total, next, nil
+}
+
+// request sends the rendered request and returns the response body
+func (t *HTTPBackend) request(ctx context.Context, q *logs.SearchParams) ([]byte, error) {
+	var reqURL, body bytes.Buffer
+	if err := t.url.Execute(&reqURL, q); err != nil {
+		return nil, fmt.Errorf("error executing url template: %w", err)
+	}
+	if err := t.body.Execute(&body, q); err != nil {
+		return nil, fmt.Errorf("error executing body template: %w", err)
+	}
+
+	method := t.config.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	var reqBody io.Reader
+	if body.Len() != 0 {
+		reqBody = &body
+	}
+
+	req, err := http.NewRequestWithContext(ctx, strings.ToUpper(method), strings.TrimSpace(reqURL.String()), reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	if reqBody != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	for name, value := range t.headers {
+		req.Header.Set(name, value)
+	}
+
+	res, err := t.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error searching: %w", err)
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(res.Body, maxResponseSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("error reading the response body: %w", err)
+	}
+	if len(data) > maxResponseSize {
+		return nil, fmt.Errorf("the response body is larger than %d bytes", maxResponseSize)
+	}
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		if len(data) > 1024 {
+			data = data[:1024]
+		}
+		return nil, fmt.Errorf("[http] got response %d: %s", res.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	return data, nil
+}
+
+// toResult maps a hit to a result with the configured paths
+func (t *HTTPBackend) toResult(hit gjson.Result) (logs.Result, error) {
+	fields := t.config.Fields
+
+	r := logs.Result{Message: hit.String()}
+	if fields.Message != "" {
+		message := hit.Get(fields.Message)
+		if !message.Exists() {
+			return r, fmt.Errorf("message field [%s] not found", fields.Message)
+		}
+		r.Message = message.String()
+	}
+
+	if fields.ID != "" {
+		r.Id = hit.Get(fields.ID).String()
+	}
+
+	if fields.Timestamp != "" {
+		if ts := hit.Get(fields.Timestamp); ts.Exists() {
+			parsed, err := parseTimestamp(ts)
+			if err != nil {
+				return r, err
+			}
+			r.Time = parsed.UTC().Format(time.RFC3339Nano)
+		}
+	}
+
+	var labels map[string]string
+	if fields.Labels != "" {
+		var err error
+		if labels, err = extractLabels(hit.Get(fields.Labels)); err != nil {
+			return r, err
+		}
+	}
+	r.Labels = collections.MergeMap(collections.MergeMap(nil, t.config.Labels), labels)
+
+	return r, nil
+}
+
+// extractLabels flattens the fields of the object into labels
+func extractLabels(value gjson.Result) (map[string]string, error) {
+	object, ok := value.Value().(map[string]any)
+	if !ok {
+		return nil, nil
+	}
+
+	flattened, err := flatten.Flatten(object, "", flatten.DotStyle)
+	if err != nil {
+		return nil, fmt.Errorf("error flattening labels: %w", err)
+	}
+
+	labels := make(map[string]string, len(flattened))
+	for k, v := range flattened {
+		str, err := utils.Stringify(v)
+		if err != nil {
+			logger.Debugf("error stringifying %v: %v", v, err)
+			continue
+		}
+		labels[k] = str
+	}
+	return labels, nil
+}
+
+// parseTimestamp parses a RFC3339 timestamp or a unix timestamp,
+// whose unit (seconds, milliseconds, microseconds or nanoseconds) is told by its magnitude
+func parseTimestamp(value gjson.Result) (time.Time, error) {
+	if value.Type == gjson.String {
+		if ts, err := time.Parse(time.RFC3339Nano, value.Str); err == nil {
+			return ts, nil
+		}
+		if _, err := strconv.ParseFloat(value.Str, 64); err != nil {
+			return time.Time{}, fmt.Errorf("invalid timestamp %q", value.Str)
+		}
+	}
+
+	unix := value.Float()
+	switch abs := math.Abs(unix); {
+	case abs < 1e11:
+		return time.Unix(0, int64(unix*1e9)), nil
+	case abs < 1e14:
+		return time.UnixMilli(int64(unix)), nil
+	case abs < 1e17:
+		return time.UnixMicro(int64(unix)), nil
+	default:
+		return time.Unix(0, value.Int()), nil
+	}
+}
@@ -0,0 +1,182 @@
+package httpbackend
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+// newTestServer serves the fixtures of the pages, like the log search API of Datadog
+func newTestServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v2/logs/events/search" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Header.Get("DD-API-KEY") != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors": ["Forbidden"]}`))
+			return
+		}
+
+		var body struct {
+			Filter struct {
+				Query string `json:"query"`
+			} `json:"filter"`
+			Page struct {
+				Cursor string `json:"cursor"`
+			} `json:"page"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("invalid request body: %v", err)
+		}
+		if body.Filter.Query != "service:api" {
+			t.Errorf("unexpected query %q", body.Filter.Query)
+		}
+
+		fixture := "testdata/page-1.json"
+		if body.Page.Cursor == "cursor-2" {
+			fixture = "testdata/page-2.json"
+		}
+		data, err := os.ReadFile(fixture)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestBackend(t *testing.T, headers map[string]string) *HTTPBackend {
+	config := &logs.HTTPBackendConfig{
+		CommonBackend: logs.CommonBackend{Labels: map[string]string{"vendor": "datadog"}},
+		URL:           newTestServer(t).URL + "/api/v2/logs/events/search",
+		Body:          `{"filter": {"query": {{json (print "service:" (index .Labels "service"))}}}, "page": {"limit": {{.Limit}}{{if .Page}}, "cursor": {{json .Page}}{{end}}}}`,
+		Fields: logs.HTTPResponseFields{
+			Hits:      "data.logs",
+			Message:   "attributes.message",
+			Timestamp: "attributes.timestamp",
+			ID:        "id",
+			Labels:    "attributes.tags",
+			NextPage:  "meta.page.after",
+			Total:     "meta.total",
+		},
+	}
+
+	backend, err := NewHTTPBackend(config, headers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return backend
+}
+
+func TestHTTPBackend_Search(t *testing.T) {
+	backend := newTestBackend(t, map[string]string{"DD-API-KEY": "secret"})
+	q := &logs.SearchParams{Labels: map[string]string{"service": "api"}, Limit: 2}
+
+	res, err := backend.Search(context.Background(), q)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []logs.Result{
+		{
+			Id:      "AAA",
+			Time:    "2023-03-09T12:29:11.828Z",
+			Message: "GET /users 200",
+			Labels:  map[string]string{"vendor": "datadog", "service": "api", "http.status": "200"},
+		},
+		{
+			Id:      "BBB",
+			Time:    "2023-03-09T12:29:10Z",
+			Message: "GET /orders 500",
+			Labels:  map[string]string{"vendor": "datadog", "service": "api", "http.status": "500"},
+		},
+	}
+	if !reflect.DeepEqual(res.Results, want) {
+		t.Errorf("got %+v, want %+v", res.Results, want)
+	}
+	if res.Total != 3 || res.NextPage != "cursor-2" {
+		t.Errorf("unexpected total %d and next page %q", res.Total, res.NextPage)
+	}
+
+	// The next page is rendered in the body
+	q.Page = res.NextPage
+	q.Query = "job"
+	if res, err = backend.Search(context.Background(), q); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Results) != 1 || res.Results[0].Time != "2023-03-09T12:29:09Z" || res.NextPage != "" {
+		t.Errorf("unexpected last page %+v", res)
+	}
+}
+
+func TestHTTPBackend_SearchQuery(t *testing.T) {
+	backend := newTestBackend(t, map[string]string{"DD-API-KEY": "secret"})
+
+	// The first page has no match, so the next one is fetched
+	res, err := backend.Search(context.Background(), &logs.SearchParams{Labels: map[string]string{"service": "api"}, Limit: 2, Query: "job"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Results) != 1 || res.Results[0].Id != "CCC" || res.Total != 1 || res.NextPage != "" {
+		t.Errorf("expected the match of the next page, got %+v", res)
+	}
+
+	// The limit is reached on the first page, which the next page follows
+	res, err = backend.Search(context.Background(), &logs.SearchParams{Labels: map[string]string{"service": "api"}, Limit: 1, Query: "500"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Results) != 1 || res.Results[0].Id != "BBB" || res.Total != 1 || res.NextPage != "cursor-2" {
+		t.Errorf("expected the match of the first page, got %+v", res)
+	}
+}
+
+func TestHTTPBackend_SearchError(t *testing.T) {
+	backend := newTestBackend(t, nil)
+
+	_, err := backend.Search(context.Background(), &logs.SearchParams{Labels: map[string]string{"service": "api"}, Limit: 2})
+	if err == nil || err.Error() != `[http] got response 403: {"errors": ["Forbidden"]}` {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestHTTPBackend_SearchEscaped(t *testing.T) {
+	var query, bodyQuery string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query().Get("q")
+		var body struct {
+			Query string `json:"query"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("invalid request body: %v", err)
+		}
+		bodyQuery = body.Query
+		w.Write([]byte(`[]`))
+	}))
+	t.Cleanup(server.Close)
+
+	backend, err := NewHTTPBackend(&logs.HTTPBackendConfig{
+		URL:  server.URL + "/search?q={{urlquery .Query}}&limit={{.Limit}}",
+		Body: `{"query": {{json .Query}}}`,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `"quoted" & limit=1`
+	if _, err := backend.Search(context.Background(), &logs.SearchParams{Query: want, Limit: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if query != want || bodyQuery != want {
+		t.Errorf("expected the query %q in the url and the body, got %q and %q", want, query, bodyQuery)
+	}
+}
@@ -0,0 +1,268 @@
+package jaeger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flanksource/apm-hub/api"
+	"github.com/flanksource/apm-hub/api/logs"
+	"github.com/flanksource/commons/utils"
+)
+
+// JaegerBackend searches the traces with the HTTP API of the Jaeger query service
+type JaegerBackend struct {
+	client *http.Client
+	config *logs.JaegerBackendConfig
+}
+
+func NewJaegerBackend(config *logs.JaegerBackendConfig) (*JaegerBackend, error) {
+	if config.Address == "" {
+		return nil, fmt.Errorf("address is empty")
+	}
+
+	return &JaegerBackend{
+		client: http.DefaultClient,
+		config: config,
+	}, nil
+}
+
+func (t *JaegerBackend) MatchRoute(q *api.TraceParams) (route logs.SearchRoute, match bool) {
+	return q.MatchRoute(t.config.CommonBackend.Routes)
+}
+
+func (t *JaegerBackend) Search(ctx context.Context, q *api.TraceParams) (api.TraceResults, error) {
+	var result api.TraceResults
+	if q.Service == "" {
+		return result, fmt.Errorf("the service is required to search jaeger")
+	}
+
+	values := url.Values{}
+	values.Set("service", q.Service)
+	values.Set("limit", strconv.FormatInt(q.Limit, 10))
+	if q.Operation != "" {
+		values.Set("operation", q.Operation)
+	}
+	if len(q.Attributes) != 0 {
+		tags, err := json.Marshal(q.Attributes)
+		if err != nil {
+			return result, err
+		}
+		values.Set("tags", string(tags))
+	}
+
+	if start := q.GetStart(); start != nil {
+		values.Set("start", strconv.FormatInt(start.UnixMicro(), 10))
+	}
+	end, err := q.GetSearchEnd()
+	if err != nil {
+		return result, err
+	}
+	if end != nil {
+		values.Set("end", strconv.FormatInt(end.UnixMicro(), 10))
+	}
+
+	if _, err := q.GetMinDuration(); err != nil {
+		return result, err
+	} else if q.MinDuration != "" {
+		values.Set("minDuration", q.MinDuration)
+	}
+	if _, err := q.GetMaxDuration(); err != nil {
+		return result, err
+	} else if q.MaxDuration != "" {
+		values.Set("maxDuration", q.MaxDuration)
+	}
+
+	var resp response
+	if _, err := t.get(ctx, "/api/traces", values, &resp); err != nil {
+		return result, err
+	}
+	if err := resp.error(); err != nil {
+		return result, err
+	}
+
+	for _, trace := range resp.Data {
+		result.Results = append(result.Results, trace.toTrace())
+	}
+	api.SortTraces(result.Results)
+
+	if int64(len(result.Results)) >= q.Limit {
+		result.Results = result.Results[:q.Limit]
+		result.NextPage = api.NextTracePage(result.Results[len(result.Results)-1])
+	}
+	result.Total = len(result.Results)
+	return result, nil
+}
+
+func (t *JaegerBackend) GetTrace(ctx context.Context, traceID string) (*api.Trace, error) {
+	var resp response
+	status, err := t.get(ctx, "/api/traces/"+url.PathEscape(traceID), nil, &resp)
+	if status == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := resp.error(); err != nil {
+		return nil, err
+	}
+
+	if len(resp.Data) == 0 {
+		return nil, nil
+	}
+
+	trace := resp.Data[0].toTrace()
+	return &trace, nil
+}
+
+func (t *JaegerBackend) get(ctx context.Context, path string, values url.Values, v any) (int, error) {
+	endpoint := strings.TrimSuffix(t.config.Address, "/") + path
+	if len(values) != 0 {
+		endpoint += "?" + values.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := t.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("error querying jaeger: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return res.StatusCode, fmt.Errorf("[jaeger] got response: %d", res.StatusCode)
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		return res.StatusCode, fmt.Errorf("error parsing the response body: %w", err)
+	}
+	return res.StatusCode, nil
+}
+
+// response is the response of the Jaeger query API
+type response struct {
+	Data   []trace `json:"data"`
+	Errors []struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+	} `json:"errors"`
+}
+
+func (t response) error() error {
+	if len(t.Errors) == 0 {
+		return nil
+	}
+
+	var messages []string
+	for _, e := range t.Errors {
+		messages = append(messages, e.Msg)
+	}
+	return fmt.Errorf("[jaeger] %s", strings.Join(messages, "; "))
+}
+
+type trace struct {
+	TraceID   string             `json:"traceID"`
+	Spans     []span             `json:"spans"`
+	Processes map[string]process `json:"processes"`
+}
+
+type span struct {
+	TraceID       string      `json:"traceID"`
+	SpanID        string      `json:"spanID"`
+	OperationName string      `json:"operationName"`
+	References    []reference `json:"references"`
+	// StartTime is the unix time in microseconds
+	StartTime int64 `json:"startTime"`
+	// Duration in microseconds
+	Duration  int64      `json:"duration"`
+	Tags      []keyValue `json:"tags"`
+	Logs      []log      `json:"logs"`
+	ProcessID string     `json:"processID"`
+}
+
+type reference struct {
+	RefType string `json:"refType"`
+	TraceID string `json:"traceID"`
+	SpanID  string `json:"spanID"`
+}
+
+type log struct {
+	Timestamp int64      `json:"timestamp"`
+	Fields    []keyValue `json:"fields"`
+}
+
+type keyValue struct {
+	Key   string `json:"key"`
+	Type  string `json:"type"`
+	Value any    `json:"value"`
+}
+
+type process struct {
+	ServiceName string     `json:"serviceName"`
+	Tags        []keyValue `json:"tags"`
+}
+
+func (t trace) toTrace() api.Trace {
+	result := api.Trace{TraceID: t.TraceID}
+	for _, s := range t.Spans {
+		result.Spans = append(result.Spans, s.toSpan(t.Processes[s.ProcessID]))
+	}
+	result.SetSummary()
+	return result
+}
+
+func (t span) toSpan(p process) api.Span {
+	s := api.Span{
+		TraceID:    t.TraceID,
+		SpanID:     t.SpanID,
+		Service:    p.ServiceName,
+		Operation:  t.OperationName,
+		StartTime:  time.UnixMicro(t.StartTime).UTC().Format(time.RFC3339Nano),
+		Duration:   t.Duration,
+		Attributes: toAttributes(t.Tags),
+	}
+
+	for _, ref := range t.References {
+		if ref.RefType == "CHILD_OF" {
+			s.ParentSpanID = ref.SpanID
+			break
+		}
+	}
+
+	for _, l := range t.Logs {
+		event := api.SpanEvent{
+			Time:       time.UnixMicro(l.Timestamp).UTC().Format(time.RFC3339Nano),
+			Attributes: toAttributes(l.Fields),
+		}
+		// The OpenTelemetry events are logs with the event field
+		if name, ok := event.Attributes["event"]; ok {
+			event.Name = name
+			delete(event.Attributes, "event")
+		}
+		s.Events = append(s.Events, event)
+	}
+
+	return s
+}
+
+func toAttributes(tags []keyValue) map[string]string {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	attributes := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		if value, err := utils.Stringify(tag.Value); err == nil {
+			attributes[tag.Key] = value
+		}
+	}
+	return attributes
+}
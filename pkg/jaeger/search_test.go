@@ -0,0 +1,106 @@
+package jaeger
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/flanksource/apm-hub/api"
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+const tracesResponse = `{"data": [
+	{
+		"traceID": "aaa",
+		"spans": [
+			{"traceID": "aaa", "spanID": "1", "operationName": "GET /users", "references": [], "startTime": 1678364951000000, "duration": 3000, "tags": [{"key": "http.status_code", "type": "int64", "value": 200}], "processID": "p1"},
+			{"traceID": "aaa", "spanID": "2", "operationName": "SELECT users", "references": [{"refType": "CHILD_OF", "traceID": "aaa", "spanID": "1"}], "startTime": 1678364951001000, "duration": 1000, "logs": [{"timestamp": 1678364951001500, "fields": [{"key": "event", "type": "string", "value": "retry"}, {"key": "attempt", "type": "int64", "value": 2}]}], "processID": "p2"}
+		],
+		"processes": {"p1": {"serviceName": "frontend"}, "p2": {"serviceName": "db"}}
+	},
+	{
+		"traceID": "bbb",
+		"spans": [{"traceID": "bbb", "spanID": "3", "operationName": "GET /users", "startTime": 1678364952000000, "duration": 500, "processID": "p1"}],
+		"processes": {"p1": {"serviceName": "frontend"}}
+	}
+]}`
+
+func newTestServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/traces", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("service") != "frontend" {
+			w.Write([]byte(`{"data": []}`))
+			return
+		}
+		if tags := r.URL.Query().Get("tags"); tags != `{"http.status_code":"200"}` {
+			t.Errorf("unexpected tags %q", tags)
+		}
+		w.Write([]byte(tracesResponse))
+	})
+	mux.HandleFunc("/api/traces/aaa", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(tracesResponse))
+	})
+	mux.HandleFunc("/api/traces/missing", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"data": null, "errors": [{"code": 404, "msg": "trace not found"}]}`))
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestJaegerBackend_Search(t *testing.T) {
+	server := newTestServer(t)
+	backend, err := NewJaegerBackend(&logs.JaegerBackendConfig{Address: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q := &api.TraceParams{Service: "frontend", Attributes: map[string]string{"http.status_code": "200"}, Limit: 1}
+	res, err := backend.Search(context.Background(), q)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Results) != 1 || res.Results[0].TraceID != "bbb" {
+		t.Fatalf("expected the newest trace, got %+v", res.Results)
+	}
+	if res.NextPage != "2023-03-09T12:29:11.999999Z" {
+		t.Errorf("unexpected next page %q", res.NextPage)
+	}
+}
+
+func TestJaegerBackend_GetTrace(t *testing.T) {
+	server := newTestServer(t)
+	backend, err := NewJaegerBackend(&logs.JaegerBackendConfig{Address: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trace, err := backend.GetTrace(context.Background(), "aaa")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if trace.RootService != "frontend" || trace.RootOperation != "GET /users" || trace.Duration != 3000 {
+		t.Errorf("unexpected trace summary %+v", trace)
+	}
+
+	child := trace.Spans[1]
+	if child.ParentSpanID != "1" || child.Service != "db" {
+		t.Errorf("unexpected child span %+v", child)
+	}
+	if len(child.Events) != 1 || child.Events[0].Name != "retry" || child.Events[0].Attributes["attempt"] != "2" {
+		t.Errorf("unexpected span events %+v", child.Events)
+	}
+	if trace.Spans[0].Attributes["http.status_code"] != "200" {
+		t.Errorf("unexpected span attributes %+v", trace.Spans[0].Attributes)
+	}
+
+	trace, err = backend.GetTrace(context.Background(), "missing")
+	if err != nil || trace != nil {
+		t.Errorf("expected no trace, got %+v, %v", trace, err)
+	}
+}
@@ -0,0 +1,88 @@
+package journald
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// entry is a journal entry, with its fields by name
+type entry map[string]string
+
+// realtime returns the time the entry was received, from the __REALTIME_TIMESTAMP field in microseconds
+func (t entry) realtime() (time.Time, error) {
+	usec, err := strconv.ParseInt(t["__REALTIME_TIMESTAMP"], 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid __REALTIME_TIMESTAMP %q: %w", t["__REALTIME_TIMESTAMP"], err)
+	}
+	return time.UnixMicro(usec), nil
+}
+
+// exportReader reads the entries of the journal export format.
+// See https://systemd.io/JOURNAL_EXPORT_FORMATS/
+//
+// Each field is either NAME=value on a line, or, for binary values, the name on a line
+// followed by the size of the value as a little endian uint64, the value and a newline.
+// The entries are separated by an empty line.
+type exportReader struct {
+	reader *bufio.Reader
+}
+
+func newExportReader(r io.Reader) *exportReader {
+	return &exportReader{reader: bufio.NewReaderSize(r, 64*1024)}
+}
+
+// Next returns the next entry, or io.EOF once all the entries are read
+func (t *exportReader) Next() (entry, error) {
+	e := make(entry)
+	for {
+		line, err := t.reader.ReadString('\n')
+		if err == io.EOF && line == "" {
+			if len(e) != 0 {
+				return e, nil
+			}
+			return nil, io.EOF
+		} else if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			if len(e) == 0 {
+				continue
+			}
+			return e, nil
+		}
+
+		if name, value, ok := strings.Cut(line, "="); ok {
+			e[name] = value
+			continue
+		}
+
+		value, err := t.readBinary()
+		if err != nil {
+			return nil, fmt.Errorf("error reading the field %s: %w", line, err)
+		}
+		e[line] = value
+	}
+}
+
+func (t *exportReader) readBinary() (string, error) {
+	var size uint64
+	if err := binary.Read(t.reader, binary.LittleEndian, &size); err != nil {
+		return "", err
+	}
+
+	value := make([]byte, size+1)
+	if _, err := io.ReadFull(t.reader, value); err != nil {
+		return "", err
+	}
+	if value[size] != '\n' {
+		return "", fmt.Errorf("the value isn't followed by a newline")
+	}
+	return string(value[:size]), nil
+}
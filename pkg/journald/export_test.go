@@ -0,0 +1,43 @@
+package journald
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestExportReader(t *testing.T) {
+	file, err := os.Open("testdata/system.export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var entries []entry
+	reader := newExportReader(file)
+	for {
+		e, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, e)
+	}
+
+	if len(entries) != 5 {
+		t.Fatalf("expected 5 entries, got %d", len(entries))
+	}
+
+	// The message of the third entry has a newline, so it's exported as a binary field
+	if got := entries[2]["MESSAGE"]; got != "upstream timed out\n(110: Connection timed out)" {
+		t.Errorf("unexpected binary message %q", got)
+	}
+	if got := entries[3]["UNIT"]; got != "nginx.service" {
+		t.Errorf("unexpected unit %q", got)
+	}
+	if got := entries[4]["__CURSOR"]; got != "s=1;i=5" {
+		t.Errorf("unexpected cursor %q", got)
+	}
+}
@@ -0,0 +1,432 @@
+package journald
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flanksource/apm-hub/api/logs"
+	"github.com/flanksource/commons/collections"
+	"github.com/flanksource/commons/logger"
+)
+
+// defaultFields are the journal fields always added to the labels of the results
+var defaultFields = []string{"_SYSTEMD_UNIT", "_HOSTNAME", "PRIORITY", "SYSLOG_IDENTIFIER", "_PID", "_BOOT_ID"}
+
+// priorities are the syslog priorities by name
+var priorities = map[string]int{
+	"emerg":   0,
+	"alert":   1,
+	"crit":    2,
+	"err":     3,
+	"warning": 4,
+	"notice":  5,
+	"info":    6,
+	"debug":   7,
+}
+
+// JournaldBackend searches the entries of the systemd journal
+type JournaldBackend struct {
+	config     *logs.JournaldBackendConfig
+	journalctl string
+}
+
+func NewJournaldBackend(config *logs.JournaldBackendConfig) (*JournaldBackend, error) {
+	if _, err := parsePriority(config.Priority); err != nil {
+		return nil, err
+	}
+
+	journalctl := config.Journalctl
+	if journalctl == "" {
+		journalctl = "journalctl"
+	}
+
+	return &JournaldBackend{
+		config:     config,
+		journalctl: journalctl,
+	}, nil
+}
+
+func (t *JournaldBackend) MatchRoute(q *logs.SearchParams) (route logs.SearchRoute, match bool) {
+	return t.config.CommonBackend.Routes.MatchRoute(q)
+}
+
+// filters are the fields the entries are filtered by, on top of the query
+type filters struct {
+	units []string
+	// priority is the highest priority value, i.e. the lowest priority, of the entries. -1 means any.
+	priority int
+	bootID   string
+
+	start, end *time.Time
+	// after is the entry the previous page ended with
+	after *pageKey
+	order string
+}
+
+// getFilters returns the filters of the config, overridden by the unit, priority and boot_id labels of the search params
+func (t *JournaldBackend) getFilters(q *logs.SearchParams) (*filters, error) {
+	f := &filters{
+		units:  append([]string(nil), t.config.Units...),
+		bootID: t.config.BootID,
+		start:  q.GetStart(),
+		end:    q.GetEnd(),
+		order:  q.Order,
+	}
+
+	priority := t.config.Priority
+	if units, ok := q.Labels["unit"]; ok {
+		f.units = strings.Split(units, ",")
+	}
+	if p, ok := q.Labels["priority"]; ok {
+		priority = p
+	}
+	if bootID, ok := q.Labels["boot_id"]; ok {
+		f.bootID = bootID
+	}
+
+	var err error
+	if f.priority, err = parsePriority(priority); err != nil {
+		return nil, err
+	}
+
+	for i, unit := range f.units {
+		f.units[i] = mangleUnit(strings.TrimSpace(unit))
+	}
+	f.bootID = strings.ToLower(strings.ReplaceAll(f.bootID, "-", ""))
+
+	if f.after, err = parseCursor(q.Page); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Search returns the entries that match the filters and the query, ordered by the time they were received.
+//
+// The page token is the time, in unix microseconds, and the cursor of the last entry returned,
+// as the cursors of the journal can't be compared across several journals.
+func (t *JournaldBackend) Search(ctx context.Context, q *logs.SearchParams) (logs.SearchResults, error) {
+	var result logs.SearchResults
+
+	query, err := q.GetQuery()
+	if err != nil {
+		return result, fmt.Errorf("error parsing query: %w", err)
+	}
+
+	f, err := t.getFilters(q)
+	if err != nil {
+		return result, err
+	}
+
+	// One more entry than needed tells whether there are more entries
+	limit := int(q.Limit) + 1
+
+	var matched []match
+	for _, src := range t.sources() {
+		entries, err := t.searchSource(ctx, src, f, query, limit)
+		if err != nil {
+			return result, err
+		}
+		matched = append(matched, entries...)
+	}
+
+	sortMatches(matched, f.order)
+	if len(matched) > int(q.Limit) {
+		matched = matched[:q.Limit]
+		result.NextPage = matched[len(matched)-1].key.encode()
+	}
+
+	for _, m := range matched {
+		result.Results = append(result.Results, m.result)
+	}
+	result.Total = len(result.Results)
+	return result, nil
+}
+
+// source is a journal directory or file
+type source struct {
+	path string
+	// export tells whether the file is in the journal export format, instead of a journal read with journalctl
+	export bool
+	dir    bool
+}
+
+// sources returns the journals of the paths, or the journal of the host when there are no paths
+func (t *JournaldBackend) sources() []source {
+	if len(t.config.Paths) == 0 {
+		return []source{{}}
+	}
+
+	var sources []source
+	for _, pattern := range t.config.Paths {
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			logger.Errorf("error matching %s: %v", pattern, err)
+			continue
+		}
+
+		for _, path := range paths {
+			info, err := os.Stat(path)
+			if err != nil {
+				logger.Errorf("error reading %s: %v", path, err)
+				continue
+			}
+
+			isJournal := strings.HasSuffix(path, ".journal") || strings.HasSuffix(path, ".journal~")
+			sources = append(sources, source{path: path, dir: info.IsDir(), export: !info.IsDir() && !isJournal})
+		}
+	}
+	return sources
+}
+
+// match is an entry that matches the search
+type match struct {
+	key    pageKey
+	result logs.Result
+}
+
+// searchSource returns up to limit entries of the journal that match, in the order of the search
+func (t *JournaldBackend) searchSource(ctx context.Context, src source, f *filters, query logs.QueryExpr, limit int) ([]match, error) {
+	if src.export {
+		file, err := os.Open(src.path)
+		if err != nil {
+			return nil, fmt.Errorf("error opening %s: %w", src.path, err)
+		}
+		defer file.Close()
+
+		// The entries of an export are read fully, as they aren't guaranteed to be ordered
+		matched, err := t.readEntries(newExportReader(file), f, query, 0)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", src.path, err)
+		}
+
+		sortMatches(matched, f.order)
+		if len(matched) > limit {
+			matched = matched[:limit]
+		}
+		return matched, nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, t.journalctl, journalctlArgs(src, f)...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("error running journalctl: %w", err)
+	}
+
+	// journalctl returns the entries in order, so the reading stops once there are enough
+	matched, readErr := t.readEntries(newExportReader(stdout), f, query, limit)
+	cancel()
+	waitErr := cmd.Wait()
+
+	if readErr != nil {
+		return nil, fmt.Errorf("error reading the output of journalctl: %w", readErr)
+	}
+	if waitErr != nil && len(matched) < limit {
+		return nil, fmt.Errorf("error running journalctl: %w: %s", waitErr, strings.TrimSpace(stderr.String()))
+	}
+	return matched, nil
+}
+
+// readEntries returns the entries that match, stopping once there are limit entries. A limit <= 0 means no limit.
+func (t *JournaldBackend) readEntries(reader *exportReader, f *filters, query logs.QueryExpr, limit int) ([]match, error) {
+	var matched []match
+	for limit <= 0 || len(matched) < limit {
+		e, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		m, ok, err := t.matchEntry(e, f)
+		if err != nil {
+			logger.Debugf("error reading journal entry: %v", err)
+			continue
+		}
+
+		if !ok || (query != nil && !query.Match(m.result)) {
+			continue
+		}
+		matched = append(matched, m)
+	}
+
+	return matched, nil
+}
+
+// matchEntry maps the entry to a result, telling whether it matches the filters
+func (t *JournaldBackend) matchEntry(e entry, f *filters) (match, bool, error) {
+	ts, err := e.realtime()
+	if err != nil {
+		return match{}, false, err
+	}
+
+	key := pageKey{usec: ts.UnixMicro(), cursor: e["__CURSOR"]}
+	if (f.start != nil && ts.Before(*f.start)) || (f.end != nil && ts.After(*f.end)) {
+		return match{}, false, nil
+	}
+	if f.after != nil && !key.after(*f.after, f.order) {
+		return match{}, false, nil
+	}
+
+	if len(f.units) != 0 && !collections.Contains(f.units, e["_SYSTEMD_UNIT"]) && !collections.Contains(f.units, e["UNIT"]) {
+		return match{}, false, nil
+	}
+	if f.priority >= 0 {
+		if p, err := strconv.Atoi(e["PRIORITY"]); err != nil || p > f.priority {
+			return match{}, false, nil
+		}
+	}
+	if f.bootID != "" && e["_BOOT_ID"] != f.bootID {
+		return match{}, false, nil
+	}
+
+	labels := collections.MergeMap(nil, t.config.Labels)
+	for _, field := range append(defaultFields, t.config.Fields...) {
+		if value, ok := e[field]; ok {
+			labels[field] = value
+		}
+	}
+
+	return match{
+		key: key,
+		result: logs.Result{
+			Id:      e["__CURSOR"],
+			Time:    ts.UTC().Format(time.RFC3339Nano),
+			Message: e["MESSAGE"],
+			Labels:  labels,
+			Cursor:  key.encode(),
+		},
+	}, true, nil
+}
+
+// journalctlArgs returns the arguments of journalctl that export the entries of the journal,
+// in the order of the search, filtered as much as journalctl can
+func journalctlArgs(src source, f *filters) []string {
+	args := []string{"--no-pager", "--output=export"}
+	switch {
+	case src.dir:
+		args = append(args, "--directory="+src.path)
+	case src.path != "":
+		args = append(args, "--file="+src.path)
+	}
+
+	if f.order != logs.OrderAscending {
+		args = append(args, "--reverse")
+	}
+
+	// journalctl takes whole seconds, so the window is widened and the entries are filtered precisely afterwards
+	start, end := f.start, f.end
+	if f.after != nil {
+		afterTime := time.UnixMicro(f.after.usec)
+		if f.order == logs.OrderAscending {
+			start = &afterTime
+		} else {
+			end = &afterTime
+		}
+	}
+	if start != nil {
+		args = append(args, fmt.Sprintf("--since=@%d", start.Unix()))
+	}
+	if end != nil {
+		args = append(args, fmt.Sprintf("--until=@%d", end.Unix()+1))
+	}
+
+	for _, unit := range f.units {
+		args = append(args, "--unit="+unit)
+	}
+	if f.priority >= 0 {
+		args = append(args, "--priority="+strconv.Itoa(f.priority))
+	}
+	if f.bootID != "" {
+		args = append(args, "_BOOT_ID="+f.bootID)
+	}
+
+	return args
+}
+
+// parsePriority parses the name or the number of a priority. An empty priority is -1.
+func parsePriority(priority string) (int, error) {
+	if priority == "" {
+		return -1, nil
+	}
+
+	if p, ok := priorities[strings.ToLower(priority)]; ok {
+		return p, nil
+	}
+
+	if p, err := strconv.Atoi(priority); err == nil && p >= 0 && p <= 7 {
+		return p, nil
+	}
+
+	return 0, fmt.Errorf("invalid priority %q", priority)
+}
+
+// mangleUnit appends the .service suffix to the units without a type, like journalctl does
+func mangleUnit(unit string) string {
+	if unit == "" || strings.Contains(unit, ".") {
+		return unit
+	}
+	return unit + ".service"
+}
+
+// pageKey orders the entries by the time they were received, then by their cursor
+type pageKey struct {
+	usec   int64
+	cursor string
+}
+
+// after tells whether the key comes after the other key in the order of the search
+func (t pageKey) after(other pageKey, order string) bool {
+	if t == other {
+		return false
+	}
+
+	less := t.usec < other.usec || (t.usec == other.usec && t.cursor < other.cursor)
+	if order == logs.OrderAscending {
+		return !less
+	}
+	return less
+}
+
+func (t pageKey) encode() string {
+	return strconv.FormatInt(t.usec, 10) + "|" + t.cursor
+}
+
+// parseCursor parses the page token returned by a previous search
+func parseCursor(page string) (*pageKey, error) {
+	if page == "" {
+		return nil, nil
+	}
+
+	usec, cursor, _ := strings.Cut(page, "|")
+	ts, err := strconv.ParseInt(usec, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid page token %q: %w", page, err)
+	}
+
+	return &pageKey{usec: ts, cursor: cursor}, nil
+}
+
+// sortMatches sorts the entries in the order of the search
+func sortMatches(matched []match, order string) {
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[j].key.after(matched[i].key, order)
+	})
+}
@@ -0,0 +1,190 @@
+package journald
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+func ids(results []logs.Result) []string {
+	var ids []string
+	for _, r := range results {
+		ids = append(ids, r.Id)
+	}
+	return ids
+}
+
+func TestJournaldBackend_Search(t *testing.T) {
+	tests := []struct {
+		name   string
+		config logs.JournaldBackendConfig
+		params logs.SearchParams
+		want   []string
+	}{
+		{
+			name:   "units",
+			config: logs.JournaldBackendConfig{Units: []string{"nginx"}},
+			want:   []string{"s=1;i=5", "s=1;i=4", "s=1;i=3", "s=1;i=1"},
+		},
+		{
+			name:   "priority label",
+			config: logs.JournaldBackendConfig{Priority: "info"},
+			params: logs.SearchParams{Labels: map[string]string{"priority": "warning"}},
+			want:   []string{"s=1;i=4", "s=1;i=3"},
+		},
+		{
+			name:   "boot id",
+			params: logs.SearchParams{Labels: map[string]string{"boot_id": "0f1e2d3c-4b5a-6978-8796-a5b4c3d2e1f0"}},
+			want:   []string{"s=1;i=5", "s=1;i=4"},
+		},
+		{
+			name:   "time window",
+			params: logs.SearchParams{Start: "2023-03-09T12:00:01Z", End: "2023-03-09T12:00:02Z"},
+			want:   []string{"s=1;i=3", "s=1;i=2"},
+		},
+		{
+			name:   "query",
+			params: logs.SearchParams{Query: `"timed out" PRIORITY<=3`},
+			want:   []string{"s=1;i=3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Paths = []string{"testdata/*.export"}
+			backend, err := NewJournaldBackend(&tt.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.params.Start == "" {
+				tt.params.Start = "2023-03-09T00:00:00Z"
+			}
+			tt.params.SetDefaults()
+
+			res, err := backend.Search(context.Background(), &tt.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := ids(res.Results); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJournaldBackend_SearchPages(t *testing.T) {
+	backend, err := NewJournaldBackend(&logs.JournaldBackendConfig{
+		CommonBackend: logs.CommonBackend{Labels: map[string]string{"type": "VM"}},
+		Paths:         []string{"testdata/system.export"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, order := range []string{logs.OrderDescending, logs.OrderAscending} {
+		q := &logs.SearchParams{Start: "2023-03-09T00:00:00Z", Limit: 2, Order: order}
+		q.SetDefaults()
+
+		var pages [][]string
+		for {
+			res, err := backend.Search(context.Background(), q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pages = append(pages, ids(res.Results))
+
+			if res.NextPage == "" {
+				break
+			}
+			q.Page = res.NextPage
+		}
+
+		want := [][]string{{"s=1;i=5", "s=1;i=4"}, {"s=1;i=3", "s=1;i=2"}, {"s=1;i=1"}}
+		if order == logs.OrderAscending {
+			want = [][]string{{"s=1;i=1", "s=1;i=2"}, {"s=1;i=3", "s=1;i=4"}, {"s=1;i=5"}}
+		}
+		if !reflect.DeepEqual(pages, want) {
+			t.Errorf("%s: got pages %v, want %v", order, pages, want)
+		}
+	}
+
+	q := &logs.SearchParams{Start: "2023-03-09T00:00:00Z", Query: `id="s=1;i=2"`}
+	q.SetDefaults()
+	res, err := backend.Search(context.Background(), q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := logs.Result{
+		Id:      "s=1;i=2",
+		Time:    "2023-03-09T12:00:01Z",
+		Message: "Accepted publickey for root",
+		Cursor:  "1678363201000000|s=1;i=2",
+		Labels: map[string]string{
+			"type":              "VM",
+			"_SYSTEMD_UNIT":     "sshd.service",
+			"_HOSTNAME":         "vm-1",
+			"PRIORITY":          "5",
+			"SYSLOG_IDENTIFIER": "sshd",
+			"_PID":              "42",
+			"_BOOT_ID":          "a1b2c3d4e5f60718293a4b5c6d7e8f90",
+		},
+	}
+	if len(res.Results) != 1 || !reflect.DeepEqual(res.Results[0], want) {
+		t.Errorf("got %+v, want %+v", res.Results, want)
+	}
+}
+
+// TestJournaldBackend_SearchJournalctl reads the journal with a stand-in of journalctl that exports the test entries
+func TestJournaldBackend_SearchJournalctl(t *testing.T) {
+	dir := t.TempDir()
+	export, err := filepath.Abs("testdata/system.export")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	journalctl := filepath.Join(dir, "journalctl")
+	script := "#!/bin/sh\necho \"$@\" > " + filepath.Join(dir, "args") + "\ncat " + export + "\n"
+	if err := os.WriteFile(journalctl, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	backend, err := NewJournaldBackend(&logs.JournaldBackendConfig{
+		Paths:      []string{dir},
+		Journalctl: journalctl,
+		Units:      []string{"nginx"},
+		Priority:   "info",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q := &logs.SearchParams{Start: "2023-03-09T12:00:00Z", End: "2023-03-09T13:00:00Z", Limit: 2, Order: logs.OrderAscending}
+	q.SetDefaults()
+	res, err := backend.Search(context.Background(), q)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := ids(res.Results); !reflect.DeepEqual(got, []string{"s=1;i=1", "s=1;i=3"}) {
+		t.Errorf("unexpected results %v", got)
+	}
+	if res.NextPage != "1678363202000000|s=1;i=3" {
+		t.Errorf("unexpected next page %q", res.NextPage)
+	}
+
+	args, err := os.ReadFile(filepath.Join(dir, "args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantArgs := "--no-pager --output=export --directory=" + dir + " --since=@1678363200 --until=@1678366801 --unit=nginx.service --priority=6"
+	if got := strings.TrimSpace(string(args)); got != wantArgs {
+		t.Errorf("got args %s, want %s", got, wantArgs)
+	}
+}
@@ -0,0 +1,619 @@
+package kubernetes
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/flanksource/apm-hub/api/logs"
+	"github.com/flanksource/commons/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	logCacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "apm_hub_kubernetes_log_cache_requests_total",
+		Help: "Searches of the logs of a container by whether they were served from the cache (hit) or fetched whole (miss). The hit ratio is hit / (hit + miss).",
+	}, []string{"result"})
+	logCacheBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "apm_hub_kubernetes_log_cache_bytes",
+		Help: "Size of the cached logs of the containers, in memory or spilled to disk.",
+	}, []string{"medium"})
+	logCacheEntries = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "apm_hub_kubernetes_log_cache_entries",
+		Help: "Number of container instances whose logs are cached, in memory or spilled to disk.",
+	}, []string{"medium"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(logCacheRequests, logCacheBytes, logCacheEntries)
+}
+
+// LogCache keeps the latest lines of the instances of the containers, keyed by pod UID, container and restart count,
+// so the searches that follow only fetch the lines written since the last cached one.
+// The least recently searched instances are evicted once the cache is full, to disk if a directory is set,
+// and the ones that haven't been searched for the TTL are dropped.
+type LogCache struct {
+	maxSize      int64
+	maxEntrySize int64
+	ttl          time.Duration
+	// disk holds the entries evicted from memory, nil if they aren't spilled
+	disk *logDiskCache
+
+	lock    sync.Mutex
+	entries map[logCacheKey]*list.Element
+	// lru holds the entries, the most recently searched first
+	lru  *list.List
+	size int64
+}
+
+func NewLogCache(config *logs.KubernetesLogCacheConfig) (*LogCache, error) {
+	maxSize, err := parseSize(config.MaxSize, 64<<20)
+	if err != nil {
+		return nil, fmt.Errorf("invalid maxSize: %w", err)
+	}
+
+	maxEntrySize, err := parseSize(config.MaxEntrySize, 1<<20)
+	if err != nil {
+		return nil, fmt.Errorf("invalid maxEntrySize: %w", err)
+	}
+
+	ttl := 5 * time.Minute
+	if config.TTL != "" {
+		if ttl, err = time.ParseDuration(config.TTL); err != nil {
+			return nil, fmt.Errorf("invalid ttl %q: %w", config.TTL, err)
+		}
+	}
+
+	cache := &LogCache{
+		maxSize:      maxSize,
+		maxEntrySize: maxEntrySize,
+		ttl:          ttl,
+		entries:      make(map[logCacheKey]*list.Element),
+		lru:          list.New(),
+	}
+
+	if config.Dir != "" {
+		maxDiskSize, err := parseSize(config.MaxDiskSize, 1<<30)
+		if err != nil {
+			return nil, fmt.Errorf("invalid maxDiskSize: %w", err)
+		}
+		if cache.disk, err = newLogDiskCache(config.Dir, maxDiskSize, ttl); err != nil {
+			return nil, err
+		}
+	}
+
+	return cache, nil
+}
+
+// parseSize parses a size, e.g. 64Mi, in bytes
+func parseSize(value string, defaultSize int64) (int64, error) {
+	if value == "" {
+		return defaultSize, nil
+	}
+
+	quantity, err := resource.ParseQuantity(value)
+	if err != nil {
+		return 0, err
+	}
+	if quantity.Value() <= 0 {
+		return 0, fmt.Errorf("%q is not a positive size", value)
+	}
+	return quantity.Value(), nil
+}
+
+// logCacheKey identifies an instance of a container
+type logCacheKey struct {
+	Cluster      string    `json:"cluster,omitempty"`
+	PodUID       types.UID `json:"podUID"`
+	Container    string    `json:"container"`
+	RestartCount int32     `json:"restartCount"`
+}
+
+// getLogCacheKey returns the key of the instance of the container.
+// The instances without a status can't be told apart so they aren't cached.
+func getLogCacheKey(cluster string, pod v1.Pod, instance ContainerLogs) (logCacheKey, bool) {
+	if pod.UID == "" || instance.Status == nil {
+		return logCacheKey{}, false
+	}
+
+	key := logCacheKey{
+		Cluster:      cluster,
+		PodUID:       pod.UID,
+		Container:    instance.Container,
+		RestartCount: instance.Status.RestartCount,
+	}
+	if instance.Previous {
+		key.RestartCount--
+	}
+	return key, true
+}
+
+// logCacheEntry holds the latest lines of an instance of a container, oldest first
+type logCacheEntry struct {
+	Key   logCacheKey   `json:"key"`
+	Lines []logs.Result `json:"lines"`
+	// Since is the time from which all the lines of the instance are held, zero if they are held since it started
+	Since time.Time `json:"since"`
+	// Final is set for the instances that have terminated, whose logs don't change anymore
+	Final    bool      `json:"final,omitempty"`
+	Size     int64     `json:"size"`
+	LastUsed time.Time `json:"lastUsed"`
+
+	// lock is held while the entry is searched
+	lock sync.Mutex
+	// cached is set once the entry holds the lines of the instance
+	cached bool
+	// refs is the number of searches using the entry, which isn't evicted while in use
+	refs int
+	// accounted is the size of the entry counted in the size of the cache
+	accounted int64
+	element   *list.Element
+}
+
+// lineSize returns the size of a line as returned by the logs API
+func lineSize(line logs.Result) int64 {
+	// The message keeps the space after the timestamp
+	return int64(len(line.Time) + len(line.Message) + 1)
+}
+
+// linesSince returns the cached lines at or after the given time
+func (e *logCacheEntry) linesSince(since time.Time) []logs.Result {
+	i := sort.Search(len(e.Lines), func(i int) bool {
+		return !e.Lines[i].GetTime().Before(since)
+	})
+	return e.Lines[i:]
+}
+
+// covers reports whether the entry holds all the lines a search since the given time, limited to the tail lines, returns
+func (e *logCacheEntry) covers(since time.Time, tail int64) bool {
+	if int64(len(e.linesSince(since))) >= tail {
+		return true
+	}
+	return e.Since.IsZero() || (!since.IsZero() && !since.Before(e.Since))
+}
+
+// selectLines returns the lines the logs API returns for the search:
+// the last tail lines since the given time, cut at the byte limit
+func (e *logCacheEntry) selectLines(since time.Time, tail int64, limitBytes *int64) []logs.Result {
+	lines := e.linesSince(since)
+	if int64(len(lines)) > tail {
+		lines = lines[int64(len(lines))-tail:]
+	}
+
+	// The logs API cuts the line at the limit, only the whole lines are returned here
+	if limitBytes != nil {
+		var size int64
+		for i, line := range lines {
+			if size += lineSize(line); size > *limitBytes {
+				lines = lines[:i]
+				break
+			}
+		}
+	}
+	return append([]logs.Result(nil), lines...)
+}
+
+// set replaces the lines of the entry with the last tail lines of the instance since the given time
+func (e *logCacheEntry) set(lines []logs.Result, since time.Time, tail int64) {
+	e.Lines = lines
+	e.Since = since
+	if len(lines) > 0 && int64(len(lines)) >= tail {
+		// The older lines were left out by the tail
+		e.Since = lines[0].GetTime()
+	}
+	e.cached = true
+}
+
+// append adds the lines fetched since the last cached line to the entry.
+// The lines at the time of the last cached line are fetched again, so as many are skipped.
+func (e *logCacheEntry) append(lines []logs.Result) {
+	last, fetchedAgain := e.Since, 0
+	if n := len(e.Lines); n > 0 {
+		last = e.Lines[n-1].GetTime()
+		for i := n - 1; i >= 0 && e.Lines[i].Time == e.Lines[n-1].Time; i-- {
+			fetchedAgain++
+		}
+	}
+
+	for _, line := range lines {
+		ts := line.GetTime()
+		if ts.Before(last) {
+			continue
+		}
+		if ts.Equal(last) && fetchedAgain > 0 {
+			fetchedAgain--
+			continue
+		}
+		e.Lines = append(e.Lines, line)
+	}
+}
+
+// trim drops the oldest lines over the max size, after which the entry only holds the lines since the oldest one left
+func (e *logCacheEntry) trim(maxSize int64) {
+	e.Size = 0
+	for _, line := range e.Lines {
+		e.Size += lineSize(line)
+	}
+
+	var dropped int
+	for ; e.Size > maxSize && dropped < len(e.Lines); dropped++ {
+		e.Size -= lineSize(e.Lines[dropped])
+	}
+	if dropped == 0 {
+		return
+	}
+
+	e.Since = e.Lines[dropped-1].GetTime()
+	e.Lines = append([]logs.Result(nil), e.Lines[dropped:]...)
+	if len(e.Lines) > 0 {
+		e.Since = e.Lines[0].GetTime()
+	}
+}
+
+// snapshot returns a copy of the lines of the entry, which are replaced or appended to but never changed in place
+func (e *logCacheEntry) snapshot() *logCacheEntry {
+	return &logCacheEntry{Key: e.Key, Lines: e.Lines, Since: e.Since, Final: e.Final, Size: e.Size, LastUsed: e.LastUsed, cached: e.cached}
+}
+
+func (e *logCacheEntry) reset() {
+	e.Lines = nil
+	e.Since = time.Time{}
+	e.Size = 0
+	e.cached = false
+}
+
+// errLogsTruncated is returned when the lines written since the logs were cached are more than an entry holds
+var errLogsTruncated = errors.New("more logs were written than can be cached")
+
+// GetLogs returns the lines of the instance of the container searched, like Client.GetLogsForContainer.
+// The lines written since the last cached line are fetched and the search is served from the cache if it holds the lines searched,
+// else the lines are fetched whole and cached.
+func (c *LogCache) GetLogs(ctx context.Context, client *Client, cluster string, q *logs.SearchParams, pod v1.Pod, instance ContainerLogs) ([]logs.Result, error) {
+	options := getLogOptions(q, instance.Container, instance.Previous)
+	key, ok := getLogCacheKey(cluster, pod, instance)
+	if !ok || options.TailLines == nil {
+		// Without a line limit, the lines searched can't be told from the cached ones
+		lines, _, err := client.fetchLogs(ctx, pod, options)
+		return lines, err
+	}
+
+	entry := c.acquire(key)
+	defer c.release(entry)
+
+	var since time.Time
+	if options.SinceTime != nil {
+		// The since time of the logs API has a precision of seconds
+		since = options.SinceTime.Truncate(time.Second)
+	}
+	tail := *options.TailLines
+
+	if entry.cached {
+		err := c.refresh(ctx, client, pod, entry)
+		if err == nil && entry.covers(since, tail) {
+			logCacheRequests.WithLabelValues("hit").Inc()
+			return entry.selectLines(since, tail, options.LimitBytes), nil
+		}
+		if err != nil {
+			logger.Tracef("error refreshing the cached logs of %s/%s: %v", pod.Name, instance.Container, err)
+		}
+	}
+	logCacheRequests.WithLabelValues("miss").Inc()
+
+	// The byte limit cuts the newest lines off, so it's applied to the cached lines instead
+	fetch := *options
+	fetch.LimitBytes = nil
+	lines, _, err := client.fetchLogs(ctx, pod, &fetch)
+	if err != nil {
+		entry.reset()
+		return nil, err
+	}
+
+	entry.set(lines, since, tail)
+	entry.Final = instance.Previous || (instance.Status.State.Terminated != nil)
+	entry.trim(c.maxEntrySize)
+	return entry.selectLines(since, tail, options.LimitBytes), nil
+}
+
+// refresh appends the lines written since the last cached line to the entry
+func (c *LogCache) refresh(ctx context.Context, client *Client, pod v1.Pod, entry *logCacheEntry) error {
+	if entry.Final {
+		return nil
+	}
+
+	options := &v1.PodLogOptions{
+		Container:  entry.Key.Container,
+		Timestamps: true,
+		LimitBytes: &c.maxEntrySize,
+	}
+	last := entry.Since
+	if n := len(entry.Lines); n > 0 {
+		last = entry.Lines[n-1].GetTime()
+	}
+	if !last.IsZero() {
+		options.SinceTime = &metav1.Time{Time: last}
+	}
+
+	lines, size, err := client.fetchLogs(ctx, pod, options)
+	if err != nil {
+		return err
+	}
+	if size >= c.maxEntrySize {
+		return errLogsTruncated
+	}
+
+	entry.append(lines)
+	entry.trim(c.maxEntrySize)
+	return nil
+}
+
+// acquire returns the entry of the key, from memory or disk or else a new one, locked for the search
+func (c *LogCache) acquire(key logCacheKey) *logCacheEntry {
+	c.lock.Lock()
+	c.expire()
+
+	var entry *logCacheEntry
+	if element, ok := c.entries[key]; ok {
+		entry = element.Value.(*logCacheEntry)
+		c.lru.MoveToFront(element)
+	} else {
+		entry = &logCacheEntry{Key: key}
+		if c.disk != nil {
+			if spilled, ok := c.disk.take(key); ok {
+				entry = spilled
+			}
+		}
+		entry.element = c.lru.PushFront(entry)
+		c.entries[key] = entry.element
+		logCacheEntries.WithLabelValues("memory").Inc()
+	}
+	entry.refs++
+	entry.LastUsed = time.Now()
+	c.lock.Unlock()
+
+	entry.lock.Lock()
+	return entry
+}
+
+// release unlocks the entry once searched, counting its size, and evicts the entries over the size of the cache
+func (c *LogCache) release(entry *logCacheEntry) {
+	c.lock.Lock()
+	entry.refs--
+	var size int64
+	if entry.cached {
+		size = entry.Size
+	}
+	c.size += size - entry.accounted
+	logCacheBytes.WithLabelValues("memory").Add(float64(size - entry.accounted))
+	entry.accounted = size
+
+	if !entry.cached && entry.refs == 0 {
+		c.remove(entry)
+	}
+	evicted := c.evict()
+	c.lock.Unlock()
+	entry.lock.Unlock()
+
+	for _, e := range evicted {
+		if err := c.disk.put(e); err != nil {
+			logger.Warnf("error spilling the cached logs of %s/%s to disk: %v", e.Key.PodUID, e.Key.Container, err)
+		}
+	}
+}
+
+// remove drops the entry from memory
+func (c *LogCache) remove(entry *logCacheEntry) {
+	c.lru.Remove(entry.element)
+	delete(c.entries, entry.Key)
+	c.size -= entry.accounted
+	logCacheBytes.WithLabelValues("memory").Sub(float64(entry.accounted))
+	logCacheEntries.WithLabelValues("memory").Dec()
+	entry.accounted = 0
+}
+
+// evict removes the least recently searched entries not in use until the cache fits its size,
+// and returns the ones to spill to disk once the cache is unlocked.
+// Until they're written, the entries are pending on the disk cache, so the entry of their key is always found in memory or on disk.
+func (c *LogCache) evict() []*logCacheEntry {
+	var evicted []*logCacheEntry
+	for element := c.lru.Back(); element != nil && c.size > c.maxSize; {
+		entry := element.Value.(*logCacheEntry)
+		element = element.Prev()
+		if entry.refs > 0 {
+			continue
+		}
+
+		c.remove(entry)
+		if c.disk != nil {
+			spilled := entry.snapshot()
+			c.disk.pend(spilled)
+			evicted = append(evicted, spilled)
+		}
+	}
+	return evicted
+}
+
+// expire drops the entries that haven't been searched for the TTL
+func (c *LogCache) expire() {
+	for element := c.lru.Back(); element != nil; {
+		entry := element.Value.(*logCacheEntry)
+		element = element.Prev()
+		if time.Since(entry.LastUsed) <= c.ttl {
+			return
+		}
+		if entry.refs == 0 {
+			c.remove(entry)
+		}
+	}
+}
+
+// logDiskCache holds the entries evicted from memory in files, dropping the least recently searched ones once full
+type logDiskCache struct {
+	dir     string
+	maxSize int64
+	ttl     time.Duration
+
+	lock  sync.Mutex
+	files map[logCacheKey]*list.Element
+	// pending holds the entries evicted from memory that are being written to disk
+	pending map[logCacheKey]*logCacheEntry
+	// lru holds the spilled files, the most recently searched first
+	lru  *list.List
+	size int64
+}
+
+// spilledFile is the file of an entry spilled to disk
+type spilledFile struct {
+	key      logCacheKey
+	path     string
+	size     int64
+	lastUsed time.Time
+}
+
+func newLogDiskCache(dir string, maxSize int64, ttl time.Duration) (*logDiskCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating the cache directory: %w", err)
+	}
+
+	// Each cache spills to its own directory as the files of another cache can't be told apart
+	dir, err := os.MkdirTemp(dir, "kubernetes-logs-")
+	if err != nil {
+		return nil, fmt.Errorf("error creating the cache directory: %w", err)
+	}
+
+	return &logDiskCache{
+		dir:     dir,
+		maxSize: maxSize,
+		ttl:     ttl,
+		files:   make(map[logCacheKey]*list.Element),
+		pending: make(map[logCacheKey]*logCacheEntry),
+		lru:     list.New(),
+	}, nil
+}
+
+// pend holds the entry until it's written to disk
+func (d *logDiskCache) pend(entry *logCacheEntry) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.pending[entry.Key] = entry
+}
+
+// put writes the pending entry to disk and removes the least recently searched files over the size of the cache.
+// The entry is dropped if it has been taken back, or evicted again, while written.
+func (d *logDiskCache) put(entry *logCacheEntry) error {
+	path, size, err := d.write(entry)
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.pending[entry.Key] != entry {
+		if err == nil {
+			removeSpilledFile(path)
+		}
+		return nil
+	}
+	delete(d.pending, entry.Key)
+	if err != nil {
+		return err
+	}
+
+	if element, ok := d.files[entry.Key]; ok {
+		d.remove(element)
+	}
+	file := &spilledFile{key: entry.Key, path: path, size: size, lastUsed: entry.LastUsed}
+	d.files[entry.Key] = d.lru.PushFront(file)
+	d.size += file.size
+	logCacheBytes.WithLabelValues("disk").Add(float64(file.size))
+	logCacheEntries.WithLabelValues("disk").Inc()
+
+	for element := d.lru.Back(); element != nil && (d.size > d.maxSize || time.Since(element.Value.(*spilledFile).lastUsed) > d.ttl); element = d.lru.Back() {
+		d.remove(element)
+	}
+	return nil
+}
+
+// write writes the entry to a new file and returns its path and size
+func (d *logDiskCache) write(entry *logCacheEntry) (string, int64, error) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return "", 0, err
+	}
+
+	// Each write has its own file, so a write of an entry evicted again doesn't overwrite the one before
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%s/%s/%s/%d", entry.Key.Cluster, entry.Key.PodUID, entry.Key.Container, entry.Key.RestartCount)))
+	file, err := os.CreateTemp(d.dir, hex.EncodeToString(hash[:])+"-*.json")
+	if err != nil {
+		return "", 0, err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		removeSpilledFile(file.Name())
+		return "", 0, err
+	}
+	if err := file.Close(); err != nil {
+		removeSpilledFile(file.Name())
+		return "", 0, err
+	}
+	return file.Name(), int64(len(data)), nil
+}
+
+// take reads the entry of the key back from disk and removes its file
+func (d *logDiskCache) take(key logCacheKey) (*logCacheEntry, bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	// The entry being written is still read by the write, so a copy of it is returned
+	if entry, ok := d.pending[key]; ok {
+		delete(d.pending, key)
+		return entry.snapshot(), true
+	}
+
+	element, ok := d.files[key]
+	if !ok {
+		return nil, false
+	}
+	file := element.Value.(*spilledFile)
+
+	data, err := os.ReadFile(file.path)
+	d.remove(element)
+	if err != nil || time.Since(file.lastUsed) > d.ttl {
+		return nil, false
+	}
+
+	var entry logCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, false
+	}
+	entry.cached = true
+	return &entry, true
+}
+
+// remove deletes the file of the element
+func (d *logDiskCache) remove(element *list.Element) {
+	file := element.Value.(*spilledFile)
+	d.lru.Remove(element)
+	delete(d.files, file.key)
+	d.size -= file.size
+	logCacheBytes.WithLabelValues("disk").Sub(float64(file.size))
+	logCacheEntries.WithLabelValues("disk").Dec()
+	removeSpilledFile(file.path)
+}
+
+func removeSpilledFile(path string) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		logger.Warnf("error removing the cached logs %s: %v", path, err)
+	}
+}
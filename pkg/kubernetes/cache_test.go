@@ -0,0 +1,311 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/flanksource/apm-hub/api/logs"
+	"github.com/flanksource/kommons"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+// fakeLogs serves the logs of a container like the logs API, with its requests recorded
+type fakeLogs struct {
+	lock     sync.Mutex
+	lines    []string
+	requests []string
+}
+
+func (f *fakeLogs) write(ts time.Time, message string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.lines = append(f.lines, ts.Format(time.RFC3339Nano)+" "+message)
+}
+
+func (f *fakeLogs) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.requests = append(f.requests, r.URL.RawQuery)
+
+	query := r.URL.Query()
+	lines := f.lines
+	if since := query.Get("sinceTime"); since != "" {
+		sinceTime, _ := time.Parse(time.RFC3339, since)
+		var filtered []string
+		for _, line := range lines {
+			if ts, _ := time.Parse(time.RFC3339Nano, strings.Split(line, " ")[0]); !ts.Before(sinceTime) {
+				filtered = append(filtered, line)
+			}
+		}
+		lines = filtered
+	}
+	if tail, err := strconv.Atoi(query.Get("tailLines")); err == nil && len(lines) > tail {
+		lines = lines[len(lines)-tail:]
+	}
+
+	var body string
+	for _, line := range lines {
+		body += line + "\n"
+	}
+	if limit, err := strconv.Atoi(query.Get("limitBytes")); err == nil && len(body) > limit {
+		body = body[:limit]
+	}
+	fmt.Fprint(w, body)
+}
+
+func newFakeLogsClient(t *testing.T, fake *fakeLogs) *Client {
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	kommonsClient := &kommons.Client{GetRESTConfig: func() (*rest.Config, error) {
+		return &rest.Config{Host: server.URL}, nil
+	}}
+	client, err := GetKubeClient(kommonsClient, &logs.KubernetesSearchBackendConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func messages(lines []logs.Result) []string {
+	var list []string
+	for _, line := range lines {
+		list = append(list, strings.TrimSpace(line.Message))
+	}
+	return list
+}
+
+func TestLogCacheGetLogs(t *testing.T) {
+	fake := &fakeLogs{}
+	start := time.Date(2023, 3, 9, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		fake.write(start.Add(time.Duration(i)*time.Second), fmt.Sprintf("line %d", i))
+	}
+	client := newFakeLogsClient(t, fake)
+
+	cache, err := NewLogCache(&logs.KubernetesLogCacheConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pod := v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "api-0", Namespace: "default", UID: "uid-1"}}
+	instance := ContainerLogs{Container: "api", Status: &v1.ContainerStatus{Name: "api"}}
+	q := &logs.SearchParams{LimitPerItem: 3}
+
+	hits, misses := testutil.ToFloat64(logCacheRequests.WithLabelValues("hit")), testutil.ToFloat64(logCacheRequests.WithLabelValues("miss"))
+
+	lines, err := cache.GetLogs(context.Background(), client, "", q, pod, instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"line 2", "line 3", "line 4"}; !reflect.DeepEqual(messages(lines), want) {
+		t.Errorf("got %v, want %v", messages(lines), want)
+	}
+
+	// Two lines at the same second as the last cached one, which the next fetch returns again
+	fake.write(start.Add(4*time.Second+time.Millisecond), "line 5")
+	fake.write(start.Add(5*time.Second), "line 6")
+
+	lines, err = cache.GetLogs(context.Background(), client, "", q, pod, instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"line 4", "line 5", "line 6"}; !reflect.DeepEqual(messages(lines), want) {
+		t.Errorf("got %v, want %v", messages(lines), want)
+	}
+
+	if len(fake.requests) != 2 {
+		t.Fatalf("expected 2 requests, got %v", fake.requests)
+	}
+	if !strings.Contains(fake.requests[1], "sinceTime=2023-03-09T12%3A00%3A04Z") || strings.Contains(fake.requests[1], "tailLines") {
+		t.Errorf("expected the lines since the last cached one to be fetched, got %s", fake.requests[1])
+	}
+	if got := testutil.ToFloat64(logCacheRequests.WithLabelValues("hit")) - hits; got != 1 {
+		t.Errorf("expected 1 hit, got %v", got)
+	}
+	if got := testutil.ToFloat64(logCacheRequests.WithLabelValues("miss")) - misses; got != 1 {
+		t.Errorf("expected 1 miss, got %v", got)
+	}
+
+	// The lines before the cached ones are fetched whole
+	lines, err = cache.GetLogs(context.Background(), client, "", &logs.SearchParams{LimitPerItem: 6}, pod, instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"line 1", "line 2", "line 3", "line 4", "line 5", "line 6"}; !reflect.DeepEqual(messages(lines), want) {
+		t.Errorf("got %v, want %v", messages(lines), want)
+	}
+	if len(fake.requests) != 4 || !strings.Contains(fake.requests[3], "tailLines=6") {
+		t.Errorf("expected the lines to be fetched whole, got %v", fake.requests)
+	}
+}
+
+func TestLogCacheSpill(t *testing.T) {
+	fake := &fakeLogs{}
+	start := time.Date(2023, 3, 9, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		fake.write(start.Add(time.Duration(i)*time.Second), fmt.Sprintf("line %d", i))
+	}
+	client := newFakeLogsClient(t, fake)
+
+	// The cache fits a single entry in memory
+	cache, err := NewLogCache(&logs.KubernetesLogCacheConfig{MaxSize: "100", Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q := &logs.SearchParams{LimitPerItem: 10}
+	first := v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "api-0", Namespace: "default", UID: "uid-1"}}
+	second := v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "api-0", Namespace: "default", UID: "uid-2"}}
+	previous := ContainerLogs{Container: "api", Previous: true, Status: &v1.ContainerStatus{Name: "api", RestartCount: 1}}
+
+	for _, pod := range []v1.Pod{first, second} {
+		if _, err := cache.GetLogs(context.Background(), client, "", q, pod, previous); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cache.lru.Len() != 1 || cache.disk.lru.Len() != 1 {
+		t.Fatalf("expected an entry in memory and one on disk, got %d and %d", cache.lru.Len(), cache.disk.lru.Len())
+	}
+
+	// The logs of a previous instance don't change, so they're served from the disk without a request
+	lines, err := cache.GetLogs(context.Background(), client, "", q, first, previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"line 0", "line 1", "line 2"}; !reflect.DeepEqual(messages(lines), want) {
+		t.Errorf("got %v, want %v", messages(lines), want)
+	}
+	if len(fake.requests) != 2 {
+		t.Errorf("expected 2 requests, got %v", fake.requests)
+	}
+}
+
+func TestLogCacheSpillConcurrent(t *testing.T) {
+	fake := &fakeLogs{}
+	start := time.Date(2023, 3, 9, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		fake.write(start.Add(time.Duration(i)*time.Second), fmt.Sprintf("line %d", i))
+	}
+	client := newFakeLogsClient(t, fake)
+
+	cache, err := NewLogCache(&logs.KubernetesLogCacheConfig{MaxSize: "100", Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q := &logs.SearchParams{LimitPerItem: 10}
+	pods := []v1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Name: "api-0", Namespace: "default", UID: "uid-1"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "api-0", Namespace: "default", UID: "uid-2"}},
+	}
+	previous := ContainerLogs{Container: "api", Previous: true, Status: &v1.ContainerStatus{Name: "api", RestartCount: 1}}
+
+	// An entry being spilled is always found in memory or on disk, so each one is only fetched once
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(pod v1.Pod) {
+			defer wg.Done()
+			lines, err := cache.GetLogs(context.Background(), client, "", q, pod, previous)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if want := []string{"line 0", "line 1", "line 2"}; !reflect.DeepEqual(messages(lines), want) {
+				t.Errorf("got %v, want %v", messages(lines), want)
+			}
+		}(pods[i%2])
+	}
+	wg.Wait()
+
+	if len(fake.requests) != 2 {
+		t.Errorf("expected 2 requests, got %v", fake.requests)
+	}
+}
+
+func TestLogDiskCachePending(t *testing.T) {
+	disk, err := newLogDiskCache(t.TempDir(), 1<<20, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := logCacheKey{PodUID: "uid-1", Container: "api"}
+	entry := &logCacheEntry{Key: key, Lines: []logs.Result{{Message: "line 0"}}, LastUsed: time.Now(), cached: true}
+
+	// An entry being written is taken back from memory, and its write is dropped
+	disk.pend(entry)
+	taken, ok := disk.take(key)
+	if !ok || taken == entry || !reflect.DeepEqual(messages(taken.Lines), []string{"line 0"}) {
+		t.Fatalf("expected a copy of the pending entry, got %+v", taken)
+	}
+	if err := disk.put(entry); err != nil {
+		t.Fatal(err)
+	}
+	if disk.lru.Len() != 0 {
+		t.Fatalf("expected the write of the entry taken back to be dropped, got %d files", disk.lru.Len())
+	}
+	if files, _ := os.ReadDir(disk.dir); len(files) != 0 {
+		t.Fatalf("expected the file of the entry taken back to be removed, got %d files", len(files))
+	}
+
+	disk.pend(entry)
+	if err := disk.put(entry); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := disk.pending[key]; ok || disk.lru.Len() != 1 {
+		t.Fatalf("expected the entry to be written, got %d files", disk.lru.Len())
+	}
+	if taken, ok := disk.take(key); !ok || !reflect.DeepEqual(messages(taken.Lines), []string{"line 0"}) {
+		t.Errorf("expected the entry to be read back from disk, got %+v", taken)
+	}
+}
+
+func TestLogCacheEntrySelectLines(t *testing.T) {
+	start := time.Date(2023, 3, 9, 12, 0, 0, 0, time.UTC)
+	entry := &logCacheEntry{}
+	for i := 0; i < 4; i++ {
+		entry.Lines = append(entry.Lines, logs.Result{Time: start.Add(time.Duration(i) * time.Second).Format(time.RFC3339Nano), Message: fmt.Sprintf(" line %d", i)})
+	}
+	// Each line is 28 bytes long with its newline
+	limit := int64(60)
+
+	tests := []struct {
+		name       string
+		since      time.Time
+		tail       int64
+		limitBytes *int64
+		want       []string
+	}{
+		{name: "tail", tail: 2, want: []string{"line 2", "line 3"}},
+		{name: "since", since: start.Add(3 * time.Second), tail: 10, want: []string{"line 3"}},
+		{name: "byte limit", tail: 3, limitBytes: &limit, want: []string{"line 1", "line 2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := messages(entry.selectLines(tt.since, tt.tail, tt.limitBytes)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	entry.Since = start.Add(time.Second)
+	if entry.covers(time.Time{}, 10) {
+		t.Error("expected the lines before the cached ones not to be covered")
+	}
+	if !entry.covers(start.Add(2*time.Second), 10) || !entry.covers(time.Time{}, 4) {
+		t.Error("expected the cached lines to be covered")
+	}
+}
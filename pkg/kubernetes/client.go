@@ -5,12 +5,17 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/flanksource/commons/logger"
-	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
 
 	"github.com/flanksource/apm-hub/api/logs"
 	"github.com/flanksource/kommons"
@@ -18,6 +23,20 @@ import (
 
 type Client struct {
 	*kommons.Client
+
+	// qps and burst limit the rate of the requests of the clientset
+	qps       float32
+	burst     int
+	clientset *kubernetes.Clientset
+	lock      sync.Mutex
+}
+
+func newClient(kommonsClient *kommons.Client, kubernetesSeachBackend *logs.KubernetesSearchBackendConfig) *Client {
+	return &Client{
+		Client: kommonsClient,
+		qps:    float32(kubernetesSeachBackend.GetQPS()),
+		burst:  kubernetesSeachBackend.GetBurst(),
+	}
 }
 
 func GetKubeClient(kommonsClient *kommons.Client, kubernetesSeachBackend *logs.KubernetesSearchBackendConfig) (*Client, error) {
@@ -28,53 +47,123 @@ func GetKubeClient(kommonsClient *kommons.Client, kubernetesSeachBackend *logs.K
 				return nil, err
 			}
 			kommonsClient, err = kommons.NewClientFromBytes([]byte(value))
-			return &Client{kommonsClient}, err
+			return newClient(kommonsClient, kubernetesSeachBackend), err
 		}
 		return nil, fmt.Errorf("default client is nil and kubeconfig is not set")
 	}
-	return &Client{kommonsClient}, nil
+	return newClient(kommonsClient, kubernetesSeachBackend), nil
 }
 
-func (c *Client) GetAllPodsForNode(nodeName string, labels map[string]string) (pods *v1.PodList, err error) {
-	client, err := c.GetClientset()
+// Cluster is a cluster searched by the backend
+type Cluster struct {
+	// Name is empty for the cluster of a backend without clusters
+	Name   string
+	Client *Client
+}
+
+// GetKubeClients returns the clients of the clusters of the backend.
+// A backend without clusters has a single unnamed cluster, connected to with its kubeconfig.
+func GetKubeClients(kommonsClient *kommons.Client, kubernetesSeachBackend *logs.KubernetesSearchBackendConfig) ([]Cluster, error) {
+	if len(kubernetesSeachBackend.Clusters) == 0 {
+		client, err := GetKubeClient(kommonsClient, kubernetesSeachBackend)
+		if err != nil {
+			return nil, err
+		}
+		return []Cluster{{Client: client}}, nil
+	}
+
+	var clusters []Cluster
+	names := make(map[string]bool)
+	for _, cluster := range kubernetesSeachBackend.Clusters {
+		if cluster.Name == "" {
+			return nil, fmt.Errorf("cluster name is required")
+		}
+		if strings.Contains(cluster.Name, "/") {
+			return nil, fmt.Errorf("cluster name %q must not contain a /", cluster.Name)
+		}
+		if names[cluster.Name] {
+			return nil, fmt.Errorf("duplicate cluster %q", cluster.Name)
+		}
+		names[cluster.Name] = true
+
+		// A cluster that can't be loaded doesn't stop the others from being searched
+		restConfig, err := getClusterRESTConfig(kommonsClient, kubernetesSeachBackend.Namespace, cluster)
+		if err != nil {
+			logger.Errorf("error getting the config of cluster %s, it isn't searched: %v", cluster.Name, err)
+			continue
+		}
+
+		client := kommons.NewClient(restConfig, logger.StandardLogger())
+		clusters = append(clusters, Cluster{Name: cluster.Name, Client: newClient(client, kubernetesSeachBackend)})
+	}
+
+	if len(clusters) == 0 {
+		return nil, fmt.Errorf("none of the clusters could be loaded")
+	}
+	return clusters, nil
+}
+
+// getClusterRESTConfig returns the REST config of the context of the kubeconfig of a cluster.
+// The kubeconfig defaults to the current one, i.e. $KUBECONFIG or ~/.kube/config.
+func getClusterRESTConfig(kommonsClient *kommons.Client, namespace string, cluster logs.KubernetesCluster) (*rest.Config, error) {
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: cluster.Context}
+	if cluster.Kubeconfig == nil {
+		return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(clientcmd.NewDefaultClientConfigLoadingRules(), overrides).ClientConfig()
+	}
+
+	if kommonsClient == nil {
+		return nil, fmt.Errorf("default client is nil and kubeconfig is not set")
+	}
+	_, value, err := kommonsClient.GetEnvValue(*cluster.Kubeconfig, namespace)
 	if err != nil {
 		return nil, err
 	}
-	labelsString := GetLabelString(labels)
 
-	if nodeName != "" {
-		pods, err = client.CoreV1().Pods("").List(context.TODO(), metav1.ListOptions{
-			FieldSelector: "spec.nodeName=" + nodeName,
-			LabelSelector: labelsString,
-		})
-	} else {
-		pods, err = client.CoreV1().Pods("").List(context.TODO(), metav1.ListOptions{
-			LabelSelector: labelsString,
-		})
+	config, err := clientcmd.Load([]byte(value))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the kubeconfig: %w", err)
 	}
+	return clientcmd.NewDefaultClientConfig(*config, overrides).ClientConfig()
+}
+
+// GetClientset returns a clientset of the backend, rate limited to its qps and burst.
+// The clientset of the kommons client isn't used as it's shared with the other backends.
+func (c *Client) GetClientset() (*kubernetes.Clientset, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.clientset != nil {
+		return c.clientset, nil
+	}
+
+	config, err := c.Client.GetRESTConfig()
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("error getting the REST config: %w", err)
 	}
-	if len(pods.Items) != 0 {
-		return pods, nil
+
+	config = rest.CopyConfig(config)
+	config.QPS = c.qps
+	config.Burst = c.burst
+	if c.clientset, err = kubernetes.NewForConfig(config); err != nil {
+		return nil, err
 	}
-	return nil, nil
+	return c.clientset, nil
 }
 
-// empty name will fetch all pods with the specified labels and if labels are nil will fetch the pods with the specified name
-func (c *Client) GetPodsWithNameAndLabels(name, namespace string, labels map[string]string) (pods *v1.PodList, err error) {
+func (c *Client) GetAllPodsForNode(ctx context.Context, nodeName string, labels map[string]string) (pods *v1.PodList, err error) {
 	client, err := c.GetClientset()
 	if err != nil {
 		return nil, err
 	}
 	labelsString := GetLabelString(labels)
-	if name != "" {
-		pods, err = client.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{
-			FieldSelector: "metadata.name=" + name,
+
+	if nodeName != "" {
+		pods, err = client.CoreV1().Pods("").List(ctx, metav1.ListOptions{
+			FieldSelector: "spec.nodeName=" + nodeName,
 			LabelSelector: labelsString,
 		})
 	} else {
-		pods, err = client.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{
+		pods, err = client.CoreV1().Pods("").List(ctx, metav1.ListOptions{
 			LabelSelector: labelsString,
 		})
 	}
@@ -87,46 +176,33 @@ func (c *Client) GetPodsWithNameAndLabels(name, namespace string, labels map[str
 	return nil, nil
 }
 
-func (c *Client) GetPodsForDeployment(name, namespace string, labels map[string]string) (pods *v1.PodList, err error) {
+// empty name will fetch all pods with the specified labels and if labels are nil will fetch the pods with the specified name
+func (c *Client) GetPodsWithNameAndLabels(ctx context.Context, name, namespace string, labels map[string]string) (pods *v1.PodList, err error) {
 	client, err := c.GetClientset()
 	if err != nil {
 		return nil, err
 	}
-
 	labelsString := GetLabelString(labels)
-
-	var deployments *appsv1.DeploymentList
 	if name != "" {
-		deployments, err = client.AppsV1().Deployments(namespace).List(context.TODO(), metav1.ListOptions{
-			LabelSelector: labelsString,
+		pods, err = client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
 			FieldSelector: "metadata.name=" + name,
+			LabelSelector: labelsString,
 		})
 	} else {
-		deployments, err = client.AppsV1().Deployments(namespace).List(context.TODO(), metav1.ListOptions{
+		pods, err = client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
 			LabelSelector: labelsString,
 		})
 	}
 	if err != nil {
 		return nil, err
 	}
-	var deploymentPod *v1.PodList
-	pods = &v1.PodList{
-		Items: []v1.Pod{},
-	}
-	for _, deployment := range deployments.Items {
-		deploymentPod, err = client.CoreV1().Pods(deployment.GetNamespace()).List(context.TODO(), metav1.ListOptions{
-			LabelSelector: GetLabelString(deployment.Spec.Template.Labels),
-		})
-		if err != nil {
-			logger.Errorf("error fetching pod for deployment: %v; error: %v", deployment.Name, err)
-			continue
-		}
-		pods.Items = append(pods.Items, deploymentPod.Items...)
+	if len(pods.Items) != 0 {
+		return pods, nil
 	}
-	return
+	return nil, nil
 }
 
-func (c *Client) GetPodsForService(name, namespace string, labels map[string]string) (pods *v1.PodList, err error) {
+func (c *Client) GetPodsForService(ctx context.Context, name, namespace string, labels map[string]string) (pods *v1.PodList, err error) {
 	client, err := c.GetClientset()
 	if err != nil {
 		return nil, err
@@ -136,12 +212,12 @@ func (c *Client) GetPodsForService(name, namespace string, labels map[string]str
 
 	var services *v1.ServiceList
 	if name != "" {
-		services, err = client.CoreV1().Services(namespace).List(context.TODO(), metav1.ListOptions{
+		services, err = client.CoreV1().Services(namespace).List(ctx, metav1.ListOptions{
 			LabelSelector: labelsString,
 			FieldSelector: "metadata.name=" + name,
 		})
 	} else {
-		services, err = client.CoreV1().Services(namespace).List(context.TODO(), metav1.ListOptions{
+		services, err = client.CoreV1().Services(namespace).List(ctx, metav1.ListOptions{
 			LabelSelector: labelsString,
 		})
 	}
@@ -152,7 +228,7 @@ func (c *Client) GetPodsForService(name, namespace string, labels map[string]str
 		Items: []v1.Pod{},
 	}
 	for _, service := range services.Items {
-		servicePods, err := client.CoreV1().Pods(service.GetNamespace()).List(context.TODO(), metav1.ListOptions{
+		servicePods, err := client.CoreV1().Pods(service.GetNamespace()).List(ctx, metav1.ListOptions{
 			LabelSelector: GetLabelString(service.Spec.Selector),
 		})
 		if err != nil {
@@ -172,47 +248,143 @@ func getLogResult(line string) logs.Result {
 	}
 }
 
-func (c *Client) GetLogsForPod(q *logs.SearchParams, pod v1.Pod) (map[string][]logs.Result, error) {
-	containerLogs := make(map[string][]logs.Result)
+// ContainerLogs are the log lines of an instance of a container
+type ContainerLogs struct {
+	Container string
+	// Previous is set for the logs of the previous instance of a restarted container
+	Previous bool
+	// Status is the status of the container, if it's been reported yet
+	Status *v1.ContainerStatus
+	Lines  []logs.Result
+}
+
+// GetContainerInstances returns the instances of the containers of the pod whose logs are searched,
+// with the previous instance of the restarted containers if asked for, without their lines
+func GetContainerInstances(pod v1.Pod, previous bool) []ContainerLogs {
+	statuses := make(map[string]*v1.ContainerStatus)
+	for _, list := range [][]v1.ContainerStatus{pod.Status.ContainerStatuses, pod.Status.InitContainerStatuses} {
+		for i := range list {
+			statuses[list[i].Name] = &list[i]
+		}
+	}
+
+	var instances []ContainerLogs
+	for _, container := range append(pod.Spec.Containers, pod.Spec.InitContainers...) {
+		status := statuses[container.Name]
+		instances = append(instances, ContainerLogs{Container: container.Name, Status: status})
+		// The kubelet keeps the logs of the last terminated instance only
+		if previous && status != nil && status.RestartCount > 0 {
+			instances = append(instances, ContainerLogs{Container: container.Name, Status: status, Previous: true})
+		}
+	}
+	return instances
+}
+
+// GetLogsForContainer returns the lines of the instance of the container
+func (c *Client) GetLogsForContainer(ctx context.Context, q *logs.SearchParams, pod v1.Pod, container string, previous bool) ([]logs.Result, error) {
+	lines, _, err := c.fetchLogs(ctx, pod, getLogOptions(q, container, previous))
+	return lines, err
+}
+
+// getLogOptions returns the options of the logs API for the instance of the container searched
+func getLogOptions(q *logs.SearchParams, container string, previous bool) *v1.PodLogOptions {
+	options := &v1.PodLogOptions{
+		Container:  container,
+		Follow:     false,
+		Previous:   previous,
+		Timestamps: true,
+	}
+
+	if q.LimitPerItem > 0 {
+		options.TailLines = &q.LimitPerItem
+	} else if q.Limit > 0 {
+		options.TailLines = &q.Limit
+	}
+	if q.LimitBytesPerItem > 0 {
+		options.LimitBytes = &q.LimitBytesPerItem
+	} else if q.LimitBytes > 0 {
+		options.LimitBytes = &q.LimitBytes
+	}
+	start := q.GetStart()
+	if start != nil {
+		options.SinceTime = &metav1.Time{Time: *start}
+	}
+
+	// A page token resumes the logs right after the last returned line
+	if cursor, err := getPageCursor(q); err == nil && cursor != nil {
+		options.SinceTime = &metav1.Time{Time: *cursor}
+	}
+	return options
+}
+
+// fetchLogs returns the lines of the logs of the pod along with their size in bytes
+func (c *Client) fetchLogs(ctx context.Context, pod v1.Pod, options *v1.PodLogOptions) ([]logs.Result, int64, error) {
+	client, err := c.GetClientset()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	podLogs, err := client.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, options).Do(ctx).Raw()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(podLogs))
+	var lines []logs.Result
+	for scanner.Scan() {
+		lines = append(lines, getLogResult(scanner.Text()))
+	}
+	return lines, int64(len(podLogs)), nil
+}
+
+// FollowLogsForContainer streams the logs of the container, since the given time, as they are written
+func (c *Client) FollowLogsForContainer(ctx context.Context, pod v1.Pod, container string, since *time.Time) (io.ReadCloser, error) {
 	client, err := c.GetClientset()
 	if err != nil {
 		return nil, err
 	}
-	pods := client.CoreV1().Pods(pod.Namespace)
 
-	for _, container := range append(pod.Spec.Containers, pod.Spec.InitContainers...) {
-		options := &v1.PodLogOptions{
-			Container:  container.Name,
-			Follow:     false,
-			Timestamps: true,
-		}
+	options := &v1.PodLogOptions{
+		Container:  container,
+		Follow:     true,
+		Timestamps: true,
+	}
+	if since != nil {
+		options.SinceTime = &metav1.Time{Time: *since}
+	}
 
-		if q.LimitPerItem > 0 {
-			options.TailLines = &q.LimitPerItem
-		} else if q.Limit > 0 {
-			options.TailLines = &q.Limit
-		}
-		if q.LimitBytesPerItem > 0 {
-			options.LimitBytes = &q.LimitBytesPerItem
-		} else if q.LimitBytes > 0 {
-			options.LimitBytes = &q.LimitBytes
-		}
-		start := q.GetStart()
-		if start != nil {
-			options.SinceTime = &metav1.Time{Time: *start}
-		}
+	return client.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, options).Stream(ctx)
+}
+
+// GetEventsForObject returns the events of the object from the given events API
+func (c *Client) GetEventsForObject(ctx context.Context, api string, object v1.ObjectReference) ([]event, error) {
+	client, err := c.GetClientset()
+	if err != nil {
+		return nil, err
+	}
 
-		podLogs, err := pods.GetLogs(pod.Name, options).Do(context.TODO()).Raw()
+	var events []event
+	if api == EventsAPIEvents {
+		list, err := client.EventsV1().Events(object.Namespace).List(ctx, metav1.ListOptions{
+			FieldSelector: fmt.Sprintf("regarding.kind=%s,regarding.name=%s", object.Kind, object.Name),
+		})
 		if err != nil {
-			logger.Tracef("failed to begin streaming %s/%s: %s", pod.Name, container.Name, err)
-			continue
+			return nil, err
 		}
-		scanner := bufio.NewScanner(bytes.NewReader(podLogs))
-		var lines []logs.Result
-		for scanner.Scan() {
-			lines = append(lines, getLogResult(scanner.Text()))
+		for _, e := range list.Items {
+			events = append(events, fromEventsV1Event(e))
 		}
-		containerLogs[container.Name] = lines
+		return events, nil
+	}
+
+	list, err := client.CoreV1().Events(object.Namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fmt.Sprintf("involvedObject.kind=%s,involvedObject.name=%s", object.Kind, object.Name),
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range list.Items {
+		events = append(events, fromCoreEvent(e))
 	}
-	return containerLogs, nil
+	return events, nil
 }
@@ -0,0 +1,73 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/flanksource/apm-hub/api/logs"
+	"github.com/flanksource/kommons"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+current-context: eu
+clusters:
+  - name: eu
+    cluster:
+      server: https://eu.example.com
+  - name: us
+    cluster:
+      server: https://us.example.com
+users:
+  - name: admin
+    user:
+      token: secret
+contexts:
+  - name: eu
+    context:
+      cluster: eu
+      user: admin
+  - name: us
+    context:
+      cluster: us
+      user: admin
+`
+
+func TestGetKubeClients(t *testing.T) {
+	kubeconfig := &kommons.EnvVar{Value: testKubeconfig}
+	config := &logs.KubernetesSearchBackendConfig{
+		QPS: 5,
+		Clusters: []logs.KubernetesCluster{
+			{Name: "europe", Kubeconfig: kubeconfig},
+			{Name: "america", Kubeconfig: kubeconfig, Context: "us"},
+			// A cluster that can't be loaded is skipped
+			{Name: "asia", Kubeconfig: kubeconfig, Context: "missing"},
+		},
+	}
+
+	clusters, err := GetKubeClients(&kommons.Client{}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hosts := map[string]string{"europe": "https://eu.example.com", "america": "https://us.example.com"}
+	if len(clusters) != len(hosts) {
+		t.Fatalf("expected %d clusters, got %d", len(hosts), len(clusters))
+	}
+	for _, cluster := range clusters {
+		restConfig, err := cluster.Client.GetRESTConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if restConfig.Host != hosts[cluster.Name] {
+			t.Errorf("expected host %s for cluster %s, got %s", hosts[cluster.Name], cluster.Name, restConfig.Host)
+		}
+		if cluster.Client.qps != 5 {
+			t.Errorf("expected qps 5 for cluster %s, got %v", cluster.Name, cluster.Client.qps)
+		}
+	}
+
+	config.Clusters = append(config.Clusters, logs.KubernetesCluster{Name: "europe", Kubeconfig: kubeconfig})
+	if _, err := GetKubeClients(&kommons.Client{}, config); err == nil {
+		t.Error("expected an error for the duplicate cluster")
+	}
+}
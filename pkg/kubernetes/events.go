@@ -0,0 +1,144 @@
+package kubernetes
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/flanksource/apm-hub/api/logs"
+	"github.com/flanksource/commons/collections"
+	v1 "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// EventsAPICore lists the events from the core/v1 API
+	EventsAPICore = "v1"
+	// EventsAPIEvents lists the events from the events.k8s.io/v1 API
+	EventsAPIEvents = "events.k8s.io/v1"
+)
+
+// event is the part of an event of either API that becomes a result
+type event struct {
+	uid     string
+	time    time.Time
+	message string
+	reason  string
+	kind    string
+	count   int32
+	object  v1.ObjectReference
+}
+
+func fromCoreEvent(e v1.Event) event {
+	count := e.Count
+	if e.Series != nil {
+		count = e.Series.Count
+	}
+
+	return event{
+		uid:     string(e.UID),
+		time:    firstTime(seriesTime(e.Series), e.LastTimestamp, metav1.Time(e.EventTime), e.FirstTimestamp, e.CreationTimestamp),
+		message: e.Message,
+		reason:  e.Reason,
+		kind:    e.Type,
+		count:   count,
+		object:  e.InvolvedObject,
+	}
+}
+
+func fromEventsV1Event(e eventsv1.Event) event {
+	count := e.DeprecatedCount
+	var lastObserved metav1.Time
+	if e.Series != nil {
+		count = e.Series.Count
+		lastObserved = metav1.Time(e.Series.LastObservedTime)
+	}
+
+	return event{
+		uid:     string(e.UID),
+		time:    firstTime(lastObserved, e.DeprecatedLastTimestamp, metav1.Time(e.EventTime), e.DeprecatedFirstTimestamp, e.CreationTimestamp),
+		message: e.Note,
+		reason:  e.Reason,
+		kind:    e.Type,
+		count:   count,
+		object:  e.Regarding,
+	}
+}
+
+func seriesTime(series *v1.EventSeries) metav1.Time {
+	if series == nil {
+		return metav1.Time{}
+	}
+	return metav1.Time(series.LastObservedTime)
+}
+
+// firstTime returns the first of the times that is set.
+// The events are recorded with different times depending on the API and the version of the recorder.
+func firstTime(times ...metav1.Time) time.Time {
+	for _, t := range times {
+		if !t.IsZero() {
+			return t.Time
+		}
+	}
+	return time.Time{}
+}
+
+// toResult maps the event to a result, labelled with its reason, type, involved object and count
+func (t event) toResult(resultLabels map[string]string) logs.Result {
+	count := t.count
+	if count == 0 {
+		count = 1
+	}
+
+	labels := collections.MergeMap(map[string]string{
+		"reason":                   t.reason,
+		"type":                     t.kind,
+		"count":                    strconv.Itoa(int(count)),
+		"involvedObject.kind":      t.object.Kind,
+		"involvedObject.name":      t.object.Name,
+		"involvedObject.uid":       string(t.object.UID),
+		"involvedObject.fieldPath": t.object.FieldPath,
+	}, resultLabels)
+	if t.object.Namespace != "" {
+		labels["involvedObject.namespace"] = t.object.Namespace
+		labels["namespace"] = t.object.Namespace
+	}
+	if t.object.Kind == "Pod" {
+		labels["pod"] = t.object.Name
+	}
+	for k, v := range labels {
+		if v == "" {
+			delete(labels, k)
+		}
+	}
+
+	return logs.Result{
+		Id:      t.uid,
+		Time:    t.time.UTC().Format(time.RFC3339Nano),
+		Message: t.message,
+		Labels:  labels,
+	}
+}
+
+// filterEvents returns the newest events, up to the limit, of the given types within the time window
+func filterEvents(events []event, types []string, start, end *time.Time, limit int64) []event {
+	var filtered []event
+	for _, e := range events {
+		if len(types) != 0 && !collections.Contains(types, e.kind) {
+			continue
+		}
+		if (start != nil && e.time.Before(*start)) || (end != nil && e.time.After(*end)) {
+			continue
+		}
+		filtered = append(filtered, e)
+	}
+
+	sort.SliceStable(filtered, func(i, j int) bool {
+		return filtered[i].time.After(filtered[j].time)
+	})
+	if limit > 0 && int64(len(filtered)) > limit {
+		filtered = filtered[:limit]
+	}
+	return filtered
+}
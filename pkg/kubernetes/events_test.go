@@ -0,0 +1,78 @@
+package kubernetes
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestEventToResult(t *testing.T) {
+	ts := time.Date(2023, 3, 9, 12, 0, 0, 0, time.UTC)
+	pod := v1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "api-0"}
+
+	core := fromCoreEvent(v1.Event{
+		ObjectMeta:     metav1.ObjectMeta{UID: "1"},
+		InvolvedObject: pod,
+		Reason:         "BackOff",
+		Message:        "Back-off restarting failed container",
+		Type:           v1.EventTypeWarning,
+		Count:          12,
+		FirstTimestamp: metav1.NewTime(ts.Add(-time.Hour)),
+		LastTimestamp:  metav1.NewTime(ts),
+	})
+	v1Event := fromEventsV1Event(eventsv1.Event{
+		ObjectMeta: metav1.ObjectMeta{UID: "1"},
+		Regarding:  pod,
+		Reason:     "BackOff",
+		Note:       "Back-off restarting failed container",
+		Type:       v1.EventTypeWarning,
+		EventTime:  metav1.NewMicroTime(ts.Add(-time.Hour)),
+		Series:     &eventsv1.EventSeries{Count: 12, LastObservedTime: metav1.NewMicroTime(ts)},
+	})
+
+	want := map[string]string{
+		"reason":                   "BackOff",
+		"type":                     "Warning",
+		"count":                    "12",
+		"involvedObject.kind":      "Pod",
+		"involvedObject.name":      "api-0",
+		"involvedObject.namespace": "default",
+		"namespace":                "default",
+		"pod":                      "api-0",
+		"deployment":               "api",
+	}
+
+	for name, e := range map[string]event{"v1": core, "events.k8s.io/v1": v1Event} {
+		r := e.toResult(map[string]string{"deployment": "api"})
+		if r.Time != "2023-03-09T12:00:00Z" || r.Message != "Back-off restarting failed container" || r.Id != "1" {
+			t.Errorf("%s: unexpected result %+v", name, r)
+		}
+		if !reflect.DeepEqual(r.Labels, want) {
+			t.Errorf("%s: got labels %v, want %v", name, r.Labels, want)
+		}
+	}
+}
+
+func TestFilterEvents(t *testing.T) {
+	ts := time.Date(2023, 3, 9, 12, 0, 0, 0, time.UTC)
+	events := []event{
+		{uid: "1", kind: "Normal", time: ts},
+		{uid: "2", kind: "Warning", time: ts.Add(time.Minute)},
+		{uid: "3", kind: "Warning", time: ts.Add(2 * time.Minute)},
+		{uid: "4", kind: "Warning", time: ts.Add(-time.Hour)},
+	}
+
+	start := ts.Add(-time.Minute)
+	var uids []string
+	for _, e := range filterEvents(events, []string{"Warning"}, &start, nil, 1) {
+		uids = append(uids, e.uid)
+	}
+
+	if !reflect.DeepEqual(uids, []string{"3"}) {
+		t.Errorf("got %v", uids)
+	}
+}
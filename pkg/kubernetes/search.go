@@ -1,25 +1,58 @@
 package kubernetes
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/flanksource/apm-hub/api/logs"
 	"github.com/flanksource/commons/collections"
 	"github.com/flanksource/commons/logger"
+	"golang.org/x/sync/errgroup"
 	v1 "k8s.io/api/core/v1"
 )
 
-func NewKubernetesSearchBackend(client *Client, config *logs.KubernetesSearchBackendConfig) *KubernetesSearch {
-	return &KubernetesSearch{
-		client: client,
+func NewKubernetesSearchBackend(clusters []Cluster, config *logs.KubernetesSearchBackendConfig) (*KubernetesSearch, error) {
+	var cache *LogCache
+	if config.Cache != nil {
+		var err error
+		if cache, err = NewLogCache(config.Cache); err != nil {
+			return nil, fmt.Errorf("error creating the log cache: %w", err)
+		}
+	}
+
+	search := &KubernetesSearch{
 		config: config,
 	}
+	for _, cluster := range clusters {
+		search.clusters = append(search.clusters, &clusterSearch{
+			name:   cluster.Name,
+			client: cluster.Client,
+			config: config,
+			cache:  cache,
+		})
+	}
+	return search, nil
 }
 
 type KubernetesSearch struct {
+	clusters []*clusterSearch
+	config   *logs.KubernetesSearchBackendConfig
+}
+
+// clusterSearch searches a single cluster of the backend
+type clusterSearch struct {
+	// name is empty for the cluster of a backend without clusters
+	name   string
 	client *Client
 	config *logs.KubernetesSearchBackendConfig
+	// cache is shared by the clusters of the backend, nil if disabled
+	cache *LogCache
 }
 
 func podNames(list *v1.PodList) []string {
@@ -30,79 +63,573 @@ func podNames(list *v1.PodList) []string {
 	return names
 }
 
-func (t *KubernetesSearch) MatchRoute(q *logs.SearchParams) (match bool, isAdditive bool) {
+func (t *KubernetesSearch) MatchRoute(q *logs.SearchParams) (route logs.SearchRoute, match bool) {
 	return t.config.CommonBackend.Routes.MatchRoute(q)
 }
 
-func (s *KubernetesSearch) Search(q *logs.SearchParams) (r logs.SearchResults, err error) {
-	var resultLabels = make(map[string]string)
-	namespace, name := s.GetNameNamespace(q)
+func (s *KubernetesSearch) Search(ctx context.Context, q *logs.SearchParams) (r logs.SearchResults, err error) {
+	cursor, err := getPageCursor(q)
+	if err != nil {
+		return r, err
+	}
 
-	logger.Debugf("searching %s namespace=%s name=%s", q, namespace, name)
-	var pods *v1.PodList
-	switch {
-	case strings.Contains(strings.ToLower(q.Type), "kubernetespod"):
-		pods, err = s.client.GetPodsWithNameAndLabels(name, namespace, q.Labels)
+	query, err := q.GetQuery()
+	if err != nil {
+		return r, fmt.Errorf("error parsing query: %w", err)
+	}
+
+	searches, err := s.getClusterSearches(q)
+	if err != nil {
+		return r, err
+	}
 
-	case strings.Contains(strings.ToLower(q.Type), "kubernetesnode"):
-		pods, err = s.client.GetAllPodsForNode(q.Id, q.Labels)
+	// The clusters are searched concurrently, each one within the limits of its own client.
+	// A cluster that fails doesn't hide the lines of the others.
+	results := make([][]logs.Result, len(searches))
+	errs := make([]error, len(searches))
+	var wg sync.WaitGroup
+	for i, search := range searches {
+		wg.Add(1)
+		go func(i int, search clusterParams) {
+			defer wg.Done()
+			results[i], errs[i] = search.cluster.search(ctx, search.params, cursor)
+		}(i, search)
+	}
+	wg.Wait()
 
-	case strings.Contains(strings.ToLower(q.Type), "kubernetesdeployment"):
-		pods, err = s.client.GetPodsForDeployment(name, namespace, q.Labels)
-		resultLabels = map[string]string{
-			"deployment": q.Id,
+	var failed []error
+	for i, search := range searches {
+		clusterResult := logs.BackendResult{Name: search.cluster.name, Type: "kubernetes", Status: logs.BackendStatusSuccess}
+		if err := errs[i]; err != nil {
+			err = search.cluster.wrapError(err)
+			clusterResult.Status, clusterResult.Error = logs.GetBackendStatus(err), err.Error()
+			failed = append(failed, err)
 		}
-	case strings.Contains(strings.ToLower(q.Type), "kubernetesservice"):
-		pods, err = s.client.GetPodsForService(name, namespace, q.Labels)
-		resultLabels = map[string]string{
-			"service": q.Id,
+
+		r.Backends = append(r.Backends, clusterResult)
+		r.Results = append(r.Results, results[i]...)
+	}
+
+	if len(failed) == len(searches) {
+		return logs.SearchResults{}, errors.Join(failed...)
+	}
+	if len(failed) != 0 {
+		r.Partial = true
+	}
+
+	// The logs API has no query engine so the query is evaluated on each line
+	r.Results = logs.FilterResults(query, r.Results)
+	r.Total = len(r.Results)
+	return r, nil
+}
+
+// Tail follows the logs of the containers of the pods that match the search params.
+// The pods created after the tail has started aren't followed.
+func (s *KubernetesSearch) Tail(ctx context.Context, q *logs.SearchParams, lines chan<- logs.Result) error {
+	query, err := q.GetQuery()
+	if err != nil {
+		return fmt.Errorf("error parsing query: %w", err)
+	}
+
+	searches, err := s.getClusterSearches(q)
+	if err != nil {
+		return err
+	}
+
+	// A cluster that fails doesn't stop the tail of the others
+	group := new(errgroup.Group)
+	for _, search := range searches {
+		search := search
+		group.Go(func() error {
+			if err := search.cluster.tail(ctx, search.params, query, lines); err != nil {
+				return search.cluster.wrapError(err)
+			}
+			return nil
+		})
+	}
+	return group.Wait()
+}
+
+// clusterParams are the search params of a cluster, without the cluster in the id and labels
+type clusterParams struct {
+	cluster *clusterSearch
+	params  *logs.SearchParams
+}
+
+// getClusterSearches returns the clusters to search along with their search params.
+// The cluster is selected by the first segment of the id, when the id has one segment more than the type takes,
+// or by the cluster label. All the clusters are searched otherwise.
+func (s *KubernetesSearch) getClusterSearches(q *logs.SearchParams) ([]clusterParams, error) {
+	if len(s.config.Clusters) == 0 {
+		// The backend has a single cluster, with the id and labels searched as is
+		var searches []clusterParams
+		for _, cluster := range s.clusters {
+			searches = append(searches, clusterParams{cluster: cluster, params: q})
 		}
+		return searches, nil
 	}
 
+	searchType, err := getType(q)
 	if err != nil {
-		return r, fmt.Errorf("error fetching the pods for node %v: %v", q, err)
+		return nil, err
+	}
+
+	id, name := q.Id, q.Labels["cluster"]
+	if parts := strings.Split(q.Id, "/"); q.Id != "" && len(parts) > idSegments(searchType) {
+		name, id = parts[0], strings.Join(parts[1:], "/")
+	}
+
+	var searches []clusterParams
+	for _, cluster := range s.clusters {
+		if name != "" && cluster.name != name {
+			continue
+		}
+
+		// Each cluster gets its own copy of the params as the labels are modified by the search
+		params := q.Clone()
+		params.Id = id
+		delete(params.Labels, "cluster")
+		searches = append(searches, clusterParams{cluster: cluster, params: params})
+	}
+
+	if len(searches) == 0 {
+		return nil, fmt.Errorf("unknown cluster %q", name)
+	}
+	return searches, nil
+}
+
+// idSegments returns the maximum number of segments of the id of a type, without the cluster
+func idSegments(searchType string) int {
+	switch searchType {
+	case TypeNode:
+		return 1
+	case TypeResource:
+		return 3
+	default:
+		return 2
+	}
+}
+
+// wrapError tells the cluster an error comes from, for a backend with several clusters
+func (s *clusterSearch) wrapError(err error) error {
+	if s.name == "" {
+		return err
+	}
+	return fmt.Errorf("error searching cluster %s: %w", s.name, err)
+}
+
+func (s *clusterSearch) search(ctx context.Context, q *logs.SearchParams, cursor *time.Time) ([]logs.Result, error) {
+	pods, searched, resultLabels, err := s.getPods(ctx, q)
+	if err != nil {
+		return nil, err
 	}
 	if pods == nil || len(pods.Items) == 0 {
 		logger.Debugf("[%s] no pods found", q)
-		return r, nil
+		// The events of the object searched can tell why it has no pods
+		if s.config.Events == nil || searched == nil {
+			return nil, nil
+		}
+		pods = &v1.PodList{}
 	}
 	logger.Tracef("[%s] searching in pods %s ", q, podNames(pods))
-	r.Results = s.getLogResultsForPods(q, pods, collections.MergeMap(s.config.CommonBackend.Labels, resultLabels))
-	r.Total = len(r.Results)
-	return r, nil
+	results, err := s.getLogResultsForPods(ctx, q, cursor, pods, resultLabels)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.config.Events != nil {
+		events, err := s.getEventResults(ctx, q, cursor, eventObjects(pods, searched), resultLabels)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, events...)
+	}
+	return results, nil
 }
 
-func (s *KubernetesSearch) getLogResultsForPods(q *logs.SearchParams, pods *v1.PodList, resultLabels map[string]string) []logs.Result {
-	var results []logs.Result
+func (s *clusterSearch) tail(ctx context.Context, q *logs.SearchParams, query logs.QueryExpr, lines chan<- logs.Result) error {
+	pods, _, resultLabels, err := s.getPods(ctx, q)
+	if err != nil {
+		return err
+	}
+	if pods == nil || len(pods.Items) == 0 {
+		logger.Debugf("[%s] no pods found", q)
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	workloads := s.client.GetWorkloads(ctx, pods.Items)
 	for _, pod := range pods.Items {
-		podLogs, err := s.client.GetLogsForPod(q, pod)
-		if err != nil {
-			logger.Errorf("error fetching logs for pod: %v in namespace: %v, err: ", pod.Name, pod.Namespace, err)
+		for _, container := range pod.Spec.Containers {
+			wg.Add(1)
+			go func(pod v1.Pod, container string) {
+				defer wg.Done()
+				labels := getContainerLabels(pod, container, resultLabels)
+				labels = collections.MergeMap(labels, getWorkloadLabels(workloads[pod.UID]))
+				if err := s.followContainer(ctx, q, query, pod, container, labels, lines); err != nil && ctx.Err() == nil {
+					logger.Errorf("error following logs for pod: %v in namespace: %v, err: %v", pod.Name, pod.Namespace, err)
+				}
+			}(pod, container.Name)
+		}
+	}
+	wg.Wait()
+
+	return nil
+}
+
+func (s *clusterSearch) followContainer(ctx context.Context, q *logs.SearchParams, query logs.QueryExpr, pod v1.Pod, container string, labels map[string]string, lines chan<- logs.Result) error {
+	stream, err := s.client.FollowLogsForContainer(ctx, pod, container, q.GetStart())
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	scanner := bufio.NewScanner(stream)
+	for scanner.Scan() {
+		line := getLogResult(scanner.Text())
+		line.Labels = labels
+		line = line.Process()
+		if line.Message == "" || (query != nil && !query.Match(line)) {
 			continue
 		}
-		for containerName, containerLogs := range podLogs {
-			var labels = map[string]string{
-				"pod":           pod.Name,
-				"containerName": containerName,
-				"nodeName":      pod.Spec.NodeName,
-				"namespace":     pod.Namespace,
+
+		if err := logs.SendResult(ctx, lines, line); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// The types of the search params the backend supports
+const (
+	TypePod         = "KubernetesPod"
+	TypeNode        = "KubernetesNode"
+	TypeService     = "KubernetesService"
+	TypeDeployment  = "KubernetesDeployment"
+	TypeStatefulSet = "KubernetesStatefulSet"
+	TypeDaemonSet   = "KubernetesDaemonSet"
+	TypeReplicaSet  = "KubernetesReplicaSet"
+	TypeJob         = "KubernetesJob"
+	TypeCronJob     = "KubernetesCronJob"
+	// TypeResource is any resource with a spec.selector, e.g. a custom resource.
+	// Its id is <namespace>/<kind>/<name>, or <kind>/<name> with the namespace label.
+	TypeResource = "KubernetesResource"
+)
+
+// workloadKinds are the kinds of the workloads by their type
+var workloadKinds = map[string]string{
+	TypeDeployment:  "Deployment",
+	TypeStatefulSet: "StatefulSet",
+	TypeDaemonSet:   "DaemonSet",
+	TypeReplicaSet:  "ReplicaSet",
+	TypeJob:         "Job",
+	TypeCronJob:     "CronJob",
+}
+
+// getType returns the type of the search params, matched case-insensitively
+func getType(q *logs.SearchParams) (string, error) {
+	types := []string{TypePod, TypeNode, TypeService, TypeDeployment, TypeStatefulSet, TypeDaemonSet, TypeReplicaSet, TypeJob, TypeCronJob, TypeResource}
+	for _, t := range types {
+		if strings.EqualFold(q.Type, t) {
+			return t, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported type %q, expected one of %s", q.Type, strings.Join(types, ", "))
+}
+
+// getPods returns the pods that match the search params
+// along with the object searched, if any, and the labels to attach to their results.
+func (s *clusterSearch) getPods(ctx context.Context, q *logs.SearchParams) (pods *v1.PodList, searched *v1.ObjectReference, resultLabels map[string]string, err error) {
+	searchType, err := getType(q)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if searchType == TypeResource {
+		namespace, kind, name, err := s.getResourceID(q)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		logger.Debugf("searching %s namespace=%s kind=%s name=%s", q, namespace, kind, name)
+		if pods, err = s.client.GetPodsForResource(ctx, kind, name, namespace); err != nil {
+			return nil, nil, nil, fmt.Errorf("error fetching the pods for %v: %v", q, err)
+		}
+		if err := s.checkPodCount(pods); err != nil {
+			return nil, nil, nil, err
+		}
+		searched = &v1.ObjectReference{Kind: kind, Namespace: namespace, Name: name}
+		return pods, searched, s.getResultLabels(nil), nil
+	}
+
+	namespace, name := s.GetNameNamespace(q)
+
+	logger.Debugf("searching %s namespace=%s name=%s", q, namespace, name)
+	switch searchType {
+	case TypePod:
+		pods, err = s.client.GetPodsWithNameAndLabels(ctx, name, namespace, q.Labels)
+
+	case TypeNode:
+		pods, err = s.client.GetAllPodsForNode(ctx, q.Id, q.Labels)
+		if q.Id != "" {
+			searched = &v1.ObjectReference{Kind: "Node", Name: q.Id}
+		}
+
+	case TypeService:
+		pods, err = s.client.GetPodsForService(ctx, name, namespace, q.Labels)
+		resultLabels = map[string]string{
+			"service": q.Id,
+		}
+		if name != "" {
+			searched = &v1.ObjectReference{Kind: "Service", Namespace: namespace, Name: name}
+		}
+
+	default:
+		kind := workloadKinds[searchType]
+		pods, err = s.client.GetPodsForWorkload(ctx, kind, name, namespace, q.Labels)
+		if searchType == TypeDeployment {
+			resultLabels = map[string]string{
+				"deployment": q.Id,
 			}
-			for k, v := range resultLabels {
-				labels[k] = v
+		}
+		if name != "" {
+			searched = &v1.ObjectReference{Kind: kind, Namespace: namespace, Name: name}
+		}
+	}
+
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error fetching the pods for %v: %v", q, err)
+	}
+	if err := s.checkPodCount(pods); err != nil {
+		return nil, nil, nil, err
+	}
+
+	return pods, searched, s.getResultLabels(resultLabels), nil
+}
+
+// getResultLabels returns the labels attached to all the results of the cluster:
+// the labels of the backend, the given ones and the name of the cluster
+func (s *clusterSearch) getResultLabels(resultLabels map[string]string) map[string]string {
+	labels := collections.MergeMap(collections.MergeMap(nil, s.config.CommonBackend.Labels), resultLabels)
+	if s.name != "" {
+		labels["cluster"] = s.name
+	}
+	return labels
+}
+
+// ErrTooManyPods is returned when a search resolves to more pods than the backend searches at once
+var ErrTooManyPods = errors.New("too many pods, narrow your selector")
+
+func (s *clusterSearch) checkPodCount(pods *v1.PodList) error {
+	if pods == nil {
+		return nil
+	}
+
+	if max := s.config.GetMaxPods(); len(pods.Items) > max {
+		return fmt.Errorf("%w: the search matches %d pods, at most %d can be searched", ErrTooManyPods, len(pods.Items), max)
+	}
+	return nil
+}
+
+// getResourceID returns the namespace, kind and name of the id of a resource
+func (s *clusterSearch) getResourceID(q *logs.SearchParams) (namespace, kind, name string, err error) {
+	parts := strings.Split(q.Id, "/")
+	switch len(parts) {
+	case 3:
+		namespace, kind, name = parts[0], parts[1], parts[2]
+	case 2:
+		namespace, kind, name = q.Labels["namespace"], parts[0], parts[1]
+	}
+
+	if kind == "" || name == "" {
+		return "", "", "", fmt.Errorf("expected id in format [<namespace>/]<kind>/<name>, got %q", q.Id)
+	}
+	return namespace, kind, name, nil
+}
+
+// getContainerLabels returns the labels of the results of a container
+func getContainerLabels(pod v1.Pod, containerName string, resultLabels map[string]string) map[string]string {
+	var labels = map[string]string{
+		"pod":           pod.Name,
+		"containerName": containerName,
+		"nodeName":      pod.Spec.NodeName,
+		"namespace":     pod.Namespace,
+	}
+	for k, v := range resultLabels {
+		labels[k] = v
+	}
+	return labels
+}
+
+// getPreviousContainerLabels returns the labels of the results of the previous instance of a container,
+// telling the restart and why the instance terminated
+func getPreviousContainerLabels(status *v1.ContainerStatus) map[string]string {
+	labels := map[string]string{
+		"previous":     "true",
+		"restartCount": strconv.Itoa(int(status.RestartCount)),
+	}
+
+	if terminated := status.LastTerminationState.Terminated; terminated != nil {
+		labels["exitCode"] = strconv.Itoa(int(terminated.ExitCode))
+		if terminated.Reason != "" {
+			labels["terminationReason"] = terminated.Reason
+		}
+	}
+	return labels
+}
+
+// containerTask is the search of the logs of an instance of a container of a pod
+type containerTask struct {
+	pod      v1.Pod
+	instance ContainerLogs
+}
+
+func (s *clusterSearch) getLogResultsForPods(ctx context.Context, q *logs.SearchParams, cursor *time.Time, pods *v1.PodList, resultLabels map[string]string) ([]logs.Result, error) {
+	var tasks []containerTask
+	for _, pod := range pods.Items {
+		for _, instance := range GetContainerInstances(pod, q.Previous) {
+			tasks = append(tasks, containerTask{pod: pod, instance: instance})
+		}
+	}
+
+	// The logs are fetched concurrently, with each task writing the lines of its own instance
+	group := new(errgroup.Group)
+	group.SetLimit(s.config.GetConcurrency())
+	for i := range tasks {
+		task := &tasks[i]
+		group.Go(func() error {
+			lines, err := s.getLogs(ctx, q, task.pod, task.instance)
+			if ctx.Err() != nil {
+				return ctx.Err()
 			}
-			for _, line := range containerLogs {
-				line.Labels = labels
-				line = line.Process()
-				if line.Message != "" {
-					results = append(results, line)
-				}
+			if err != nil {
+				logger.Tracef("failed to begin streaming %s/%s (previous=%v): %s", task.pod.Name, task.instance.Container, task.instance.Previous, err)
+				return nil
+			}
+			task.instance.Lines = lines
+			return nil
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+
+	var results []logs.Result
+	workloads := s.client.GetWorkloads(ctx, pods.Items)
+	for _, task := range tasks {
+		pod, containerLogs := task.pod, task.instance
+		labels := getContainerLabels(pod, containerLogs.Container, resultLabels)
+		labels = collections.MergeMap(labels, getWorkloadLabels(workloads[pod.UID]))
+		if containerLogs.Previous {
+			labels = collections.MergeMap(labels, getPreviousContainerLabels(containerLogs.Status))
+		}
+		for _, line := range containerLogs.Lines {
+			line.Labels = labels
+			line = line.Process()
+			if line.Message == "" {
+				continue
+			}
+
+			// The since time of the logs API has a precision of seconds
+			// so the lines up to the cursor are filtered out here.
+			if cursor != nil && !line.GetTime().After(*cursor) {
+				continue
+			}
+
+			// The logs API can only be resumed forward in time
+			if q.Order == logs.OrderAscending {
+				line.Cursor = line.Time
+			}
+			results = append(results, line)
+		}
+	}
+	return results, nil
+}
+
+// getLogs returns the lines of the instance of the container, from the cache if enabled
+func (s *clusterSearch) getLogs(ctx context.Context, q *logs.SearchParams, pod v1.Pod, instance ContainerLogs) ([]logs.Result, error) {
+	if s.cache != nil {
+		return s.cache.GetLogs(ctx, s.client, s.name, q, pod, instance)
+	}
+	return s.client.GetLogsForContainer(ctx, q, pod, instance.Container, instance.Previous)
+}
+
+// eventObjects returns the objects whose events are searched: the pods and the object searched
+func eventObjects(pods *v1.PodList, searched *v1.ObjectReference) []v1.ObjectReference {
+	var objects []v1.ObjectReference
+	if searched != nil {
+		objects = append(objects, *searched)
+	}
+	for _, pod := range pods.Items {
+		objects = append(objects, v1.ObjectReference{Kind: "Pod", Namespace: pod.Namespace, Name: pod.Name})
+	}
+	return objects
+}
+
+// getEventResults returns the events of the objects as results.
+// Up to LimitPerItem events are returned for each object, the newest first.
+func (s *clusterSearch) getEventResults(ctx context.Context, q *logs.SearchParams, cursor *time.Time, objects []v1.ObjectReference, resultLabels map[string]string) ([]logs.Result, error) {
+	start := q.GetStart()
+	if cursor != nil {
+		start = cursor
+	}
+
+	eventsByObject := make([][]event, len(objects))
+	group := new(errgroup.Group)
+	group.SetLimit(s.config.GetConcurrency())
+	for i, object := range objects {
+		i, object := i, object
+		group.Go(func() error {
+			events, err := s.client.GetEventsForObject(ctx, s.config.Events.API, object)
+			if ctx.Err() != nil {
+				return ctx.Err()
 			}
+			if err != nil {
+				logger.Errorf("error fetching events for %s: %v in namespace: %v, err: %v", object.Kind, object.Name, object.Namespace, err)
+				return nil
+			}
+			eventsByObject[i] = events
+			return nil
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+
+	var results []logs.Result
+	for _, events := range eventsByObject {
+		for _, e := range filterEvents(events, s.config.Events.Types, start, q.GetEnd(), q.LimitPerItem) {
+			// The events up to the cursor were returned on the previous page
+			if cursor != nil && !e.time.After(*cursor) {
+				continue
+			}
+
+			result := e.toResult(resultLabels)
+			if q.Order == logs.OrderAscending {
+				result.Cursor = result.Time
+			}
+			results = append(results, result)
 		}
 	}
-	return results
+	return results, nil
+}
+
+// getPageCursor returns the timestamp of the last line returned on the previous page
+func getPageCursor(q *logs.SearchParams) (*time.Time, error) {
+	if q.Page == "" {
+		return nil, nil
+	}
+
+	cursor, err := time.Parse(time.RFC3339Nano, q.Page)
+	if err != nil {
+		return nil, fmt.Errorf("invalid page token %q: %w", q.Page, err)
+	}
+
+	return &cursor, nil
 }
 
-func (s *KubernetesSearch) GetNameNamespace(q *logs.SearchParams) (namespace, name string) {
+func (s *clusterSearch) GetNameNamespace(q *logs.SearchParams) (namespace, name string) {
 	if strings.Contains(q.Id, "/") {
 		// namespace is provided as a prefix in the ID
 		namespaceName := strings.Split(q.Id, "/")
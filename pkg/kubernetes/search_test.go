@@ -0,0 +1,241 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/flanksource/apm-hub/api/logs"
+	"github.com/flanksource/kommons"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+func TestGetPreviousContainerLabels(t *testing.T) {
+	status := &v1.ContainerStatus{
+		Name:         "api",
+		RestartCount: 3,
+		LastTerminationState: v1.ContainerState{
+			Terminated: &v1.ContainerStateTerminated{ExitCode: 137, Reason: "OOMKilled"},
+		},
+	}
+
+	want := map[string]string{
+		"previous":          "true",
+		"restartCount":      "3",
+		"exitCode":          "137",
+		"terminationReason": "OOMKilled",
+	}
+	if got := getPreviousContainerLabels(status); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestGetType(t *testing.T) {
+	if got, err := getType(&logs.SearchParams{Type: "kubernetesstatefulset"}); err != nil || got != TypeStatefulSet {
+		t.Errorf("got %s, %v", got, err)
+	}
+
+	for _, unknown := range []string{"", "VM", "KubernetesPods"} {
+		if _, err := getType(&logs.SearchParams{Type: unknown}); err == nil {
+			t.Errorf("expected an error for the type %q", unknown)
+		}
+	}
+}
+
+func TestGetLogResultsForPods(t *testing.T) {
+	var inFlight, maxInFlight int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+
+		// /api/v1/namespaces/default/pods/<name>/log
+		pod := strings.Split(r.URL.Path, "/")[6]
+		fmt.Fprintf(w, "2023-03-09T12:00:00Z started %s\n", pod)
+	}))
+	defer server.Close()
+
+	kommonsClient := &kommons.Client{GetRESTConfig: func() (*rest.Config, error) {
+		return &rest.Config{Host: server.URL}, nil
+	}}
+	config := &logs.KubernetesSearchBackendConfig{Concurrency: 2}
+	client, err := GetKubeClient(kommonsClient, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	search := &clusterSearch{client: client, config: config}
+
+	pods := &v1.PodList{}
+	for i := 0; i < 6; i++ {
+		pods.Items = append(pods.Items, v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("api-%d", i), Namespace: "default"},
+			Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "api"}}},
+		})
+	}
+
+	results, err := search.getLogResultsForPods(context.Background(), &logs.SearchParams{}, nil, pods, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var messages []string
+	for _, r := range results {
+		messages = append(messages, r.Message)
+	}
+	want := []string{"started api-0", "started api-1", "started api-2", "started api-3", "started api-4", "started api-5"}
+	if !reflect.DeepEqual(messages, want) {
+		t.Errorf("got %v, want %v", messages, want)
+	}
+	if maxInFlight != 2 {
+		t.Errorf("expected 2 requests at once, got %d", maxInFlight)
+	}
+}
+
+func TestCheckPodCount(t *testing.T) {
+	search := &clusterSearch{config: &logs.KubernetesSearchBackendConfig{MaxPods: 1}}
+
+	pods := &v1.PodList{Items: []v1.Pod{{}, {}}}
+	if err := search.checkPodCount(pods); !errors.Is(err, ErrTooManyPods) {
+		t.Errorf("expected ErrTooManyPods, got %v", err)
+	}
+	if err := search.checkPodCount(&v1.PodList{Items: pods.Items[:1]}); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestGetClusterSearches(t *testing.T) {
+	config := &logs.KubernetesSearchBackendConfig{Clusters: []logs.KubernetesCluster{{Name: "eu"}, {Name: "us"}}}
+	search, err := NewKubernetesSearchBackend([]Cluster{{Name: "eu"}, {Name: "us"}}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		q        logs.SearchParams
+		clusters []string
+		id       string
+		err      bool
+	}{
+		{name: "all clusters", q: logs.SearchParams{Type: TypeDeployment, Id: "default/api"}, clusters: []string{"eu", "us"}, id: "default/api"},
+		{name: "cluster in id", q: logs.SearchParams{Type: TypeDeployment, Id: "us/default/api"}, clusters: []string{"us"}, id: "default/api"},
+		{name: "cluster label", q: logs.SearchParams{Type: TypePod, Id: "api-0", Labels: map[string]string{"cluster": "eu"}}, clusters: []string{"eu"}, id: "api-0"},
+		{name: "node", q: logs.SearchParams{Type: TypeNode, Id: "eu/node-1"}, clusters: []string{"eu"}, id: "node-1"},
+		{name: "resource", q: logs.SearchParams{Type: TypeResource, Id: "eu/default/Rollout/api"}, clusters: []string{"eu"}, id: "default/Rollout/api"},
+		{name: "unknown cluster", q: logs.SearchParams{Type: TypeDeployment, Id: "asia/default/api"}, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			searches, err := search.getClusterSearches(&tt.q)
+			if tt.err {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var clusters []string
+			for _, s := range searches {
+				clusters = append(clusters, s.cluster.name)
+				if s.params.Id != tt.id {
+					t.Errorf("expected id %q, got %q", tt.id, s.params.Id)
+				}
+				if _, ok := s.params.Labels["cluster"]; ok {
+					t.Error("expected the cluster label to be removed")
+				}
+			}
+			if !reflect.DeepEqual(clusters, tt.clusters) {
+				t.Errorf("expected clusters %v, got %v", tt.clusters, clusters)
+			}
+		})
+	}
+}
+
+func TestGetResultLabels(t *testing.T) {
+	config := &logs.KubernetesSearchBackendConfig{CommonBackend: logs.CommonBackend{Labels: map[string]string{"env": "prod"}}}
+
+	labels := (&clusterSearch{name: "eu", config: config}).getResultLabels(map[string]string{"deployment": "api"})
+	want := map[string]string{"env": "prod", "deployment": "api", "cluster": "eu"}
+	if !reflect.DeepEqual(labels, want) {
+		t.Errorf("got %v, want %v", labels, want)
+	}
+
+	if labels := (&clusterSearch{config: config}).getResultLabels(nil); labels["cluster"] != "" {
+		t.Errorf("expected no cluster label for an unnamed cluster, got %v", labels)
+	}
+}
+
+func TestSearchClusterFailure(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/log") {
+			fmt.Fprintln(w, "2023-03-09T12:00:00Z started")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"kind": "PodList", "apiVersion": "v1", "items": [{"metadata": {"name": "api-0", "namespace": "default"}, "spec": {"containers": [{"name": "api"}]}}]}`)
+	}))
+	defer healthy.Close()
+	unreachable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer unreachable.Close()
+
+	config := &logs.KubernetesSearchBackendConfig{Clusters: []logs.KubernetesCluster{{Name: "europe"}, {Name: "america"}}}
+	var clusters []Cluster
+	for name, host := range map[string]string{"europe": healthy.URL, "america": unreachable.URL} {
+		host := host
+		client, err := GetKubeClient(&kommons.Client{GetRESTConfig: func() (*rest.Config, error) {
+			return &rest.Config{Host: host}, nil
+		}}, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		clusters = append(clusters, Cluster{Name: name, Client: client})
+	}
+
+	search, err := NewKubernetesSearchBackend(clusters, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The lines of the healthy cluster are returned along with the failed cluster
+	results, err := search.Search(context.Background(), &logs.SearchParams{Type: TypeNode})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results.Results) != 1 || results.Results[0].Labels["cluster"] != "europe" {
+		t.Errorf("expected the line of the healthy cluster, got %+v", results.Results)
+	}
+	if !results.Partial {
+		t.Error("expected partial results")
+	}
+	for _, cluster := range results.Backends {
+		if failed := cluster.Status != logs.BackendStatusSuccess; failed != (cluster.Name == "america") {
+			t.Errorf("unexpected status %s of cluster %s: %s", cluster.Status, cluster.Name, cluster.Error)
+		}
+	}
+
+	// The search fails once all the clusters fail
+	if _, err := search.Search(context.Background(), &logs.SearchParams{Type: TypeNode, Labels: map[string]string{"cluster": "america"}}); err == nil {
+		t.Error("expected an error when all the clusters fail")
+	}
+}
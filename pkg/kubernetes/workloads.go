@@ -0,0 +1,337 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/flanksource/commons/logger"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// workload is a controller owning pods, directly or through replica sets or jobs
+type workload struct {
+	uid       types.UID
+	kind      string
+	name      string
+	namespace string
+	owners    []metav1.OwnerReference
+	// selector selects the pods of the workload, along with the pods of other workloads.
+	// A nil selector selects all the pods of the namespace.
+	selector *metav1.LabelSelector
+}
+
+// listWorkloads returns the workloads of the kind, e.g. StatefulSet, with the name (all if empty) and label selector
+func listWorkloads(ctx context.Context, client kubernetes.Interface, kind, name, namespace, labelSelector string) ([]workload, error) {
+	options := metav1.ListOptions{LabelSelector: labelSelector}
+	if name != "" {
+		options.FieldSelector = "metadata.name=" + name
+	}
+
+	var workloads []workload
+	add := func(meta metav1.ObjectMeta, selector *metav1.LabelSelector) {
+		workloads = append(workloads, workload{uid: meta.UID, kind: kind, name: meta.Name, namespace: meta.Namespace, owners: meta.OwnerReferences, selector: selector})
+	}
+
+	switch kind {
+	case "Deployment":
+		list, err := client.AppsV1().Deployments(namespace).List(ctx, options)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range list.Items {
+			add(item.ObjectMeta, item.Spec.Selector)
+		}
+	case "StatefulSet":
+		list, err := client.AppsV1().StatefulSets(namespace).List(ctx, options)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range list.Items {
+			add(item.ObjectMeta, item.Spec.Selector)
+		}
+	case "DaemonSet":
+		list, err := client.AppsV1().DaemonSets(namespace).List(ctx, options)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range list.Items {
+			add(item.ObjectMeta, item.Spec.Selector)
+		}
+	case "ReplicaSet":
+		list, err := client.AppsV1().ReplicaSets(namespace).List(ctx, options)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range list.Items {
+			add(item.ObjectMeta, item.Spec.Selector)
+		}
+	case "Job":
+		list, err := client.BatchV1().Jobs(namespace).List(ctx, options)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range list.Items {
+			add(item.ObjectMeta, item.Spec.Selector)
+		}
+	case "CronJob":
+		list, err := client.BatchV1().CronJobs(namespace).List(ctx, options)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range list.Items {
+			add(item.ObjectMeta, item.Spec.JobTemplate.Spec.Selector)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported workload kind %s", kind)
+	}
+
+	return workloads, nil
+}
+
+// GetPodsForWorkload returns the pods of the workloads of the kind, e.g. StatefulSet, with the name (all if empty) and labels.
+//
+// The pods are those owned by the workloads, walking the owner references through the
+// replica sets of a deployment and the jobs of a cron job, so the pods of other workloads
+// whose labels happen to match the selector aren't included.
+func (c *Client) GetPodsForWorkload(ctx context.Context, kind, name, namespace string, labels map[string]string) (*v1.PodList, error) {
+	client, err := c.GetClientset()
+	if err != nil {
+		return nil, err
+	}
+	return getPodsForWorkload(ctx, client, kind, name, namespace, labels)
+}
+
+func getPodsForWorkload(ctx context.Context, client kubernetes.Interface, kind, name, namespace string, labels map[string]string) (*v1.PodList, error) {
+	workloads, err := listWorkloads(ctx, client, kind, name, namespace, GetLabelString(labels))
+	if err != nil {
+		return nil, err
+	}
+
+	pods := &v1.PodList{Items: []v1.Pod{}}
+	for _, w := range workloads {
+		owners := map[types.UID]bool{w.uid: true}
+
+		// The pods of deployments and cron jobs are owned by their replica sets and jobs
+		var intermediate string
+		switch w.kind {
+		case "Deployment":
+			intermediate = "ReplicaSet"
+		case "CronJob":
+			intermediate = "Job"
+		}
+		if intermediate != "" {
+			selector, err := selectorString(w.selector)
+			if err != nil {
+				logger.Errorf("invalid selector of %s: %v; error: %v", w.kind, w.name, err)
+				continue
+			}
+
+			children, err := listWorkloads(ctx, client, intermediate, "", w.namespace, selector)
+			if err != nil {
+				logger.Errorf("error fetching %s for %s: %v; error: %v", intermediate, w.kind, w.name, err)
+				continue
+			}
+
+			owners = map[types.UID]bool{}
+			for _, child := range children {
+				if controller := getController(child.owners); controller != nil && controller.UID == w.uid {
+					owners[child.uid] = true
+				}
+			}
+		}
+
+		owned, err := getOwnedPods(ctx, client, w.namespace, w.selector, owners)
+		if err != nil {
+			logger.Errorf("error fetching pod for %s: %v; error: %v", w.kind, w.name, err)
+			continue
+		}
+		pods.Items = append(pods.Items, owned...)
+	}
+	return pods, nil
+}
+
+// selectorString returns the label selector as a string. A nil selector selects everything.
+func selectorString(selector *metav1.LabelSelector) (string, error) {
+	if selector == nil {
+		return "", nil
+	}
+
+	s, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return "", err
+	}
+	return s.String(), nil
+}
+
+// getOwnedPods returns the pods, selected by the selector, controlled by one of the owners
+func getOwnedPods(ctx context.Context, client kubernetes.Interface, namespace string, selector *metav1.LabelSelector, owners map[types.UID]bool) ([]v1.Pod, error) {
+	if len(owners) == 0 {
+		return nil, nil
+	}
+
+	labelSelector, err := selectorString(selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector: %w", err)
+	}
+
+	list, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		return nil, err
+	}
+
+	var pods []v1.Pod
+	for _, pod := range list.Items {
+		if controller := getController(pod.OwnerReferences); controller != nil && owners[controller.UID] {
+			pods = append(pods, pod)
+		}
+	}
+	return pods, nil
+}
+
+// GetPodsForResource returns the pods selected by the selector of any resource, e.g. a custom resource,
+// whose spec.selector is either a label selector or a map of labels
+func (c *Client) GetPodsForResource(ctx context.Context, kind, name, namespace string) (*v1.PodList, error) {
+	client, err := c.GetClientset()
+	if err != nil {
+		return nil, err
+	}
+
+	resource, err := c.GetByKind(kind, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+
+	selector, err := getResourceSelector(resource)
+	if err != nil {
+		return nil, fmt.Errorf("error getting the selector of %s %s/%s: %w", kind, namespace, name, err)
+	}
+
+	return client.CoreV1().Pods(resource.GetNamespace()).List(ctx, metav1.ListOptions{LabelSelector: selector})
+}
+
+// getResourceSelector returns the label selector, as a string, of the spec.selector of the resource
+func getResourceSelector(resource *unstructured.Unstructured) (string, error) {
+	value, found, err := unstructured.NestedFieldNoCopy(resource.Object, "spec", "selector")
+	if err != nil {
+		return "", err
+	}
+	if !found || value == nil {
+		return "", fmt.Errorf("spec.selector not found")
+	}
+
+	fields, ok := value.(map[string]any)
+	if !ok {
+		return "", fmt.Errorf("spec.selector is a %T", value)
+	}
+
+	_, hasMatchLabels := fields["matchLabels"]
+	_, hasMatchExpressions := fields["matchExpressions"]
+	if hasMatchLabels || hasMatchExpressions {
+		var labelSelector metav1.LabelSelector
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(fields, &labelSelector); err != nil {
+			return "", err
+		}
+		return selectorString(&labelSelector)
+	}
+
+	set := make(labels.Set, len(fields))
+	for k, v := range fields {
+		str, ok := v.(string)
+		if !ok {
+			return "", fmt.Errorf("the label %s of spec.selector is a %T", k, v)
+		}
+		set[k] = str
+	}
+	if len(set) == 0 {
+		return "", fmt.Errorf("spec.selector is empty")
+	}
+	return labels.SelectorFromSet(set).String(), nil
+}
+
+// GetWorkloads returns the workloads owning the pods, by the uid of the pod,
+// resolving the replica sets of deployments and the jobs of cron jobs.
+// The pods without an owner aren't included.
+func (c *Client) GetWorkloads(ctx context.Context, pods []v1.Pod) map[types.UID]v1.ObjectReference {
+	client, err := c.GetClientset()
+	if err != nil {
+		logger.Errorf("error getting the clientset: %v", err)
+		return nil
+	}
+	return getWorkloads(ctx, client, pods)
+}
+
+func getWorkloads(ctx context.Context, client kubernetes.Interface, pods []v1.Pod) map[types.UID]v1.ObjectReference {
+	workloads := make(map[types.UID]v1.ObjectReference)
+	// The owners of the replica sets and jobs, shared by the pods
+	owners := make(map[types.UID]*metav1.OwnerReference)
+	for _, pod := range pods {
+		controller := getController(pod.OwnerReferences)
+		if controller == nil {
+			continue
+		}
+
+		owner := controller
+		if controller.Kind == "ReplicaSet" || controller.Kind == "Job" {
+			parent, ok := owners[controller.UID]
+			if !ok {
+				parent = getParent(ctx, client, controller.Kind, pod.Namespace, controller.Name)
+				owners[controller.UID] = parent
+			}
+			if parent != nil {
+				owner = parent
+			}
+		}
+
+		workloads[pod.UID] = v1.ObjectReference{Kind: owner.Kind, Namespace: pod.Namespace, Name: owner.Name, UID: owner.UID}
+	}
+	return workloads
+}
+
+// getParent returns the controller of the replica set or job, if any
+func getParent(ctx context.Context, client kubernetes.Interface, kind, namespace, name string) *metav1.OwnerReference {
+	var refs []metav1.OwnerReference
+	switch kind {
+	case "ReplicaSet":
+		rs, err := client.AppsV1().ReplicaSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			logger.Debugf("error fetching replica set %s/%s: %v", namespace, name, err)
+			return nil
+		}
+		refs = rs.OwnerReferences
+	case "Job":
+		job, err := client.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			logger.Debugf("error fetching job %s/%s: %v", namespace, name, err)
+			return nil
+		}
+		refs = job.OwnerReferences
+	}
+	return getController(refs)
+}
+
+// getController returns the owner reference of the controller of an object
+func getController(refs []metav1.OwnerReference) *metav1.OwnerReference {
+	for i := range refs {
+		if refs[i].Controller != nil && *refs[i].Controller {
+			return &refs[i]
+		}
+	}
+	return nil
+}
+
+// getWorkloadLabels returns the labels telling the workload of the results of a pod
+func getWorkloadLabels(workload v1.ObjectReference) map[string]string {
+	if workload.Kind == "" {
+		return nil
+	}
+	return map[string]string{
+		"workloadKind": workload.Kind,
+		"workload":     workload.Name,
+	}
+}
@@ -0,0 +1,138 @@
+package kubernetes
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func objectMeta(name, uid string, labels map[string]string, owner *metav1.OwnerReference) metav1.ObjectMeta {
+	meta := metav1.ObjectMeta{Name: name, Namespace: "default", UID: types.UID(uid), Labels: labels}
+	if owner != nil {
+		meta.OwnerReferences = []metav1.OwnerReference{*owner}
+	}
+	return meta
+}
+
+func controllerRef(kind, name, uid string) *metav1.OwnerReference {
+	controller := true
+	return &metav1.OwnerReference{Kind: kind, Name: name, UID: types.UID(uid), Controller: &controller}
+}
+
+func newWorkloadsClientset() *fake.Clientset {
+	api := map[string]string{"app": "api"}
+	canary := map[string]string{"app": "api", "track": "canary"}
+
+	objects := []runtime.Object{
+		&appsv1.Deployment{ObjectMeta: objectMeta("api", "d1", nil, nil), Spec: appsv1.DeploymentSpec{Selector: &metav1.LabelSelector{MatchLabels: api}}},
+		&appsv1.ReplicaSet{ObjectMeta: objectMeta("api-abc", "rs1", api, controllerRef("Deployment", "api", "d1"))},
+		&v1.Pod{ObjectMeta: objectMeta("api-abc-1", "p1", api, controllerRef("ReplicaSet", "api-abc", "rs1"))},
+
+		// The selector of the api deployment matches the pods of the canary deployment too
+		&appsv1.Deployment{ObjectMeta: objectMeta("api-canary", "d2", nil, nil), Spec: appsv1.DeploymentSpec{Selector: &metav1.LabelSelector{MatchLabels: canary}}},
+		&appsv1.ReplicaSet{ObjectMeta: objectMeta("api-canary-def", "rs2", canary, controllerRef("Deployment", "api-canary", "d2"))},
+		&v1.Pod{ObjectMeta: objectMeta("api-canary-def-1", "p2", canary, controllerRef("ReplicaSet", "api-canary-def", "rs2"))},
+
+		// A pod without an owner, matching the selector of the api deployment
+		&v1.Pod{ObjectMeta: objectMeta("debug", "p3", api, nil)},
+
+		&batchv1.CronJob{ObjectMeta: objectMeta("backup", "c1", nil, nil)},
+		&batchv1.Job{ObjectMeta: objectMeta("backup-1", "j1", nil, controllerRef("CronJob", "backup", "c1"))},
+		&v1.Pod{ObjectMeta: objectMeta("backup-1-x", "p4", map[string]string{"job-name": "backup-1"}, controllerRef("Job", "backup-1", "j1"))},
+
+		&appsv1.StatefulSet{ObjectMeta: objectMeta("db", "s1", nil, nil), Spec: appsv1.StatefulSetSpec{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}}}},
+		&v1.Pod{ObjectMeta: objectMeta("db-0", "p5", map[string]string{"app": "db"}, controllerRef("StatefulSet", "db", "s1"))},
+	}
+	return fake.NewSimpleClientset(objects...)
+}
+
+func names(pods *v1.PodList) []string {
+	names := podNames(pods)
+	sort.Strings(names)
+	return names
+}
+
+func TestGetPodsForWorkload(t *testing.T) {
+	client := newWorkloadsClientset()
+
+	tests := []struct {
+		kind string
+		want []string
+	}{
+		{kind: "Deployment", want: []string{"api-abc-1", "api-canary-def-1"}},
+		{kind: "CronJob", want: []string{"backup-1-x"}},
+		{kind: "StatefulSet", want: []string{"db-0"}},
+		{kind: "DaemonSet", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.kind, func(t *testing.T) {
+			pods, err := getPodsForWorkload(context.Background(), client, tt.kind, "", "default", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := names(pods); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetWorkloads(t *testing.T) {
+	client := newWorkloadsClientset()
+	pods, err := client.CoreV1().Pods("default").List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]string)
+	for uid, w := range getWorkloads(context.Background(), client, pods.Items) {
+		got[string(uid)] = w.Kind + "/" + w.Name
+	}
+
+	want := map[string]string{
+		"p1": "Deployment/api",
+		"p2": "Deployment/api-canary",
+		"p4": "CronJob/backup",
+		"p5": "StatefulSet/db",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestGetResourceSelector(t *testing.T) {
+	tests := []struct {
+		selector any
+		want     string
+	}{
+		{selector: map[string]any{"matchLabels": map[string]any{"app": "api"}}, want: "app=api"},
+		{selector: map[string]any{"matchExpressions": []any{map[string]any{"key": "tier", "operator": "In", "values": []any{"web"}}}}, want: "tier in (web)"},
+		{selector: map[string]any{"app": "api"}, want: "app=api"},
+	}
+
+	for _, tt := range tests {
+		resource := &unstructured.Unstructured{Object: map[string]any{"spec": map[string]any{"selector": tt.selector}}}
+		got, err := getResourceSelector(resource)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("got %s, want %s", got, tt.want)
+		}
+	}
+
+	if _, err := getResourceSelector(&unstructured.Unstructured{Object: map[string]any{"spec": map[string]any{}}}); err == nil {
+		t.Errorf("expected an error for a resource without a selector")
+	}
+}
@@ -0,0 +1,103 @@
+package loganalytics
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+var identifierRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// toWhere compiles a query expression into the predicate of a KQL where operator.
+// The message, id and timestamp fields are the mapped columns, while any other field
+// is a column, or a property of a dynamic column, e.g. Properties.status.
+func toWhere(expr logs.QueryExpr, fields logs.AzureLogAnalyticsFields) string {
+	switch e := expr.(type) {
+	case logs.QueryAnd:
+		return joinPredicates(e.Exprs, " and ", fields)
+	case logs.QueryOr:
+		return joinPredicates(e.Exprs, " or ", fields)
+	case logs.QueryNot:
+		return "not(" + toWhere(e.Expr, fields) + ")"
+	case logs.QueryTerm:
+		return termPredicate(e, fields)
+	}
+
+	return ""
+}
+
+// joinPredicates joins the non empty predicates, wrapping them in parentheses
+func joinPredicates(exprs []logs.QueryExpr, sep string, fields logs.AzureLogAnalyticsFields) string {
+	predicates := make([]string, 0, len(exprs))
+	for _, e := range exprs {
+		if p := toWhere(e, fields); p != "" {
+			predicates = append(predicates, p)
+		}
+	}
+	return "(" + strings.Join(predicates, sep) + ")"
+}
+
+func termPredicate(term logs.QueryTerm, fields logs.AzureLogAnalyticsFields) string {
+	column := term.GetField()
+	switch column {
+	case logs.QueryFieldMessage:
+		column = fields.Message
+	case logs.QueryFieldID:
+		if fields.ID != "" {
+			column = fields.ID
+		}
+	case logs.QueryFieldTimestamp:
+		column = fields.Timestamp
+	}
+
+	ref := columnRef(column)
+	value := strconv.Quote(term.Value)
+	switch term.Op {
+	case logs.QueryOpContains:
+		// contains is case-insensitive, like the query language
+		return "tostring(" + ref + ") contains " + value
+	case logs.QueryOpEquals:
+		return "tostring(" + ref + ") == " + value
+	case logs.QueryOpNotEquals:
+		return "tostring(" + ref + ") != " + value
+	case logs.QueryOpRegex:
+		return "tostring(" + ref + ") matches regex " + value
+	case logs.QueryOpGreater, logs.QueryOpGreaterEqual, logs.QueryOpLess, logs.QueryOpLessEqual:
+		op := string(term.Op)
+		if term.IsNumeric() {
+			return "todouble(" + ref + ") " + op + " " + term.Value
+		}
+		if _, err := time.Parse(time.RFC3339Nano, term.Value); err == nil && column == fields.Timestamp {
+			return ref + " " + op + " todatetime(" + value + ")"
+		}
+		return "strcmp(tostring(" + ref + "), " + value + ") " + op + " 0"
+	}
+
+	return ""
+}
+
+// columnRef returns the reference to the column, or to the property of a dynamic column,
+// quoting the names that aren't identifiers, e.g. Properties['k8s-pod/app']
+func columnRef(field string) string {
+	segments := strings.Split(field, ".")
+
+	ref := quoteName(segments[0])
+	for _, s := range segments[1:] {
+		if identifierRegex.MatchString(s) {
+			ref += "." + s
+		} else {
+			ref += "[" + strconv.Quote(s) + "]"
+		}
+	}
+	return ref
+}
+
+func quoteName(name string) string {
+	if identifierRegex.MatchString(name) {
+		return name
+	}
+	return "[" + strconv.Quote(name) + "]"
+}
@@ -0,0 +1,46 @@
+package loganalytics
+
+import (
+	"testing"
+
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+func TestToWhere(t *testing.T) {
+	fields := logs.AzureLogAnalyticsFields{Message: "LogMessage", Timestamp: "TimeGenerated", ID: "_ItemId"}
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{
+			query: `"connection refused"`,
+			want:  `tostring(LogMessage) contains "connection refused"`,
+		},
+		{
+			query: `PodName=api-0 LogLevel!=info`,
+			want:  `(tostring(PodName) == "api-0" and tostring(LogLevel) != "info")`,
+		},
+		{
+			query: `Properties.status>=500 OR NOT Properties.k8s-pod/app:/^worker-/`,
+			want:  `(todouble(Properties.status) >= 500 or not(tostring(Properties["k8s-pod/app"]) matches regex "^worker-"))`,
+		},
+		{
+			query: `timestamp>"2023-03-09T12:00:00Z" id=abc`,
+			want:  `(TimeGenerated > todatetime("2023-03-09T12:00:00Z") and tostring(_ItemId) == "abc")`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			expr, err := logs.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("error parsing query: %v", err)
+			}
+
+			if got := toWhere(expr, fields); got != tt.want {
+				t.Errorf("toWhere() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,334 @@
+package loganalytics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/flanksource/apm-hub/api/logs"
+	"github.com/flanksource/commons/collections"
+	"github.com/flanksource/commons/logger"
+	"github.com/flanksource/commons/utils"
+	"github.com/jeremywohl/flatten"
+)
+
+const (
+	// DefaultEndpoint is the endpoint of the Log Analytics API in the Azure public cloud
+	DefaultEndpoint = "https://api.loganalytics.io"
+
+	defaultTimestampColumn = "TimeGenerated"
+)
+
+// AzureLogAnalyticsBackend runs KQL queries against a Log Analytics workspace
+type AzureLogAnalyticsBackend struct {
+	// client authenticates the requests, e.g. with the token of a service principal
+	client   *http.Client
+	config   *logs.AzureLogAnalyticsBackendConfig
+	fields   logs.AzureLogAnalyticsFields
+	template *template.Template
+}
+
+func NewAzureLogAnalyticsBackend(client *http.Client, config *logs.AzureLogAnalyticsBackendConfig) (*AzureLogAnalyticsBackend, error) {
+	if client == nil {
+		return nil, fmt.Errorf("client is nil")
+	}
+
+	if config.WorkspaceID == "" {
+		return nil, fmt.Errorf("workspaceID is empty")
+	}
+
+	if config.Query == "" {
+		return nil, fmt.Errorf("query is empty")
+	}
+
+	if config.Fields.Message == "" {
+		return nil, fmt.Errorf("fields.message is empty")
+	}
+
+	template, err := template.New("query").Parse(config.Query)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing template: %w", err)
+	}
+
+	fields := config.Fields
+	if fields.Timestamp == "" {
+		fields.Timestamp = defaultTimestampColumn
+	}
+
+	return &AzureLogAnalyticsBackend{
+		client:   client,
+		config:   config,
+		fields:   fields,
+		template: template,
+	}, nil
+}
+
+func (t *AzureLogAnalyticsBackend) MatchRoute(q *logs.SearchParams) (route logs.SearchRoute, match bool) {
+	return t.config.CommonBackend.Routes.MatchRoute(q)
+}
+
+// Search runs the rendered KQL query, bounded by the time window of the params, sorted by the timestamp column.
+//
+// KQL can't resume after a row, so the page token is the time window of the first page
+// along with the number of rows already returned.
+func (t *AzureLogAnalyticsBackend) Search(ctx context.Context, q *logs.SearchParams) (logs.SearchResults, error) {
+	var result logs.SearchResults
+	var buf bytes.Buffer
+
+	if err := t.template.Execute(&buf, q); err != nil {
+		return result, fmt.Errorf("error executing template: %w", err)
+	}
+
+	query, err := q.GetQuery()
+	if err != nil {
+		return result, fmt.Errorf("error parsing query: %w", err)
+	}
+
+	start, end := q.GetStart(), q.GetEnd()
+	if end == nil {
+		now := time.Now()
+		end = &now
+	}
+
+	var offset int
+	if q.Page != "" {
+		if start, end, offset, err = parseCursor(q.Page); err != nil {
+			return result, err
+		}
+	}
+
+	kql := t.buildQuery(buf.String(), query, start, end, offset, int(q.Limit), q.Order)
+	table, err := t.query(ctx, kql, start, end)
+	if err != nil {
+		return result, err
+	}
+
+	for i, row := range table.Rows {
+		// One more row than needed tells whether there are more rows
+		if i == int(q.Limit) {
+			result.NextPage = encodeCursor(start, end, offset+i)
+			break
+		}
+
+		r, err := t.toResult(table.Columns, row)
+		if err != nil {
+			logger.Debugf("error mapping row: %v", err)
+			continue
+		}
+		result.Results = append(result.Results, r)
+	}
+
+	result.Total = len(result.Results)
+	return result, nil
+}
+
+// buildQuery appends the time window, the query expression, the order and the page to the rendered query
+func (t *AzureLogAnalyticsBackend) buildQuery(kql string, expr logs.QueryExpr, start, end *time.Time, offset, limit int, order string) string {
+	timestamp := columnRef(t.fields.Timestamp)
+
+	stages := []string{strings.TrimSpace(kql)}
+	if start != nil {
+		stages = append(stages, fmt.Sprintf("where %s between (datetime(%s) .. datetime(%s))", timestamp, formatTime(*start), formatTime(*end)))
+	} else {
+		stages = append(stages, fmt.Sprintf("where %s <= datetime(%s)", timestamp, formatTime(*end)))
+	}
+
+	if expr != nil {
+		stages = append(stages, "where "+toWhere(expr, t.fields))
+	}
+
+	direction := "desc"
+	if order == logs.OrderAscending {
+		direction = "asc"
+	}
+	stages = append(stages, fmt.Sprintf("order by %s %s", timestamp, direction))
+
+	if offset > 0 {
+		stages = append(stages, "extend _row = row_number()", fmt.Sprintf("where _row > %d", offset), "project-away _row")
+	}
+	stages = append(stages, fmt.Sprintf("take %d", limit+1))
+
+	return strings.Join(stages, "\n| ")
+}
+
+// query runs the query and returns the primary table of the response
+func (t *AzureLogAnalyticsBackend) query(ctx context.Context, kql string, start, end *time.Time) (*table, error) {
+	body := map[string]string{"query": kql}
+	if start != nil {
+		body["timespan"] = formatTime(*start) + "/" + formatTime(*end)
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := t.config.Endpoint
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+	url := fmt.Sprintf("%s/v1/workspaces/%s/query", strings.TrimSuffix(endpoint, "/"), t.config.WorkspaceID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := t.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error querying log analytics: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		var errResp errorResponse
+		respBody, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+		if err := json.Unmarshal(respBody, &errResp); err == nil && errResp.Error.Message != "" {
+			return nil, fmt.Errorf("[loganalytics] got response %d: %s: %s", res.StatusCode, errResp.Error.Code, errResp.Error.Message)
+		}
+		return nil, fmt.Errorf("[loganalytics] got response %d: %s", res.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+
+	var resp response
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("error parsing the response body: %w", err)
+	}
+
+	if len(resp.Tables) == 0 {
+		return nil, fmt.Errorf("[loganalytics] the response has no tables")
+	}
+	return &resp.Tables[0], nil
+}
+
+// toResult maps a row to a result with the configured columns
+func (t *AzureLogAnalyticsBackend) toResult(columns []column, row []any) (logs.Result, error) {
+	var r logs.Result
+	if len(row) != len(columns) {
+		return r, fmt.Errorf("the row has %d values for %d columns", len(row), len(columns))
+	}
+
+	values := make(map[string]any, len(columns))
+	for i, c := range columns {
+		value := row[i]
+		// The dynamic values are returned as JSON strings
+		if str, ok := value.(string); ok && c.Type == "dynamic" {
+			var parsed any
+			if err := json.Unmarshal([]byte(str), &parsed); err == nil {
+				value = parsed
+			}
+		}
+		values[c.Name] = value
+	}
+
+	message, ok := values[t.fields.Message]
+	if !ok {
+		return r, fmt.Errorf("message column [%s] not found", t.fields.Message)
+	}
+
+	var err error
+	if r.Message, err = utils.Stringify(message); err != nil {
+		return r, fmt.Errorf("error stringifying message: %w", err)
+	}
+	r.Time, _ = values[t.fields.Timestamp].(string)
+	if t.fields.ID != "" && values[t.fields.ID] != nil {
+		r.Id, _ = utils.Stringify(values[t.fields.ID])
+	}
+
+	labels := make(map[string]any, len(values))
+	for k, v := range values {
+		if v == nil || k == t.fields.Message || k == t.fields.Timestamp || k == t.fields.ID || collections.Contains(t.fields.Exclusions, k) {
+			continue
+		}
+		labels[k] = v
+	}
+
+	flattened, err := flatten.Flatten(labels, "", flatten.DotStyle)
+	if err != nil {
+		return r, fmt.Errorf("error flattening labels: %w", err)
+	}
+
+	r.Labels = collections.MergeMap(nil, t.config.Labels)
+	for k, v := range flattened {
+		str, err := utils.Stringify(v)
+		if err != nil {
+			logger.Debugf("error stringifying %v: %v", v, err)
+			continue
+		}
+		r.Labels[k] = str
+	}
+
+	return r, nil
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// encodeCursor returns the page token of the next page
+func encodeCursor(start, end *time.Time, offset int) string {
+	var startTime string
+	if start != nil {
+		startTime = formatTime(*start)
+	}
+	return strings.Join([]string{startTime, formatTime(*end), strconv.Itoa(offset)}, "|")
+}
+
+// parseCursor returns the time window and the number of rows already returned in the page token
+func parseCursor(page string) (*time.Time, *time.Time, int, error) {
+	parts := strings.Split(page, "|")
+	if len(parts) != 3 {
+		return nil, nil, 0, fmt.Errorf("invalid page token %q", page)
+	}
+
+	var start *time.Time
+	if parts[0] != "" {
+		s, err := time.Parse(time.RFC3339Nano, parts[0])
+		if err != nil {
+			return nil, nil, 0, fmt.Errorf("invalid page token %q: %w", page, err)
+		}
+		start = &s
+	}
+
+	end, err := time.Parse(time.RFC3339Nano, parts[1])
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("invalid page token %q: %w", page, err)
+	}
+
+	offset, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("invalid page token %q: %w", page, err)
+	}
+
+	return start, &end, offset, nil
+}
+
+// response is the response of the query API
+type response struct {
+	Tables []table `json:"tables"`
+}
+
+type table struct {
+	Name    string   `json:"name"`
+	Columns []column `json:"columns"`
+	Rows    [][]any  `json:"rows"`
+}
+
+type column struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type errorResponse struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
@@ -0,0 +1,122 @@
+package loganalytics
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+const queryResponse = `{
+	"tables": [{
+		"name": "PrimaryResult",
+		"columns": [
+			{"name": "TimeGenerated", "type": "datetime"},
+			{"name": "PodName", "type": "string"},
+			{"name": "LogMessage", "type": "dynamic"},
+			{"name": "Properties", "type": "dynamic"},
+			{"name": "_ResourceId", "type": "string"}
+		],
+		"rows": [
+			["2023-03-09T12:29:11.828Z", "api-0", "connection refused", "{\"status\":500}", "/subscriptions/1"],
+			["2023-03-09T12:29:10Z", "api-0", "{\"msg\":\"GET /users\"}", null, "/subscriptions/1"],
+			["2023-03-09T12:29:09Z", "api-0", "started", null, "/subscriptions/1"]
+		]
+	}]
+}`
+
+func TestAzureLogAnalyticsBackend_Search(t *testing.T) {
+	var requests []map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/workspaces/my-workspace/query" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("invalid request: %v", err)
+		}
+		requests = append(requests, body)
+
+		if strings.Contains(body["query"], "_row > 2") {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": {"code": "BadArgumentError", "message": "The request had some invalid properties"}}`))
+			return
+		}
+		w.Write([]byte(queryResponse))
+	}))
+	defer server.Close()
+
+	backend, err := NewAzureLogAnalyticsBackend(server.Client(), &logs.AzureLogAnalyticsBackendConfig{
+		CommonBackend: logs.CommonBackend{Labels: map[string]string{"cloud": "azure"}},
+		WorkspaceID:   "my-workspace",
+		Endpoint:      server.URL,
+		Query:         `ContainerLogV2 | where PodNamespace == "{{index .Labels "namespace"}}"`,
+		Fields:        logs.AzureLogAnalyticsFields{Message: "LogMessage", Exclusions: []string{"_ResourceId"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q := &logs.SearchParams{
+		Labels: map[string]string{"namespace": "default"},
+		Start:  "2023-03-09T00:00:00Z",
+		End:    "2023-03-10T00:00:00Z",
+		Query:  "PodName=api-0",
+		Limit:  2,
+	}
+	q.SetDefaults()
+
+	res, err := backend.Search(context.Background(), q)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantQuery := strings.Join([]string{
+		`ContainerLogV2 | where PodNamespace == "default"`,
+		`where TimeGenerated between (datetime(2023-03-09T00:00:00Z) .. datetime(2023-03-10T00:00:00Z))`,
+		`where tostring(PodName) == "api-0"`,
+		`order by TimeGenerated desc`,
+		`take 3`,
+	}, "\n| ")
+	if requests[0]["query"] != wantQuery {
+		t.Errorf("got query %s, want %s", requests[0]["query"], wantQuery)
+	}
+	if requests[0]["timespan"] != "2023-03-09T00:00:00Z/2023-03-10T00:00:00Z" {
+		t.Errorf("unexpected timespan %s", requests[0]["timespan"])
+	}
+
+	want := []logs.Result{
+		{
+			Time:    "2023-03-09T12:29:11.828Z",
+			Message: "connection refused",
+			Labels:  map[string]string{"cloud": "azure", "PodName": "api-0", "Properties.status": "500"},
+		},
+		{
+			Time:    "2023-03-09T12:29:10Z",
+			Message: `{"msg":"GET /users"}`,
+			Labels:  map[string]string{"cloud": "azure", "PodName": "api-0"},
+		},
+	}
+	if !reflect.DeepEqual(res.Results, want) {
+		t.Errorf("got %+v, want %+v", res.Results, want)
+	}
+
+	// The next page skips the rows already returned in the same time window
+	if res.NextPage != "2023-03-09T00:00:00Z|2023-03-10T00:00:00Z|2" {
+		t.Fatalf("unexpected next page %q", res.NextPage)
+	}
+	q.Page = res.NextPage
+	if _, err := backend.Search(context.Background(), q); err == nil || !strings.Contains(err.Error(), "BadArgumentError: The request had some invalid properties") {
+		t.Errorf("expected the error of the API, got %v", err)
+	}
+	if !strings.Contains(requests[1]["query"], "extend _row = row_number()\n| where _row > 2\n| project-away _row\n| take 3") {
+		t.Errorf("unexpected query of the next page %s", requests[1]["query"])
+	}
+}
@@ -0,0 +1,80 @@
+package loki
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+// labelNameRegex matches the label names that can be used in a LogQL label filter
+var labelNameRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// addPipeline appends the stages of the query expression to the LogQL query.
+//
+// Just the terms that all have to match, i.e. the top level terms joined by AND,
+// are pushed down as line and label filters. The rest of the expression is
+// left to be matched against the results of the backend.
+func addPipeline(query string, expr logs.QueryExpr) string {
+	var terms []logs.QueryExpr
+	switch e := expr.(type) {
+	case logs.QueryAnd:
+		terms = e.Exprs
+	case logs.QueryTerm:
+		terms = []logs.QueryExpr{e}
+	}
+
+	var stages []string
+	for _, t := range terms {
+		term, ok := t.(logs.QueryTerm)
+		if !ok {
+			continue
+		}
+		if stage, ok := termStage(term); ok {
+			stages = append(stages, stage)
+		}
+	}
+
+	if len(stages) == 0 {
+		return query
+	}
+	return strings.TrimSpace(query) + " " + strings.Join(stages, " ")
+}
+
+// termStage returns the LogQL stage that filters the lines like the term,
+// or false if the term can't be expressed in LogQL
+func termStage(term logs.QueryTerm) (string, bool) {
+	field := term.GetField()
+	if field == logs.QueryFieldMessage {
+		switch term.Op {
+		case logs.QueryOpContains:
+			return "|~ " + strconv.Quote("(?i)"+regexp.QuoteMeta(term.Value)), true
+		case logs.QueryOpRegex:
+			return "|~ " + strconv.Quote(term.Value), true
+		}
+		return "", false
+	}
+
+	if field == logs.QueryFieldID || field == logs.QueryFieldTimestamp || !labelNameRegex.MatchString(field) {
+		return "", false
+	}
+
+	// The regular expressions of the label filters match the whole value
+	switch term.Op {
+	case logs.QueryOpEquals, logs.QueryOpNotEquals:
+		return "| " + field + string(term.Op) + strconv.Quote(term.Value), true
+	case logs.QueryOpContains:
+		return "| " + field + "=~" + strconv.Quote("(?i).*"+regexp.QuoteMeta(term.Value)+".*"), true
+	case logs.QueryOpRegex:
+		return "| " + field + "=~" + strconv.Quote(".*(?:"+term.Value+").*"), true
+	case logs.QueryOpGreater, logs.QueryOpGreaterEqual, logs.QueryOpLess, logs.QueryOpLessEqual:
+		// The label filters compare just numbers
+		if !term.IsNumeric() {
+			return "", false
+		}
+		return "| " + field + string(term.Op) + term.Value, true
+	}
+
+	return "", false
+}
@@ -0,0 +1,49 @@
+package loki
+
+import (
+	"testing"
+
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+func TestAddPipeline(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{
+			query: "",
+			want:  `{app="api"}`,
+		},
+		{
+			query: `"connection refused"`,
+			want:  `{app="api"} |~ "(?i)connection refused"`,
+		},
+		{
+			query: `level=error status>=500 pod:/^worker-/ /time(d)? out/`,
+			want:  `{app="api"} | level="error" | status>=500 | pod=~".*(?:^worker-).*" |~ "time(d)? out"`,
+		},
+		{
+			// The terms that can't be pushed down are left to the results
+			query: `path:"a.b" trace.id=abc status>=high`,
+			want:  `{app="api"} | path=~"(?i).*a\\.b.*"`,
+		},
+		{
+			query: `timeout OR level=error`,
+			want:  `{app="api"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			expr, err := logs.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("error parsing query: %v", err)
+			}
+
+			if got := addPipeline(`{app="api"}`, expr); got != tt.want {
+				t.Errorf("addPipeline() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
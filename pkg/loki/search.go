@@ -0,0 +1,277 @@
+package loki
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/flanksource/apm-hub/api/logs"
+	"github.com/flanksource/commons/collections"
+)
+
+// LokiBackend searches the logs with the query_range API of Grafana Loki
+type LokiBackend struct {
+	client   *http.Client
+	config   *logs.LokiBackendConfig
+	template *template.Template
+
+	username    string
+	password    string
+	bearerToken string
+}
+
+func NewLokiBackend(config *logs.LokiBackendConfig, username, password, bearerToken string) (*LokiBackend, error) {
+	if config.Address == "" {
+		return nil, fmt.Errorf("address is empty")
+	}
+
+	if config.Query == "" {
+		return nil, fmt.Errorf("query is empty")
+	}
+
+	template, err := template.New("query").Parse(config.Query)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing template: %w", err)
+	}
+
+	return &LokiBackend{
+		client:      http.DefaultClient,
+		config:      config,
+		template:    template,
+		username:    username,
+		password:    password,
+		bearerToken: bearerToken,
+	}, nil
+}
+
+func (t *LokiBackend) MatchRoute(q *logs.SearchParams) (route logs.SearchRoute, match bool) {
+	return t.config.CommonBackend.Routes.MatchRoute(q)
+}
+
+// Search runs the rendered LogQL query over the time window of the params.
+//
+// The page token is the timestamp, in unix nanoseconds, of the last line returned
+// and the number of lines returned at that timestamp, as several lines can share it.
+func (t *LokiBackend) Search(ctx context.Context, q *logs.SearchParams) (logs.SearchResults, error) {
+	var result logs.SearchResults
+	var buf bytes.Buffer
+
+	if err := t.template.Execute(&buf, q); err != nil {
+		return result, fmt.Errorf("error executing template: %w", err)
+	}
+
+	query, err := q.GetQuery()
+	if err != nil {
+		return result, fmt.Errorf("error parsing query: %w", err)
+	}
+
+	start, end := time.Time{}, time.Now()
+	if s := q.GetStart(); s != nil {
+		start = *s
+	}
+	if e := q.GetEnd(); e != nil {
+		end = *e
+	}
+
+	cursorTime, skip, err := parseCursor(q.Page)
+	if err != nil {
+		return result, err
+	}
+
+	direction := "backward"
+	if q.Order == logs.OrderAscending {
+		direction = "forward"
+		if q.Page != "" {
+			start = time.Unix(0, cursorTime)
+		}
+	} else if q.Page != "" {
+		// The end is exclusive
+		end = time.Unix(0, cursorTime+1)
+	}
+
+	// One more line than needed tells whether there are more lines
+	limit := int(q.Limit) + skip + 1
+
+	values := url.Values{}
+	values.Set("query", addPipeline(buf.String(), query))
+	values.Set("start", strconv.FormatInt(start.UnixNano(), 10))
+	values.Set("end", strconv.FormatInt(end.UnixNano(), 10))
+	values.Set("limit", strconv.Itoa(limit))
+	values.Set("direction", direction)
+
+	resp, err := t.queryRange(ctx, values)
+	if err != nil {
+		return result, err
+	}
+
+	entries, err := resp.entries(t.config.Labels)
+	if err != nil {
+		return result, err
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if q.Order == logs.OrderAscending {
+			return entries[i].ts < entries[j].ts
+		}
+		return entries[i].ts > entries[j].ts
+	})
+
+	hasMore := len(entries) >= limit
+	var lastCursor string
+	seen := 0
+	for _, e := range entries {
+		if e.ts == cursorTime && skip > 0 {
+			// The lines returned at the timestamp of the cursor on the previous page
+			skip--
+			seen++
+			continue
+		}
+
+		if len(result.Results) >= int(q.Limit) {
+			hasMore = true
+			break
+		}
+
+		if e.ts == cursorTime {
+			seen++
+		} else {
+			cursorTime, seen = e.ts, 1
+		}
+		lastCursor = fmt.Sprintf("%d:%d", cursorTime, seen)
+
+		r := logs.Result{
+			Time:    time.Unix(0, e.ts).UTC().Format(time.RFC3339Nano),
+			Message: e.line,
+			Labels:  e.labels,
+			Cursor:  lastCursor,
+		}
+		if query != nil && !query.Match(r) {
+			continue
+		}
+		result.Results = append(result.Results, r)
+	}
+
+	result.Total = len(result.Results)
+	if hasMore {
+		result.NextPage = lastCursor
+	}
+	return result, nil
+}
+
+func (t *LokiBackend) queryRange(ctx context.Context, values url.Values) (*response, error) {
+	endpoint := strings.TrimSuffix(t.config.Address, "/") + "/loki/api/v1/query_range?" + values.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.config.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", t.config.TenantID)
+	}
+	if t.bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+t.bearerToken)
+	} else if t.username != "" || t.password != "" {
+		req.SetBasicAuth(t.username, t.password)
+	}
+
+	res, err := t.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error querying loki: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		// Loki explains the errors in plain text
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return nil, fmt.Errorf("[loki] got response %d: %s", res.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var resp response
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("error parsing the response body: %w", err)
+	}
+
+	if resp.Data.ResultType != "streams" {
+		return nil, fmt.Errorf("[loki] expected the query to return log streams, got %s", resp.Data.ResultType)
+	}
+	return &resp, nil
+}
+
+// parseCursor parses the page token returned by a previous search
+func parseCursor(page string) (int64, int, error) {
+	if page == "" {
+		return 0, 0, nil
+	}
+
+	ts, count, _ := strings.Cut(page, ":")
+	cursorTime, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid page token %q: %w", page, err)
+	}
+
+	skip, err := strconv.Atoi(count)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid page token %q: %w", page, err)
+	}
+
+	return cursorTime, skip, nil
+}
+
+// response is the response of the query_range API for the log queries
+type response struct {
+	Data struct {
+		ResultType string   `json:"resultType"`
+		Result     []stream `json:"result"`
+	} `json:"data"`
+}
+
+type stream struct {
+	Stream map[string]string `json:"stream"`
+	// Values are the lines of the stream, each as a timestamp in unix nanoseconds and the line.
+	// The newer versions of Loki can add the structured metadata as a third element.
+	Values [][]json.RawMessage `json:"values"`
+}
+
+type entry struct {
+	ts     int64
+	line   string
+	labels map[string]string
+}
+
+// entries returns the lines of all the streams
+func (t response) entries(labelsToAttach map[string]string) ([]entry, error) {
+	var entries []entry
+	for _, s := range t.Data.Result {
+		labels := collections.MergeMap(collections.MergeMap(nil, labelsToAttach), s.Stream)
+		for _, v := range s.Values {
+			if len(v) < 2 {
+				return nil, fmt.Errorf("invalid stream value %s", v)
+			}
+
+			var ts, line string
+			if err := json.Unmarshal(v[0], &ts); err != nil {
+				return nil, fmt.Errorf("invalid timestamp %s: %w", v[0], err)
+			}
+			if err := json.Unmarshal(v[1], &line); err != nil {
+				return nil, fmt.Errorf("invalid line %s: %w", v[1], err)
+			}
+
+			nanos, err := strconv.ParseInt(ts, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid timestamp %q: %w", ts, err)
+			}
+
+			entries = append(entries, entry{ts: nanos, line: line, labels: labels})
+		}
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,159 @@
+package loki
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+// testLine is a line of the stand-in Loki
+type testLine struct {
+	stream string
+	ts     int64
+	line   string
+}
+
+var testLines = []testLine{
+	{stream: "api", ts: 1000, line: "GET /users"},
+	{stream: "api", ts: 2000, line: "GET /orders"},
+	{stream: "worker", ts: 2000, line: "job started"},
+	{stream: "worker", ts: 3000, line: "job done"},
+	{stream: "api", ts: 4000, line: "GET /health"},
+}
+
+// newTestServer serves the lines in the time window, up to the limit, like Loki does
+func newTestServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/loki/api/v1/query_range" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Header.Get("X-Scope-OrgID") != "team-a" || r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if query := r.URL.Query().Get("query"); query != `{namespace="default"}` {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("parse error: " + query))
+			return
+		}
+
+		start, _ := strconv.ParseInt(r.URL.Query().Get("start"), 10, 64)
+		end, _ := strconv.ParseInt(r.URL.Query().Get("end"), 10, 64)
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+		var lines []testLine
+		for _, l := range testLines {
+			if l.ts >= start && l.ts < end {
+				lines = append(lines, l)
+			}
+		}
+		sort.SliceStable(lines, func(i, j int) bool {
+			if r.URL.Query().Get("direction") == "forward" {
+				return lines[i].ts < lines[j].ts
+			}
+			return lines[i].ts > lines[j].ts
+		})
+		if len(lines) > limit {
+			lines = lines[:limit]
+		}
+
+		streams := map[string][][]string{}
+		for _, l := range lines {
+			streams[l.stream] = append(streams[l.stream], []string{strconv.FormatInt(l.ts, 10), l.line})
+		}
+
+		var result []map[string]any
+		for _, name := range []string{"api", "worker"} {
+			if values, ok := streams[name]; ok {
+				result = append(result, map[string]any{"stream": map[string]string{"app": name}, "values": values})
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"status": "success",
+			"data":   map[string]any{"resultType": "streams", "result": result},
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestBackend(t *testing.T) *LokiBackend {
+	config := &logs.LokiBackendConfig{
+		CommonBackend: logs.CommonBackend{Labels: map[string]string{"cluster": "prod"}},
+		Address:       newTestServer(t).URL,
+		Query:         `{namespace="{{index .Labels "namespace"}}"}`,
+		TenantID:      "team-a",
+	}
+
+	backend, err := NewLokiBackend(config, "", "", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return backend
+}
+
+func TestLokiBackend_Search(t *testing.T) {
+	backend := newTestBackend(t)
+
+	tests := []struct {
+		order string
+		want  []string
+	}{
+		{order: logs.OrderDescending, want: []string{"GET /health", "job done", "GET /orders", "job started", "GET /users"}},
+		{order: logs.OrderAscending, want: []string{"GET /users", "GET /orders", "job started", "job done", "GET /health"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.order, func(t *testing.T) {
+			q := &logs.SearchParams{
+				Labels: map[string]string{"namespace": "default"},
+				Start:  "1970-01-01T00:00:00Z",
+				Order:  tt.order,
+				Limit:  2,
+			}
+
+			// The lines at the same timestamp are split across the pages
+			var messages []string
+			for page := 0; page < 5; page++ {
+				res, err := backend.Search(context.Background(), q)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				for _, r := range res.Results {
+					if r.Labels["cluster"] != "prod" || r.Labels["app"] == "" {
+						t.Errorf("unexpected labels %v", r.Labels)
+					}
+					messages = append(messages, r.Message)
+				}
+
+				if res.NextPage == "" {
+					break
+				}
+				q.Page = res.NextPage
+			}
+
+			if !reflect.DeepEqual(messages, tt.want) {
+				t.Errorf("got %v, want %v", messages, tt.want)
+			}
+		})
+	}
+}
+
+func TestLokiBackend_SearchError(t *testing.T) {
+	backend := newTestBackend(t)
+
+	q := &logs.SearchParams{Labels: map[string]string{"namespace": "default"}, Query: "error", Limit: 10}
+	q.SetDefaults()
+	if _, err := backend.Search(context.Background(), q); err == nil {
+		t.Errorf("expected the error of the stand-in server")
+	}
+}
@@ -0,0 +1,98 @@
+package pkg
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/flanksource/apm-hub/api"
+	"github.com/flanksource/apm-hub/api/logs"
+	"github.com/flanksource/commons/logger"
+	"github.com/flanksource/commons/timer"
+	"github.com/labstack/echo/v4"
+)
+
+// QueryMetrics evaluates the query on the metrics backends and collates their series
+func QueryMetrics(c echo.Context) error {
+	cc := c.(*api.Context)
+	metricsParams := new(api.MetricsParams)
+	if err := c.Bind(metricsParams); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	metricsParams.SetDefaults()
+
+	if err := metricsParams.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	ctx := c.Request().Context()
+	if SearchTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, SearchTimeout)
+		defer cancel()
+	}
+
+	timer := timer.NewTimer()
+	results := queryMetricsBackends(ctx, api.GlobalMetricsBackends, metricsParams)
+	logger.Infof("[%s] => %d series in %s", metricsParams, len(results.Results), timer)
+
+	return cc.JSON(http.StatusOK, *results)
+}
+
+// queryMetricsBackends concurrently queries the metrics backends selected by their routes.
+// The backends are selected the same way as in the log searches.
+func queryMetricsBackends(ctx context.Context, backends []api.MetricsBackend, metricsParams *api.MetricsParams) *api.MetricsResults {
+	// Resolve the time window once so that all the backends query the same window.
+	metricsParams.GetStart()
+	metricsParams.GetEnd()
+
+	names := make([]string, len(backends))
+	for i, backend := range backends {
+		names[i] = backend.Name
+	}
+	matchedBackends := selectRoutes(names, func(i int) (logs.SearchRoute, bool) { return backends[i].API.MatchRoute(metricsParams) })
+
+	queryResults := make([]api.MetricsResults, len(matchedBackends))
+	queryErrors := make([]error, len(matchedBackends))
+	durations := make([]time.Duration, len(matchedBackends))
+
+	var wg sync.WaitGroup
+	for j, i := range matchedBackends {
+		wg.Add(1)
+		go func(j int, backend api.MetricsBackend) {
+			defer wg.Done()
+			start := time.Now()
+
+			ctx, cancel := withBackendTimeout(ctx, backend.Timeout)
+			defer cancel()
+			queryResults[j], queryErrors[j] = backend.API.Query(ctx, metricsParams.Clone())
+			durations[j] = time.Since(start)
+		}(j, backends[i])
+	}
+	wg.Wait()
+
+	results := &api.MetricsResults{}
+	for j, i := range matchedBackends {
+		backendResult := logs.BackendResult{
+			Name:       backends[i].Name,
+			Type:       backends[i].Type,
+			Status:     logs.BackendStatusSuccess,
+			DurationMs: durations[j].Milliseconds(),
+		}
+
+		if err := queryErrors[j]; err != nil {
+			backendResult.Status = logs.GetBackendStatus(err)
+			backendResult.Error = err.Error()
+			results.Partial = true
+			logger.Errorf("error querying metrics backend %s: %v", backends[i].Name, err)
+		} else {
+			backendResult.Count = len(queryResults[j].Results)
+			results.Results = append(results.Results, queryResults[j].Results...)
+		}
+
+		results.Backends = append(results.Backends, backendResult)
+	}
+
+	return results
+}
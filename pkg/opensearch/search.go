@@ -9,6 +9,7 @@ import (
 
 	"github.com/flanksource/apm-hub/api/logs"
 	"github.com/flanksource/apm-hub/external/elasticsearch"
+	"github.com/flanksource/apm-hub/pkg/resultcache"
 	"github.com/flanksource/commons/logger"
 	opensearch "github.com/opensearch-project/opensearch-go/v2"
 )
@@ -19,6 +20,7 @@ type OpenSearchBackend struct {
 	template *template.Template
 	index    string
 	config   *logs.OpenSearchBackendConfig
+	cache    *resultcache.Cache
 }
 
 func NewOpenSearchBackend(client *opensearch.Client, config *logs.OpenSearchBackendConfig) (*OpenSearchBackend, error) {
@@ -41,26 +43,97 @@ func NewOpenSearchBackend(client *opensearch.Client, config *logs.OpenSearchBack
 		config:   config,
 		index:    config.Index,
 		template: template,
+		cache:    resultcache.New("opensearch", config, config.Cache),
 	}, nil
 }
 
-func (t *OpenSearchBackend) MatchRoute(q *logs.SearchParams) (match bool, isAdditive bool) {
+func (t *OpenSearchBackend) MatchRoute(q *logs.SearchParams) (route logs.SearchRoute, match bool) {
 	return t.config.CommonBackend.Routes.MatchRoute(q)
 }
 
-func (t *OpenSearchBackend) Search(q *logs.SearchParams) (logs.SearchResults, error) {
-	var result logs.SearchResults
-	var buf bytes.Buffer
+func (t *OpenSearchBackend) Search(ctx context.Context, q *logs.SearchParams) (logs.SearchResults, error) {
+	body, err := t.request(q, nil)
+	if err != nil {
+		return logs.SearchResults{}, err
+	}
+
+	rendered := elasticsearch.CacheRequest{Index: t.index, Size: q.Limit + 1, Body: body}
+	return t.cache.Search(ctx, q, rendered, func() (logs.SearchResults, error) {
+		return t.do(ctx, q, body)
+	})
+}
+
+// Tail polls for the hits after the newest one sent so far
+func (t *OpenSearchBackend) Tail(ctx context.Context, q *logs.SearchParams, lines chan<- logs.Result) error {
+	params := q.Clone()
+	params.Page = ""
 
+	var searchAfter string
+	return logs.Poll(ctx, logs.TailPollInterval, func(ctx context.Context) error {
+		for {
+			result, err := t.search(ctx, params, &searchAfter)
+			if err != nil {
+				return err
+			}
+
+			for _, r := range result.Results {
+				if err := logs.SendResult(ctx, lines, r); err != nil {
+					return err
+				}
+				searchAfter = r.Cursor
+			}
+
+			if result.NextPage == "" {
+				return nil
+			}
+		}
+	})
+}
+
+// search searches the index with the rendered query.
+// When searchAfter is given, the hits after it are searched oldest first.
+func (t *OpenSearchBackend) search(ctx context.Context, q *logs.SearchParams, searchAfter *string) (logs.SearchResults, error) {
+	body, err := t.request(q, searchAfter)
+	if err != nil {
+		return logs.SearchResults{}, err
+	}
+	return t.do(ctx, q, body)
+}
+
+// request returns the body of the search request with the rendered query
+func (t *OpenSearchBackend) request(q *logs.SearchParams, searchAfter *string) ([]byte, error) {
+	var buf bytes.Buffer
 	if err := t.template.Execute(&buf, q); err != nil {
-		return result, fmt.Errorf("error executing template: %w", err)
+		return nil, fmt.Errorf("error executing template: %w", err)
 	}
-	logger.Debugf("Query: %s", buf.String())
+
+	query, err := q.GetQuery()
+	if err != nil {
+		return nil, fmt.Errorf("error parsing query: %w", err)
+	}
+
+	body, err := elasticsearch.AddQueryFilter(buf.Bytes(), query, t.fields)
+	if err != nil {
+		return nil, err
+	}
+
+	if searchAfter != nil {
+		if body, err = elasticsearch.TailRequest(body, t.fields, *searchAfter); err != nil {
+			return nil, err
+		}
+	}
+	return body, nil
+}
+
+// do sends the search request
+func (t *OpenSearchBackend) do(ctx context.Context, q *logs.SearchParams, body []byte) (logs.SearchResults, error) {
+	var result logs.SearchResults
+	logger.Debugf("Query: %s", body)
 
 	res, err := t.client.Search(
-		t.client.Search.WithContext(context.Background()),
+		t.client.Search.WithContext(ctx),
 		t.client.Search.WithIndex(t.index),
-		t.client.Search.WithBody(&buf),
+		t.client.Search.WithBody(bytes.NewReader(body)),
 		t.client.Search.WithSize(int(q.Limit+1)),
 		t.client.Search.WithErrorTrace(),
 	)
@@ -0,0 +1,155 @@
+package prometheus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flanksource/apm-hub/api"
+	"github.com/flanksource/apm-hub/api/logs"
+	"github.com/flanksource/commons/collections"
+)
+
+// PrometheusBackend queries the metrics with the HTTP API of Prometheus,
+// which is also served by Thanos, Mimir, VictoriaMetrics, etc.
+type PrometheusBackend struct {
+	client   *http.Client
+	config   *logs.PrometheusBackendConfig
+	username string
+	password string
+}
+
+func NewPrometheusBackend(config *logs.PrometheusBackendConfig, username, password string) (*PrometheusBackend, error) {
+	if config.Address == "" {
+		return nil, fmt.Errorf("address is empty")
+	}
+
+	return &PrometheusBackend{
+		client:   http.DefaultClient,
+		config:   config,
+		username: username,
+		password: password,
+	}, nil
+}
+
+func (t *PrometheusBackend) MatchRoute(q *api.MetricsParams) (route logs.SearchRoute, match bool) {
+	return q.MatchRoute(t.config.CommonBackend.Routes)
+}
+
+// Query evaluates the query as a range query over the time window of the params
+func (t *PrometheusBackend) Query(ctx context.Context, q *api.MetricsParams) (api.MetricsResults, error) {
+	var result api.MetricsResults
+
+	step, err := q.GetStep()
+	if err != nil {
+		return result, err
+	}
+
+	form := url.Values{}
+	form.Set("query", q.Query)
+	form.Set("step", strconv.FormatFloat(step.Seconds(), 'f', -1, 64))
+	if start := q.GetStart(); start != nil {
+		form.Set("start", start.Format(time.RFC3339Nano))
+	}
+	if end := q.GetEnd(); end != nil {
+		form.Set("end", end.Format(time.RFC3339Nano))
+	}
+
+	// The query is posted, rather than sent in the URL, as long queries could exceed the URL limits
+	endpoint := strings.TrimSuffix(t.config.Address, "/") + "/api/v1/query_range"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return result, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if t.username != "" || t.password != "" {
+		req.SetBasicAuth(t.username, t.password)
+	}
+
+	res, err := t.client.Do(req)
+	if err != nil {
+		return result, fmt.Errorf("error querying prometheus: %w", err)
+	}
+	defer res.Body.Close()
+
+	var resp response
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		if res.StatusCode != http.StatusOK {
+			return result, fmt.Errorf("[prometheus] got response: %d", res.StatusCode)
+		}
+		return result, fmt.Errorf("error parsing the response body: %w", err)
+	}
+
+	if resp.Status != "success" {
+		return result, fmt.Errorf("[prometheus] %s: %s", resp.ErrorType, resp.Error)
+	}
+
+	for _, s := range resp.Data.Result {
+		series, err := s.toSeries(t.config.Labels)
+		if err != nil {
+			return result, err
+		}
+		result.Results = append(result.Results, series)
+	}
+
+	return result, nil
+}
+
+// response is the response of the Prometheus HTTP API
+type response struct {
+	Status    string `json:"status"`
+	ErrorType string `json:"errorType"`
+	Error     string `json:"error"`
+	Data      struct {
+		ResultType string   `json:"resultType"`
+		Result     []matrix `json:"result"`
+	} `json:"data"`
+}
+
+type matrix struct {
+	Metric map[string]string `json:"metric"`
+	// Values are pairs of a unix timestamp in seconds and a value as a string
+	Values [][2]any `json:"values"`
+}
+
+func (t matrix) toSeries(labelsToAttach map[string]string) (api.Series, error) {
+	series := api.Series{
+		Labels:  collections.MergeMap(collections.MergeMap(nil, labelsToAttach), t.Metric),
+		Samples: make([]api.Sample, 0, len(t.Values)),
+	}
+
+	for _, v := range t.Values {
+		ts, ok := v[0].(float64)
+		if !ok {
+			return series, fmt.Errorf("invalid sample timestamp %v", v[0])
+		}
+
+		raw, ok := v[1].(string)
+		if !ok {
+			return series, fmt.Errorf("invalid sample value %v", v[1])
+		}
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return series, fmt.Errorf("invalid sample value %q: %w", raw, err)
+		}
+
+		// NaN and infinite values can't be represented in JSON
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			continue
+		}
+
+		sec, frac := math.Modf(ts)
+		series.Samples = append(series.Samples, api.Sample{
+			Time:  time.Unix(int64(sec), int64(math.Round(frac*1e3))*int64(time.Millisecond)).UTC().Format(time.RFC3339Nano),
+			Value: value,
+		})
+	}
+
+	return series, nil
+}
@@ -0,0 +1,91 @@
+package prometheus
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/flanksource/apm-hub/api"
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+const queryRangeBody = `{
+	"status": "success",
+	"data": {
+		"resultType": "matrix",
+		"result": [
+			{"metric": {"__name__": "up", "job": "api"}, "values": [[1678364951, "1"], [1678364966.5, "0"], [1678364981, "NaN"]]}
+		]
+	}
+}`
+
+func newTestServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/query_range" || r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if user, pass, ok := r.BasicAuth(); !ok || user != "admin" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if r.FormValue("query") != "up" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"status": "error", "errorType": "bad_data", "error": "parse error"}`))
+			return
+		}
+
+		if r.FormValue("step") != "15" || r.FormValue("start") == "" || r.FormValue("end") == "" {
+			t.Errorf("unexpected form %v", r.Form)
+		}
+		w.Write([]byte(queryRangeBody))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestPrometheusBackend_Query(t *testing.T) {
+	server := newTestServer(t)
+	config := &logs.PrometheusBackendConfig{
+		CommonBackend: logs.CommonBackend{Labels: map[string]string{"cluster": "prod", "job": "ignored"}},
+		Address:       server.URL,
+	}
+	backend, err := NewPrometheusBackend(config, "admin", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := backend.Query(context.Background(), &api.MetricsParams{Query: "up", Start: "1h", Step: "15s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Results) != 1 {
+		t.Fatalf("expected a single series, got %+v", res.Results)
+	}
+
+	series := res.Results[0]
+	if series.Labels["job"] != "api" || series.Labels["cluster"] != "prod" {
+		t.Errorf("unexpected labels %v", series.Labels)
+	}
+
+	want := []api.Sample{
+		{Time: "2023-03-09T12:29:11Z", Value: 1},
+		{Time: "2023-03-09T12:29:26.5Z", Value: 0},
+	}
+	if len(series.Samples) != len(want) {
+		t.Fatalf("got samples %+v, want %+v", series.Samples, want)
+	}
+	for i := range want {
+		if series.Samples[i] != want[i] {
+			t.Errorf("got sample %+v, want %+v", series.Samples[i], want[i])
+		}
+	}
+
+	if _, err := backend.Query(context.Background(), &api.MetricsParams{Query: "up{", Start: "1h", Step: "15s"}); err == nil {
+		t.Errorf("expected the error of the invalid query")
+	}
+}
@@ -0,0 +1,184 @@
+// Package resultcache caches the results of the searches of the backends whose queries are slow or cost money,
+// so dashboards refreshing the same search don't send it again.
+package resultcache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/flanksource/apm-hub/api/logs"
+	"github.com/flanksource/commons/logger"
+)
+
+var (
+	// MaxEntries is the number of search results kept in memory
+	MaxEntries = 1000
+	// UsePostgres shares the search results between the instances of the server through the database
+	UsePostgres = false
+
+	// DefaultStore holds the results of the backends with a cache, set up by Init.
+	// The searches aren't cached until it is.
+	DefaultStore Store
+)
+
+// Init sets the default store up from the flags, once they're parsed.
+// The Postgres store needs the table of the db migrations.
+func Init() {
+	var store Store = NewLRU(MaxEntries)
+	if UsePostgres {
+		store = Tiered{store, &Postgres{}}
+	}
+	DefaultStore = store
+}
+
+// Cache caches the results of the searches of a backend.
+// A nil cache sends all the searches.
+type Cache struct {
+	// identity tells the backend and its config apart from the others
+	identity string
+	config   *logs.ResultCacheConfig
+	// store defaults to the DefaultStore
+	store Store
+}
+
+// New returns the cache of the backend of the given type and config, nil if the cache isn't enabled
+func New(backendType string, backendConfig any, config *logs.ResultCacheConfig) *Cache {
+	if config == nil {
+		return nil
+	}
+
+	// The backends configured the same way return the same results, so they share their cache
+	data, err := json.Marshal(backendConfig)
+	if err != nil {
+		logger.Warnf("error encoding the config of the %s backend, its results aren't cached: %v", backendType, err)
+		return nil
+	}
+	hash := sha256.Sum256(data)
+
+	return &Cache{
+		identity: backendType + ":" + hex.EncodeToString(hash[:]),
+		config:   config,
+	}
+}
+
+func (c *Cache) getStore() Store {
+	if c.store != nil {
+		return c.store
+	}
+	return DefaultStore
+}
+
+// Key returns the key of a search of the backend.
+// The request rendered for a time window between two timestamps is the same for every search, so it's the key.
+// The one rendered for a relative window, e.g. of the last hour, holds the time of the search,
+// so the search params, with the window as given, are the key instead.
+func (c *Cache) Key(q *logs.SearchParams, rendered any) (string, error) {
+	key := struct {
+		Backend  string
+		Request  any                `json:",omitempty"`
+		Params   *logs.SearchParams `json:",omitempty"`
+		Relative bool
+	}{Backend: c.identity, Relative: q.IsRelative()}
+
+	if key.Relative {
+		params := q.Clone()
+		params.NoCache = false
+		key.Params = params
+	} else {
+		key.Request = rendered
+	}
+
+	data, err := json.Marshal(key)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// Search returns the cached results of the search with the rendered request, else it searches and caches the results.
+// The search params can bypass the cache, in which case the results are still cached.
+func (c *Cache) Search(ctx context.Context, q *logs.SearchParams, rendered any, search func() (logs.SearchResults, error)) (logs.SearchResults, error) {
+	if c == nil {
+		return search()
+	}
+
+	key, err := c.Key(q, rendered)
+	if err != nil {
+		logger.Warnf("error computing the cache key of the search: %v", err)
+		return search()
+	}
+
+	store := c.getStore()
+	if store == nil {
+		return search()
+	}
+	if !q.NoCache {
+		if results, ok := c.get(ctx, store, key); ok {
+			logger.Debugf("[%s] cached results", q)
+			return results, nil
+		}
+	}
+
+	results, err := search()
+	if err != nil {
+		return results, err
+	}
+
+	if err := c.set(ctx, store, key, q, results); err != nil {
+		logger.Warnf("error caching the search results: %v", err)
+	}
+	return results, nil
+}
+
+// get returns the cached results of the key, if any.
+// The store failing is a cache miss.
+func (c *Cache) get(ctx context.Context, store Store, key string) (logs.SearchResults, bool) {
+	var results logs.SearchResults
+	entry, err := store.Get(ctx, key)
+	if err != nil {
+		logger.Warnf("error getting the cached search results: %v", err)
+		return results, false
+	}
+	if entry == nil {
+		return results, false
+	}
+
+	var cached cachedResults
+	if err := json.Unmarshal(entry.Results, &cached); err != nil || len(cached.Cursors) != len(cached.Results) {
+		logger.Warnf("error decoding the cached search results: %v", err)
+		return results, false
+	}
+
+	results = cached.SearchResults
+	for i := range results.Results {
+		results.Results[i].Cursor = cached.Cursors[i]
+	}
+	return results, true
+}
+
+// cachedResults is the encoding of the cached search results,
+// with the cursors the results leave out of the responses of the API
+type cachedResults struct {
+	logs.SearchResults
+	Cursors []string `json:"cursors"`
+}
+
+// set caches the results of the search for the TTL of its time window
+func (c *Cache) set(ctx context.Context, store Store, key string, q *logs.SearchParams, results logs.SearchResults) error {
+	cached := cachedResults{SearchResults: results, Cursors: make([]string, len(results.Results))}
+	for i, result := range results.Results {
+		cached.Cursors[i] = result.Cursor
+	}
+
+	data, err := json.Marshal(cached)
+	if err != nil {
+		return fmt.Errorf("error encoding the search results: %w", err)
+	}
+
+	return store.Set(ctx, key, Entry{Results: data, ExpiresAt: time.Now().Add(c.config.GetTTL(q.IsRelative()))})
+}
@@ -0,0 +1,174 @@
+package resultcache
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+func TestCacheSearch(t *testing.T) {
+	cache := New("cloudwatch", logs.CloudWatchBackendConfig{LogGroup: "api"}, &logs.ResultCacheConfig{})
+	cache.store = NewLRU(10)
+
+	var searches int
+	search := func() (logs.SearchResults, error) {
+		searches++
+		return logs.SearchResults{
+			Total:    2,
+			Results:  []logs.Result{{Message: "first", Cursor: "1"}, {Message: "second", Cursor: "2"}},
+			NextPage: "2",
+		}, nil
+	}
+
+	absolute := &logs.SearchParams{Start: "2023-03-09T12:00:00Z", End: "2023-03-09T13:00:00Z"}
+	for i := 0; i < 2; i++ {
+		results, err := cache.Search(context.Background(), absolute, "query", search)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if results.Results[1].Cursor != "2" || results.NextPage != "2" {
+			t.Errorf("expected the cursors and the next page to be cached, got %+v", results)
+		}
+	}
+	if searches != 1 {
+		t.Errorf("expected 1 search, got %d", searches)
+	}
+
+	// Another rendered request is another search
+	if _, err := cache.Search(context.Background(), absolute, "another query", search); err != nil {
+		t.Fatal(err)
+	}
+	if searches != 2 {
+		t.Errorf("expected 2 searches, got %d", searches)
+	}
+
+	// Bypassing the cache searches again and caches the results
+	bypass := absolute.Clone()
+	bypass.NoCache = true
+	if _, err := cache.Search(context.Background(), bypass, "query", search); err != nil {
+		t.Fatal(err)
+	}
+	if searches != 3 {
+		t.Errorf("expected 3 searches, got %d", searches)
+	}
+
+	// The request rendered for a relative window holds the time of the search, so it's left out of the key
+	relative := &logs.SearchParams{Start: "1h"}
+	for _, rendered := range []string{"query at 12:00", "query at 12:01"} {
+		if _, err := cache.Search(context.Background(), relative, rendered, search); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if searches != 4 {
+		t.Errorf("expected 4 searches, got %d", searches)
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	cache := New("elasticsearch", logs.ElasticSearchBackendConfig{Index: "logs"}, &logs.ResultCacheConfig{TTL: "2h", RelativeTTL: "10s"})
+	store := NewLRU(10)
+	cache.store = store
+
+	search := func() (logs.SearchResults, error) { return logs.SearchResults{}, nil }
+	tests := []struct {
+		q   *logs.SearchParams
+		ttl time.Duration
+	}{
+		{q: &logs.SearchParams{Start: "2023-03-09T12:00:00Z", End: "2023-03-09T13:00:00Z"}, ttl: 2 * time.Hour},
+		{q: &logs.SearchParams{Start: "2023-03-09T12:00:00Z"}, ttl: 10 * time.Second},
+		{q: &logs.SearchParams{Start: "2h", End: "1h"}, ttl: 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if _, err := cache.Search(context.Background(), tt.q, "query", search); err != nil {
+			t.Fatal(err)
+		}
+
+		key, _ := cache.Key(tt.q, "query")
+		entry, _ := store.Get(context.Background(), key)
+		if entry == nil {
+			t.Fatalf("[%s] expected the results to be cached", tt.q)
+		}
+		if ttl := time.Until(entry.ExpiresAt); ttl > tt.ttl || ttl < tt.ttl-time.Minute {
+			t.Errorf("[%s] expected a ttl of %s, got %s", tt.q, tt.ttl, ttl)
+		}
+	}
+}
+
+func TestLRU(t *testing.T) {
+	ctx := context.Background()
+	lru := NewLRU(2)
+	expiresAt := time.Now().Add(time.Hour)
+
+	_ = lru.Set(ctx, "a", Entry{Results: []byte("a"), ExpiresAt: expiresAt})
+	_ = lru.Set(ctx, "b", Entry{Results: []byte("b"), ExpiresAt: expiresAt})
+	// a is used more recently than b, which is evicted
+	if entry, _ := lru.Get(ctx, "a"); entry == nil {
+		t.Fatal("expected a to be cached")
+	}
+	_ = lru.Set(ctx, "c", Entry{Results: []byte("c"), ExpiresAt: expiresAt})
+	if entry, _ := lru.Get(ctx, "b"); entry != nil {
+		t.Error("expected b to be evicted")
+	}
+
+	_ = lru.Set(ctx, "d", Entry{Results: []byte("d"), ExpiresAt: time.Now().Add(-time.Second)})
+	if entry, _ := lru.Get(ctx, "d"); entry != nil {
+		t.Error("expected d to have expired")
+	}
+}
+
+func TestTiered(t *testing.T) {
+	ctx := context.Background()
+	memory, shared := NewLRU(10), NewLRU(10)
+	tiered := Tiered{memory, shared}
+
+	entry := Entry{Results: []byte("results"), ExpiresAt: time.Now().Add(time.Hour)}
+	_ = shared.Set(ctx, "key", entry)
+
+	got, err := tiered.Get(ctx, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || !reflect.DeepEqual(*got, entry) {
+		t.Fatalf("expected %v, got %v", entry, got)
+	}
+	if got, _ := memory.Get(ctx, "key"); got == nil {
+		t.Error("expected the entry of the shared store to be copied in memory")
+	}
+}
+
+func TestInit(t *testing.T) {
+	defer func(store Store, maxEntries int) { DefaultStore, MaxEntries = store, maxEntries }(DefaultStore, MaxEntries)
+	DefaultStore = nil
+
+	cache := New("cloudwatch", logs.CloudWatchBackendConfig{LogGroup: "api"}, &logs.ResultCacheConfig{})
+	q := &logs.SearchParams{Start: "2023-03-09T12:00:00Z", End: "2023-03-09T13:00:00Z"}
+	var searches int
+	search := func() (logs.SearchResults, error) {
+		searches++
+		return logs.SearchResults{Results: []logs.Result{{Message: "first"}}}, nil
+	}
+
+	// The searches aren't cached until the store is set up from the flags
+	for i := 0; i < 2; i++ {
+		if _, err := cache.Search(context.Background(), q, "query", search); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if searches != 2 {
+		t.Errorf("expected 2 searches, got %d", searches)
+	}
+
+	MaxEntries = 1
+	Init()
+	for _, rendered := range []string{"query", "other", "query"} {
+		if _, err := cache.Search(context.Background(), q, rendered, search); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if searches != 5 {
+		t.Errorf("expected the store to hold a single entry, got %d searches", searches)
+	}
+}
@@ -0,0 +1,157 @@
+package resultcache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/flanksource/apm-hub/db"
+	"github.com/flanksource/commons/logger"
+)
+
+// Entry is the encoded results of a search along with when they expire
+type Entry struct {
+	Results   []byte
+	ExpiresAt time.Time
+}
+
+// Store holds the results of the searches by their key
+type Store interface {
+	// Get returns the entry of the key, nil if it isn't held or has expired
+	Get(ctx context.Context, key string) (*Entry, error)
+	Set(ctx context.Context, key string, entry Entry) error
+}
+
+// LRU holds the entries in memory, evicting the least recently used ones once full
+type LRU struct {
+	maxEntries int
+
+	lock    sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+type lruEntry struct {
+	key   string
+	entry Entry
+}
+
+func NewLRU(maxEntries int) *LRU {
+	return &LRU{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+func (t *LRU) Get(ctx context.Context, key string) (*Entry, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	element, ok := t.entries[key]
+	if !ok {
+		return nil, nil
+	}
+
+	cached := element.Value.(*lruEntry)
+	if !time.Now().Before(cached.entry.ExpiresAt) {
+		t.lru.Remove(element)
+		delete(t.entries, key)
+		return nil, nil
+	}
+
+	t.lru.MoveToFront(element)
+	entry := cached.entry
+	return &entry, nil
+}
+
+func (t *LRU) Set(ctx context.Context, key string, entry Entry) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if element, ok := t.entries[key]; ok {
+		element.Value.(*lruEntry).entry = entry
+		t.lru.MoveToFront(element)
+		return nil
+	}
+
+	t.entries[key] = t.lru.PushFront(&lruEntry{key: key, entry: entry})
+	for t.lru.Len() > t.maxEntries {
+		oldest := t.lru.Back()
+		t.lru.Remove(oldest)
+		delete(t.entries, oldest.Value.(*lruEntry).key)
+	}
+	return nil
+}
+
+// Postgres holds the entries in the database, shared by the instances of the server
+type Postgres struct {
+	lock sync.Mutex
+	// lastCleanup is when the expired entries were last deleted
+	lastCleanup time.Time
+}
+
+// cleanupInterval is how often the expired entries are deleted from the database
+const cleanupInterval = time.Minute
+
+func (t *Postgres) Get(ctx context.Context, key string) (*Entry, error) {
+	result, err := db.GetSearchResult(ctx, key)
+	if err != nil || result == nil {
+		return nil, err
+	}
+	return &Entry{Results: result.Results, ExpiresAt: result.ExpiresAt}, nil
+}
+
+func (t *Postgres) Set(ctx context.Context, key string, entry Entry) error {
+	if err := db.PersistSearchResult(ctx, db.SearchResult{Key: key, Results: entry.Results, ExpiresAt: entry.ExpiresAt}); err != nil {
+		return err
+	}
+
+	t.lock.Lock()
+	cleanup := time.Since(t.lastCleanup) > cleanupInterval
+	if cleanup {
+		t.lastCleanup = time.Now()
+	}
+	t.lock.Unlock()
+
+	if cleanup {
+		if err := db.DeleteExpiredSearchResults(ctx); err != nil {
+			logger.Warnf("error deleting the expired search results: %v", err)
+		}
+	}
+	return nil
+}
+
+// Tiered looks the entries up in each store in turn, e.g. in memory then in the database.
+// The entries found in a store are copied to the stores before it, and the entries set are set in all of them.
+type Tiered []Store
+
+func (t Tiered) Get(ctx context.Context, key string) (*Entry, error) {
+	for i, store := range t {
+		entry, err := store.Get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			continue
+		}
+
+		for _, previous := range t[:i] {
+			if err := previous.Set(ctx, key, *entry); err != nil {
+				logger.Warnf("error caching the search results: %v", err)
+			}
+		}
+		return entry, nil
+	}
+	return nil, nil
+}
+
+func (t Tiered) Set(ctx context.Context, key string, entry Entry) error {
+	for _, store := range t {
+		if err := store.Set(ctx, key, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
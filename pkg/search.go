@@ -1,7 +1,13 @@
 package pkg
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/flanksource/commons/logger"
 	"github.com/flanksource/commons/timer"
@@ -11,6 +17,15 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
+var (
+	// SearchTimeout is the overall deadline of a search request across all backends.
+	SearchTimeout = time.Minute
+
+	// BackendTimeout is the default deadline of a search on a single backend.
+	// It can be overridden per backend with the timeout field in the config.
+	BackendTimeout = 30 * time.Second
+)
+
 // Search and collate logs
 func Search(c echo.Context) error {
 	cc := c.(*api.Context)
@@ -21,33 +36,268 @@ func Search(c echo.Context) error {
 	}
 	searchParams.SetDefaults()
 
+	ctx := c.Request().Context()
+	if SearchTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, SearchTimeout)
+		defer cancel()
+	}
+
+	pageTokens, err := logs.ParsePageTokens(searchParams.Page)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if _, err := searchParams.GetQuery(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid query: %v", err))
+	}
+
 	timer := timer.NewTimer()
+	results := searchBackends(ctx, logs.GlobalBackends, searchParams, pageTokens)
+	logger.Infof("[%s] => %d results in %s", searchParams, results.Total, timer)
+
+	return cc.JSON(http.StatusOK, *results)
+}
+
+// searchBackends concurrently queries the backends selected by their routes
+// and merges their results by timestamp.
+//
+// When page tokens from a previous search are given, each backend resumes from its own position
+// and the backends that had no more results are skipped.
+func searchBackends(ctx context.Context, backends []logs.SearchBackend, searchParams *logs.SearchParams, pageTokens logs.PageTokens) *logs.SearchResults {
+	return searchSelectedBackends(ctx, backends, selectBackends(backends, searchParams), searchParams, pageTokens)
+}
+
+// searchSelectedBackends concurrently queries the backends with the given indices
+// and merges their results by timestamp.
+func searchSelectedBackends(ctx context.Context, backends []logs.SearchBackend, selected []int, searchParams *logs.SearchParams, pageTokens logs.PageTokens) *logs.SearchResults {
+	// Resolve the time window once so that all the backends search the same window.
+	searchParams.GetStart()
+	searchParams.GetEnd()
+
+	var matchedBackends []int
+	for _, i := range selected {
+		// Backends that had no more results on the previous page are skipped
+		if _, ok := pageTokens[backends[i].Name]; pageTokens != nil && !ok {
+			logger.Debugf("backend %s has no more results", backends[i].Name)
+			continue
+		}
+
+		matchedBackends = append(matchedBackends, i)
+	}
+
+	backendParams := make([]*logs.SearchParams, len(matchedBackends))
+	skips := make([]int, len(matchedBackends))
+	searchResults := make([]logs.SearchResults, len(matchedBackends))
+	searchErrors := make([]error, len(matchedBackends))
+	durations := make([]time.Duration, len(matchedBackends))
+
+	var wg sync.WaitGroup
+	for j, i := range matchedBackends {
+		backendParams[j] = searchParams.Clone()
+		backendParams[j].Page, skips[j] = parseSkipToken(pageTokens[backends[i].Name])
+
+		wg.Add(1)
+		go func(j int, backend logs.SearchBackend) {
+			defer wg.Done()
+			start := time.Now()
+			searchResults[j], searchErrors[j] = searchBackend(ctx, backend, backendParams[j])
+			durations[j] = time.Since(start)
+
+			// The results returned on the previous page are left out,
+			// counted in the order they're merged in rather than the one the backend returned them in
+			if skip := skips[j]; skip > 0 && searchErrors[j] == nil {
+				logs.SortResults(searchResults[j].Results, searchParams.Order)
+				if skip > len(searchResults[j].Results) {
+					skip = len(searchResults[j].Results)
+				}
+				searchResults[j].Results = searchResults[j].Results[skip:]
+			}
+		}(j, backends[i])
+	}
+	wg.Wait()
+
 	results := &logs.SearchResults{}
-	for i, backend := range logs.GlobalBackends {
-		matched, isAdditive := backend.API.MatchRoute(searchParams)
+	lists := make([][]logs.Result, len(matchedBackends))
+	for j, i := range matchedBackends {
+		backendResult := logs.BackendResult{
+			Name:       backends[i].Name,
+			Type:       backends[i].Type,
+			Status:     logs.BackendStatusSuccess,
+			DurationMs: durations[j].Milliseconds(),
+		}
+
+		if err := searchErrors[j]; err != nil {
+			backendResult.Status = logs.GetBackendStatus(err)
+			backendResult.Error = err.Error()
+			results.Partial = true
+			logger.Errorf("error searching backend %s: %v", backends[i].Name, err)
+		} else {
+			if searchResults[j].Partial {
+				backendResult.Status = logs.BackendStatusPartial
+				backendResult.Error = partialError(searchResults[j].Backends)
+				results.Partial = true
+				logger.Errorf("error searching backend %s: %s", backends[i].Name, backendResult.Error)
+			}
+
+			lists[j] = searchResults[j].Results
+			logs.LinkTraces(lists[j], backends[i].TraceFields, backends[i].SpanFields)
+			results.Total += searchResults[j].Total
+		}
+
+		results.Backends = append(results.Backends, backendResult)
+	}
+
+	var consumed []int
+	results.Results, consumed = logs.MergeResults(searchParams.Order, int(searchParams.Limit), lists...)
+
+	nextPageTokens := make(logs.PageTokens)
+	for j, i := range matchedBackends {
+		results.Backends[j].Count = consumed[j]
+		if page, ok := nextPage(backendParams[j], skips[j], searchResults[j], searchErrors[j], consumed[j]); ok {
+			nextPageTokens[backends[i].Name] = page
+		}
+	}
+	results.NextPage = nextPageTokens.Encode()
+
+	return results
+}
+
+// selectBackends returns the indices of the backends to search, in the order they are configured.
+func selectBackends(backends []logs.SearchBackend, searchParams *logs.SearchParams) []int {
+	names := make([]string, len(backends))
+	for i, backend := range backends {
+		names[i] = backend.Name
+	}
+
+	return selectRoutes(names, func(i int) (logs.SearchRoute, bool) {
+		return backends[i].API.MatchRoute(searchParams)
+	})
+}
+
+// selectRoutes returns the indices of the named backends to search, given how each one matches the search.
+//
+// Each backend is matched by its highest priority route that matches the search params. Then:
+//  1. If any backend matched an exclusive route, just the backend whose exclusive route
+//     has the highest priority is searched. Ties go to the backend configured first.
+//  2. Otherwise, all the backends that matched an additive route are searched.
+//  3. If none matched an additive route either, all the backends that matched a fallback route are searched.
+func selectRoutes(names []string, match func(i int) (logs.SearchRoute, bool)) []int {
+	var exclusive, additive, fallback []int
+	var exclusivePriority int
+	for i, name := range names {
+		route, matched := match(i)
 		if !matched {
-			logger.Debugf("backend[%d] did not match any routes", i)
+			logger.Debugf("backend %s did not match any routes", name)
 			continue
 		}
 
-		searchResult, err := backend.API.Search(searchParams)
-		if err != nil {
-			logger.Errorf("error searching backend[%d]: %v", i, err)
-			continue
+		switch route.GetMode() {
+		case logs.RouteModeExclusive:
+			if len(exclusive) == 0 || route.Priority > exclusivePriority {
+				exclusive, exclusivePriority = []int{i}, route.Priority
+			}
+		case logs.RouteModeFallback:
+			fallback = append(fallback, i)
+		default:
+			additive = append(additive, i)
+		}
+	}
+
+	switch {
+	case len(exclusive) != 0:
+		logger.Debugf("exclusive route matched on backend %s", names[exclusive[0]])
+		return exclusive
+	case len(additive) != 0:
+		return additive
+	default:
+		return fallback
+	}
+}
+
+// nextPage returns the position a backend should resume from on the next page
+// and whether the backend has more results at all.
+func nextPage(params *logs.SearchParams, skip int, result logs.SearchResults, err error, consumed int) (string, bool) {
+	if err != nil {
+		// Retry the same page of a failed backend
+		return skipToken(params.Page, skip), true
+	}
+
+	if consumed < len(result.Results) {
+		// Some of the results were left out by the limit,
+		// so resume right after the last result that was returned.
+		if consumed == 0 {
+			return skipToken(params.Page, skip), true
 		}
-		results.Append(&searchResult)
 
-		// If the route is additive, all the previous search results are discarded
-		// and just the search result from this backend is returned exclusively.
-		if isAdditive {
-			logger.Infof("additive route matched. discarding previous results and exiting early")
-			results := &logs.SearchResults{}
-			results.Append(&searchResult)
-			break
+		if cursor := result.Results[consumed-1].Cursor; cursor != "" {
+			return cursor, true
 		}
+
+		// The backend can't resume from a result,
+		// so the same page is searched again without the results already returned.
+		return skipToken(params.Page, skip+consumed), true
 	}
 
-	logger.Infof("[%s] => %d results in %s", searchParams, results.Total, timer)
+	return result.NextPage, result.NextPage != ""
+}
 
-	return cc.JSON(http.StatusOK, *results)
+// skipPrefix marks the position of a backend that searches a page again without its first results.
+// It's how the backends without cursors on their results are resumed.
+const skipPrefix = "skip:"
+
+// skipToken returns the position of a backend that searches the page again without its first results
+func skipToken(page string, skip int) string {
+	if skip == 0 {
+		return page
+	}
+	return fmt.Sprintf("%s%d:%s", skipPrefix, skip, page)
+}
+
+// parseSkipToken returns the page of a backend's position and the number of its first results to leave out
+func parseSkipToken(token string) (string, int) {
+	rest, ok := strings.CutPrefix(token, skipPrefix)
+	if !ok {
+		return token, 0
+	}
+
+	count, page, ok := strings.Cut(rest, ":")
+	skip, err := strconv.Atoi(count)
+	if !ok || err != nil || skip < 0 {
+		return token, 0
+	}
+	return page, skip
+}
+
+// partialError returns the errors of the parts of a backend that failed, e.g. of its clusters
+func partialError(parts []logs.BackendResult) string {
+	var errs []string
+	for _, part := range parts {
+		if part.Error != "" {
+			errs = append(errs, part.Error)
+		}
+	}
+	return strings.Join(errs, "; ")
+}
+
+// searchBackend searches a single backend, cancelling the search
+// once the backend's deadline is exceeded.
+func searchBackend(ctx context.Context, backend logs.SearchBackend, searchParams *logs.SearchParams) (logs.SearchResults, error) {
+	ctx, cancel := withBackendTimeout(ctx, backend.Timeout)
+	defer cancel()
+
+	return backend.API.Search(ctx, searchParams)
+}
+
+// withBackendTimeout returns the context of a search on a single backend,
+// which defaults to the BackendTimeout when the backend has no timeout of its own.
+func withBackendTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout == 0 {
+		timeout = BackendTimeout
+	}
+
+	if timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
 }
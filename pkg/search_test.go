@@ -0,0 +1,299 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+// fakeBackend is a search backend that returns canned results
+type fakeBackend struct {
+	routes  logs.Routes
+	results []logs.Result
+	delay   time.Duration
+	err     error
+	// failedParts are the parts of the backend that fail, e.g. its clusters
+	failedParts []logs.BackendResult
+}
+
+func (t *fakeBackend) MatchRoute(q *logs.SearchParams) (logs.SearchRoute, bool) {
+	return t.routes.MatchRoute(q)
+}
+
+func (t *fakeBackend) Search(ctx context.Context, q *logs.SearchParams) (logs.SearchResults, error) {
+	select {
+	case <-ctx.Done():
+		return logs.SearchResults{}, ctx.Err()
+	case <-time.After(t.delay):
+	}
+
+	if t.err != nil {
+		return logs.SearchResults{}, t.err
+	}
+
+	query, err := q.GetQuery()
+	if err != nil {
+		return logs.SearchResults{}, err
+	}
+
+	// A copy, as a backend returns new results on each search
+	results := logs.FilterResults(query, append([]logs.Result(nil), t.results...))
+	return logs.SearchResults{Results: results, Total: len(results), Partial: len(t.failedParts) != 0, Backends: t.failedParts}, nil
+}
+
+func newFakeBackends(routes ...logs.Routes) []logs.SearchBackend {
+	var backends []logs.SearchBackend
+	for i, r := range routes {
+		backends = append(backends, logs.SearchBackend{
+			Name: fmt.Sprintf("fake[%d]", i),
+			Type: "fake",
+			API:  &fakeBackend{routes: r},
+		})
+	}
+	return backends
+}
+
+func TestSelectBackends(t *testing.T) {
+	q := &logs.SearchParams{Type: "KubernetesPod", Id: "prod-api-1234"}
+
+	tests := []struct {
+		name   string
+		routes []logs.Routes
+		want   []int
+	}{
+		{
+			name: "additive backends are all searched",
+			routes: []logs.Routes{
+				{{Type: "KubernetesPod"}},
+				{{Type: "KubernetesNode"}},
+				{{IdPrefix: "prod-", Mode: logs.RouteModeAdditive}},
+			},
+			want: []int{0, 2},
+		},
+		{
+			name: "legacy additive flag returns the backend on its own",
+			routes: []logs.Routes{
+				{{IdPrefix: "prod-"}},
+				{{Type: "KubernetesPod", IsAdditive: true}},
+			},
+			want: []int{1},
+		},
+		{
+			name: "exclusive backend discards earlier and later backends",
+			routes: []logs.Routes{
+				{{Type: "KubernetesPod"}},
+				{{IdPrefix: "prod-", Mode: logs.RouteModeExclusive}},
+				{{IdPrefix: "prod-"}},
+			},
+			want: []int{1},
+		},
+		{
+			name: "highest priority exclusive backend wins",
+			routes: []logs.Routes{
+				{{Type: "KubernetesPod", Mode: logs.RouteModeExclusive, Priority: 1}},
+				{{IdPrefix: "prod-", Mode: logs.RouteModeExclusive, Priority: 5}},
+				{{IdPrefix: "prod-", Mode: logs.RouteModeExclusive, Priority: 5}},
+			},
+			want: []int{1},
+		},
+		{
+			name: "first exclusive backend wins on equal priority",
+			routes: []logs.Routes{
+				{{Type: "KubernetesNode", Mode: logs.RouteModeExclusive}},
+				{{Type: "KubernetesPod", Mode: logs.RouteModeExclusive}},
+				{{IdPrefix: "prod-", Mode: logs.RouteModeExclusive}},
+			},
+			want: []int{1},
+		},
+		{
+			name: "backend uses its highest priority route",
+			routes: []logs.Routes{
+				{{Type: "KubernetesPod", Mode: logs.RouteModeExclusive}, {IdPrefix: "prod-", Priority: 1}},
+				{{IdPrefix: "prod-"}},
+			},
+			want: []int{0, 1},
+		},
+		{
+			name: "fallback is ignored when another route matches",
+			routes: []logs.Routes{
+				{{Type: "KubernetesPod", Mode: logs.RouteModeFallback}},
+				{{IdPrefix: "prod-"}},
+			},
+			want: []int{1},
+		},
+		{
+			name: "fallback backends are searched when nothing else matches",
+			routes: []logs.Routes{
+				{{Type: "KubernetesPod", Mode: logs.RouteModeFallback}},
+				{{Type: "KubernetesNode"}},
+				{{Mode: logs.RouteModeFallback}},
+			},
+			want: []int{0, 2},
+		},
+		{
+			name: "no backend matches",
+			routes: []logs.Routes{
+				{{Type: "KubernetesNode"}},
+			},
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := selectBackends(newFakeBackends(tt.routes...), q)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("selectBackends() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchBackends(t *testing.T) {
+	backends := newFakeBackends(logs.Routes{{}}, logs.Routes{{}}, logs.Routes{{}}, logs.Routes{{Type: "none"}})
+	backends[0].API.(*fakeBackend).results = []logs.Result{
+		{Id: "a1", Time: "2023-01-01T00:00:10Z"},
+		{Id: "a2", Time: "2023-01-01T00:00:30Z"},
+	}
+	backends[1].API.(*fakeBackend).results = []logs.Result{
+		{Id: "b1", Time: "2023-01-01T00:00:20Z"},
+	}
+	backends[2].API.(*fakeBackend).delay = time.Minute
+	backends[2].Timeout = 50 * time.Millisecond
+
+	q := &logs.SearchParams{}
+	q.SetDefaults()
+
+	results := searchBackends(context.Background(), backends, q, nil)
+
+	var ids []string
+	for _, r := range results.Results {
+		ids = append(ids, r.Id)
+	}
+	if want := []string{"a2", "b1", "a1"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("expected results %v, got %v", want, ids)
+	}
+
+	if !results.Partial {
+		t.Errorf("expected partial results when a backend times out")
+	}
+
+	wantStatus := []logs.BackendStatus{logs.BackendStatusSuccess, logs.BackendStatusSuccess, logs.BackendStatusTimeout}
+	if len(results.Backends) != len(wantStatus) {
+		t.Fatalf("expected %d backend results, got %d", len(wantStatus), len(results.Backends))
+	}
+	for i, want := range wantStatus {
+		if results.Backends[i].Status != want {
+			t.Errorf("expected backend[%d] status %s, got %s", i, want, results.Backends[i].Status)
+		}
+	}
+
+	// Only the backend that timed out is retried on the next page
+	tokens, err := logs.ParsePageTokens(results.NextPage)
+	if err != nil {
+		t.Fatalf("error parsing next page: %v", err)
+	}
+	if want := (logs.PageTokens{"fake[2]": ""}); !reflect.DeepEqual(tokens, want) {
+		t.Errorf("expected next page tokens %v, got %v", want, tokens)
+	}
+}
+
+func TestSearchBackendTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { BackendTimeout = timeout }(BackendTimeout)
+	BackendTimeout = 50 * time.Millisecond
+
+	backends := newFakeBackends(logs.Routes{{}}, logs.Routes{{}}, logs.Routes{{}})
+	backends[0].API.(*fakeBackend).results = []logs.Result{{Id: "fast", Time: "2023-01-01T00:00:10Z"}}
+	// The slow backend times out with the default timeout
+	backends[1].API.(*fakeBackend).delay = time.Minute
+	// The backend with a timeout of its own returns after the default one
+	backends[2].API.(*fakeBackend).delay = 100 * time.Millisecond
+	backends[2].API.(*fakeBackend).results = []logs.Result{{Id: "patient", Time: "2023-01-01T00:00:20Z"}}
+	backends[2].Timeout = time.Second
+
+	q := &logs.SearchParams{}
+	q.SetDefaults()
+
+	start := time.Now()
+	results := searchBackends(context.Background(), backends, q, nil)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the slow backend to be cancelled, the search took %s", elapsed)
+	}
+
+	var ids []string
+	for _, r := range results.Results {
+		ids = append(ids, r.Id)
+	}
+	if want := []string{"patient", "fast"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("expected results %v, got %v", want, ids)
+	}
+
+	wantStatus := []logs.BackendStatus{logs.BackendStatusSuccess, logs.BackendStatusTimeout, logs.BackendStatusSuccess}
+	for i, want := range wantStatus {
+		if results.Backends[i].Status != want {
+			t.Errorf("expected backend[%d] status %s, got %s", i, want, results.Backends[i].Status)
+		}
+	}
+	if !results.Partial {
+		t.Error("expected partial results when a backend times out")
+	}
+}
+
+func TestSearchBackendsWithoutCursors(t *testing.T) {
+	backends := newFakeBackends(logs.Routes{{}}, logs.Routes{{}})
+	// The results have no cursor, like the ones of a backend that can't resume from a result
+	backends[0].API.(*fakeBackend).results = []logs.Result{
+		{Id: "a1", Time: "2023-01-01T00:00:10Z"},
+		{Id: "a2", Time: "2023-01-01T00:00:30Z"},
+		{Id: "a3", Time: "2023-01-01T00:00:50Z"},
+	}
+	backends[1].API.(*fakeBackend).results = []logs.Result{
+		{Id: "b1", Time: "2023-01-01T00:00:20Z"},
+		{Id: "b2", Time: "2023-01-01T00:00:40Z"},
+	}
+
+	q := &logs.SearchParams{Limit: 2}
+	q.SetDefaults()
+
+	var ids []string
+	var tokens logs.PageTokens
+	for page := 0; page < 5; page++ {
+		results := searchBackends(context.Background(), backends, q.Clone(), tokens)
+		for _, r := range results.Results {
+			ids = append(ids, r.Id)
+		}
+		if results.NextPage == "" {
+			break
+		}
+
+		var err error
+		if tokens, err = logs.ParsePageTokens(results.NextPage); err != nil {
+			t.Fatalf("error parsing next page: %v", err)
+		}
+	}
+
+	if want := []string{"a3", "b2", "a2", "b1", "a1"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("expected results %v, got %v", want, ids)
+	}
+}
+
+func TestSearchBackendsPartial(t *testing.T) {
+	backends := newFakeBackends(logs.Routes{{}})
+	backends[0].API.(*fakeBackend).results = []logs.Result{{Id: "a1", Time: "2023-01-01T00:00:10Z"}}
+	backends[0].API.(*fakeBackend).failedParts = []logs.BackendResult{{Name: "america", Status: logs.BackendStatusError, Error: "error searching cluster america"}}
+
+	q := &logs.SearchParams{}
+	q.SetDefaults()
+
+	results := searchBackends(context.Background(), backends, q, nil)
+	if len(results.Results) != 1 || !results.Partial {
+		t.Errorf("expected the partial results of the backend, got %+v", results)
+	}
+	if backend := results.Backends[0]; backend.Status != logs.BackendStatusPartial || backend.Error != "error searching cluster america" {
+		t.Errorf("expected the failed part of the backend to be reported, got %+v", backend)
+	}
+}
@@ -0,0 +1,213 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flanksource/apm-hub/api/logs"
+	"github.com/flanksource/commons/logger"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/net/websocket"
+)
+
+var (
+	// TailHeartbeat is the interval of the heartbeats sent to the tail clients,
+	// so that idle streams aren't closed by proxies.
+	TailHeartbeat = 15 * time.Second
+
+	// tailBufferSize is the number of lines buffered for a slow tail client.
+	// The backends are held back once the buffer is full.
+	tailBufferSize = 100
+)
+
+// Tail streams the new log lines as they arrive, over Server-Sent Events
+// or over a WebSocket when the client asks for an upgrade.
+//
+// The search params are taken from the query string, with the labels as key1=value1,key2=value2.
+// Only the lines after the start, which defaults to now, are streamed.
+func Tail(c echo.Context) error {
+	searchParams := new(logs.SearchParams)
+	if err := c.Bind(searchParams); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if labels := c.QueryParam("labels"); labels != "" {
+		searchParams.Labels = parseLabels(labels)
+	}
+
+	if searchParams.Start == "" {
+		searchParams.SetStart(time.Now())
+	}
+	searchParams.SetDefaults()
+
+	if _, err := searchParams.GetQuery(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid query: %v", err))
+	}
+
+	// The tail stops once the client disconnects
+	ctx, cancel := context.WithCancel(c.Request().Context())
+	defer cancel()
+
+	lines := make(chan logs.Result, tailBufferSize)
+	go tailBackends(ctx, logs.GlobalBackends, searchParams, lines)
+
+	logger.Infof("[%s] tailing", searchParams)
+	if c.IsWebSocket() {
+		return tailWebSocket(ctx, cancel, c, lines)
+	}
+	return tailEventStream(ctx, c, lines)
+}
+
+// tailBackends tails the backends selected by their routes
+// and closes the lines once all of them are done.
+func tailBackends(ctx context.Context, backends []logs.SearchBackend, searchParams *logs.SearchParams, lines chan<- logs.Result) {
+	var wg sync.WaitGroup
+	for _, i := range selectBackends(backends, searchParams) {
+		wg.Add(1)
+		go func(backend logs.SearchBackend) {
+			defer wg.Done()
+			if err := tailBackend(ctx, backend, searchParams.Clone(), lines); err != nil && ctx.Err() == nil {
+				logger.Errorf("error tailing backend %s: %v", backend.Name, err)
+			}
+		}(backends[i])
+	}
+
+	wg.Wait()
+	close(lines)
+}
+
+// tailBackend streams the new lines of a backend, polling the
+// backends that can't stream them with a search on every interval.
+func tailBackend(ctx context.Context, backend logs.SearchBackend, searchParams *logs.SearchParams, lines chan<- logs.Result) error {
+	// The lines of the backend are linked to their traces on their way to the client
+	backendLines := make(chan logs.Result)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for line := range backendLines {
+			if err := logs.SendResult(ctx, lines, logs.LinkTrace(line, backend.TraceFields, backend.SpanFields)); err != nil {
+				return
+			}
+		}
+	}()
+	defer func() {
+		close(backendLines)
+		<-done
+	}()
+
+	if tailer, ok := backend.API.(logs.TailAPI); ok {
+		return tailer.Tail(ctx, searchParams, backendLines)
+	}
+
+	return logs.PollSearch(ctx, backend.API, searchParams, backendLines)
+}
+
+func tailEventStream(ctx context.Context, c echo.Context, lines <-chan logs.Result) error {
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.Header().Set("Connection", "keep-alive")
+	// Disables the response buffering of nginx
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+
+	heartbeat := time.NewTicker(TailHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(res, ": heartbeat\n\n"); err != nil {
+				return nil
+			}
+
+		case line, ok := <-lines:
+			if !ok {
+				fmt.Fprint(res, "event: end\ndata: {}\n\n")
+				res.Flush()
+				return nil
+			}
+
+			data, err := json.Marshal(line)
+			if err != nil {
+				logger.Errorf("error marshalling the line: %v", err)
+				continue
+			}
+
+			if _, err := fmt.Fprintf(res, "data: %s\n\n", data); err != nil {
+				return nil
+			}
+		}
+
+		res.Flush()
+	}
+}
+
+func tailWebSocket(ctx context.Context, cancel context.CancelFunc, c echo.Context, lines <-chan logs.Result) error {
+	// The server, unlike the handler, doesn't check the origin, so the non browser clients can connect too
+	server := websocket.Server{Handler: func(ws *websocket.Conn) {
+		defer ws.Close()
+
+		// The messages of the client are read, and discarded, just to notice when it disconnects
+		go func() {
+			defer cancel()
+			for {
+				var message string
+				if err := websocket.Message.Receive(ws, &message); err != nil {
+					return
+				}
+			}
+		}()
+
+		heartbeat := time.NewTicker(TailHeartbeat)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case <-heartbeat.C:
+				ws.PayloadType = websocket.PingFrame
+				_, err := ws.Write(nil)
+				ws.PayloadType = websocket.TextFrame
+				if err != nil {
+					return
+				}
+
+			case line, ok := <-lines:
+				if !ok {
+					return
+				}
+
+				if err := websocket.JSON.Send(ws, line); err != nil {
+					return
+				}
+			}
+		}
+	}}
+
+	server.ServeHTTP(c.Response(), c.Request())
+	return nil
+}
+
+// parseLabels parses the labels in the key1=value1,key2=value2 format
+func parseLabels(labels string) map[string]string {
+	parsed := make(map[string]string)
+	for _, label := range strings.Split(labels, ",") {
+		key, value, _ := strings.Cut(label, "=")
+		if key = strings.TrimSpace(key); key != "" {
+			parsed[key] = strings.TrimSpace(value)
+		}
+	}
+	return parsed
+}
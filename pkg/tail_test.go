@@ -0,0 +1,86 @@
+package pkg
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flanksource/apm-hub/api/logs"
+	"github.com/labstack/echo/v4"
+)
+
+func TestTailEventStream(t *testing.T) {
+	backends := logs.GlobalBackends
+	pollInterval := logs.TailPollInterval
+	defer func() {
+		logs.GlobalBackends = backends
+		logs.TailPollInterval = pollInterval
+	}()
+
+	logs.TailPollInterval = 10 * time.Millisecond
+	logs.GlobalBackends = []logs.SearchBackend{{
+		Name: "fake",
+		Type: "fake",
+		API: &fakeBackend{
+			routes: logs.Routes{{Type: "KubernetesPod"}},
+			results: []logs.Result{
+				{Id: "2", Time: "2022-11-01T10:01:00Z", Message: "second"},
+				{Id: "1", Time: "2022-11-01T10:00:00Z", Message: "first"},
+			},
+		},
+	}}
+
+	e := echo.New()
+	e.GET("/tail", Tail)
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/tail?type=KubernetesPod&start=2022-11-01T00:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if contentType := resp.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Fatalf("Content-Type = %s, want text/event-stream", contentType)
+	}
+
+	// The lines are sent oldest first and just once, even though they're searched on every poll
+	var got []string
+	reader := bufio.NewReader(resp.Body)
+	deadline := time.After(200 * time.Millisecond)
+	for len(got) < 3 {
+		lineCh := make(chan string, 1)
+		go func() {
+			line, _ := reader.ReadString('\n')
+			lineCh <- line
+		}()
+
+		select {
+		case line := <-lineCh:
+			data, ok := strings.CutPrefix(strings.TrimSpace(line), "data: ")
+			if !ok {
+				continue
+			}
+
+			var result logs.Result
+			if err := json.Unmarshal([]byte(data), &result); err != nil {
+				t.Fatalf("invalid event %s: %v", data, err)
+			}
+			got = append(got, result.Message)
+		case <-deadline:
+			want := []string{"first", "second"}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("streamed %v, want %v", got, want)
+			}
+			return
+		}
+	}
+
+	t.Errorf("streamed %v, want just 2 lines", got)
+}
@@ -0,0 +1,340 @@
+package tempo
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flanksource/apm-hub/api"
+	"github.com/flanksource/apm-hub/api/logs"
+	"github.com/flanksource/commons/utils"
+)
+
+// TempoBackend searches the traces with the HTTP API of Grafana Tempo
+type TempoBackend struct {
+	client *http.Client
+	config *logs.TempoBackendConfig
+}
+
+func NewTempoBackend(config *logs.TempoBackendConfig) (*TempoBackend, error) {
+	if config.Address == "" {
+		return nil, fmt.Errorf("address is empty")
+	}
+
+	return &TempoBackend{
+		client: http.DefaultClient,
+		config: config,
+	}, nil
+}
+
+func (t *TempoBackend) MatchRoute(q *api.TraceParams) (route logs.SearchRoute, match bool) {
+	return q.MatchRoute(t.config.CommonBackend.Routes)
+}
+
+// Search returns the summaries of the matching traces.
+// Tempo's search doesn't return the spans, which are fetched with GetTrace.
+func (t *TempoBackend) Search(ctx context.Context, q *api.TraceParams) (api.TraceResults, error) {
+	var result api.TraceResults
+
+	values := url.Values{}
+	values.Set("limit", strconv.FormatInt(q.Limit, 10))
+	if tags := searchTags(q); tags != "" {
+		values.Set("tags", tags)
+	}
+
+	if start := q.GetStart(); start != nil {
+		values.Set("start", strconv.FormatInt(start.Unix(), 10))
+	}
+	end, err := q.GetSearchEnd()
+	if err != nil {
+		return result, err
+	}
+	if end != nil {
+		values.Set("end", strconv.FormatInt(end.Unix(), 10))
+	} else if values.Has("start") {
+		// Tempo needs both ends of the time window
+		values.Set("end", strconv.FormatInt(time.Now().Unix(), 10))
+	}
+
+	if _, err := q.GetMinDuration(); err != nil {
+		return result, err
+	} else if q.MinDuration != "" {
+		values.Set("minDuration", q.MinDuration)
+	}
+	if _, err := q.GetMaxDuration(); err != nil {
+		return result, err
+	} else if q.MaxDuration != "" {
+		values.Set("maxDuration", q.MaxDuration)
+	}
+
+	var resp searchResponse
+	if _, err := t.get(ctx, "/api/search", values, &resp); err != nil {
+		return result, err
+	}
+
+	for _, summary := range resp.Traces {
+		trace, err := summary.toTrace()
+		if err != nil {
+			return result, err
+		}
+
+		// The window is in seconds, so the traces started after the end of the page are left out
+		if end != nil && trace.GetStartTime().After(*end) {
+			continue
+		}
+		result.Results = append(result.Results, trace)
+	}
+	api.SortTraces(result.Results)
+
+	if int64(len(result.Results)) >= q.Limit {
+		result.Results = result.Results[:q.Limit]
+		result.NextPage = api.NextTracePage(result.Results[len(result.Results)-1])
+	}
+	result.Total = len(result.Results)
+	return result, nil
+}
+
+func (t *TempoBackend) GetTrace(ctx context.Context, traceID string) (*api.Trace, error) {
+	var resp traceResponse
+	status, err := t.get(ctx, "/api/traces/"+url.PathEscape(traceID), nil, &resp)
+	if status == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	trace := api.Trace{TraceID: traceID}
+	for _, batch := range resp.Batches {
+		service := batch.Resource.attributes()["service.name"]
+
+		// instrumentationLibrarySpans is the name of the scopeSpans before OTLP v0.15
+		for _, scope := range append(batch.ScopeSpans, batch.InstrumentationLibrarySpans...) {
+			for _, s := range scope.Spans {
+				span, err := s.toSpan(service)
+				if err != nil {
+					return nil, err
+				}
+				trace.Spans = append(trace.Spans, span)
+			}
+		}
+	}
+
+	if len(trace.Spans) == 0 {
+		return nil, nil
+	}
+
+	trace.TraceID = trace.Spans[0].TraceID
+	trace.SetSummary()
+	return &trace, nil
+}
+
+func (t *TempoBackend) get(ctx context.Context, path string, values url.Values, v any) (int, error) {
+	endpoint := strings.TrimSuffix(t.config.Address, "/") + path
+	if len(values) != 0 {
+		endpoint += "?" + values.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if t.config.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", t.config.TenantID)
+	}
+
+	res, err := t.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("error querying tempo: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return res.StatusCode, fmt.Errorf("[tempo] got response: %d", res.StatusCode)
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		return res.StatusCode, fmt.Errorf("error parsing the response body: %w", err)
+	}
+	return res.StatusCode, nil
+}
+
+// searchTags returns the tags of the search in the logfmt format
+func searchTags(q *api.TraceParams) string {
+	var tags []string
+	if q.Service != "" {
+		tags = append(tags, fmt.Sprintf("service.name=%q", q.Service))
+	}
+	if q.Operation != "" {
+		tags = append(tags, fmt.Sprintf("name=%q", q.Operation))
+	}
+
+	var attributes []string
+	for k, v := range q.Attributes {
+		attributes = append(attributes, fmt.Sprintf("%s=%q", k, v))
+	}
+	sort.Strings(attributes)
+
+	return strings.Join(append(tags, attributes...), " ")
+}
+
+type searchResponse struct {
+	Traces []traceSummary `json:"traces"`
+}
+
+type traceSummary struct {
+	TraceID         string `json:"traceID"`
+	RootServiceName string `json:"rootServiceName"`
+	RootTraceName   string `json:"rootTraceName"`
+	// StartTimeUnixNano is the unix time in nanoseconds, as a string
+	StartTimeUnixNano string `json:"startTimeUnixNano"`
+	DurationMs        int64  `json:"durationMs"`
+}
+
+func (t traceSummary) toTrace() (api.Trace, error) {
+	start, err := parseUnixNano(t.StartTimeUnixNano)
+	if err != nil {
+		return api.Trace{}, err
+	}
+
+	return api.Trace{
+		TraceID:       t.TraceID,
+		RootService:   t.RootServiceName,
+		RootOperation: t.RootTraceName,
+		StartTime:     start.Format(time.RFC3339Nano),
+		Duration:      (time.Duration(t.DurationMs) * time.Millisecond).Microseconds(),
+	}, nil
+}
+
+// traceResponse is a trace in the OTLP JSON format
+type traceResponse struct {
+	Batches []batch `json:"batches"`
+}
+
+type batch struct {
+	Resource                    resource     `json:"resource"`
+	ScopeSpans                  []scopeSpans `json:"scopeSpans"`
+	InstrumentationLibrarySpans []scopeSpans `json:"instrumentationLibrarySpans"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+func (t resource) attributes() map[string]string {
+	return toAttributes(t.Attributes)
+}
+
+type scopeSpans struct {
+	Spans []span `json:"spans"`
+}
+
+type span struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId"`
+	Name              string     `json:"name"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []keyValue `json:"attributes"`
+	Events            []event    `json:"events"`
+}
+
+type event struct {
+	TimeUnixNano string     `json:"timeUnixNano"`
+	Name         string     `json:"name"`
+	Attributes   []keyValue `json:"attributes"`
+}
+
+type keyValue struct {
+	Key string `json:"key"`
+	// Value holds a single field named after the type of the value, e.g. stringValue, intValue, etc.
+	Value map[string]any `json:"value"`
+}
+
+func (t span) toSpan(service string) (api.Span, error) {
+	start, err := parseUnixNano(t.StartTimeUnixNano)
+	if err != nil {
+		return api.Span{}, err
+	}
+	end, err := parseUnixNano(t.EndTimeUnixNano)
+	if err != nil {
+		return api.Span{}, err
+	}
+
+	s := api.Span{
+		TraceID:      parseID(t.TraceID),
+		SpanID:       parseID(t.SpanID),
+		ParentSpanID: parseID(t.ParentSpanID),
+		Service:      service,
+		Operation:    t.Name,
+		StartTime:    start.Format(time.RFC3339Nano),
+		Duration:     end.Sub(start).Microseconds(),
+		Attributes:   toAttributes(t.Attributes),
+	}
+
+	for _, e := range t.Events {
+		ts, err := parseUnixNano(e.TimeUnixNano)
+		if err != nil {
+			return api.Span{}, err
+		}
+
+		s.Events = append(s.Events, api.SpanEvent{
+			Name:       e.Name,
+			Time:       ts.Format(time.RFC3339Nano),
+			Attributes: toAttributes(e.Attributes),
+		})
+	}
+
+	return s, nil
+}
+
+// parseID returns the hex form of a trace or span ID,
+// which the OTLP JSON of older Tempo versions encodes in base64
+func parseID(id string) string {
+	if _, err := hex.DecodeString(id); err == nil && (len(id) == 16 || len(id) == 32) {
+		return id
+	}
+
+	if decoded, err := base64.StdEncoding.DecodeString(id); err == nil {
+		return hex.EncodeToString(decoded)
+	}
+	return id
+}
+
+func parseUnixNano(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	nanos, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid unix nano timestamp %q: %w", value, err)
+	}
+	return time.Unix(0, nanos).UTC(), nil
+}
+
+func toAttributes(keyValues []keyValue) map[string]string {
+	if len(keyValues) == 0 {
+		return nil
+	}
+
+	attributes := make(map[string]string, len(keyValues))
+	for _, kv := range keyValues {
+		for _, v := range kv.Value {
+			if value, err := utils.Stringify(v); err == nil {
+				attributes[kv.Key] = value
+			}
+		}
+	}
+	return attributes
+}
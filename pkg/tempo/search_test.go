@@ -0,0 +1,110 @@
+package tempo
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/flanksource/apm-hub/api"
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+const searchBody = `{"traces": [
+	{"traceID": "2f3e0cee77ae5dc9c17ade3689eb2e54", "rootServiceName": "frontend", "rootTraceName": "GET /users", "startTimeUnixNano": "1678364951000000000", "durationMs": 3},
+	{"traceID": "6a07d9d1c7a7c6b9", "rootServiceName": "frontend", "rootTraceName": "GET /orders", "startTimeUnixNano": "1678364952000000000", "durationMs": 12}
+]}`
+
+// traceBody has base64 IDs, as returned by the older Tempo versions
+const traceBody = `{"batches": [
+	{
+		"resource": {"attributes": [{"key": "service.name", "value": {"stringValue": "frontend"}}]},
+		"scopeSpans": [{"spans": [
+			{"traceId": "Lz4M7neuXcnBet42iesuVA==", "spanId": "AAAAAAAAAAE=", "name": "GET /users", "startTimeUnixNano": "1678364951000000000", "endTimeUnixNano": "1678364951003000000", "attributes": [{"key": "http.status_code", "value": {"intValue": "200"}}]}
+		]}]
+	},
+	{
+		"resource": {"attributes": [{"key": "service.name", "value": {"stringValue": "db"}}]},
+		"instrumentationLibrarySpans": [{"spans": [
+			{"traceId": "Lz4M7neuXcnBet42iesuVA==", "spanId": "AAAAAAAAAAI=", "parentSpanId": "AAAAAAAAAAE=", "name": "SELECT users", "startTimeUnixNano": "1678364951001000000", "endTimeUnixNano": "1678364951002000000", "events": [{"timeUnixNano": "1678364951001500000", "name": "retry"}]}
+		]}]
+	}
+]}`
+
+func newTestServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/search", func(w http.ResponseWriter, r *http.Request) {
+		if tags := r.URL.Query().Get("tags"); tags != `service.name="frontend" http.method="GET"` {
+			t.Errorf("unexpected tags %q", tags)
+		}
+		w.Write([]byte(searchBody))
+	})
+	mux.HandleFunc("/api/traces/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Scope-OrgID") != "team-a" {
+			t.Errorf("expected the tenant header")
+		}
+		if r.URL.Path != "/api/traces/2f3e0cee77ae5dc9c17ade3689eb2e54" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(traceBody))
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestTempoBackend_Search(t *testing.T) {
+	server := newTestServer(t)
+	backend, err := NewTempoBackend(&logs.TempoBackendConfig{Address: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q := &api.TraceParams{Service: "frontend", Attributes: map[string]string{"http.method": "GET"}, Limit: 20}
+	res, err := backend.Search(context.Background(), q)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Results) != 2 || res.Results[0].RootOperation != "GET /orders" || res.Results[0].Duration != 12000 {
+		t.Fatalf("unexpected traces %+v", res.Results)
+	}
+	if res.NextPage != "" {
+		t.Errorf("expected no next page, got %q", res.NextPage)
+	}
+}
+
+func TestTempoBackend_GetTrace(t *testing.T) {
+	server := newTestServer(t)
+	backend, err := NewTempoBackend(&logs.TempoBackendConfig{Address: server.URL, TenantID: "team-a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trace, err := backend.GetTrace(context.Background(), "2f3e0cee77ae5dc9c17ade3689eb2e54")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if trace.TraceID != "2f3e0cee77ae5dc9c17ade3689eb2e54" || trace.RootService != "frontend" || trace.Duration != 3000 {
+		t.Errorf("unexpected trace summary %+v", trace)
+	}
+
+	child := trace.Spans[1]
+	if child.SpanID != "0000000000000002" || child.ParentSpanID != "0000000000000001" || child.Service != "db" || child.Duration != 1000 {
+		t.Errorf("unexpected child span %+v", child)
+	}
+	if len(child.Events) != 1 || child.Events[0].Name != "retry" {
+		t.Errorf("unexpected span events %+v", child.Events)
+	}
+	if trace.Spans[0].Attributes["http.status_code"] != "200" {
+		t.Errorf("unexpected span attributes %+v", trace.Spans[0].Attributes)
+	}
+
+	trace, err = backend.GetTrace(context.Background(), "missing")
+	if err != nil || trace != nil {
+		t.Errorf("expected no trace, got %+v, %v", trace, err)
+	}
+}
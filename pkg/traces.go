@@ -0,0 +1,287 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/flanksource/apm-hub/api"
+	"github.com/flanksource/apm-hub/api/logs"
+	"github.com/flanksource/commons/collections"
+	"github.com/flanksource/commons/logger"
+	"github.com/flanksource/commons/timer"
+	"github.com/labstack/echo/v4"
+)
+
+// SearchTraces searches the trace backends and collates their traces, newest first
+func SearchTraces(c echo.Context) error {
+	cc := c.(*api.Context)
+	traceParams := new(api.TraceParams)
+	if err := c.Bind(traceParams); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	traceParams.SetDefaults()
+
+	if _, err := traceParams.GetMinDuration(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if _, err := traceParams.GetMaxDuration(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	pageTokens, err := logs.ParsePageTokens(traceParams.Page)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	ctx := c.Request().Context()
+	if SearchTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, SearchTimeout)
+		defer cancel()
+	}
+
+	timer := timer.NewTimer()
+	results := searchTraceBackends(ctx, api.GlobalTraceBackends, traceParams, pageTokens)
+	logger.Infof("[%s] => %d traces in %s", traceParams, results.Total, timer)
+
+	return cc.JSON(http.StatusOK, *results)
+}
+
+// GetTrace returns the trace with all its spans from the first trace backend that has it
+func GetTrace(c echo.Context) error {
+	cc := c.(*api.Context)
+	traceID := c.Param("id")
+
+	ctx := c.Request().Context()
+	if SearchTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, SearchTimeout)
+		defer cancel()
+	}
+
+	trace, err := getTrace(ctx, api.GlobalTraceBackends, traceID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadGateway, err.Error())
+	}
+	if trace == nil {
+		return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("trace %s not found", traceID))
+	}
+
+	return cc.JSON(http.StatusOK, trace)
+}
+
+// TraceLogs searches all the log backends for the log lines of a trace.
+//
+// The lines are matched by the trace id in any of the trace fields of the backends.
+// The search params are taken from the query string, like in Tail, and the query narrows the lines further.
+func TraceLogs(c echo.Context) error {
+	cc := c.(*api.Context)
+	traceID := c.Param("id")
+
+	searchParams := new(logs.SearchParams)
+	if err := c.Bind(searchParams); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if labels := c.QueryParam("labels"); labels != "" {
+		searchParams.Labels = parseLabels(labels)
+	}
+	searchParams.SetDefaults()
+
+	if _, err := searchParams.GetQuery(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid query: %v", err))
+	}
+
+	pageTokens, err := logs.ParsePageTokens(searchParams.Page)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	ctx := c.Request().Context()
+	if SearchTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, SearchTimeout)
+		defer cancel()
+	}
+
+	timer := timer.NewTimer()
+	results := searchTraceLogs(ctx, logs.GlobalBackends, traceID, searchParams, pageTokens)
+	logger.Infof("[trace=%s %s] => %d results in %s", traceID, searchParams, results.Total, timer)
+
+	return cc.JSON(http.StatusOK, *results)
+}
+
+// searchTraceLogs searches all the backends, regardless of their routes,
+// for the log lines with the trace id in any of the trace fields of the backends.
+func searchTraceLogs(ctx context.Context, backends []logs.SearchBackend, traceID string, searchParams *logs.SearchParams, pageTokens logs.PageTokens) *logs.SearchResults {
+	// The fields of all the backends are searched, as the query is shared by the backends.
+	// A field missing from a backend's lines just doesn't match.
+	var traceFields []string
+	all := make([]int, len(backends))
+	for i, backend := range backends {
+		traceFields = append(traceFields, backend.TraceFields...)
+		all[i] = i
+	}
+	if len(traceFields) == 0 {
+		traceFields = logs.DefaultTraceFields
+	}
+
+	query := logs.TraceQuery(traceID, collections.Dedup(traceFields)).String()
+	if searchParams.Query != "" {
+		query = fmt.Sprintf("(%s) AND (%s)", query, searchParams.Query)
+	}
+	searchParams.Query = query
+
+	return searchSelectedBackends(ctx, backends, all, searchParams, pageTokens)
+}
+
+// searchTraceBackends concurrently queries the trace backends selected by their routes.
+// The backends are selected and paged the same way as in the log searches.
+func searchTraceBackends(ctx context.Context, backends []api.TraceBackend, traceParams *api.TraceParams, pageTokens logs.PageTokens) *api.TraceResults {
+	// Resolve the time window once so that all the backends search the same window.
+	traceParams.GetStart()
+	traceParams.GetEnd()
+
+	names := make([]string, len(backends))
+	for i, backend := range backends {
+		names[i] = backend.Name
+	}
+
+	var matchedBackends []int
+	for _, i := range selectRoutes(names, func(i int) (logs.SearchRoute, bool) { return backends[i].API.MatchRoute(traceParams) }) {
+		if _, ok := pageTokens[backends[i].Name]; pageTokens != nil && !ok {
+			logger.Debugf("backend %s has no more traces", backends[i].Name)
+			continue
+		}
+		matchedBackends = append(matchedBackends, i)
+	}
+
+	backendParams := make([]*api.TraceParams, len(matchedBackends))
+	searchResults := make([]api.TraceResults, len(matchedBackends))
+	searchErrors := make([]error, len(matchedBackends))
+	durations := make([]time.Duration, len(matchedBackends))
+
+	var wg sync.WaitGroup
+	for j, i := range matchedBackends {
+		backendParams[j] = traceParams.Clone()
+		backendParams[j].Page = pageTokens[backends[i].Name]
+
+		wg.Add(1)
+		go func(j int, backend api.TraceBackend) {
+			defer wg.Done()
+			start := time.Now()
+
+			ctx, cancel := withBackendTimeout(ctx, backend.Timeout)
+			defer cancel()
+			searchResults[j], searchErrors[j] = backend.API.Search(ctx, backendParams[j])
+			durations[j] = time.Since(start)
+		}(j, backends[i])
+	}
+	wg.Wait()
+
+	type backendTrace struct {
+		backend int
+		trace   api.Trace
+	}
+
+	results := &api.TraceResults{}
+	var traces []backendTrace
+	for j, i := range matchedBackends {
+		backendResult := logs.BackendResult{
+			Name:       backends[i].Name,
+			Type:       backends[i].Type,
+			Status:     logs.BackendStatusSuccess,
+			DurationMs: durations[j].Milliseconds(),
+		}
+
+		if err := searchErrors[j]; err != nil {
+			backendResult.Status = logs.GetBackendStatus(err)
+			backendResult.Error = err.Error()
+			results.Partial = true
+			logger.Errorf("error searching trace backend %s: %v", backends[i].Name, err)
+		} else {
+			for _, trace := range searchResults[j].Results {
+				traces = append(traces, backendTrace{backend: j, trace: trace})
+			}
+		}
+
+		results.Backends = append(results.Backends, backendResult)
+	}
+
+	sort.SliceStable(traces, func(a, b int) bool {
+		return traces[a].trace.GetStartTime().After(traces[b].trace.GetStartTime())
+	})
+	if int64(len(traces)) > traceParams.Limit {
+		traces = traces[:traceParams.Limit]
+	}
+
+	// The oldest trace returned from each backend
+	oldest := make(map[int]api.Trace)
+	for _, t := range traces {
+		results.Results = append(results.Results, t.trace)
+		results.Backends[t.backend].Count++
+		oldest[t.backend] = t.trace
+	}
+	results.Total = len(results.Results)
+
+	nextPageTokens := make(logs.PageTokens)
+	for j, i := range matchedBackends {
+		switch {
+		case searchErrors[j] != nil:
+			// Retry the same page of a failed backend
+			nextPageTokens[backends[i].Name] = backendParams[j].Page
+		case results.Backends[j].Count < len(searchResults[j].Results):
+			// Some of the traces were left out by the limit, so resume right after the last one returned
+			if trace, ok := oldest[j]; ok {
+				nextPageTokens[backends[i].Name] = api.NextTracePage(trace)
+			} else {
+				nextPageTokens[backends[i].Name] = backendParams[j].Page
+			}
+		case searchResults[j].NextPage != "":
+			nextPageTokens[backends[i].Name] = searchResults[j].NextPage
+		}
+	}
+	results.NextPage = nextPageTokens.Encode()
+
+	return results
+}
+
+// getTrace queries all the trace backends concurrently
+// and returns the trace from the first backend, in the configured order, that has it.
+// An error is returned only when the trace isn't found and a backend failed.
+func getTrace(ctx context.Context, backends []api.TraceBackend, traceID string) (*api.Trace, error) {
+	traces := make([]*api.Trace, len(backends))
+	errs := make([]error, len(backends))
+
+	var wg sync.WaitGroup
+	for i, backend := range backends {
+		wg.Add(1)
+		go func(i int, backend api.TraceBackend) {
+			defer wg.Done()
+
+			ctx, cancel := withBackendTimeout(ctx, backend.Timeout)
+			defer cancel()
+			traces[i], errs[i] = backend.API.GetTrace(ctx, traceID)
+			if errs[i] != nil {
+				logger.Errorf("error getting trace %s from backend %s: %v", traceID, backend.Name, errs[i])
+			}
+		}(i, backend)
+	}
+	wg.Wait()
+
+	for _, trace := range traces {
+		if trace != nil {
+			return trace, nil
+		}
+	}
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("error getting the trace from backend %s: %w", backends[i].Name, err)
+		}
+	}
+	return nil, nil
+}
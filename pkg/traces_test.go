@@ -0,0 +1,149 @@
+package pkg
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/flanksource/apm-hub/api"
+	"github.com/flanksource/apm-hub/api/logs"
+)
+
+// fakeTraceBackend is a trace backend that returns canned traces
+type fakeTraceBackend struct {
+	routes logs.Routes
+	traces []api.Trace
+}
+
+func (t *fakeTraceBackend) MatchRoute(q *api.TraceParams) (logs.SearchRoute, bool) {
+	return q.MatchRoute(t.routes)
+}
+
+func (t *fakeTraceBackend) Search(ctx context.Context, q *api.TraceParams) (api.TraceResults, error) {
+	end, err := q.GetSearchEnd()
+	if err != nil {
+		return api.TraceResults{}, err
+	}
+
+	var results api.TraceResults
+	for _, trace := range t.traces {
+		if end == nil || !trace.GetStartTime().After(*end) {
+			results.Results = append(results.Results, trace)
+		}
+	}
+	results.Total = len(results.Results)
+	return results, nil
+}
+
+func (t *fakeTraceBackend) GetTrace(ctx context.Context, traceID string) (*api.Trace, error) {
+	for _, trace := range t.traces {
+		if trace.TraceID == traceID {
+			return &trace, nil
+		}
+	}
+	return nil, nil
+}
+
+func newFakeTrace(id string, start time.Time) api.Trace {
+	return api.Trace{TraceID: id, StartTime: start.Format(time.RFC3339Nano)}
+}
+
+func TestSearchTraceBackends(t *testing.T) {
+	now := time.Now()
+	backends := []api.TraceBackend{
+		{Name: "jaeger[0]", Type: "jaeger", API: &fakeTraceBackend{
+			routes: logs.Routes{{Type: "Service"}},
+			traces: []api.Trace{newFakeTrace("a1", now.Add(-time.Minute)), newFakeTrace("a2", now.Add(-3*time.Minute))},
+		}},
+		{Name: "tempo[1]", Type: "tempo", API: &fakeTraceBackend{
+			routes: logs.Routes{{Type: "Service"}},
+			traces: []api.Trace{newFakeTrace("b1", now.Add(-2*time.Minute))},
+		}},
+		{Name: "tempo[2]", Type: "tempo", API: &fakeTraceBackend{
+			routes: logs.Routes{{Type: "Pod"}},
+			traces: []api.Trace{newFakeTrace("c1", now)},
+		}},
+	}
+
+	q := &api.TraceParams{Type: "Service", Limit: 2}
+	q.SetDefaults()
+
+	var ids []string
+	pageTokens := logs.PageTokens(nil)
+	for page := 0; page < 3; page++ {
+		results := searchTraceBackends(context.Background(), backends, q.Clone(), pageTokens)
+		for _, trace := range results.Results {
+			ids = append(ids, trace.TraceID)
+		}
+
+		if results.NextPage == "" {
+			break
+		}
+
+		var err error
+		if pageTokens, err = logs.ParsePageTokens(results.NextPage); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{"a1", "b1", "a2"}
+	if len(ids) != len(want) {
+		t.Fatalf("got traces %v, want %v", ids, want)
+	}
+	for i := range want {
+		if ids[i] != want[i] {
+			t.Fatalf("got traces %v, want %v", ids, want)
+		}
+	}
+}
+
+func TestGetTrace(t *testing.T) {
+	backends := []api.TraceBackend{
+		{Name: "jaeger[0]", API: &fakeTraceBackend{}},
+		{Name: "tempo[1]", API: &fakeTraceBackend{traces: []api.Trace{newFakeTrace("b1", time.Now())}}},
+	}
+
+	trace, err := getTrace(context.Background(), backends, "b1")
+	if err != nil || trace == nil || trace.TraceID != "b1" {
+		t.Errorf("expected trace b1, got %+v, %v", trace, err)
+	}
+
+	trace, err = getTrace(context.Background(), backends, "missing")
+	if err != nil || trace != nil {
+		t.Errorf("expected no trace, got %+v, %v", trace, err)
+	}
+}
+
+func TestSearchTraceLogs(t *testing.T) {
+	backends := newFakeBackends(logs.Routes{{Type: "KubernetesPod"}}, logs.Routes{{Type: "none"}})
+	backends[0].TraceFields = logs.DefaultTraceFields
+	backends[0].SpanFields = logs.DefaultSpanFields
+	backends[0].API.(*fakeBackend).results = []logs.Result{
+		{Id: "a1", Time: "2023-01-01T00:00:10Z", Labels: map[string]string{"traceId": "abc", "spanId": "1"}},
+		{Id: "a2", Time: "2023-01-01T00:00:20Z", Labels: map[string]string{"traceId": "def"}},
+	}
+	backends[1].TraceFields = []string{"otel.trace_id"}
+	backends[1].API.(*fakeBackend).results = []logs.Result{
+		{Id: "b1", Time: "2023-01-01T00:00:30Z", Labels: map[string]string{"otel.trace_id": "abc", "level": "error"}},
+		{Id: "b2", Time: "2023-01-01T00:00:40Z", Labels: map[string]string{"otel.trace_id": "abc", "level": "info"}},
+	}
+
+	q := &logs.SearchParams{Start: "2022-12-31T00:00:00Z", Query: "level!=info"}
+	q.SetDefaults()
+
+	// The backends are searched regardless of their routes
+	results := searchTraceLogs(context.Background(), backends, "abc", q, nil)
+
+	var ids []string
+	for _, r := range results.Results {
+		ids = append(ids, r.Id)
+	}
+	if want := []string{"b1", "a1"}; len(ids) != len(want) || ids[0] != want[0] || ids[1] != want[1] {
+		t.Fatalf("expected results %v, got %v", want, ids)
+	}
+
+	want := logs.TraceLink{TraceID: "abc", SpanID: "1", URL: "/traces/abc"}
+	if link := results.Results[1].Trace; link == nil || *link != want {
+		t.Errorf("expected the trace link %+v, got %+v", want, link)
+	}
+}